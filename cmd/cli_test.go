@@ -2,9 +2,15 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/oneclickvirt/basics/system"
 )
 
 func TestParseCLIOptions(t *testing.T) {
@@ -54,3 +60,275 @@ func TestParseCLIRejectsUnsupportedLanguageAndPositionalArguments(t *testing.T)
 		t.Fatalf("language was not normalized: opts=%#v err=%v", opts, err)
 	}
 }
+
+func TestParseCLISectionFilter(t *testing.T) {
+	opts, err := parseCLI([]string{"--json", "--sections", "cpu,disks", "--skip-sections", "disks"})
+	if err != nil {
+		t.Fatalf("parseCLI returned error: %v", err)
+	}
+	if len(opts.sectionFilter.Enable) != 2 || len(opts.sectionFilter.Disable) != 1 || opts.sectionFilter.Allows("disks") || !opts.sectionFilter.Allows("cpu") {
+		t.Fatalf("unexpected section filter: %#v", opts.sectionFilter)
+	}
+	for _, args := range [][]string{{"--sections", "cpu"}, {"--json", "--sections", "unknown"}} {
+		if _, err := parseCLI(args); err == nil {
+			t.Fatalf("expected arguments %v to be rejected", args)
+		}
+	}
+}
+
+func TestParseCLICaptureAndReplay(t *testing.T) {
+	opts, err := parseCLI([]string{"--capture", "snapshot.tar.gz", "--timeout", "5s"})
+	if err != nil || opts.capture != "snapshot.tar.gz" {
+		t.Fatalf("capture options = %#v, err=%v", opts, err)
+	}
+	if _, err := parseCLI([]string{"--json", "--replay", "snapshot"}); err != nil {
+		t.Fatalf("replay rejected: %v", err)
+	}
+	for _, args := range [][]string{{"--replay", "snapshot"}, {"--json", "--capture", "a", "--replay", "b"}} {
+		if _, err := parseCLI(args); err == nil {
+			t.Fatalf("expected arguments %v to be rejected", args)
+		}
+	}
+}
+
+func TestParseCLIIPInfoProviders(t *testing.T) {
+	opts, err := parseCLI([]string{"--ip-providers", "cloudflare,ipinfo", "--ip-provider-url", "ipinfo=http://127.0.0.1:8080/json"})
+	if err != nil {
+		t.Fatalf("parseCLI returned error: %v", err)
+	}
+	if len(opts.ipInfoConfig.Providers) != 2 || opts.ipInfoConfig.Providers[0] != "cloudflare" || opts.ipInfoConfig.BaseURLs["ipinfo"] != "http://127.0.0.1:8080/json" {
+		t.Fatalf("unexpected IP info config: %#v", opts.ipInfoConfig)
+	}
+	for _, args := range [][]string{{"--ip-providers", "unknown"}, {"--ip-provider-url", "ipinfo"}, {"--ip-provider-url", "ipinfo=ftp://example"}} {
+		if _, err := parseCLI(args); err == nil {
+			t.Fatalf("expected arguments %v to be rejected", args)
+		}
+	}
+}
+
+func TestParseCLIMMDBPaths(t *testing.T) {
+	t.Setenv("BASICS_MMDB_CITY", "")
+	t.Setenv("BASICS_MMDB_ASN", "")
+	if _, err := parseCLI([]string{"--ip-providers", "mmdb"}); err == nil {
+		t.Fatal("expected mmdb without databases to be rejected")
+	}
+	missing := filepath.Join(t.TempDir(), "missing.mmdb")
+	if _, err := parseCLI([]string{"--mmdb-city", missing}); err == nil {
+		t.Fatal("expected a missing City database to be rejected")
+	}
+	t.Setenv("BASICS_MMDB_ASN", missing)
+	if _, err := parseCLI(nil); err == nil {
+		t.Fatal("expected BASICS_MMDB_ASN to be validated")
+	}
+}
+
+func TestParseCLIPublicIPURL(t *testing.T) {
+	opts, err := parseCLI([]string{"--json", "--public-ip-url", "http://127.0.0.1:8080/ip"})
+	if err != nil || opts.publicIPURL != "http://127.0.0.1:8080/ip" {
+		t.Fatalf("unexpected result: %#v, %v", opts.publicIPURL, err)
+	}
+	if _, err := parseCLI([]string{"--json", "--public-ip-url", "127.0.0.1/ip"}); err == nil {
+		t.Fatal("expected a URL without scheme to be rejected")
+	}
+	for _, args := range [][]string{
+		{"--public-ip-url", "http://127.0.0.1:8080/ip"},
+		{"--text", "--public-ip-url", "http://127.0.0.1:8080/ip"},
+		{"--json", "--replay", "snapshot", "--public-ip-url", "http://127.0.0.1:8080/ip"},
+	} {
+		if _, err := parseCLI(args); err == nil || !strings.Contains(err.Error(), "--public-ip-url requires --json") {
+			t.Fatalf("parseCLI(%q) error = %v", args, err)
+		}
+	}
+}
+
+func TestParseCLISTUNServers(t *testing.T) {
+	opts, err := parseCLI([]string{"--json", "--stun-servers", "127.0.0.1:3478, [::1]:3478,"})
+	if err != nil {
+		t.Fatalf("parseCLI returned error: %v", err)
+	}
+	if servers := splitList(opts.stunServers); len(servers) != 2 || servers[1] != "[::1]:3478" {
+		t.Fatalf("unexpected servers: %v", servers)
+	}
+	if _, err := parseCLI([]string{"--json", "--stun-servers", "stun.example.com"}); err == nil {
+		t.Fatal("expected a server without port to be rejected")
+	}
+	// --text has no public network section, so NAT is never probed.
+	for _, args := range [][]string{
+		{"--stun-servers", "127.0.0.1:3478"},
+		{"--text", "--stun-servers", "127.0.0.1:3478"},
+		{"--text", "--replay", "snapshot", "--stun-servers", "127.0.0.1:3478"},
+	} {
+		if _, err := parseCLI(args); err == nil || !strings.Contains(err.Error(), "--stun-servers requires --json") {
+			t.Fatalf("parseCLI(%q) error = %v", args, err)
+		}
+	}
+}
+
+func TestParseCLIIPv6Interface(t *testing.T) {
+	opts, err := parseCLI([]string{"--ipv6-interface", "bond0.100"})
+	if err != nil || opts.ipv6Interface != "bond0.100" {
+		t.Fatalf("unexpected result: %#v, %v", opts.ipv6Interface, err)
+	}
+	if options := opts.networkCheckOptions(); options.IPv6Interface != "bond0.100" {
+		t.Fatalf("interface not passed to the network check: %+v", options)
+	}
+}
+
+func TestParseCLIIPConflicts(t *testing.T) {
+	opts, err := parseCLI([]string{"--ip-conflicts"})
+	if err != nil || !opts.networkCheckOptions().IPConflicts {
+		t.Fatalf("unexpected result: %#v, %v", opts, err)
+	}
+}
+
+func TestParseCLIShowMAC(t *testing.T) {
+	opts, err := parseCLI([]string{"--json", "--show-mac", "--sections", "interfaces"})
+	if err != nil || !opts.showMAC || len(opts.sectionFilter.Enable) != 1 || opts.sectionFilter.Enable[0] != "interfaces" {
+		t.Fatalf("unexpected result: %#v, %v", opts, err)
+	}
+	if options := opts.reportOptions(); !options.IncludeMACAddresses || len(options.Filter.Enable) != 1 {
+		t.Fatalf("unexpected report options: %+v", options)
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	before := write("before.json", `{"schema_version":"goecs.system/v1","cpu":{"availability":"available","logical_cpus":8},"public_network":{"stack_type":"IPv4"}}`)
+	grown := write("grown.json", `{"schema_version":"goecs.system/v1","cpu":{"availability":"available","logical_cpus":16}}`)
+	shrunk := write("shrunk.json", `{"schema_version":"goecs.system/v1","cpu":{"availability":"available","logical_cpus":4}}`)
+
+	var stdout, stderr bytes.Buffer
+	if code := runDiff([]string{"-l", "en", before, grown}, &stdout, &stderr); code != 0 || !strings.Contains(stdout.String(), "[info] cpu logical_cpus: 8 -> 16") {
+		t.Fatalf("code=%d stdout=%q stderr=%q", code, stdout.String(), stderr.String())
+	}
+	stdout.Reset()
+	if code := runDiff([]string{before, shrunk, "-json"}, &stdout, &stderr); code != diffExitRegressed || !strings.Contains(stdout.String(), `"regressions":1`) {
+		t.Fatalf("code=%d stdout=%q stderr=%q", code, stdout.String(), stderr.String())
+	}
+	for _, args := range [][]string{{before}, {before, filepath.Join(dir, "missing.json")}, {"-l", "fr", before, grown}} {
+		if code := runDiff(args, io.Discard, io.Discard); code != diffExitError {
+			t.Fatalf("runDiff(%v) = %d, want %d", args, code, diffExitError)
+		}
+	}
+}
+
+func TestParseCLIDiskThresholds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "thresholds.json")
+	if err := os.WriteFile(path, []byte(`{"pending_sectors_failing": 1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := parseCLI([]string{"--json", "--disk-thresholds", path})
+	if err != nil || opts.diskVerdictThresholds.PendingSectorsFailing != 1 || opts.diskVerdictThresholds.ReallocatedSectorsWarning != 1 {
+		t.Fatalf("unexpected result: %#v, %v", opts.diskVerdictThresholds, err)
+	}
+	if options := opts.reportOptions(); options.DiskThresholds == nil || options.DiskThresholds.PendingSectorsFailing != 1 {
+		t.Fatalf("thresholds not passed to the report: %+v", options)
+	}
+	if opts, _ := parseCLI([]string{"--json"}); opts.reportOptions().DiskThresholds != nil {
+		t.Fatal("expected the default thresholds without --disk-thresholds")
+	}
+	if _, err := parseCLI([]string{"--disk-thresholds", filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Fatal("expected a missing thresholds file to be rejected")
+	}
+}
+
+func TestDiskVerdictExitCode(t *testing.T) {
+	for _, test := range []struct {
+		verdicts []string
+		want     int
+	}{
+		{nil, 0},
+		{[]string{system.DiskVerdictOK, system.DiskVerdictUnknown}, 0},
+		{[]string{system.DiskVerdictOK, system.DiskVerdictWarning}, exitDiskWarning},
+		{[]string{system.DiskVerdictFailing, system.DiskVerdictWarning}, exitDiskFailing},
+	} {
+		report := &system.SystemReport{}
+		for _, verdict := range test.verdicts {
+			report.Disks = append(report.Disks, system.DiskReport{Verdict: system.DiskVerdict{Status: verdict}})
+		}
+		if got := diskVerdictExitCode(report); got != test.want {
+			t.Fatalf("diskVerdictExitCode(%v) = %d, want %d", test.verdicts, got, test.want)
+		}
+	}
+}
+
+func TestParseCLIVerboseRequiresText(t *testing.T) {
+	opts, err := parseCLI([]string{"--text", "--verbose"})
+	if err != nil || !opts.verbose {
+		t.Fatalf("unexpected result: %#v, %v", opts, err)
+	}
+	if _, err := parseCLI([]string{"--json", "--verbose"}); err == nil {
+		t.Fatal("expected --verbose without --text to be rejected")
+	}
+}
+
+func TestParseCLIContentionWindow(t *testing.T) {
+	opts, err := parseCLI([]string{"--json", "--contention-window", "3s"})
+	if err != nil || opts.contentionWindow != 3*time.Second || opts.reportOptions().ContentionWindow != 3*time.Second {
+		t.Fatalf("unexpected result: %#v, %v", opts, err)
+	}
+	for _, args := range [][]string{{"--contention-window", "3s"}, {"--json", "--contention-window", "-1s"}} {
+		if _, err := parseCLI(args); err == nil {
+			t.Fatalf("expected %v to be rejected", args)
+		}
+	}
+}
+
+func TestRunDeep(t *testing.T) {
+	var devices []string
+	if err := system.RegisterDeepTool(system.DeepTool{
+		Name: "fixture-tool",
+		Run: func(_ context.Context, options system.DeepToolOptions) system.DeepToolResult {
+			devices = append(devices, options.Device+"/"+options.Kind)
+			if options.Progress != nil {
+				options.Progress(50)
+			}
+			status := "ok"
+			if options.Device == "bad" {
+				status = "failed"
+			}
+			return system.DeepToolResult{SchemaVersion: "fixture/v1", Status: status, Target: options.Device}
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer system.UnregisterDeepTool("fixture-tool")
+
+	var stdout, stderr bytes.Buffer
+	code := runDeep(context.Background(), []string{"-json", "fixture-tool", "-device", "a", "-kind", "extended", "fixture-tool", "-device", "b", "-timeout", "1m"}, &stdout, &stderr)
+	if code != 0 || strings.Join(devices, ",") != "a/extended,b/" || !strings.Contains(stdout.String(), `"tool":"fixture-tool"`) || !strings.Contains(stderr.String(), "fixture-tool: 50%") {
+		t.Fatalf("code=%d devices=%v stdout=%q stderr=%q", code, devices, stdout.String(), stderr.String())
+	}
+	stdout.Reset()
+	if code := runDeep(context.Background(), []string{"-l", "en", "fixture-tool", "-device", "bad"}, &stdout, io.Discard); code != deepExitFailed || !strings.Contains(stdout.String(), "Deep fixture-tool") {
+		t.Fatalf("code=%d stdout=%q", code, stdout.String())
+	}
+	for _, args := range [][]string{nil, {"missing-tool"}, {"fixture-tool", "-timeout", "-1s"}, {"fixture-tool", "-bogus"}} {
+		if code := runDeep(context.Background(), args, io.Discard, io.Discard); code != deepExitError {
+			t.Fatalf("runDeep(%v) = %d, want %d", args, code, deepExitError)
+		}
+	}
+}
+
+func TestParseCLIDeep(t *testing.T) {
+	opts, err := parseCLI([]string{"--json", "--deep", "smart-selftest=/dev/sda, gpu-compute"})
+	if err != nil || len(opts.deepRuns) != 2 || opts.deepRuns[0].Options.Device != "/dev/sda" || opts.deepRuns[1].Tool != "gpu-compute" || opts.deepRuns[1].Options.Device != "" {
+		t.Fatalf("unexpected result: %#v, %v", opts.deepRuns, err)
+	}
+	for _, args := range [][]string{
+		{"--deep", "gpu-compute"},
+		{"--json", "--deep", "missing"},
+		{"--json", "--replay", "snapshot", "--deep", "gpu-compute"},
+	} {
+		if _, err := parseCLI(args); err == nil {
+			t.Fatalf("parseCLI(%v) accepted", args)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/oneclickvirt/basics/system"
+)
+
+// Exit codes of basics deep: 1 when a tool did not finish with "ok" and 2
+// for a usage error.
+const (
+	deepExitFailed = 1
+	deepExitError  = 2
+)
+
+// runDeep implements "basics deep [-json] [-l en|zh] <tool> [tool options]
+// [<tool> [tool options] ...]". Tools run one after another; canceling ctx
+// stops the running tool, which for a SMART self-test aborts it on the drive.
+func runDeep(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	var jsonOutput bool
+	var language string
+	fs := flag.NewFlagSet("basics deep", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.BoolVar(&jsonOutput, "json", false, "Print the results as JSON")
+	fs.StringVar(&language, "l", "", "Set language (en or zh)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: basics deep [options] <tool> [-device target] [-kind kind] [-size size] [-duration duration] [-timeout duration] [<tool> ...]")
+		fs.PrintDefaults()
+		fmt.Fprintln(stderr, "Tools:")
+		for _, tool := range system.DeepTools() {
+			timeouts := []string{fmt.Sprintf("default timeout %s", tool.DefaultTimeout)}
+			for _, kind := range slices.Sorted(maps.Keys(tool.KindTimeouts)) {
+				timeouts = append(timeouts, fmt.Sprintf("%s %s", kind, tool.KindTimeouts[kind]))
+			}
+			fmt.Fprintf(stderr, "  %-16s %s (%s)\n", tool.Name, tool.Description, strings.Join(timeouts, ", "))
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return deepExitError
+	}
+	runs, err := parseDeepToolRuns(fs.Args())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return deepExitError
+	}
+	if len(runs) == 0 {
+		fs.Usage()
+		return deepExitError
+	}
+	language = strings.ToLower(strings.TrimSpace(language))
+	if language == "" {
+		language = "zh"
+	}
+	if language != "en" && language != "zh" {
+		fmt.Fprintln(stderr, "language must be en or zh")
+		return deepExitError
+	}
+	for index := range runs {
+		tool := runs[index].Tool
+		runs[index].Options.Progress = func(percent int) {
+			fmt.Fprintf(stderr, "%s: %d%%\n", tool, percent)
+		}
+	}
+	results := system.RunDeepTools(ctx, runs)
+	if jsonOutput {
+		encoded, err := json.Marshal(results)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return deepExitError
+		}
+		fmt.Fprintln(stdout, string(encoded))
+	} else {
+		fmt.Fprint(stdout, system.RenderDeepToolResultsText(results, language))
+	}
+	for _, result := range results {
+		if result.Status != "ok" {
+			return deepExitFailed
+		}
+	}
+	return 0
+}
+
+// parseDeepToolRuns splits the arguments into tool names, each followed by
+// its own -device, -kind, -size, -duration and -timeout flags.
+func parseDeepToolRuns(args []string) ([]system.DeepToolRun, error) {
+	var runs []system.DeepToolRun
+	for len(args) > 0 {
+		run := system.DeepToolRun{Tool: args[0]}
+		if _, ok := system.LookupDeepTool(run.Tool); !ok {
+			return nil, fmt.Errorf("unknown deep tool %q (available: %s)", run.Tool, strings.Join(deepToolNames(), ", "))
+		}
+		fs := flag.NewFlagSet("basics deep "+run.Tool, flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fs.StringVar(&run.Options.Device, "device", "", "Explicit target device")
+		fs.StringVar(&run.Options.Kind, "kind", "", "Tool specific variant")
+		fs.StringVar(&run.Options.Size, "size", "", "Amount of data generated, such as 256M")
+		fs.DurationVar(&run.Options.Duration, "duration", 0, "Run time of load generating tools")
+		fs.DurationVar(&run.Timeout, "timeout", 0, "Run timeout (default per tool)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return nil, fmt.Errorf("%s: %w", run.Tool, err)
+		}
+		if run.Timeout < 0 || run.Options.Duration < 0 {
+			return nil, fmt.Errorf("%s: timeout and duration must not be negative", run.Tool)
+		}
+		runs = append(runs, run)
+		args = fs.Args()
+	}
+	return runs, nil
+}
+
+// parseDeepToolList parses the --deep value: comma separated tool or
+// tool=device entries run with their default timeouts.
+func parseDeepToolList(value string) ([]system.DeepToolRun, error) {
+	var runs []system.DeepToolRun
+	for _, entry := range splitList(value) {
+		name, device, _ := strings.Cut(entry, "=")
+		run := system.DeepToolRun{Tool: strings.TrimSpace(name), Options: system.DeepToolOptions{Device: strings.TrimSpace(device)}}
+		if _, ok := system.LookupDeepTool(run.Tool); !ok {
+			return nil, fmt.Errorf("unknown deep tool %q (available: %s)", run.Tool, strings.Join(deepToolNames(), ", "))
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+func deepToolNames() []string {
+	var names []string
+	for _, tool := range system.DeepTools() {
+		names = append(names, tool.Name)
+	}
+	return names
+}
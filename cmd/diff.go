@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/oneclickvirt/basics/system"
+)
+
+// Exit codes of basics diff follow diff(1): 1 reports a regression of a
+// critical field and 2 reports a usage or input error.
+const (
+	diffExitRegressed = 1
+	diffExitError     = 2
+)
+
+// runDiff implements "basics diff [-json] [-l en|zh] old.json new.json".
+func runDiff(args []string, stdout, stderr io.Writer) int {
+	var jsonOutput bool
+	var language string
+	fs := flag.NewFlagSet("basics diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.BoolVar(&jsonOutput, "json", false, "Print the diff as JSON")
+	fs.StringVar(&language, "l", "", "Set language (en or zh)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: basics diff [options] old.json new.json")
+		fs.PrintDefaults()
+	}
+	// Flags may follow the report paths, as in "basics diff a.json b.json -json".
+	var paths []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return diffExitError
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		paths = append(paths, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(paths) != 2 {
+		fs.Usage()
+		return diffExitError
+	}
+	language = strings.ToLower(strings.TrimSpace(language))
+	if language == "" {
+		language = "zh"
+	}
+	if language != "en" && language != "zh" {
+		fmt.Fprintln(stderr, "language must be en or zh")
+		return diffExitError
+	}
+	before, err := system.LoadSystemReport(paths[0])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return diffExitError
+	}
+	after, err := system.LoadSystemReport(paths[1])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return diffExitError
+	}
+	diff := system.DiffSystemReports(before, after)
+	if jsonOutput {
+		output, err := json.Marshal(diff)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return diffExitError
+		}
+		fmt.Fprintln(stdout, string(output))
+	} else {
+		fmt.Fprint(stdout, system.RenderReportDiffText(diff, language))
+	}
+	if diff.Regressed() {
+		return diffExitRegressed
+	}
+	return 0
+}
@@ -6,14 +6,20 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/oneclickvirt/basics/model"
 	"github.com/oneclickvirt/basics/network"
+	"github.com/oneclickvirt/basics/network/baseinfo"
+	"github.com/oneclickvirt/basics/network/ipv6"
 	"github.com/oneclickvirt/basics/system"
 	"github.com/oneclickvirt/basics/utils"
 )
@@ -23,6 +29,47 @@ type cliOptions struct {
 	language                                   string
 	timeout                                    time.Duration
 	timeoutSet                                 bool
+	sections, skipSections                     string
+	capture, replay                            string
+	sectionFilter                              system.ReportSectionFilter
+	ipProviders, ipProviderURLs                string
+	ipConflicts                                bool
+	mmdbCity, mmdbASN                          string
+	publicIPURL, stunServers                   string
+	ipv6Interface                              string
+	showMAC                                    bool
+	diskThresholds                             string
+	verbose                                    bool
+	contentionWindow                           time.Duration
+	deep                                       string
+	deepRuns                                   []system.DeepToolRun
+	diskVerdictThresholds                      system.DiskHealthThresholds
+	ipInfoConfig                               baseinfo.IPInfoConfig
+}
+
+// Exit codes of the structured modes when a disk verdict is not ok, so a
+// cron job can page on failing drives.
+const (
+	exitDiskWarning = 3
+	exitDiskFailing = 4
+)
+
+func diskVerdictExitCode(report *system.SystemReport) int {
+	switch system.WorstDiskVerdict(report.Disks) {
+	case system.DiskVerdictFailing:
+		return exitDiskFailing
+	case system.DiskVerdictWarning:
+		return exitDiskWarning
+	default:
+		return 0
+	}
+}
+
+// jsonReport is the --json document: the hardware SystemReport with the
+// public network section alongside it.
+type jsonReport struct {
+	*system.SystemReport
+	PublicNetwork *network.NetworkReport `json:"public_network,omitempty"`
 }
 
 func parseCLI(args []string) (cliOptions, error) {
@@ -49,12 +96,122 @@ func parseCLI(args []string) (cliOptions, error) {
 	if opts.jsonOutput && opts.textOutput {
 		return opts, fmt.Errorf("--json/--structured and --text are mutually exclusive")
 	}
-	if opts.timeoutSet && !opts.jsonOutput && !opts.textOutput {
-		return opts, fmt.Errorf("--timeout requires --json/--structured or --text")
+	structured := opts.jsonOutput || opts.textOutput || opts.capture != ""
+	if opts.timeoutSet && !structured {
+		return opts, fmt.Errorf("--timeout requires --json/--structured, --text or --capture")
+	}
+	if opts.capture != "" && opts.replay != "" {
+		return opts, fmt.Errorf("--capture and --replay are mutually exclusive")
+	}
+	if opts.replay != "" && !opts.jsonOutput && !opts.textOutput {
+		return opts, fmt.Errorf("--replay requires --json/--structured or --text")
+	}
+	if opts.verbose && !opts.textOutput {
+		return opts, fmt.Errorf("--verbose requires --text")
+	}
+	if opts.contentionWindow < 0 {
+		return opts, fmt.Errorf("--contention-window must not be negative")
+	}
+	if opts.contentionWindow > 0 && !structured {
+		return opts, fmt.Errorf("--contention-window requires --json/--structured, --text or --capture")
+	}
+	if opts.deep != "" {
+		if !opts.jsonOutput && !opts.textOutput {
+			return opts, fmt.Errorf("--deep requires --json/--structured or --text")
+		}
+		if opts.replay != "" {
+			return opts, fmt.Errorf("--deep cannot be combined with --replay")
+		}
+		runs, err := parseDeepToolList(opts.deep)
+		if err != nil {
+			return opts, fmt.Errorf("--deep: %w", err)
+		}
+		opts.deepRuns = runs
+	}
+	opts.sectionFilter = system.ReportSectionFilter{
+		Enable:  system.ParseReportSectionList(opts.sections),
+		Disable: system.ParseReportSectionList(opts.skipSections),
+	}
+	if len(opts.sectionFilter.Enable) > 0 || len(opts.sectionFilter.Disable) > 0 {
+		if !structured {
+			return opts, fmt.Errorf("--sections/--skip-sections require --json/--structured, --text or --capture")
+		}
+		if err := opts.sectionFilter.Validate(); err != nil {
+			return opts, err
+		}
+	}
+	ipInfoConfig, err := baseinfo.ParseIPInfoConfig(opts.ipProviders, opts.ipProviderURLs)
+	if err != nil {
+		return opts, err
+	}
+	if opts.mmdbCity == "" {
+		opts.mmdbCity = os.Getenv("BASICS_MMDB_CITY")
+	}
+	if opts.mmdbASN == "" {
+		opts.mmdbASN = os.Getenv("BASICS_MMDB_ASN")
+	}
+	ipInfoConfig.MMDBCityPath, ipInfoConfig.MMDBASNPath = opts.mmdbCity, opts.mmdbASN
+	if err := ipInfoConfig.Validate(); err != nil {
+		return opts, err
+	}
+	opts.ipInfoConfig = ipInfoConfig
+	// The public network section is only collected live with --json.
+	liveNetwork := opts.jsonOutput && opts.replay == ""
+	if opts.publicIPURL != "" {
+		if !liveNetwork {
+			return opts, fmt.Errorf("--public-ip-url requires --json/--structured without --replay")
+		}
+		parsed, err := url.Parse(opts.publicIPURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return opts, fmt.Errorf("--public-ip-url must be an http or https URL")
+		}
+	}
+	if opts.diskThresholds != "" {
+		thresholds, err := system.LoadDiskHealthThresholds(opts.diskThresholds)
+		if err != nil {
+			return opts, fmt.Errorf("--disk-thresholds: %w", err)
+		}
+		opts.diskVerdictThresholds = thresholds
+	}
+	if opts.stunServers != "" && !liveNetwork {
+		return opts, fmt.Errorf("--stun-servers requires --json/--structured without --replay")
+	}
+	for _, server := range splitList(opts.stunServers) {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			return opts, fmt.Errorf("--stun-servers entries must be host:port: %s", server)
+		}
 	}
 	return opts, nil
 }
 
+// splitList splits a comma separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// reportOptions returns the structured report options selected on the
+// command line.
+func (opts cliOptions) reportOptions() system.ReportOptions {
+	options := system.ReportOptions{Filter: opts.sectionFilter, IncludeMACAddresses: opts.showMAC, ContentionWindow: opts.contentionWindow}
+	if opts.diskThresholds != "" {
+		thresholds := opts.diskVerdictThresholds
+		options.DiskThresholds = &thresholds
+	}
+	return options
+}
+
+// networkCheckOptions returns the legacy text mode options selected on the
+// command line.
+func (opts cliOptions) networkCheckOptions() network.NetworkCheckOptions {
+	return network.NetworkCheckOptions{IPv6Interface: opts.ipv6Interface, IPConflicts: opts.ipConflicts}
+}
+
 func newFlagSet(opts *cliOptions, output io.Writer) *flag.FlagSet {
 	fs := flag.NewFlagSet("basics", flag.ContinueOnError)
 	fs.SetOutput(output)
@@ -66,21 +223,51 @@ func newFlagSet(opts *cliOptions, output io.Writer) *flag.FlagSet {
 	fs.BoolVar(&opts.jsonOutput, "structured", false, "Print the structured system report as JSON")
 	fs.BoolVar(&opts.textOutput, "text", false, "Print the structured hardware summary as compact text")
 	fs.DurationVar(&opts.timeout, "timeout", 0, "Structured report timeout (for example 10s)")
+	fs.StringVar(&opts.sections, "sections", "", "Comma separated structured report sections to collect (default all)")
+	fs.StringVar(&opts.skipSections, "skip-sections", "", "Comma separated structured report sections to skip")
+	fs.StringVar(&opts.capture, "capture", "", "Record the files read by the structured report to a directory or .tar.gz archive")
+	fs.StringVar(&opts.replay, "replay", "", "Build the structured report from a directory or .tar.gz archive written by --capture")
+	fs.StringVar(&opts.ipProviders, "ip-providers", "", "Comma separated IP info providers in priority order (default "+strings.Join(baseinfo.IPInfoProviderNames(), ",")+")")
+	fs.StringVar(&opts.ipProviderURLs, "ip-provider-url", "", "Comma separated name=url overrides for IP info provider endpoints")
+	fs.BoolVar(&opts.ipConflicts, "ip-conflicts", false, "Also print IP info fields on which providers disagree")
+	fs.StringVar(&opts.publicIPURL, "public-ip-url", "", "Plain text what-is-my-IP URL used for egress address discovery with --json (default "+baseinfo.DefaultPublicIPURL+")")
+	fs.StringVar(&opts.stunServers, "stun-servers", "", "Comma separated host:port STUN servers for NAT and egress address discovery with --json (default gostun servers)")
+	fs.StringVar(&opts.ipv6Interface, "ipv6-interface", "", "Network interface probed for the IPv6 prefix (default the interface owning the public IPv6)")
+	fs.BoolVar(&opts.showMAC, "show-mac", false, "Include full MAC addresses in the interfaces section (default vendor prefix only)")
+	fs.StringVar(&opts.diskThresholds, "disk-thresholds", "", "JSON file overriding the disk health verdict thresholds")
+	fs.DurationVar(&opts.contentionWindow, "contention-window", 0, "Sampling window of the cpu_contention report section (default 1s)")
+	fs.BoolVar(&opts.verbose, "verbose", false, "Also print ATA SMART attribute tables, self-test and error logs with --text")
+	fs.StringVar(&opts.deep, "deep", "", "Comma separated deep tools to run and include in the report, as tool or tool=device (see basics deep -h)")
+	fs.StringVar(&opts.mmdbCity, "mmdb-city", "", "Local GeoIP2/GeoLite2 City database for offline lookups (env BASICS_MMDB_CITY)")
+	fs.StringVar(&opts.mmdbASN, "mmdb-asn", "", "Local GeoIP2/GeoLite2 ASN database for offline lookups (env BASICS_MMDB_ASN)")
 	return fs
 }
 
 func printCLIHelp(program string) {
-	fmt.Printf("Usage: %s [options]\n", program)
+	fmt.Printf("Usage: %s [options]\n       %s diff [-json] [-l en|zh] old.json new.json\n       %s deep [-json] [-l en|zh] <tool> [-device target] [-kind kind] [-size size] [-duration duration] [-timeout duration] [<tool> ...]\n", program, program, program)
 	newFlagSet(&cliOptions{}, os.Stdout).PrintDefaults()
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(runDiff(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "deep" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		code := runDeep(ctx, os.Args[2:], os.Stdout, os.Stderr)
+		stop()
+		os.Exit(code)
+	}
 	opts, err := parseCLI(os.Args[1:])
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(2)
 	}
 	model.EnableLoger = opts.log
+	if err := baseinfo.SetIPInfoConfig(opts.ipInfoConfig); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 	if opts.help {
 		printCLIHelp(os.Args[0])
 		return
@@ -89,29 +276,79 @@ func main() {
 		fmt.Println(model.BasicsVersion)
 		return
 	}
-	if opts.jsonOutput || opts.textOutput {
+	if opts.jsonOutput || opts.textOutput || opts.capture != "" {
 		timeout := opts.timeout
 		if timeout <= 0 {
 			timeout = 10 * time.Second
 		}
 		ctx, cancel := context.WithTimeout(context.Background(), timeout)
 		defer cancel()
-		systemReport := system.CollectSystemReport(ctx)
+		// The public network section is live data, so it is neither captured
+		// nor replayed; it runs alongside the hardware sections.
+		var networkReport chan *network.NetworkReport
+		if opts.jsonOutput && opts.replay == "" {
+			networkReport = make(chan *network.NetworkReport, 1)
+			go func() {
+				stunServers := splitList(opts.stunServers)
+				networkReport <- network.CollectNetworkReportWithOptions(ctx, network.NetworkReportOptions{
+					PublicIP:   baseinfo.PublicIPDiscoveryConfig{URL: opts.publicIPURL, STUNServers: stunServers},
+					NAT:        system.NATProbeConfig{Servers: stunServers},
+					IPv6Prefix: ipv6.IPv6PrefixOptions{Interface: opts.ipv6Interface},
+				})
+			}()
+		}
+		var systemReport *system.SystemReport
+		switch {
+		case opts.capture != "":
+			report, recorder, captureErr := system.CaptureSystemReportWithOptions(ctx, opts.capture, opts.reportOptions())
+			if captureErr != nil {
+				fmt.Fprintln(os.Stderr, captureErr)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "Captured %d files to %s\n", recorder.FileCount(), opts.capture)
+			if !opts.jsonOutput && !opts.textOutput {
+				return
+			}
+			systemReport = report
+		case opts.replay != "":
+			files, operatingSystem, replayErr := system.OpenReportSnapshot(opts.replay)
+			if replayErr != nil {
+				fmt.Fprintln(os.Stderr, replayErr)
+				os.Exit(1)
+			}
+			systemReport = system.CollectSystemReportFromWithOptions(ctx, files, operatingSystem, opts.reportOptions())
+		default:
+			systemReport = system.CollectSystemReportWithOptions(ctx, opts.reportOptions())
+		}
+		if len(opts.deepRuns) > 0 {
+			// Deep tools have their own timeouts rather than the report's.
+			deepCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			systemReport.DeepTools = system.RunDeepTools(deepCtx, opts.deepRuns)
+			stop()
+		}
 		if opts.textOutput {
 			language := strings.ToLower(strings.TrimSpace(opts.language))
 			if language == "" {
 				language = "zh"
 			}
 			fmt.Print(system.RenderSystemReportText(systemReport, language))
-			return
+			if opts.verbose {
+				fmt.Print(system.RenderDiskDetailsText(systemReport, language))
+			}
+			fmt.Print(system.RenderDeepToolResultsText(systemReport.DeepTools, language))
+			os.Exit(diskVerdictExitCode(systemReport))
+		}
+		output := jsonReport{SystemReport: systemReport}
+		if networkReport != nil {
+			output.PublicNetwork = <-networkReport
 		}
-		report, marshalErr := json.Marshal(systemReport)
+		report, marshalErr := json.Marshal(output)
 		if marshalErr != nil {
 			fmt.Fprintln(os.Stderr, marshalErr)
 			return
 		}
 		fmt.Println(string(report))
-		return
+		os.Exit(diskVerdictExitCode(systemReport))
 	}
 	language := opts.language
 	if language == "" {
@@ -130,12 +367,15 @@ func main() {
 	fmt.Println("Repo:", "https://github.com/oneclickvirt/basics")
 	preCheck := utils.CheckPublicAccess(3 * time.Second)
 	var ipInfo string
+	checkOptions := opts.networkCheckOptions()
 	if preCheck.Connected && preCheck.StackType == "DualStack" {
-		_, _, ipInfo, _, _ = network.NetworkCheck("both", false, language)
+		_, _, ipInfo, _, _ = network.NetworkCheckContext(context.Background(), "both", false, language, checkOptions)
 	} else if preCheck.Connected && preCheck.StackType == "IPv4" {
-		_, _, ipInfo, _, _ = network.NetworkCheck("ipv4", false, language)
+		_, _, ipInfo, _, _ = network.NetworkCheckContext(context.Background(), "ipv4", false, language, checkOptions)
 	} else if preCheck.Connected && preCheck.StackType == "IPv6" {
-		_, _, ipInfo, _, _ = network.NetworkCheck("ipv6", false, language)
+		_, _, ipInfo, _, _ = network.NetworkCheckContext(context.Background(), "ipv6", false, language, checkOptions)
+	} else if baseinfo.HasOfflineIPInfoProvider() {
+		_, _, ipInfo, _, _ = network.NetworkCheckContext(context.Background(), "both", false, language, checkOptions)
 	}
 	res := system.CheckSystemInfo(language)
 	fmt.Println("--------------------------------------------------")
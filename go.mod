@@ -9,6 +9,8 @@ require (
 	github.com/libp2p/go-nat v0.2.0
 	github.com/oneclickvirt/defaultset v0.0.2-20240624082446
 	github.com/oneclickvirt/gostun v0.0.10
+	github.com/oschwald/maxminddb-golang/v2 v2.1.1
+	github.com/pion/stun/v2 v2.0.0
 	github.com/shirou/gopsutil/v4 v4.25.6
 	github.com/yusufpapurcu/wmi v1.2.4
 	golang.org/x/sys v0.45.0
@@ -34,7 +36,6 @@ require (
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/pion/dtls/v2 v2.2.7 // indirect
 	github.com/pion/logging v0.2.2 // indirect
-	github.com/pion/stun/v2 v2.0.0 // indirect
 	github.com/pion/transport/v2 v2.2.1 // indirect
 	github.com/pion/transport/v3 v3.0.1 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
@@ -17,146 +17,181 @@ import (
 )
 
 // FetchIPInfoIo 从 ipinfo.io 获取 IP 信息
+//
+// Deprecated: 请使用 FetchIPInfoIoContext，以便调用方取消请求。
 func FetchIPInfoIo(netType string) (*model.IpInfo, error) {
-	data, err := utils.FetchJsonFromURL("http://ipinfo.io", netType, false, "")
-	if err == nil {
-		res := &model.IpInfo{}
-		if ip, ok := data["ip"].(string); ok && ip != "" {
-			res.Ip = ip
-		}
-		if city, ok := data["city"].(string); ok && city != "" {
-			res.City = city
-		}
-		if region, ok := data["region"].(string); ok && region != "" {
-			res.Region = region
-		}
-		if country, ok := data["country"].(string); ok && country != "" {
-			res.Country = country
-		}
-		if org, ok := data["org"].(string); ok && org != "" {
-			parts := strings.Split(org, " ")
-			if len(parts) > 0 {
-				res.ASN = parts[0]
-				res.Org = strings.Join(parts[1:], " ")
-			} else {
-				res.ASN = org
-			}
+	return FetchIPInfoIoContext(context.Background(), netType)
+}
+
+// FetchIPInfoIoContext 从 ipinfo.io 获取 IP 信息
+func FetchIPInfoIoContext(ctx context.Context, netType string) (*model.IpInfo, error) {
+	return fetchHTTPIPInfo(ctx, ipInfoIoProvider, netType)
+}
+
+// parseIPInfoIo 解析 ipinfo.io 的返回数据
+func parseIPInfoIo(data map[string]interface{}) *model.IpInfo {
+	res := &model.IpInfo{}
+	if ip, ok := data["ip"].(string); ok && ip != "" {
+		res.Ip = ip
+	}
+	if city, ok := data["city"].(string); ok && city != "" {
+		res.City = city
+	}
+	if region, ok := data["region"].(string); ok && region != "" {
+		res.Region = region
+	}
+	if country, ok := data["country"].(string); ok && country != "" {
+		res.Country = country
+	}
+	if org, ok := data["org"].(string); ok && org != "" {
+		parts := strings.Split(org, " ")
+		if len(parts) > 0 {
+			res.ASN = parts[0]
+			res.Org = strings.Join(parts[1:], " ")
+		} else {
+			res.ASN = org
 		}
-		return res, nil
-	} else {
-		return nil, err
 	}
+	return res
 }
 
 // FetchCloudFlare 从 speed.cloudflare.com 获取 IP 信息
+//
+// Deprecated: 请使用 FetchCloudFlareContext，以便调用方取消请求。
 func FetchCloudFlare(netType string) (*model.IpInfo, error) {
-	data, err := utils.FetchJsonFromURL("https://speed.cloudflare.com/meta", netType, false, "")
-	if err == nil {
-		res := &model.IpInfo{}
-		if ip, ok := data["clientIp"].(string); ok && ip != "" {
-			res.Ip = ip
-		}
-		if city, ok := data["city"].(string); ok && city != "" {
-			res.City = city
-		}
-		if region, ok := data["region"].(string); ok && region != "" {
-			res.Region = region
-		}
-		if country, ok := data["country"].(string); ok && country != "" {
-			res.Country = country
-		}
-		if asnFloat, ok := data["asn"].(float64); ok {
-			res.ASN = strconv.FormatInt(int64(asnFloat), 10)
-		} else if asnStr, ok := data["asn"].(string); ok && asnStr != "" {
-			res.ASN = asnStr
-		}
-		if org, ok := data["asOrganization"].(string); ok && org != "" {
-			res.Org = org
-		}
-		return res, nil
-	} else {
-		return nil, err
+	return FetchCloudFlareContext(context.Background(), netType)
+}
+
+// FetchCloudFlareContext 从 speed.cloudflare.com 获取 IP 信息
+func FetchCloudFlareContext(ctx context.Context, netType string) (*model.IpInfo, error) {
+	return fetchHTTPIPInfo(ctx, cloudFlareProvider, netType)
+}
+
+// parseCloudFlare 解析 speed.cloudflare.com 的返回数据
+func parseCloudFlare(data map[string]interface{}) *model.IpInfo {
+	res := &model.IpInfo{}
+	if ip, ok := data["clientIp"].(string); ok && ip != "" {
+		res.Ip = ip
+	}
+	if city, ok := data["city"].(string); ok && city != "" {
+		res.City = city
+	}
+	if region, ok := data["region"].(string); ok && region != "" {
+		res.Region = region
+	}
+	if country, ok := data["country"].(string); ok && country != "" {
+		res.Country = country
+	}
+	if asnFloat, ok := data["asn"].(float64); ok {
+		res.ASN = strconv.FormatInt(int64(asnFloat), 10)
+	} else if asnStr, ok := data["asn"].(string); ok && asnStr != "" {
+		res.ASN = asnStr
 	}
+	if org, ok := data["asOrganization"].(string); ok && org != "" {
+		res.Org = org
+	}
+	return res
 }
 
 // FetchIpSb 从 api.ip.sb 获取 IP 信息
+//
+// Deprecated: 请使用 FetchIpSbContext，以便调用方取消请求。
 func FetchIpSb(netType string) (*model.IpInfo, error) {
-	data, err := utils.FetchJsonFromURL("https://api.ip.sb/geoip", netType, true, "")
-	if err == nil {
-		res := &model.IpInfo{}
-		if ip, ok := data["ip"].(string); ok && ip != "" {
+	return FetchIpSbContext(context.Background(), netType)
+}
+
+// FetchIpSbContext 从 api.ip.sb 获取 IP 信息
+func FetchIpSbContext(ctx context.Context, netType string) (*model.IpInfo, error) {
+	return fetchHTTPIPInfo(ctx, ipSbProvider, netType)
+}
+
+// parseIpSb 解析 api.ip.sb 的返回数据
+func parseIpSb(data map[string]interface{}) *model.IpInfo {
+	res := &model.IpInfo{}
+	if ip, ok := data["ip"].(string); ok && ip != "" {
+		res.Ip = ip
+	}
+	if city, ok := data["city"].(string); ok && city != "" {
+		res.City = city
+	}
+	if region, ok := data["region"].(string); ok && region != "" {
+		res.Region = region
+	}
+	if country, ok := data["country"].(string); ok && country != "" {
+		res.Country = country
+	}
+	if asnFloat, ok := data["asn"].(float64); ok {
+		res.ASN = strconv.FormatInt(int64(asnFloat), 10)
+	} else if asnStr, ok := data["asn"].(string); ok && asnStr != "" {
+		res.ASN = asnStr
+	}
+	if org, ok := data["asn_organization"].(string); ok && org != "" {
+		res.Org = org
+	}
+	return res
+}
+
+// FetchMaxMind 从 MaxMind 获取 IP 信息
+//
+// Deprecated: 请使用 FetchMaxMindContext，以便调用方取消请求。
+func FetchMaxMind(netType string) (*model.IpInfo, error) {
+	return FetchMaxMindContext(context.Background(), netType)
+}
+
+// FetchMaxMindContext 从 MaxMind 获取 IP 信息
+func FetchMaxMindContext(ctx context.Context, netType string) (*model.IpInfo, error) {
+	return fetchHTTPIPInfo(ctx, maxMindProvider, netType)
+}
+
+// parseMaxMind 解析 MaxMind 的返回数据
+func parseMaxMind(data map[string]interface{}) *model.IpInfo {
+	res := &model.IpInfo{}
+	if traits, ok := data["traits"].(map[string]interface{}); ok {
+		if ip, ok := traits["ip_address"].(string); ok && ip != "" {
 			res.Ip = ip
 		}
-		if city, ok := data["city"].(string); ok && city != "" {
-			res.City = city
-		}
-		if region, ok := data["region"].(string); ok && region != "" {
-			res.Region = region
-		}
-		if country, ok := data["country"].(string); ok && country != "" {
-			res.Country = country
-		}
-		if asnFloat, ok := data["asn"].(float64); ok {
+		if asnFloat, ok := traits["autonomous_system_number"].(float64); ok {
 			res.ASN = strconv.FormatInt(int64(asnFloat), 10)
-		} else if asnStr, ok := data["asn"].(string); ok && asnStr != "" {
-			res.ASN = asnStr
 		}
-		if org, ok := data["asn_organization"].(string); ok && org != "" {
+		if org, ok := traits["autonomous_system_organization"].(string); ok && org != "" {
 			res.Org = org
 		}
-		return res, nil
-	} else {
-		return nil, err
 	}
-}
-
-// FetchMaxMind 从 MaxMind 获取 IP 信息
-func FetchMaxMind(netType string) (*model.IpInfo, error) {
-	data, err := utils.FetchJsonFromURL("https://geoip.maxmind.com/geoip/v2.1/city/me", netType, true, "Referer: https://www.maxmind.com/en/locate-my-ip-address")
-	if err == nil {
-		res := &model.IpInfo{}
-		if traits, ok := data["traits"].(map[string]interface{}); ok {
-			if ip, ok := traits["ip_address"].(string); ok && ip != "" {
-				res.Ip = ip
-			}
-			if asnFloat, ok := traits["autonomous_system_number"].(float64); ok {
-				res.ASN = strconv.FormatInt(int64(asnFloat), 10)
-			}
-			if org, ok := traits["autonomous_system_organization"].(string); ok && org != "" {
-				res.Org = org
+	if city, ok := data["city"].(map[string]interface{}); ok {
+		if names, ok := city["names"].(map[string]interface{}); ok {
+			if cityName, ok := names["en"].(string); ok && cityName != "" {
+				res.City = cityName
 			}
 		}
-		if city, ok := data["city"].(map[string]interface{}); ok {
-			if names, ok := city["names"].(map[string]interface{}); ok {
-				if cityName, ok := names["en"].(string); ok && cityName != "" {
-					res.City = cityName
-				}
-			}
-		}
-		if subdivisions, ok := data["subdivisions"].([]interface{}); ok && len(subdivisions) > 0 {
-			if subdivision, ok := subdivisions[0].(map[string]interface{}); ok {
-				if names, ok := subdivision["names"].(map[string]interface{}); ok {
-					if regionName, ok := names["en"].(string); ok && regionName != "" {
-						res.Region = regionName
-					}
+	}
+	if subdivisions, ok := data["subdivisions"].([]interface{}); ok && len(subdivisions) > 0 {
+		if subdivision, ok := subdivisions[0].(map[string]interface{}); ok {
+			if names, ok := subdivision["names"].(map[string]interface{}); ok {
+				if regionName, ok := names["en"].(string); ok && regionName != "" {
+					res.Region = regionName
 				}
 			}
 		}
-		if country, ok := data["country"].(map[string]interface{}); ok {
-			if names, ok := country["names"].(map[string]interface{}); ok {
-				if countryName, ok := names["en"].(string); ok && countryName != "" {
-					res.Country = countryName
-				}
+	}
+	if country, ok := data["country"].(map[string]interface{}); ok {
+		if names, ok := country["names"].(map[string]interface{}); ok {
+			if countryName, ok := names["en"].(string); ok && countryName != "" {
+				res.Country = countryName
 			}
 		}
-		return res, nil
-	} else {
-		return nil, err
 	}
+	return res
 }
 
 // FetchHackerTargetASN 使用HackerTarget获取ASN信息
+//
+// Deprecated: 请使用 FetchHackerTargetASNContext，以便调用方取消请求。
 func FetchHackerTargetASN(ip string, netType string) (*model.IpInfo, error) {
+	return FetchHackerTargetASNContext(context.Background(), ip, netType)
+}
+
+// FetchHackerTargetASNContext 使用HackerTarget获取ASN信息
+func FetchHackerTargetASNContext(ctx context.Context, ip string, netType string) (*model.IpInfo, error) {
 	url := fmt.Sprintf("https://api.hackertarget.com/aslookup/?q=%s", ip)
 	// 检查网络类型是否有效
 	if netType != "tcp4" && netType != "tcp6" {
@@ -176,7 +211,7 @@ func FetchHackerTargetASN(ip string, netType string) (*model.IpInfo, error) {
 		SetRetryBackoffInterval(1*time.Second, 2*time.Second).
 		SetRetryFixedInterval(1 * time.Second)
 	// 执行请求
-	resp, err := client.R().Get(url)
+	resp, err := client.R().SetContext(ctx).Get(url)
 	if err != nil {
 		return nil, err
 	}
@@ -205,9 +240,16 @@ func FetchHackerTargetASN(ip string, netType string) (*model.IpInfo, error) {
 }
 
 // FetchIPApiASN 使用ip-api.com获取ASN信息
+//
+// Deprecated: 请使用 FetchIPApiASNContext，以便调用方取消请求。
 func FetchIPApiASN(ip string, netType string) (*model.IpInfo, error) {
+	return FetchIPApiASNContext(context.Background(), ip, netType)
+}
+
+// FetchIPApiASNContext 使用ip-api.com获取ASN信息
+func FetchIPApiASNContext(ctx context.Context, ip string, netType string) (*model.IpInfo, error) {
 	url := fmt.Sprintf("http://ip-api.com/json/%s?fields=as", ip)
-	data, err := utils.FetchJsonFromURL(url, netType, false, "")
+	data, err := utils.FetchJsonFromURLContext(ctx, url, netType, false, "")
 	if err != nil {
 		return nil, err
 	}
@@ -242,14 +284,15 @@ func needsASNFallback(info *model.IpInfo) bool {
 	return hasGeoInfo(info) && info.ASN == ""
 }
 
-// fillASNWithFallback 使用备用方法补充ASN信息
-func fillASNWithFallback(ipInfo *model.IpInfo, netType string) *model.IpInfo {
+// fillASNWithFallback 使用备用方法补充ASN信息，同时返回被补充字段(asn org)的来源
+func fillASNWithFallback(ctx context.Context, ipInfo *model.IpInfo, netType string) (*model.IpInfo, map[string]string) {
+	filledBy := make(map[string]string)
 	if !needsASNFallback(ipInfo) {
-		return ipInfo
+		return ipInfo, filledBy
 	}
-	asnFunctions := []func(string, string) (*model.IpInfo, error){
-		FetchHackerTargetASN,
-		FetchIPApiASN,
+	asnFunctions := []func(context.Context, string, string) (*model.IpInfo, error){
+		FetchHackerTargetASNContext,
+		FetchIPApiASNContext,
 	}
 	asnFuncNames := []string{
 		"hackertarget",
@@ -261,7 +304,7 @@ func fillASNWithFallback(ipInfo *model.IpInfo, netType string) *model.IpInfo {
 	// 并发执行ASN查询
 	wg.Add(len(asnFunctions))
 	for i, fn := range asnFunctions {
-		go func(f func(string, string) (*model.IpInfo, error), name string) {
+		go func(f func(context.Context, string, string) (*model.IpInfo, error), name string) {
 			defer wg.Done()
 			defer func() {
 				if r := recover(); r != nil {
@@ -274,7 +317,7 @@ func fillASNWithFallback(ipInfo *model.IpInfo, netType string) *model.IpInfo {
 					}
 				}
 			}()
-			if result, err := f(ipInfo.Ip, netType); err == nil && result != nil {
+			if result, err := f(ctx, ipInfo.Ip, netType); err == nil && result != nil {
 				select {
 				case asnChan <- &ipInfoWithSource{info: result, source: name}:
 				default:
@@ -309,21 +352,23 @@ func fillASNWithFallback(ipInfo *model.IpInfo, netType string) *model.IpInfo {
 				// 补充ASN信息
 				if ipInfo.ASN == "" && asnResult.info.ASN != "" {
 					ipInfo.ASN = asnResult.info.ASN
+					filledBy["asn"] = asnResult.source
 				}
 				if ipInfo.Org == "" && asnResult.info.Org != "" {
 					ipInfo.Org = asnResult.info.Org
+					filledBy["org"] = asnResult.source
 				}
 				// 如果ASN已经补充完整，直接返回
 				if ipInfo.ASN != "" {
 					if model.EnableLoger {
 						Logger.Info(fmt.Sprintf("ASN filled by %s: ASN=%s, Org=%s", asnResult.source, ipInfo.ASN, ipInfo.Org))
 					}
-					return ipInfo
+					return ipInfo, filledBy
 				}
 			}
 		}
 	}
-	return ipInfo
+	return ipInfo, filledBy
 }
 
 // ipInfoWithSource 包装IP信息和来源
@@ -332,7 +377,7 @@ type ipInfoWithSource struct {
 	source string
 }
 
-func safeFetchIPInfo(fetchFunc func(string) (*model.IpInfo, error), ipType string) (ret *model.IpInfo, err error) {
+func safeFetchIPInfo(ctx context.Context, fetchFunc func(context.Context, string) (*model.IpInfo, error), ipType string) (ret *model.IpInfo, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("panic in fetch function for %s: %v", ipType, r)
@@ -341,153 +386,270 @@ func safeFetchIPInfo(fetchFunc func(string) (*model.IpInfo, error), ipType strin
 			}
 		}
 	}()
-	return fetchFunc(ipType)
+	return fetchFunc(ctx, ipType)
 }
 
 // executeFunctions 并发执行函数
 // 仅区分IPV4或IPV6，BOTH的情况需要两次执行本函数分别指定
-func executeFunctions(checkType string, fetchFunc func(string) (*model.IpInfo, error), funcName string, ipInfoChan chan *ipInfoWithSource, wg *sync.WaitGroup) {
+func executeFunctions(ctx context.Context, checkType string, fetchFunc func(context.Context, string) (*model.IpInfo, error), funcName string, ipInfoChan chan *ipInfoWithSource, wg *sync.WaitGroup) {
 	defer wg.Done()
-	ipFetcher := func(ipType string) {
-		ipInfo, err := safeFetchIPInfo(fetchFunc, ipType)
-		if err == nil {
-			select {
-			case ipInfoChan <- &ipInfoWithSource{info: ipInfo, source: funcName}:
-			default:
-			}
-		} else {
-			select {
-			case ipInfoChan <- &ipInfoWithSource{info: nil, source: funcName}:
-			default:
-			}
-		}
+	if checkType != "ipv4" && checkType != "ipv6" {
+		return
 	}
-	if checkType == "ipv4" {
-		ipFetcher("tcp4")
-	}
-	if checkType == "ipv6" {
-		ipFetcher("tcp6")
+	ipInfo, err := safeFetchIPInfo(ctx, fetchFunc, checkType)
+	if err == nil {
+		select {
+		case ipInfoChan <- &ipInfoWithSource{info: ipInfo, source: funcName}:
+		default:
+		}
+	} else {
+		select {
+		case ipInfoChan <- &ipInfoWithSource{info: nil, source: funcName}:
+		default:
+		}
 	}
 }
 
+// IpCheckResult 单个协议族的合并结果及其数据来源
+type IpCheckResult struct {
+	Info *model.IpInfo
+	// Sources 按优先级从高到低列出返回了数据的提供商，ASN备用查询排在最后
+	Sources []string
+	// FieldSources 记录合并后各字段(ip asn org country region city)最终取自哪个提供商
+	FieldSources map[string]string
+	// Conflicts 记录各字段中与最终取值不一致的其他提供商取值，没有分歧的字段不出现
+	Conflicts map[string][]utils.SourcedValue
+}
+
 // RunIpCheck 并发请求获取信息
+//
+// Deprecated: 请使用 RunIpCheckContext，以便调用方取消请求。
 func RunIpCheck(checkType string) (*model.IpInfo, *model.IpInfo, error) {
+	return RunIpCheckContext(context.Background(), checkType)
+}
+
+// RunIpCheckContext 并发请求获取信息
+// ctx 结束时所有正在进行的查询都会被中止，已返回的结果仍会被合并
+func RunIpCheckContext(ctx context.Context, checkType string) (*model.IpInfo, *model.IpInfo, error) {
+	ipv4Result, ipv6Result, err := RunIpCheckWithSourcesContext(ctx, checkType)
+	return ipv4Result.info(), ipv6Result.info(), err
+}
+
+func (r *IpCheckResult) info() *model.IpInfo {
+	if r == nil {
+		return nil
+	}
+	return r.Info
+}
+
+// RunIpCheckWithSources 并发请求获取信息，并记录每个字段的数据来源
+//
+// Deprecated: 请使用 RunIpCheckWithSourcesContext，以便调用方取消请求。
+func RunIpCheckWithSources(checkType string) (*IpCheckResult, *IpCheckResult, error) {
+	return RunIpCheckWithSourcesContext(context.Background(), checkType)
+}
+
+// RunIpCheckWithSourcesContext 使用 SetIPInfoConfig 配置的提供商并发请求获取信息，并记录每个字段的数据来源
+func RunIpCheckWithSourcesContext(ctx context.Context, checkType string) (*IpCheckResult, *IpCheckResult, error) {
+	providers, err := configuredIPInfoProviders()
+	if err != nil {
+		return nil, nil, err
+	}
+	return RunIpCheckWithProviders(ctx, checkType, providers)
+}
+
+// RunIpCheckWithProviders 使用指定的提供商并发请求获取信息
+// providers 按优先级从高到低排列，高优先级提供商的非空字段优先采用
+func RunIpCheckWithProviders(ctx context.Context, checkType string, providers []IPInfoProvider) (*IpCheckResult, *IpCheckResult, error) {
 	if model.EnableLoger {
 		InitLogger()
 		defer Logger.Sync()
 	}
-	functions := []func(string) (*model.IpInfo, error){
-		FetchIPInfoIo,
-		FetchMaxMind,
-		FetchCloudFlare,
-		FetchIpSb,
+	var families []string
+	switch checkType {
+	case "both":
+		families = []string{"ipv4", "ipv6"}
+	case "ipv4", "ipv6":
+		families = []string{checkType}
+	default:
+		if model.EnableLoger {
+			Logger.Info("RunIpCheckContext: wrong checkType")
+		}
+		return nil, nil, fmt.Errorf("wrong checkType")
 	}
-	funcNames := []string{
-		"ipinfo",
-		"maxmind",
-		"cloudflare",
-		"ipsb",
+	priority := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		priority = append(priority, provider.Name())
 	}
-	ipInfoIPv4 := make(chan *ipInfoWithSource, len(functions))
-	ipInfoIPv6 := make(chan *ipInfoWithSource, len(functions))
+	ipInfoIPv4 := make(chan *ipInfoWithSource, len(providers))
+	ipInfoIPv6 := make(chan *ipInfoWithSource, len(providers))
 	var wg sync.WaitGroup
-	if checkType == "both" {
-		wg.Add(len(functions) * 2) // 每个函数都会产生一个 IPv4 和一个 IPv6 结果
-		// 启动协程执行函数
-		for i, f := range functions {
-			go executeFunctions("ipv4", f, funcNames[i], ipInfoIPv4, &wg)
-			go executeFunctions("ipv6", f, funcNames[i], ipInfoIPv6, &wg)
-		}
-	} else if checkType == "ipv4" {
-		wg.Add(len(functions)) // 每个函数都会产生一个 IPv4 结果
-		// 启动协程执行函数
-		for i, f := range functions {
-			go executeFunctions("ipv4", f, funcNames[i], ipInfoIPv4, &wg)
-		}
-	} else if checkType == "ipv6" {
-		wg.Add(len(functions)) // 每个函数都会产生一个 IPv6 结果
-		// 启动协程执行函数
-		for i, f := range functions {
-			go executeFunctions("ipv6", f, funcNames[i], ipInfoIPv6, &wg)
-		}
-	} else {
-		if model.EnableLoger {
-			Logger.Info("RunIpCheck: wrong checkType")
+	// 每个提供商对其支持的每个协议族产生一个结果
+	for _, provider := range providers {
+		for _, family := range families {
+			if !containsSource(provider.Families(), family) {
+				continue
+			}
+			ipInfoChan := ipInfoIPv4
+			if family == "ipv6" {
+				ipInfoChan = ipInfoIPv6
+			}
+			wg.Add(1)
+			go executeFunctions(ctx, family, provider.Fetch, provider.Name(), ipInfoChan, &wg)
 		}
-		return nil, nil, fmt.Errorf("wrong checkType")
 	}
 	go func() {
 		wg.Wait()
 		close(ipInfoIPv4)
 		close(ipInfoIPv6)
 	}()
-	// 收集并排序IPv4结果
+	// 收集IPv4结果
 	ipInfoV4List := make([]*ipInfoWithSource, 0)
 	for ipInfo := range ipInfoIPv4 {
 		ipInfoV4List = append(ipInfoV4List, ipInfo)
 	}
-	// 收集并排序IPv6结果
+	// 收集IPv6结果
 	ipInfoV6List := make([]*ipInfoWithSource, 0)
 	for ipInfo := range ipInfoIPv6 {
 		ipInfoV6List = append(ipInfoV6List, ipInfo)
 	}
-	// 排序顺序
-	orderMap := map[string]int{
-		"ipinfo":     0,
-		"maxmind":    1,
-		"cloudflare": 2,
-		"ipsb":       3,
-	}
-	// 按顺序处理IPv4结果
-	var ipInfoV4Result *model.IpInfo
-	for order := 0; order < len(funcNames); order++ {
-		for _, ipInfoWithSrc := range ipInfoV4List {
-			if orderMap[ipInfoWithSrc.source] == order && ipInfoWithSrc.info != nil {
-				if ipInfoV4Result == nil {
-					ipInfoV4Result = &model.IpInfo{}
-				}
-				ipInfoV4TempResult, err := utils.CompareAndMergeIpInfo(ipInfoV4Result, ipInfoWithSrc.info)
-				if err == nil {
-					ipInfoV4Result = ipInfoV4TempResult
-				} else {
-					if model.EnableLoger {
-						Logger.Info(fmt.Sprintf("utils.CompareAndMergeIpInfo(ipInfoV4Result, ipInfo): %s", err.Error()))
-					}
+	relookupDetectedIP(ctx, ipInfoV4List, providers)
+	relookupDetectedIP(ctx, ipInfoV6List, providers)
+	ipInfoV4Result := mergeIpInfoResults(ipInfoV4List, priority)
+	ipInfoV6Result := mergeIpInfoResults(ipInfoV6List, priority)
+	// 仅启用离线提供商时不发起任何在线查询
+	if allOfflineProviders(providers) {
+		return ipInfoV4Result, ipInfoV6Result, nil
+	}
+	// 如果地理信息存在但ASN缺失，使用备用方法补充ASN信息
+	if ipInfoV4Result != nil && needsASNFallback(ipInfoV4Result.Info) {
+		if model.EnableLoger {
+			Logger.Info("IPv4 ASN missing, trying fallback methods")
+		}
+		ipInfoV4Result.fillASN(ctx, "tcp4")
+	}
+	if ipInfoV6Result != nil && needsASNFallback(ipInfoV6Result.Info) {
+		if model.EnableLoger {
+			Logger.Info("IPv6 ASN missing, trying fallback methods")
+		}
+		ipInfoV6Result.fillASN(ctx, "tcp6")
+	}
+	return ipInfoV4Result, ipInfoV6Result, nil
+}
+
+// relookupDetectedIP 当其他提供商检测到的公网IP与 IPInfoLookup 提供商自身的结果不同时，
+// 使用检测到的公网IP重新查询，例如NAT环境下本机网卡上没有公网地址
+func relookupDetectedIP(ctx context.Context, list []*ipInfoWithSource, providers []IPInfoProvider) {
+	var detected string
+	for _, provider := range providers {
+		if _, ok := provider.(IPInfoLookup); ok {
+			continue
+		}
+		for _, ipInfoWithSrc := range list {
+			if ipInfoWithSrc.source == provider.Name() && ipInfoWithSrc.info != nil && ipInfoWithSrc.info.Ip != "" {
+				detected = ipInfoWithSrc.info.Ip
+				break
+			}
+		}
+		if detected != "" {
+			break
+		}
+	}
+	if detected == "" {
+		return
+	}
+	for _, provider := range providers {
+		lookup, ok := provider.(IPInfoLookup)
+		if !ok {
+			continue
+		}
+		for _, ipInfoWithSrc := range list {
+			if ipInfoWithSrc.source != provider.Name() || (ipInfoWithSrc.info != nil && ipInfoWithSrc.info.Ip == detected) {
+				continue
+			}
+			info, err := lookup.LookupIP(ctx, detected)
+			if err != nil {
+				if model.EnableLoger {
+					Logger.Info(fmt.Sprintf("%s lookup of %s failed: %s", provider.Name(), detected, err.Error()))
 				}
+				info = nil
 			}
+			ipInfoWithSrc.info = info
+		}
+	}
+}
+
+func allOfflineProviders(providers []IPInfoProvider) bool {
+	for _, provider := range providers {
+		if !isOfflineProvider(provider) {
+			return false
 		}
 	}
-	// 按顺序处理IPv6结果
-	var ipInfoV6Result *model.IpInfo
-	for order := 0; order < len(funcNames); order++ {
-		for _, ipInfoWithSrc := range ipInfoV6List {
-			if orderMap[ipInfoWithSrc.source] == order && ipInfoWithSrc.info != nil {
-				if ipInfoV6Result == nil {
-					ipInfoV6Result = &model.IpInfo{}
+	return true
+}
+
+// mergeIpInfoResults 合并同一协议族的查询结果
+// priority 按优先级从高到低排列，从最低优先级开始合并，使高优先级的非空字段最终生效
+func mergeIpInfoResults(list []*ipInfoWithSource, priority []string) *IpCheckResult {
+	var result *IpCheckResult
+	provenance := make(utils.IpInfoProvenance)
+	for order := len(priority) - 1; order >= 0; order-- {
+		for _, ipInfoWithSrc := range list {
+			if ipInfoWithSrc.source == priority[order] && ipInfoWithSrc.info != nil {
+				if result == nil {
+					result = &IpCheckResult{Info: &model.IpInfo{}}
 				}
-				ipInfoV6TempResult, err := utils.CompareAndMergeIpInfo(ipInfoV6Result, ipInfoWithSrc.info)
-				if err == nil {
-					ipInfoV6Result = ipInfoV6TempResult
-				} else {
+				merged, err := utils.CompareAndMergeIpInfoFrom(result.Info, ipInfoWithSrc.info, ipInfoWithSrc.source, provenance)
+				if err != nil {
 					if model.EnableLoger {
-						Logger.Info(fmt.Sprintf("utils.CompareAndMergeIpInfo(ipInfoV6Result, ipInfo): %s", err.Error()))
+						Logger.Info(fmt.Sprintf("utils.CompareAndMergeIpInfo(%s): %s", ipInfoWithSrc.source, err.Error()))
 					}
+					continue
 				}
+				result.Info = merged
+				result.Sources = append([]string{ipInfoWithSrc.source}, result.Sources...)
 			}
 		}
 	}
-	// 如果地理信息存在但ASN缺失，使用备用方法补充ASN信息
-	if needsASNFallback(ipInfoV4Result) {
-		if model.EnableLoger {
-			Logger.Info("IPv4 ASN missing, trying fallback methods")
+	if result == nil {
+		return nil
+	}
+	result.FieldSources = make(map[string]string)
+	for _, field := range utils.IpInfoFieldNames {
+		if source := provenance.Source(field); source != "" {
+			result.FieldSources[field] = source
+		}
+		if conflicts := provenance.Conflicts(field); len(conflicts) > 0 {
+			if result.Conflicts == nil {
+				result.Conflicts = make(map[string][]utils.SourcedValue)
+			}
+			result.Conflicts[field] = conflicts
 		}
-		ipInfoV4Result = fillASNWithFallback(ipInfoV4Result, "tcp4")
 	}
-	if needsASNFallback(ipInfoV6Result) {
-		if model.EnableLoger {
-			Logger.Info("IPv6 ASN missing, trying fallback methods")
+	return result
+}
+
+// fillASN 使用备用方法补充ASN信息，并记录补充字段的来源
+func (r *IpCheckResult) fillASN(ctx context.Context, netType string) {
+	info, filledBy := fillASNWithFallback(ctx, r.Info, netType)
+	r.Info = info
+	for _, field := range []string{"asn", "org"} {
+		source, ok := filledBy[field]
+		if !ok {
+			continue
+		}
+		r.FieldSources[field] = source
+		if !containsSource(r.Sources, source) {
+			r.Sources = append(r.Sources, source)
 		}
-		ipInfoV6Result = fillASNWithFallback(ipInfoV6Result, "tcp6")
 	}
-	return ipInfoV4Result, ipInfoV6Result, nil
+}
+
+func containsSource(sources []string, source string) bool {
+	for _, current := range sources {
+		if current == source {
+			return true
+		}
+	}
+	return false
 }
@@ -1,6 +1,7 @@
 package baseinfo
 
 import (
+	"context"
 	"sync"
 	"testing"
 	"time"
@@ -9,10 +10,10 @@ import (
 )
 
 func TestSafeFetchIPInfoRecoverPanic(t *testing.T) {
-	fetch := func(string) (*model.IpInfo, error) {
+	fetch := func(context.Context, string) (*model.IpInfo, error) {
 		panic("boom")
 	}
-	ipInfo, err := safeFetchIPInfo(fetch, "tcp4")
+	ipInfo, err := safeFetchIPInfo(context.Background(), fetch, "tcp4")
 	if err == nil {
 		t.Fatalf("expected panic to be converted to error")
 	}
@@ -23,13 +24,13 @@ func TestSafeFetchIPInfoRecoverPanic(t *testing.T) {
 
 func TestExecuteFunctionsRecoverPanic(t *testing.T) {
 	ipInfoChan := make(chan *ipInfoWithSource, 1)
-	fetch := func(string) (*model.IpInfo, error) {
+	fetch := func(context.Context, string) (*model.IpInfo, error) {
 		panic("boom")
 	}
 
 	var wg sync.WaitGroup
 	wg.Add(1)
-	go executeFunctions("ipv4", fetch, "panicfetch", ipInfoChan, &wg)
+	go executeFunctions(context.Background(), "ipv4", fetch, "panicfetch", ipInfoChan, &wg)
 
 	done := make(chan struct{})
 	go func() {
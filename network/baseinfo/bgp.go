@@ -2,6 +2,7 @@ package baseinfo
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"image/color"
@@ -19,8 +20,15 @@ import (
 	. "github.com/oneclickvirt/defaultset"
 )
 
-// GetCIDRPrefix
+// GetCIDRPrefix 查询IP所在的BGP前缀，失败时返回 "", -1
+//
+// Deprecated: 请使用 GetCIDRPrefixContext，以便调用方取消请求。
 func GetCIDRPrefix(ip string) (string, int) {
+	return GetCIDRPrefixContext(context.Background(), ip)
+}
+
+// GetCIDRPrefixContext 查询IP所在的BGP前缀，失败时返回 "", -1
+func GetCIDRPrefixContext(ctx context.Context, ip string) (string, int) {
 	if model.EnableLoger {
 		InitLogger()
 		defer Logger.Sync()
@@ -28,7 +36,7 @@ func GetCIDRPrefix(ip string) (string, int) {
 	client := req.C()
 	client.ImpersonateChrome()
 	client.SetTimeout(6 * time.Second)
-	cidrIp, cidrPrefix, err := fetchCIDRFromBGPToolsAndHe(client, ip)
+	cidrIp, cidrPrefix, err := fetchCIDRFromBGPToolsAndHe(ctx, client, ip)
 	if err == nil && cidrPrefix > 0 {
 		return cidrIp, cidrPrefix
 	}
@@ -41,10 +49,10 @@ func GetCIDRPrefix(ip string) (string, int) {
 }
 
 // fetchCIDRFromBGPToolsAndHe 通过 BGP Tools 和 HE 查询 CIDR 前缀
-func fetchCIDRFromBGPToolsAndHe(client *req.Client, ip string) (string, int, error) {
+func fetchCIDRFromBGPToolsAndHe(ctx context.Context, client *req.Client, ip string) (string, int, error) {
 	// 先尝试从 HE 获取 CIDR
 	heURL := fmt.Sprintf("https://bgp.he.net/whois/ip/%s", ip)
-	heResp, err := client.R().Get(heURL)
+	heResp, err := client.R().SetContext(ctx).Get(heURL)
 	if err == nil && heResp.IsSuccessState() {
 		cidr := parseCIDRFromHE(heResp.String())
 		if cidrIP, cidrPrefix, parseErr := parseCIDR(cidr); parseErr == nil {
@@ -53,7 +61,7 @@ func fetchCIDRFromBGPToolsAndHe(client *req.Client, ip string) (string, int, err
 	}
 	// 如果 HE 解析失败，尝试从 BGP Tools 获取 CIDR
 	bgpURL := fmt.Sprintf("https://bgp.tools/prefix/%s", ip)
-	bgpResp, err := client.R().Get(bgpURL)
+	bgpResp, err := client.R().SetContext(ctx).Get(bgpURL)
 	if err != nil {
 		return "", -1, err
 	}
@@ -138,7 +146,14 @@ func MaskIP(ipStr string) string {
 	return ""
 }
 
+// GetActiveIpsCount 统计IP所在前缀内的活跃IP数
+//
+// Deprecated: 请使用 GetActiveIpsCountContext，以便调用方取消请求。
 func GetActiveIpsCount(ip string, prefixNum int) (int, int, error) {
+	return GetActiveIpsCountContext(context.Background(), ip, prefixNum)
+}
+
+func GetActiveIpsCountContext(ctx context.Context, ip string, prefixNum int) (int, int, error) {
 	if ip == "" {
 		return 0, 0, fmt.Errorf("IP address cannot be empty")
 	}
@@ -149,15 +164,15 @@ func GetActiveIpsCount(ip string, prefixNum int) (int, int, error) {
 	client.ImpersonateChrome()
 	cidrBase := fmt.Sprintf("%s/%d", ip, prefixNum)
 	total := int(math.Pow(2, float64(32-prefixNum)))
-	active, err := countActiveIPs(client, fmt.Sprintf("https://bgp.tools/pfximg/%s", cidrBase), total)
+	active, err := countActiveIPs(ctx, client, fmt.Sprintf("https://bgp.tools/pfximg/%s", cidrBase), total)
 	if err != nil {
 		return 0, 0, err
 	}
 	return active, total, nil
 }
 
-func countActiveIPs(client *req.Client, url string, total int) (int, error) {
-	resp, err := client.R().Get(url)
+func countActiveIPs(ctx context.Context, client *req.Client, url string, total int) (int, error) {
+	resp, err := client.R().SetContext(ctx).Get(url)
 	if err != nil {
 		return 0, err
 	}
@@ -1,6 +1,15 @@
 package baseinfo
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3"
+)
 
 func TestParseCIDRValid(t *testing.T) {
 	ip, prefix, err := parseCIDR("1.2.3.0/24")
@@ -42,3 +51,16 @@ func TestParseCIDRFromBGPToolsNoMatch(t *testing.T) {
 		t.Fatalf("expected empty cidr, got %q", got)
 	}
 }
+
+func TestCountActiveIPsAbortsWhenContextCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := countActiveIPs(ctx, req.C(), server.URL, 256); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
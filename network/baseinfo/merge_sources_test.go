@@ -0,0 +1,62 @@
+package baseinfo
+
+import (
+	"testing"
+
+	"github.com/oneclickvirt/basics/model"
+)
+
+func TestMergeIpInfoResultsRecordsFieldSources(t *testing.T) {
+	priority := []string{"ipsb", "cloudflare", "maxmind", "ipinfo"}
+	list := []*ipInfoWithSource{
+		{source: "cloudflare", info: &model.IpInfo{Ip: "203.0.113.7", City: "Amsterdam"}},
+		{source: "maxmind", info: nil},
+		{source: "ipinfo", info: &model.IpInfo{Ip: "203.0.113.7", ASN: "AS64500", Country: "NL"}},
+	}
+	result := mergeIpInfoResults(list, priority)
+	if result == nil || result.Info.ASN != "AS64500" || result.Info.City != "Amsterdam" {
+		t.Fatalf("unexpected merge result: %+v", result)
+	}
+	if len(result.Sources) != 2 || result.Sources[0] != "cloudflare" || result.Sources[1] != "ipinfo" {
+		t.Fatalf("unexpected sources: %v", result.Sources)
+	}
+	want := map[string]string{"ip": "cloudflare", "asn": "ipinfo", "country": "ipinfo", "city": "cloudflare"}
+	if len(result.FieldSources) != len(want) {
+		t.Fatalf("unexpected field sources: %v", result.FieldSources)
+	}
+	for field, source := range want {
+		if result.FieldSources[field] != source {
+			t.Fatalf("field %s: expected %s, got %s", field, source, result.FieldSources[field])
+		}
+	}
+}
+
+func TestMergeIpInfoResultsWithoutAnswers(t *testing.T) {
+	if result := mergeIpInfoResults([]*ipInfoWithSource{{source: "ipinfo"}}, []string{"ipinfo"}); result != nil {
+		t.Fatalf("expected nil result, got %+v", result)
+	}
+}
+
+func TestMergeIpInfoResultsRecordsConflicts(t *testing.T) {
+	priority := []string{"ipinfo", "cloudflare", "ipsb"}
+	list := []*ipInfoWithSource{
+		{source: "ipsb", info: &model.IpInfo{ASN: "64500", Country: "NL", City: "Rotterdam"}},
+		{source: "cloudflare", info: &model.IpInfo{ASN: "64500", Country: "DE", City: "Amsterdam"}},
+		{source: "ipinfo", info: &model.IpInfo{ASN: "AS64500", Country: "nl ", City: "Amsterdam"}},
+	}
+	result := mergeIpInfoResults(list, priority)
+	if result.Info.Country != "nl " || result.FieldSources["country"] != "ipinfo" {
+		t.Fatalf("unexpected merge result: %+v %v", result.Info, result.FieldSources)
+	}
+	// ASN prefixes and case differences are not disagreements; values that
+	// agree with the winner are not listed.
+	if len(result.Conflicts) != 2 || result.Conflicts["asn"] != nil {
+		t.Fatalf("unexpected conflicts: %v", result.Conflicts)
+	}
+	if country := result.Conflicts["country"]; len(country) != 1 || country[0].Source != "cloudflare" || country[0].Value != "DE" {
+		t.Fatalf("unexpected country conflicts: %v", country)
+	}
+	if city := result.Conflicts["city"]; len(city) != 1 || city[0].Source != "ipsb" || city[0].Value != "Rotterdam" {
+		t.Fatalf("unexpected city conflicts: %v", city)
+	}
+}
@@ -0,0 +1,148 @@
+package baseinfo
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strconv"
+
+	"github.com/oneclickvirt/basics/model"
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// MMDBProviderName 本地 MMDB 提供商在配置与来源标注中使用的名称
+const MMDBProviderName = "mmdb"
+
+// MMDBProvider 使用本地 MaxMind 格式数据库(City 与 ASN)查询IP信息，不发起任何网络请求
+// 单独使用时以本机网卡上的公网地址作为查询对象；与在线提供商同时启用时，
+// 会改用在线提供商检测到的公网IP重新查询
+type MMDBProvider struct {
+	city *maxminddb.Reader
+	asn  *maxminddb.Reader
+}
+
+// mmdbCityRecord GeoIP2/GeoLite2 City 数据库中使用到的字段
+type mmdbCityRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	Country struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+}
+
+// mmdbASNRecord GeoIP2/GeoLite2 ASN 数据库中使用到的字段
+type mmdbASNRecord struct {
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+}
+
+// NewMMDBProvider 打开 City 与 ASN 数据库，两者至少提供一个
+func NewMMDBProvider(cityPath, asnPath string) (*MMDBProvider, error) {
+	if cityPath == "" && asnPath == "" {
+		return nil, fmt.Errorf("mmdb provider requires a City or ASN database")
+	}
+	provider := &MMDBProvider{}
+	if cityPath != "" {
+		reader, err := maxminddb.Open(cityPath)
+		if err != nil {
+			return nil, fmt.Errorf("open City database %s: %w", cityPath, err)
+		}
+		provider.city = reader
+	}
+	if asnPath != "" {
+		reader, err := maxminddb.Open(asnPath)
+		if err != nil {
+			provider.Close()
+			return nil, fmt.Errorf("open ASN database %s: %w", asnPath, err)
+		}
+		provider.asn = reader
+	}
+	return provider, nil
+}
+
+// Close 关闭已打开的数据库
+func (p *MMDBProvider) Close() error {
+	var firstErr error
+	for _, reader := range []*maxminddb.Reader{p.city, p.asn} {
+		if reader == nil {
+			continue
+		}
+		if err := reader.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (p *MMDBProvider) Name() string {
+	return MMDBProviderName
+}
+
+func (p *MMDBProvider) Families() []string {
+	return []string{"ipv4", "ipv6"}
+}
+
+// Offline 标记该提供商不需要网络访问
+func (p *MMDBProvider) Offline() bool {
+	return true
+}
+
+// Fetch 查询本机网卡上 family 协议族的公网地址
+func (p *MMDBProvider) Fetch(ctx context.Context, family string) (*model.IpInfo, error) {
+	addr, err := localPublicAddress(family)
+	if err != nil {
+		return nil, err
+	}
+	return p.LookupIP(ctx, addr.String())
+}
+
+// LookupIP 在本地数据库中查询指定IP
+func (p *MMDBProvider) LookupIP(ctx context.Context, ip string) (*model.IpInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP address %q", ip)
+	}
+	addr = addr.Unmap()
+	res := &model.IpInfo{Ip: addr.String()}
+	found := false
+	if p.city != nil {
+		var record mmdbCityRecord
+		result := p.city.Lookup(addr)
+		if err := result.Decode(&record); err != nil {
+			return nil, fmt.Errorf("City database lookup for %s: %w", ip, err)
+		}
+		if result.Found() {
+			found = true
+			res.City = record.City.Names["en"]
+			if len(record.Subdivisions) > 0 {
+				res.Region = record.Subdivisions[0].Names["en"]
+			}
+			res.Country = record.Country.Names["en"]
+		}
+	}
+	if p.asn != nil {
+		var record mmdbASNRecord
+		result := p.asn.Lookup(addr)
+		if err := result.Decode(&record); err != nil {
+			return nil, fmt.Errorf("ASN database lookup for %s: %w", ip, err)
+		}
+		if result.Found() {
+			found = true
+			if record.AutonomousSystemNumber != 0 {
+				res.ASN = strconv.FormatUint(uint64(record.AutonomousSystemNumber), 10)
+			}
+			res.Org = record.AutonomousSystemOrganization
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%s not found in mmdb databases", ip)
+	}
+	return res, nil
+}
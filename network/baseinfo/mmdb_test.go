@@ -0,0 +1,266 @@
+package baseinfo
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/oneclickvirt/basics/model"
+)
+
+// writeTestMMDB writes a minimal IPv6 MaxMind DB (record size 24) mapping each
+// prefix to its record. IPv4 prefixes are stored under ::/96 as real databases do.
+func writeTestMMDB(t *testing.T, databaseType string, records map[string]map[string]any) string {
+	t.Helper()
+	type node struct{ child, data [2]int }
+	nodes := []node{{child: [2]int{-1, -1}, data: [2]int{-1, -1}}}
+	var data bytes.Buffer
+	prefixes := make([]string, 0, len(records))
+	for prefix := range records {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, value := range prefixes {
+		prefix := netip.MustParsePrefix(value)
+		bits := prefix.Bits()
+		addr := prefix.Addr().As16()
+		if prefix.Addr().Is4() {
+			bits += 96
+			addr = netip.AddrFrom16(addr).As16()
+			copy(addr[:12], make([]byte, 12))
+		}
+		offset := data.Len()
+		encodeMMDBValue(&data, records[value])
+		current := 0
+		for depth := 0; depth < bits; depth++ {
+			bit := int(addr[depth/8]>>(7-depth%8)) & 1
+			if depth == bits-1 {
+				nodes[current].data[bit] = offset
+				break
+			}
+			if nodes[current].child[bit] < 0 {
+				nodes = append(nodes, node{child: [2]int{-1, -1}, data: [2]int{-1, -1}})
+				nodes[current].child[bit] = len(nodes) - 1
+			}
+			current = nodes[current].child[bit]
+		}
+	}
+	var out bytes.Buffer
+	nodeCount := len(nodes)
+	for _, n := range nodes {
+		for side := 0; side < 2; side++ {
+			record := nodeCount
+			if n.child[side] >= 0 {
+				record = n.child[side]
+			} else if n.data[side] >= 0 {
+				record = nodeCount + 16 + n.data[side]
+			}
+			out.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xab\xcd\xefMaxMind.com")
+	encodeMMDBValue(&out, map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"database_type":               databaseType,
+		"description":                 map[string]any{"en": "test"},
+		"ip_version":                  uint16(6),
+		"languages":                   []any{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+	})
+	path := filepath.Join(t.TempDir(), databaseType+".mmdb")
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func encodeMMDBValue(buf *bytes.Buffer, value any) {
+	control := func(kind, size int) {
+		// Sizes up to 284 are enough for these fixtures.
+		sizeBits, extra := size, []byte(nil)
+		if size >= 29 {
+			sizeBits, extra = 29, []byte{byte(size - 29)}
+		}
+		if kind <= 7 {
+			buf.WriteByte(byte(kind<<5 | sizeBits))
+		} else {
+			buf.WriteByte(byte(sizeBits))
+			buf.WriteByte(byte(kind - 7))
+		}
+		buf.Write(extra)
+	}
+	unsigned := func(kind int, v uint64) {
+		var raw [8]byte
+		binary.BigEndian.PutUint64(raw[:], v)
+		trimmed := bytes.TrimLeft(raw[:], "\x00")
+		control(kind, len(trimmed))
+		buf.Write(trimmed)
+	}
+	switch v := value.(type) {
+	case string:
+		control(2, len(v))
+		buf.WriteString(v)
+	case uint16:
+		unsigned(5, uint64(v))
+	case uint32:
+		unsigned(6, uint64(v))
+	case uint64:
+		unsigned(9, v)
+	case []any:
+		control(11, len(v))
+		for _, item := range v {
+			encodeMMDBValue(buf, item)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		control(7, len(keys))
+		for _, key := range keys {
+			encodeMMDBValue(buf, key)
+			encodeMMDBValue(buf, v[key])
+		}
+	}
+}
+
+func names(en string) map[string]any {
+	return map[string]any{"names": map[string]any{"en": en}}
+}
+
+func writeTestMMDBPair(t *testing.T) (string, string) {
+	t.Helper()
+	city := writeTestMMDB(t, "GeoLite2-City", map[string]map[string]any{
+		"203.0.113.0/24": {"city": names("Amsterdam"), "country": names("Netherlands"), "subdivisions": []any{names("North Holland")}},
+		"2001:db8::/32":  {"city": names("Frankfurt"), "country": names("Germany")},
+	})
+	asn := writeTestMMDB(t, "GeoLite2-ASN", map[string]map[string]any{
+		"203.0.113.0/24":  {"autonomous_system_number": uint32(64500), "autonomous_system_organization": "Example Net"},
+		"198.51.100.0/24": {"autonomous_system_number": uint32(64501), "autonomous_system_organization": "NAT Gateway"},
+	})
+	return city, asn
+}
+
+func TestMMDBProviderLookupIP(t *testing.T) {
+	cityPath, asnPath := writeTestMMDBPair(t)
+	provider, err := NewMMDBProvider(cityPath, asnPath)
+	if err != nil {
+		t.Fatalf("NewMMDBProvider: %v", err)
+	}
+	defer provider.Close()
+	info, err := provider.LookupIP(context.Background(), "203.0.113.7")
+	if err != nil {
+		t.Fatalf("LookupIP: %v", err)
+	}
+	want := model.IpInfo{Ip: "203.0.113.7", ASN: "64500", Org: "Example Net", Country: "Netherlands", Region: "North Holland", City: "Amsterdam"}
+	if *info != want {
+		t.Fatalf("unexpected lookup result: %+v", info)
+	}
+	info, err = provider.LookupIP(context.Background(), "2001:db8::7")
+	if err != nil || info.City != "Frankfurt" || info.ASN != "" {
+		t.Fatalf("unexpected ipv6 lookup result: %+v, %v", info, err)
+	}
+	if _, err := provider.LookupIP(context.Background(), "192.0.2.1"); err == nil {
+		t.Fatal("expected an address outside the databases to be reported as not found")
+	}
+}
+
+func TestMMDBProviderFetchUsesLocalPublicAddress(t *testing.T) {
+	cityPath, asnPath := writeTestMMDBPair(t)
+	provider, err := NewMMDBProvider(cityPath, asnPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer provider.Close()
+	old := interfaceAddrs
+	t.Cleanup(func() { interfaceAddrs = old })
+	interfaceAddrs = func() ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+			&net.IPNet{IP: net.ParseIP("10.0.0.5"), Mask: net.CIDRMask(8, 32)},
+			&net.IPNet{IP: net.ParseIP("100.64.0.9"), Mask: net.CIDRMask(10, 32)},
+			&net.IPNet{IP: net.ParseIP("203.0.113.7"), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+		}, nil
+	}
+	info, err := provider.Fetch(context.Background(), "ipv4")
+	if err != nil || info.Ip != "203.0.113.7" || info.ASN != "64500" {
+		t.Fatalf("unexpected fetch result: %+v, %v", info, err)
+	}
+	if _, err := provider.Fetch(context.Background(), "ipv6"); err == nil || !strings.Contains(err.Error(), "no public ipv6 address") {
+		t.Fatalf("expected missing ipv6 address error, got %v", err)
+	}
+}
+
+func TestRunIpCheckWithOnlyMMDBMakesNoOnlineCalls(t *testing.T) {
+	restoreIPInfoConfig(t)
+	cityPath, _ := writeTestMMDBPair(t)
+	old := interfaceAddrs
+	t.Cleanup(func() { interfaceAddrs = old })
+	interfaceAddrs = func() ([]net.Addr, error) {
+		return []net.Addr{&net.IPNet{IP: net.ParseIP("203.0.113.7"), Mask: net.CIDRMask(24, 32)}}, nil
+	}
+	// Only a City database: geo is present and ASN is missing, which would
+	// normally trigger the online ASN fallback.
+	if err := SetIPInfoConfig(IPInfoConfig{Providers: []string{MMDBProviderName}, MMDBCityPath: cityPath}); err != nil {
+		t.Fatalf("SetIPInfoConfig: %v", err)
+	}
+	if !HasOfflineIPInfoProvider() {
+		t.Fatal("expected the mmdb provider to be reported as offline")
+	}
+	ipv4, _, err := RunIpCheckWithSourcesContext(context.Background(), "ipv4")
+	if err != nil || ipv4 == nil || ipv4.Info.City != "Amsterdam" || ipv4.Info.ASN != "" {
+		t.Fatalf("unexpected offline result: %+v, %v", ipv4, err)
+	}
+	if strings.Join(ipv4.Sources, ",") != MMDBProviderName {
+		t.Fatalf("expected only the mmdb source, got %v", ipv4.Sources)
+	}
+}
+
+func TestRunIpCheckRelooksUpMMDBWithDetectedIP(t *testing.T) {
+	cityPath, asnPath := writeTestMMDBPair(t)
+	restoreIPInfoConfig(t)
+	old := interfaceAddrs
+	t.Cleanup(func() { interfaceAddrs = old })
+	interfaceAddrs = func() ([]net.Addr, error) {
+		return []net.Addr{&net.IPNet{IP: net.ParseIP("203.0.113.7"), Mask: net.CIDRMask(24, 32)}}, nil
+	}
+	online := newJSONServer(t, `{"ip":"198.51.100.20","country":"NL","org":"AS64501 NAT Gateway"}`)
+	if err := SetIPInfoConfig(IPInfoConfig{
+		Providers:    []string{"ipinfo", MMDBProviderName},
+		BaseURLs:     map[string]string{"ipinfo": online.URL},
+		MMDBCityPath: cityPath,
+		MMDBASNPath:  asnPath,
+	}); err != nil {
+		t.Fatalf("SetIPInfoConfig: %v", err)
+	}
+	ipv4, _, err := RunIpCheckWithSourcesContext(context.Background(), "ipv4")
+	if err != nil || ipv4 == nil {
+		t.Fatalf("unexpected result: %+v, %v", ipv4, err)
+	}
+	if ipv4.Info.Ip != "198.51.100.20" || ipv4.Info.City != "" || ipv4.Info.ASN != "AS64501" {
+		t.Fatalf("expected the mmdb provider to look up the detected IP, got %+v", ipv4.Info)
+	}
+}
+
+func TestMMDBProviderConfigValidation(t *testing.T) {
+	if err := (IPInfoConfig{Providers: []string{MMDBProviderName}}).Validate(); err == nil {
+		t.Fatal("expected mmdb without databases to be rejected")
+	}
+	if err := (IPInfoConfig{MMDBCityPath: filepath.Join(t.TempDir(), "missing.mmdb")}).Validate(); err == nil {
+		t.Fatal("expected a missing database to be rejected")
+	}
+}
@@ -0,0 +1,321 @@
+package baseinfo
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/oneclickvirt/basics/model"
+	"github.com/oneclickvirt/basics/network/utils"
+)
+
+// IPInfoProvider 公网IP信息提供商
+// RunIpCheckContext 对每个启用的提供商按其支持的协议族并发调用 Fetch
+type IPInfoProvider interface {
+	// Name 提供商名称，用于配置、优先级排序与来源标注
+	Name() string
+	// Families 支持的协议族，取值为 "ipv4" 或 "ipv6"
+	Families() []string
+	// Fetch 通过 family 协议族查询本机的公网IP信息，ctx 结束时应尽快返回
+	Fetch(ctx context.Context, family string) (*model.IpInfo, error)
+}
+
+// IPInfoLookup 由可以直接查询指定IP的提供商实现，例如本地 MMDB 数据库
+// 当其他提供商检测到的公网IP与其自身检测结果不同时，RunIpCheckContext 会用该IP重新查询
+type IPInfoLookup interface {
+	LookupIP(ctx context.Context, ip string) (*model.IpInfo, error)
+}
+
+// offlineIPInfoProvider 由不需要网络访问的提供商实现
+type offlineIPInfoProvider interface {
+	Offline() bool
+}
+
+// IPInfoConfig 控制 RunIpCheckContext 使用哪些提供商及其查询地址
+type IPInfoConfig struct {
+	// Providers 启用的提供商，按优先级从高到低排列；为空时使用默认顺序
+	Providers []string
+	// BaseURLs 按提供商名称覆盖内置提供商的查询地址
+	BaseURLs map[string]string
+	// MMDBCityPath 与 MMDBASNPath 为本地 MaxMind 格式数据库，设置任一项即启用 mmdb 提供商
+	MMDBCityPath string
+	MMDBASNPath  string
+}
+
+// httpIPInfoProvider 通过 HTTP JSON 接口查询的内置提供商
+type httpIPInfoProvider struct {
+	name             string
+	baseURL          string
+	enableHeader     bool
+	additionalHeader string
+	parse            func(map[string]interface{}) *model.IpInfo
+}
+
+func (p httpIPInfoProvider) Name() string {
+	return p.name
+}
+
+func (p httpIPInfoProvider) Families() []string {
+	return []string{"ipv4", "ipv6"}
+}
+
+func (p httpIPInfoProvider) Fetch(ctx context.Context, family string) (*model.IpInfo, error) {
+	netType, err := familyNetType(family)
+	if err != nil {
+		return nil, err
+	}
+	return fetchHTTPIPInfo(ctx, p, netType)
+}
+
+func fetchHTTPIPInfo(ctx context.Context, p httpIPInfoProvider, netType string) (*model.IpInfo, error) {
+	data, err := utils.FetchJsonFromURLContext(ctx, p.baseURL, netType, p.enableHeader, p.additionalHeader)
+	if err != nil {
+		return nil, err
+	}
+	return p.parse(data), nil
+}
+
+// familyNetType 将协议族转换为 FetchJsonFromURLContext 使用的网络类型
+func familyNetType(family string) (string, error) {
+	switch family {
+	case "ipv4":
+		return "tcp4", nil
+	case "ipv6":
+		return "tcp6", nil
+	}
+	return "", fmt.Errorf("unsupported IP family: %s", family)
+}
+
+var (
+	ipInfoIoProvider   = httpIPInfoProvider{name: "ipinfo", baseURL: "http://ipinfo.io", parse: parseIPInfoIo}
+	maxMindProvider    = httpIPInfoProvider{name: "maxmind", baseURL: "https://geoip.maxmind.com/geoip/v2.1/city/me", enableHeader: true, additionalHeader: "Referer: https://www.maxmind.com/en/locate-my-ip-address", parse: parseMaxMind}
+	cloudFlareProvider = httpIPInfoProvider{name: "cloudflare", baseURL: "https://speed.cloudflare.com/meta", parse: parseCloudFlare}
+	ipSbProvider       = httpIPInfoProvider{name: "ipsb", baseURL: "https://api.ip.sb/geoip", enableHeader: true, parse: parseIpSb}
+)
+
+// defaultIPInfoProviderOrder 默认优先级，从高到低
+// 合并时高优先级提供商的非空字段覆盖低优先级提供商的字段
+var defaultIPInfoProviderOrder = []string{"ipsb", "cloudflare", "maxmind", "ipinfo"}
+
+var ipInfoRegistry = struct {
+	sync.RWMutex
+	providers map[string]IPInfoProvider
+	// names 记录注册顺序，未在默认顺序中的提供商按此顺序排在最后
+	names  []string
+	config IPInfoConfig
+	// mmdb 缓存按 mmdbPaths 打开的本地数据库
+	mmdb      *MMDBProvider
+	mmdbPaths [2]string
+}{
+	providers: map[string]IPInfoProvider{
+		ipInfoIoProvider.name:   ipInfoIoProvider,
+		maxMindProvider.name:    maxMindProvider,
+		cloudFlareProvider.name: cloudFlareProvider,
+		ipSbProvider.name:       ipSbProvider,
+	},
+	names: []string{ipInfoIoProvider.name, maxMindProvider.name, cloudFlareProvider.name, ipSbProvider.name},
+}
+
+// RegisterIPInfoProvider 注册额外的提供商
+// 未显式配置 Providers 时，额外的提供商以最低优先级参与查询
+func RegisterIPInfoProvider(provider IPInfoProvider) error {
+	if provider == nil {
+		return fmt.Errorf("IP info provider is nil")
+	}
+	name := provider.Name()
+	if strings.TrimSpace(name) == "" || strings.ContainsAny(name, ",= ") {
+		return fmt.Errorf("invalid IP info provider name %q", name)
+	}
+	ipInfoRegistry.Lock()
+	defer ipInfoRegistry.Unlock()
+	if _, exists := ipInfoRegistry.providers[name]; exists {
+		return fmt.Errorf("IP info provider %q is already registered", name)
+	}
+	ipInfoRegistry.providers[name] = provider
+	ipInfoRegistry.names = append(ipInfoRegistry.names, name)
+	return nil
+}
+
+// UnregisterIPInfoProvider 移除已注册的提供商
+func UnregisterIPInfoProvider(name string) {
+	ipInfoRegistry.Lock()
+	defer ipInfoRegistry.Unlock()
+	delete(ipInfoRegistry.providers, name)
+	for i, current := range ipInfoRegistry.names {
+		if current == name {
+			ipInfoRegistry.names = append(ipInfoRegistry.names[:i:i], ipInfoRegistry.names[i+1:]...)
+			break
+		}
+	}
+}
+
+// IPInfoProviderNames 按默认优先级列出所有已注册的提供商
+func IPInfoProviderNames() []string {
+	ipInfoRegistry.RLock()
+	defer ipInfoRegistry.RUnlock()
+	return defaultProviderNamesLocked()
+}
+
+func defaultProviderNamesLocked() []string {
+	names := make([]string, 0, len(ipInfoRegistry.names))
+	for _, name := range defaultIPInfoProviderOrder {
+		if _, ok := ipInfoRegistry.providers[name]; ok {
+			names = append(names, name)
+		}
+	}
+	for _, name := range ipInfoRegistry.names {
+		if !containsSource(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ParseIPInfoConfig 解析命令行参数形式的提供商配置
+// providers 为逗号分隔的提供商名称，baseURLs 为逗号分隔的 name=url
+func ParseIPInfoConfig(providers, baseURLs string) (IPInfoConfig, error) {
+	var config IPInfoConfig
+	for _, name := range strings.Split(providers, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" && !containsSource(config.Providers, name) {
+			config.Providers = append(config.Providers, name)
+		}
+	}
+	for _, entry := range strings.Split(baseURLs, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, baseURL, ok := strings.Cut(entry, "=")
+		if !ok {
+			return IPInfoConfig{}, fmt.Errorf("invalid IP info provider URL %q, expected name=url", entry)
+		}
+		if config.BaseURLs == nil {
+			config.BaseURLs = make(map[string]string)
+		}
+		config.BaseURLs[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(baseURL)
+	}
+	return config, nil
+}
+
+// Validate 检查配置中的提供商是否已注册、查询地址是否有效
+func (c IPInfoConfig) Validate() error {
+	ipInfoRegistry.Lock()
+	defer ipInfoRegistry.Unlock()
+	_, err := resolveIPInfoProvidersLocked(c)
+	return err
+}
+
+// SetIPInfoConfig 设置后续 RunIpCheckContext 使用的提供商配置
+func SetIPInfoConfig(config IPInfoConfig) error {
+	ipInfoRegistry.Lock()
+	defer ipInfoRegistry.Unlock()
+	if _, err := resolveIPInfoProvidersLocked(config); err != nil {
+		return err
+	}
+	ipInfoRegistry.config = config
+	return nil
+}
+
+// ResolveIPInfoProviders 按配置返回启用的提供商，按优先级从高到低排列
+func ResolveIPInfoProviders(config IPInfoConfig) ([]IPInfoProvider, error) {
+	ipInfoRegistry.Lock()
+	defer ipInfoRegistry.Unlock()
+	return resolveIPInfoProvidersLocked(config)
+}
+
+// HasOfflineIPInfoProvider 当前配置是否启用了不需要网络访问的提供商
+func HasOfflineIPInfoProvider() bool {
+	providers, err := configuredIPInfoProviders()
+	if err != nil {
+		return false
+	}
+	for _, provider := range providers {
+		if isOfflineProvider(provider) {
+			return true
+		}
+	}
+	return false
+}
+
+func isOfflineProvider(provider IPInfoProvider) bool {
+	offline, ok := provider.(offlineIPInfoProvider)
+	return ok && offline.Offline()
+}
+
+func configuredIPInfoProviders() ([]IPInfoProvider, error) {
+	// 解析时可能需要打开并缓存 mmdb 数据库，因此使用写锁
+	ipInfoRegistry.Lock()
+	defer ipInfoRegistry.Unlock()
+	return resolveIPInfoProvidersLocked(ipInfoRegistry.config)
+}
+
+func resolveIPInfoProvidersLocked(config IPInfoConfig) ([]IPInfoProvider, error) {
+	mmdbConfigured := config.MMDBCityPath != "" || config.MMDBASNPath != ""
+	names := config.Providers
+	if len(names) == 0 {
+		names = defaultProviderNamesLocked()
+		if mmdbConfigured {
+			names = append(names, MMDBProviderName)
+		}
+	}
+	var unknown []string
+	for _, name := range names {
+		if name == MMDBProviderName {
+			if !mmdbConfigured {
+				return nil, fmt.Errorf("mmdb provider requires a City or ASN database")
+			}
+			continue
+		}
+		if _, ok := ipInfoRegistry.providers[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	for name := range config.BaseURLs {
+		if _, ok := ipInfoRegistry.providers[name]; !ok && !containsSource(unknown, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown IP info providers: %s (known: %s)", strings.Join(unknown, ","), strings.Join(defaultProviderNamesLocked(), ","))
+	}
+	providers := make([]IPInfoProvider, 0, len(names))
+	for _, name := range names {
+		if name == MMDBProviderName && mmdbConfigured {
+			provider, err := openMMDBProviderLocked(config.MMDBCityPath, config.MMDBASNPath)
+			if err != nil {
+				return nil, err
+			}
+			providers = append(providers, provider)
+			continue
+		}
+		provider := ipInfoRegistry.providers[name]
+		if baseURL, ok := config.BaseURLs[name]; ok {
+			httpProvider, ok := provider.(httpIPInfoProvider)
+			if !ok {
+				return nil, fmt.Errorf("IP info provider %q does not support a custom URL", name)
+			}
+			if parsed, err := url.Parse(baseURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return nil, fmt.Errorf("invalid URL for IP info provider %q: %q", name, baseURL)
+			}
+			httpProvider.baseURL = baseURL
+			provider = httpProvider
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+// openMMDBProviderLocked 复用已按相同路径打开的数据库
+func openMMDBProviderLocked(cityPath, asnPath string) (*MMDBProvider, error) {
+	paths := [2]string{cityPath, asnPath}
+	if ipInfoRegistry.mmdb != nil && ipInfoRegistry.mmdbPaths == paths {
+		return ipInfoRegistry.mmdb, nil
+	}
+	provider, err := NewMMDBProvider(cityPath, asnPath)
+	if err != nil {
+		return nil, err
+	}
+	ipInfoRegistry.mmdb, ipInfoRegistry.mmdbPaths = provider, paths
+	return provider, nil
+}
@@ -0,0 +1,160 @@
+package baseinfo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/oneclickvirt/basics/model"
+)
+
+func newJSONServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func restoreIPInfoConfig(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		if err := SetIPInfoConfig(IPInfoConfig{}); err != nil {
+			t.Fatalf("reset IP info config: %v", err)
+		}
+	})
+}
+
+func TestRunIpCheckUsesConfiguredProvidersAndPriority(t *testing.T) {
+	restoreIPInfoConfig(t)
+	ipinfo := newJSONServer(t, `{"ip":"203.0.113.7","city":"Amsterdam","country":"NL","org":"AS64500 Example Net"}`)
+	cloudflare := newJSONServer(t, `{"clientIp":"203.0.113.7","city":"Rotterdam","region":"South Holland","asn":64500}`)
+	if err := SetIPInfoConfig(IPInfoConfig{
+		Providers: []string{"ipinfo", "cloudflare"},
+		BaseURLs:  map[string]string{"ipinfo": ipinfo.URL, "cloudflare": cloudflare.URL},
+	}); err != nil {
+		t.Fatalf("SetIPInfoConfig: %v", err)
+	}
+	ipv4, ipv6, err := RunIpCheckWithSourcesContext(context.Background(), "ipv4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ipv6 != nil {
+		t.Fatalf("expected no ipv6 result, got %+v", ipv6)
+	}
+	if ipv4 == nil || ipv4.Info.City != "Amsterdam" || ipv4.Info.Region != "South Holland" || ipv4.Info.Org != "Example Net" {
+		t.Fatalf("expected ipinfo to win conflicts and cloudflare to fill gaps, got %+v", ipv4)
+	}
+	if ipv4.FieldSources["city"] != "ipinfo" || ipv4.FieldSources["region"] != "cloudflare" {
+		t.Fatalf("unexpected field sources: %v", ipv4.FieldSources)
+	}
+	if strings.Join(ipv4.Sources, ",") != "ipinfo,cloudflare" {
+		t.Fatalf("unexpected sources: %v", ipv4.Sources)
+	}
+}
+
+type stubIPInfoProvider struct {
+	name     string
+	families []string
+	info     *model.IpInfo
+	err      error
+	mu       sync.Mutex
+	calls    []string
+}
+
+func (p *stubIPInfoProvider) Name() string       { return p.name }
+func (p *stubIPInfoProvider) Families() []string { return p.families }
+func (p *stubIPInfoProvider) Fetch(ctx context.Context, family string) (*model.IpInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, family)
+	return p.info, p.err
+}
+
+func TestRunIpCheckWithProvidersSkipsUnsupportedFamilies(t *testing.T) {
+	v4Only := &stubIPInfoProvider{name: "v4only", families: []string{"ipv4"}, info: &model.IpInfo{Ip: "203.0.113.7", ASN: "64500"}}
+	failing := &stubIPInfoProvider{name: "failing", families: []string{"ipv4", "ipv6"}, err: errors.New("blocked")}
+	ipv4, ipv6, err := RunIpCheckWithProviders(context.Background(), "both", []IPInfoProvider{failing, v4Only})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(v4Only.calls) != 1 || v4Only.calls[0] != "ipv4" {
+		t.Fatalf("expected a single ipv4 call, got %v", v4Only.calls)
+	}
+	if ipv4 == nil || ipv4.Info.Ip != "203.0.113.7" || strings.Join(ipv4.Sources, ",") != "v4only" {
+		t.Fatalf("unexpected ipv4 result: %+v", ipv4)
+	}
+	if ipv6 != nil {
+		t.Fatalf("expected no ipv6 result, got %+v", ipv6)
+	}
+}
+
+func TestRegisterIPInfoProvider(t *testing.T) {
+	restoreIPInfoConfig(t)
+	custom := &stubIPInfoProvider{name: "geoip", families: []string{"ipv4"}, info: &model.IpInfo{Ip: "203.0.113.7", ASN: "64500"}}
+	if err := RegisterIPInfoProvider(custom); err != nil {
+		t.Fatalf("RegisterIPInfoProvider: %v", err)
+	}
+	t.Cleanup(func() { UnregisterIPInfoProvider("geoip") })
+	if err := RegisterIPInfoProvider(custom); err == nil {
+		t.Fatal("expected duplicate registration to fail")
+	}
+	if err := RegisterIPInfoProvider(&stubIPInfoProvider{name: "bad,name"}); err == nil {
+		t.Fatal("expected invalid name to fail")
+	}
+	names := IPInfoProviderNames()
+	if strings.Join(names, ",") != "ipsb,cloudflare,maxmind,ipinfo,geoip" {
+		t.Fatalf("unexpected provider names: %v", names)
+	}
+	if err := SetIPInfoConfig(IPInfoConfig{Providers: []string{"geoip"}}); err != nil {
+		t.Fatalf("SetIPInfoConfig: %v", err)
+	}
+	ipv4, _, err := RunIpCheckWithSourcesContext(context.Background(), "ipv4")
+	if err != nil || ipv4 == nil || ipv4.FieldSources["ip"] != "geoip" {
+		t.Fatalf("expected the custom provider to answer, got %+v, %v", ipv4, err)
+	}
+}
+
+func TestIPInfoConfigValidation(t *testing.T) {
+	cases := []IPInfoConfig{
+		{Providers: []string{"unknown"}},
+		{BaseURLs: map[string]string{"unknown": "http://127.0.0.1"}},
+		{BaseURLs: map[string]string{"ipinfo": "ftp://127.0.0.1"}},
+		{BaseURLs: map[string]string{"ipinfo": "not a url"}},
+	}
+	for _, config := range cases {
+		if err := config.Validate(); err == nil {
+			t.Fatalf("expected %+v to be rejected", config)
+		}
+	}
+	custom := &stubIPInfoProvider{name: "geoip", families: []string{"ipv4"}}
+	if err := RegisterIPInfoProvider(custom); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { UnregisterIPInfoProvider("geoip") })
+	if err := (IPInfoConfig{BaseURLs: map[string]string{"geoip": "http://127.0.0.1"}}).Validate(); err == nil {
+		t.Fatal("expected a custom URL for a non-HTTP provider to be rejected")
+	}
+}
+
+func TestParseIPInfoConfig(t *testing.T) {
+	config, err := ParseIPInfoConfig(" IPinfo,cloudflare,ipinfo ", "ipinfo=http://127.0.0.1:8080/json, cloudflare = https://example.test/meta")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(config.Providers, ",") != "ipinfo,cloudflare" {
+		t.Fatalf("unexpected providers: %v", config.Providers)
+	}
+	if config.BaseURLs["ipinfo"] != "http://127.0.0.1:8080/json" || config.BaseURLs["cloudflare"] != "https://example.test/meta" {
+		t.Fatalf("unexpected base URLs: %v", config.BaseURLs)
+	}
+	if _, err := ParseIPInfoConfig("", "ipinfo"); err == nil {
+		t.Fatal("expected an entry without = to be rejected")
+	}
+}
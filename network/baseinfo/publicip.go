@@ -0,0 +1,228 @@
+package baseinfo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/oneclickvirt/basics/network/utils"
+	stunmodel "github.com/oneclickvirt/gostun/model"
+	"github.com/oneclickvirt/gostun/stuncheck"
+)
+
+// 公网出口地址的探测方法
+const (
+	PublicIPMethodSTUN = "stun"
+	PublicIPMethodURL  = "url"
+)
+
+// 主机的寻址方式
+const (
+	// AddressingDirect 出口地址直接配置在本机网卡上
+	AddressingDirect = "direct"
+	// AddressingNAT 本机网卡上没有出口地址，出口经过地址转换
+	AddressingNAT = "nat"
+	// AddressingUnknown 未能确定出口地址
+	AddressingUnknown = "unknown"
+)
+
+// DefaultPublicIPURL 以纯文本返回请求方公网IP的默认地址，同时支持 IPv4 与 IPv6
+const DefaultPublicIPURL = "https://api64.ipify.org"
+
+// PublicIPDiscoveryConfig 公网出口地址探测的配置，零值使用默认值
+type PublicIPDiscoveryConfig struct {
+	// STUNServers 为空时使用 gostun 对应协议族的默认服务器列表
+	STUNServers []string
+	// URL 以纯文本返回公网IP的地址，为空时使用 DefaultPublicIPURL
+	URL string
+	// Timeout 单个 STUN 服务器的探测超时，为 0 时为 3 秒
+	Timeout time.Duration
+}
+
+// PublicIPObservation 单次探测得到的出口地址
+type PublicIPObservation struct {
+	Method string `json:"method"`
+	// Source 为 STUN 服务器或 URL
+	Source  string `json:"source"`
+	Address string `json:"address,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PublicIPDiscovery 单个协议族的公网出口地址探测结果
+type PublicIPDiscovery struct {
+	Family string `json:"family"`
+	// EgressIP 各探测方法中得到最多一致结果的出口地址
+	EgressIP string `json:"egress_ip,omitempty"`
+	// InterfaceIPs 本机网卡上属于该协议族的公网地址
+	InterfaceIPs []string `json:"interface_ips,omitempty"`
+	// Addressing 取值见 AddressingDirect AddressingNAT AddressingUnknown
+	Addressing   string                `json:"addressing"`
+	Observations []PublicIPObservation `json:"observations,omitempty"`
+}
+
+var (
+	probeSTUN         = stuncheck.ProbeNAT
+	fetchPublicIPText = utils.FetchTextFromURL
+	interfaceAddrs    = net.InterfaceAddrs
+)
+
+// DiscoverPublicIP 不依赖IP信息提供商，通过 STUN、本机网卡与纯文本IP查询地址确定 family(ipv4 或 ipv6) 的出口地址，
+// 并据此判断主机是直接拥有公网地址还是位于 NAT 之后
+func DiscoverPublicIP(ctx context.Context, family string, config PublicIPDiscoveryConfig) *PublicIPDiscovery {
+	res := &PublicIPDiscovery{Family: family, Addressing: AddressingUnknown}
+	interfaceIPs, _ := localPublicAddresses(family)
+	for _, ip := range interfaceIPs {
+		res.InterfaceIPs = append(res.InterfaceIPs, ip.String())
+	}
+	servers := config.STUNServers
+	if len(servers) == 0 {
+		servers = stunmodel.GetDefaultServers(family)
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	url := config.URL
+	if url == "" {
+		url = DefaultPublicIPURL
+	}
+	var stunObservations []PublicIPObservation
+	var urlObservation PublicIPObservation
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		stunObservations = discoverBySTUN(ctx, family, servers, timeout)
+	}()
+	go func() {
+		defer wg.Done()
+		urlObservation = discoverByURL(ctx, family, url)
+	}()
+	wg.Wait()
+	res.Observations = append(stunObservations, urlObservation)
+	res.EgressIP = majorityAddress(res.Observations)
+	if res.EgressIP != "" {
+		res.Addressing = AddressingNAT
+		for _, ip := range res.InterfaceIPs {
+			if ip == res.EgressIP {
+				res.Addressing = AddressingDirect
+				break
+			}
+		}
+	}
+	return res
+}
+
+func discoverBySTUN(ctx context.Context, family string, servers []string, timeout time.Duration) []PublicIPObservation {
+	summary := probeSTUN(ctx, stuncheck.ProbeConfig{
+		Servers:       servers,
+		IPVersion:     family,
+		Timeout:       timeout,
+		MaxConcurrent: len(servers),
+	})
+	observations := make([]PublicIPObservation, 0, len(summary.Results))
+	for _, result := range summary.Results {
+		observation := PublicIPObservation{Method: PublicIPMethodSTUN, Source: result.Server}
+		if host, _, err := net.SplitHostPort(result.MappedAddress); err == nil {
+			observation.Address, observation.Error = familyAddress(host, family)
+		} else if result.Error != "" {
+			observation.Error = result.Error
+		} else {
+			observation.Error = string(result.Status)
+		}
+		observations = append(observations, observation)
+	}
+	if len(observations) == 0 && summary.Error != "" {
+		observations = append(observations, PublicIPObservation{Method: PublicIPMethodSTUN, Error: summary.Error})
+	}
+	return observations
+}
+
+func discoverByURL(ctx context.Context, family, url string) PublicIPObservation {
+	observation := PublicIPObservation{Method: PublicIPMethodURL, Source: url}
+	netType := "tcp4"
+	if family == "ipv6" {
+		netType = "tcp6"
+	}
+	text, err := fetchPublicIPText(ctx, url, netType)
+	if err != nil {
+		observation.Error = err.Error()
+		return observation
+	}
+	observation.Address, observation.Error = familyAddress(text, family)
+	return observation
+}
+
+// familyAddress 校验 value 为 family 协议族的IP地址并返回其规范形式
+func familyAddress(value, family string) (string, string) {
+	ip, err := netip.ParseAddr(value)
+	if err != nil {
+		return "", fmt.Sprintf("invalid IP address %q", value)
+	}
+	ip = ip.Unmap()
+	if (family == "ipv4") != ip.Is4() {
+		return "", fmt.Sprintf("%s is not an %s address", ip, family)
+	}
+	return ip.String(), ""
+}
+
+// majorityAddress 返回出现次数最多的地址，次数相同时取先出现的
+func majorityAddress(observations []PublicIPObservation) string {
+	counts := make(map[string]int)
+	var best string
+	for _, observation := range observations {
+		if observation.Address == "" {
+			continue
+		}
+		counts[observation.Address]++
+		if counts[observation.Address] > counts[best] {
+			best = observation.Address
+		}
+	}
+	return best
+}
+
+// localPublicAddresses 返回本机网卡上属于 family 协议族的全部公网地址
+func localPublicAddresses(family string) ([]netip.Addr, error) {
+	addrs, err := interfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	var res []netip.Addr
+	for _, addr := range addrs {
+		prefix, err := netip.ParsePrefix(addr.String())
+		if err != nil {
+			continue
+		}
+		ip := prefix.Addr().Unmap()
+		if (family == "ipv4") != ip.Is4() {
+			continue
+		}
+		if isPublicAddress(ip) {
+			res = append(res, ip)
+		}
+	}
+	return res, nil
+}
+
+// localPublicAddress 返回本机网卡上第一个属于 family 协议族的公网地址
+func localPublicAddress(family string) (netip.Addr, error) {
+	addrs, err := localPublicAddresses(family)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if len(addrs) == 0 {
+		return netip.Addr{}, fmt.Errorf("no public %s address on local interfaces", family)
+	}
+	return addrs[0], nil
+}
+
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// isPublicAddress 排除私有、回环、链路本地以及运营商级 NAT 地址
+func isPublicAddress(ip netip.Addr) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
@@ -0,0 +1,102 @@
+package baseinfo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oneclickvirt/gostun/stuncheck"
+)
+
+func stubPublicIPDiscovery(t *testing.T, local []string, stun map[string]string) {
+	t.Helper()
+	oldProbe, oldAddrs := probeSTUN, interfaceAddrs
+	t.Cleanup(func() { probeSTUN, interfaceAddrs = oldProbe, oldAddrs })
+	interfaceAddrs = func() ([]net.Addr, error) {
+		var addrs []net.Addr
+		for _, value := range local {
+			_, ipNet, _ := net.ParseCIDR(value)
+			ipNet.IP = net.ParseIP(strings.Split(value, "/")[0])
+			addrs = append(addrs, ipNet)
+		}
+		return addrs, nil
+	}
+	probeSTUN = func(ctx context.Context, config stuncheck.ProbeConfig) stuncheck.NATSummary {
+		summary := stuncheck.NATSummary{IPVersion: config.IPVersion}
+		for _, server := range config.Servers {
+			result := stuncheck.NATReport{Server: server, Status: stuncheck.CapabilityTimeout, Error: "timeout"}
+			if mapped := stun[server]; mapped != "" {
+				result.Status, result.Error, result.MappedAddress = stuncheck.CapabilityAvailable, "", mapped
+			}
+			summary.Results = append(summary.Results, result)
+		}
+		return summary
+	}
+}
+
+func newTextServer(t *testing.T, body string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestDiscoverPublicIPBehindNAT(t *testing.T) {
+	stubPublicIPDiscovery(t, []string{"10.0.0.5/24", "2001:db8::5/64"}, map[string]string{
+		"stun-a:3478": "203.0.113.7:40000",
+		"stun-b:3478": "203.0.113.7:40002",
+	})
+	result := DiscoverPublicIP(context.Background(), "ipv4", PublicIPDiscoveryConfig{
+		STUNServers: []string{"stun-a:3478", "stun-b:3478", "stun-c:3478"},
+		URL:         newTextServer(t, "198.51.100.1\n"),
+		Timeout:     time.Second,
+	})
+	if result.EgressIP != "203.0.113.7" || result.Addressing != AddressingNAT || len(result.InterfaceIPs) != 0 {
+		t.Fatalf("unexpected discovery: %+v", result)
+	}
+	if len(result.Observations) != 4 {
+		t.Fatalf("expected one observation per method and server, got %+v", result.Observations)
+	}
+	if timeout := result.Observations[2]; timeout.Method != PublicIPMethodSTUN || timeout.Source != "stun-c:3478" || timeout.Error != "timeout" {
+		t.Fatalf("unexpected failed stun observation: %+v", timeout)
+	}
+	if url := result.Observations[3]; url.Method != PublicIPMethodURL || url.Address != "198.51.100.1" {
+		t.Fatalf("unexpected url observation: %+v", url)
+	}
+}
+
+func TestDiscoverPublicIPDirectlyAddressed(t *testing.T) {
+	stubPublicIPDiscovery(t, []string{"192.168.1.2/24", "203.0.113.7/24"}, nil)
+	result := DiscoverPublicIP(context.Background(), "ipv4", PublicIPDiscoveryConfig{
+		STUNServers: []string{"stun-a:3478"},
+		URL:         newTextServer(t, "203.0.113.7"),
+	})
+	if result.EgressIP != "203.0.113.7" || result.Addressing != AddressingDirect {
+		t.Fatalf("unexpected discovery: %+v", result)
+	}
+	if len(result.InterfaceIPs) != 1 || result.InterfaceIPs[0] != "203.0.113.7" {
+		t.Fatalf("unexpected interface addresses: %v", result.InterfaceIPs)
+	}
+}
+
+func TestDiscoverPublicIPRejectsWrongFamily(t *testing.T) {
+	stubPublicIPDiscovery(t, []string{"203.0.113.7/24"}, map[string]string{"stun-a:3478": "203.0.113.7:40000"})
+	result := DiscoverPublicIP(context.Background(), "ipv6", PublicIPDiscoveryConfig{
+		STUNServers: []string{"stun-a:3478"},
+		URL:         newTextServer(t, "not an address"),
+	})
+	if result.EgressIP != "" || result.Addressing != AddressingUnknown || len(result.InterfaceIPs) != 0 {
+		t.Fatalf("unexpected discovery: %+v", result)
+	}
+	for _, observation := range result.Observations {
+		if observation.Address != "" || observation.Error == "" {
+			t.Fatalf("expected every observation to be rejected, got %+v", observation)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package ipv6
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"strings"
@@ -48,10 +49,53 @@ func isNonGlobalPrefix(prefix [16]byte) bool {
 	return false
 }
 
-// 格式化返回IPv6子网掩码
+func isPrefixLengthValid(prefixLen int) bool {
+	return prefixLen >= 1 && prefixLen <= 128
+}
+
+// 格式化返回IPv6子网掩码，前缀长度未知时不加斜杠
 func formatIPv6Mask(prefixLen string, language string) string {
+	if prefixLen != PrefixLengthUnknown {
+		prefixLen = "/" + prefixLen
+	}
+	if language == "en" {
+		return fmt.Sprintf(" IPv6 Mask           : %s\n", prefixLen)
+	}
+	return fmt.Sprintf(" IPv6 子网掩码       : %s\n", prefixLen)
+}
+
+// formatIPv6Prefixes 多个接口配置了全局IPv6地址时按接口列出前缀
+func formatIPv6Prefixes(interfaces []InterfaceIPv6, language string) string {
+	if len(interfaces) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, iface := range interfaces {
+		parts = append(parts, iface.Interface+" "+strings.Join(iface.Prefixes, " "))
+	}
 	if language == "en" {
-		return fmt.Sprintf(" IPv6 Mask           : /%s\n", prefixLen)
+		return fmt.Sprintf(" IPv6 Prefixes       : %s\n", strings.Join(parts, ", "))
+	}
+	return fmt.Sprintf(" IPv6 各接口前缀   : %s\n", strings.Join(parts, ", "))
+}
+
+// GetIPv6Mask 获取 IPv6 子网掩码
+//
+// Deprecated: 请使用 GetIPv6MaskContext，以便调用方取消请求。
+func GetIPv6Mask(publicIPv6, language string) (string, error) {
+	return GetIPv6MaskContext(context.Background(), publicIPv6, language)
+}
+
+// GetIPv6MaskContext 获取 IPv6 子网掩码
+func GetIPv6MaskContext(ctx context.Context, publicIPv6, language string) (string, error) {
+	return GetIPv6MaskWithOptions(ctx, publicIPv6, language, IPv6PrefixOptions{})
+}
+
+// GetIPv6MaskWithOptions 与 GetIPv6MaskContext 相同，可指定探测的网络接口
+func GetIPv6MaskWithOptions(ctx context.Context, publicIPv6, language string, options IPv6PrefixOptions) (string, error) {
+	report, err := GetIPv6PrefixReportWithOptions(ctx, publicIPv6, options)
+	if err != nil {
+		return "", err
 	}
-	return fmt.Sprintf(" IPv6 子网掩码       : /%s\n", prefixLen)
+	return formatIPv6Mask(report.PrefixLength, language) + formatIPv6Prefixes(report.Interfaces, language), nil
 }
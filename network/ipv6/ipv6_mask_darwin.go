@@ -4,6 +4,7 @@
 package ipv6
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 	"regexp"
@@ -12,8 +13,8 @@ import (
 )
 
 // macOS上获取前缀长度
-func getPrefixFromIfconfig(interfaceName string) (string, error) {
-	cmd := exec.Command("ifconfig", interfaceName)
+func getPrefixFromIfconfig(ctx context.Context, interfaceName string) (string, error) {
+	cmd := exec.CommandContext(ctx, "ifconfig", interfaceName)
 	output, err := cmd.Output()
 	if err != nil {
 		return "", err
@@ -43,8 +44,8 @@ func getPrefixFromIfconfig(interfaceName string) (string, error) {
 }
 
 // macOS平台上使用networksetup命令获取更多信息
-func getPrefixFromNetworksetup(interfaceName string) (string, error) {
-	cmd := exec.Command("networksetup", "-listallhardwareports")
+func getPrefixFromNetworksetup(ctx context.Context, interfaceName string) (string, error) {
+	cmd := exec.CommandContext(ctx, "networksetup", "-listallhardwareports")
 	output, err := cmd.Output()
 	if err != nil {
 		return "", err
@@ -63,7 +64,7 @@ func getPrefixFromNetworksetup(interfaceName string) (string, error) {
 	if serviceName == "" {
 		return "", fmt.Errorf("未找到网络接口对应的服务名称")
 	}
-	cmd = exec.Command("networksetup", "-getinfo", serviceName)
+	cmd = exec.CommandContext(ctx, "networksetup", "-getinfo", serviceName)
 	output, err = cmd.Output()
 	if err != nil {
 		return "", err
@@ -81,24 +82,14 @@ func getPrefixFromNetworksetup(interfaceName string) (string, error) {
 	return "", fmt.Errorf("未找到IPv6前缀长度信息")
 }
 
-// 获取 IPv6 子网掩码
-func GetIPv6Mask(publicIPv6, language string) (string, error) {
-	if publicIPv6 == "" {
-		return "", fmt.Errorf("无公网IPV6地址")
+// prefixMethods macOS 上依次尝试ifconfig与networksetup
+func prefixMethods(interfaceName string) []prefixMethod {
+	return []prefixMethod{
+		legacyPrefixMethod(MethodIfconfig, func(ctx context.Context) (string, error) {
+			return getPrefixFromIfconfig(ctx, interfaceName)
+		}),
+		legacyPrefixMethod(MethodNetworksetup, func(ctx context.Context) (string, error) {
+			return getPrefixFromNetworksetup(ctx, interfaceName)
+		}),
 	}
-	interfaceName, err := getInterface()
-	if err != nil || interfaceName == "" {
-		return "", fmt.Errorf("获取网络接口失败: %v", err)
-	}
-	// 方法1：从ifconfig获取前缀长度
-	prefixLen, err := getPrefixFromIfconfig(interfaceName)
-	if err == nil && prefixLen != "" {
-		return formatIPv6Mask(prefixLen, language), nil
-	}
-	// 方法2：从networksetup获取前缀长度
-	prefixLen, err = getPrefixFromNetworksetup(interfaceName)
-	if err == nil && prefixLen != "" {
-		return formatIPv6Mask(prefixLen, language), nil
-	}
-	return formatIPv6Mask("128", language), nil
 }
@@ -4,6 +4,7 @@
 package ipv6
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -13,8 +14,8 @@ import (
 )
 
 // FreeBSD 上获取前缀长度
-func getPrefixFromIfconfig(interfaceName string) (string, error) {
-	cmd := exec.Command("ifconfig", interfaceName)
+func getPrefixFromIfconfig(ctx context.Context, interfaceName string) (string, error) {
+	cmd := exec.CommandContext(ctx, "ifconfig", interfaceName)
 	output, err := cmd.Output()
 	if err != nil {
 		return "", err
@@ -71,24 +72,14 @@ func getPrefixFromConfigFiles() (string, error) {
 	return "", fmt.Errorf("在配置文件中未找到IPv6前缀长度信息")
 }
 
-// 获取 IPv6 子网掩码
-func GetIPv6Mask(publicIPv6, language string) (string, error) {
-	if publicIPv6 == "" {
-		return "", fmt.Errorf("无公网IPV6地址")
+// prefixMethods FreeBSD 上依次尝试ifconfig与网络配置文件
+func prefixMethods(interfaceName string) []prefixMethod {
+	return []prefixMethod{
+		legacyPrefixMethod(MethodIfconfig, func(ctx context.Context) (string, error) {
+			return getPrefixFromIfconfig(ctx, interfaceName)
+		}),
+		legacyPrefixMethod(MethodConfigFiles, func(context.Context) (string, error) {
+			return getPrefixFromConfigFiles()
+		}),
 	}
-	interfaceName, err := getInterface()
-	if err != nil || interfaceName == "" {
-		return "", fmt.Errorf("获取网络接口失败: %v", err)
-	}
-	// 方法1：从ifconfig获取前缀长度
-	prefixLen, err := getPrefixFromIfconfig(interfaceName)
-	if err == nil && prefixLen != "" {
-		return formatIPv6Mask(prefixLen, language), nil
-	}
-	// 方法2：从配置文件获取前缀长度
-	prefixLen, err = getPrefixFromConfigFiles()
-	if err == nil && prefixLen != "" {
-		return formatIPv6Mask(prefixLen, language), nil
-	}
-	return formatIPv6Mask("128", language), nil
 }
@@ -5,8 +5,10 @@ package ipv6
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
 	"net"
+	"net/netip"
 	"os"
 	"os/exec"
 	"regexp"
@@ -23,36 +25,37 @@ const (
 	ICMPv6OptionPrefix        = 3
 )
 
-func extractPrefixFromRAOption(data []byte) []string {
-	var prefixLengths []string
+// parseRAPrefixes 解析RA报文(不含IPv6头部)中的全部前缀信息选项
+func parseRAPrefixes(data []byte, router string) []RAPrefix {
+	var prefixes []RAPrefix
 	optionStart := 16
-	for optionStart < len(data) {
-		if optionStart+2 > len(data) {
-			break
-		}
+	for optionStart+2 <= len(data) {
 		optionType := data[optionStart]
-		optionLen := data[optionStart+1] * 8
-		if optionLen == 0 || optionStart+int(optionLen) > len(data) {
+		optionLen := int(data[optionStart+1]) * 8
+		if optionLen == 0 || optionStart+optionLen > len(data) {
 			break
 		}
 		if optionType == ICMPv6OptionPrefix && optionLen >= 32 {
-			prefixLen := data[optionStart+2]
-			prefixStart := optionStart + 16
-			if prefixStart+16 <= len(data) {
+			option := data[optionStart : optionStart+optionLen]
+			prefixLen := int(option[2])
+			if isPrefixLengthValid(prefixLen) {
 				var prefix [16]byte
-				copy(prefix[:], data[prefixStart:prefixStart+16])
-				if !isNonGlobalPrefix(prefix) && isPrefixLengthValid(int(prefixLen)) {
-					prefixLengths = append(prefixLengths, fmt.Sprintf("%d", prefixLen))
-				}
+				copy(prefix[:], option[16:32])
+				prefixes = append(prefixes, RAPrefix{
+					Prefix:            netip.PrefixFrom(netip.AddrFrom16(prefix), prefixLen).Masked().String(),
+					PrefixLength:      prefixLen,
+					Global:            !isNonGlobalPrefix(prefix),
+					OnLink:            option[3]&0x80 != 0,
+					Autonomous:        option[3]&0x40 != 0,
+					ValidLifetime:     binary.BigEndian.Uint32(option[4:8]),
+					PreferredLifetime: binary.BigEndian.Uint32(option[8:12]),
+					Router:            router,
+				})
 			}
 		}
-		optionStart += int(optionLen)
+		optionStart += optionLen
 	}
-	return prefixLengths
-}
-
-func isPrefixLengthValid(prefixLen int) bool {
-	return prefixLen >= 1 && prefixLen <= 128
+	return prefixes
 }
 
 func sendRouterSolicitation(fd int, interfaceName string) error {
@@ -80,87 +83,160 @@ func sendRouterSolicitation(fd int, interfaceName string) error {
 	return nil
 }
 
-func getPrefixFromRA(interfaceName string) (string, error) {
-	radvdumpPath, err := exec.LookPath("radvdump")
-	if err == nil && radvdumpPath != "" {
-		cmd := exec.Command("radvdump", "-i", interfaceName)
-		output, err := cmd.Output()
-		if err == nil {
-			re := regexp.MustCompile(`(?i)prefix\s+([a-fA-F0-9:]+)/(\d+)`)
-			matches := re.FindAllStringSubmatch(string(output), -1)
-			for _, match := range matches {
-				prefix := match[1]
-				prefixLen := match[2]
-				prefixLenInt, err := strconv.Atoi(prefixLen)
-				if err != nil || !isPrefixLengthValid(prefixLenInt) {
-					continue
-				}
-				if !strings.HasPrefix(prefix, "fe80") &&
-					!strings.HasPrefix(prefix, "::1") &&
-					!strings.HasPrefix(prefix, "fc") &&
-					!strings.HasPrefix(prefix, "fd") &&
-					!strings.HasPrefix(prefix, "ff") {
-					return prefixLen, nil
-				}
+var (
+	radvdumpRouterRe = regexp.MustCompile(`(?i)based on Router Advertisement from\s+([0-9a-f:]+)`)
+	radvdumpPrefixRe = regexp.MustCompile(`(?i)^prefix\s+([0-9a-f:]+)/(\d+)`)
+	radvdumpOptionRe = regexp.MustCompile(`(?i)^(AdvOnLink|AdvAutonomous|AdvValidLifetime|AdvPreferredLifetime)\s+(\S+?);`)
+)
+
+// parseRadvdump 解析 radvdump 输出中的前缀定义
+func parseRadvdump(output string) []RAPrefix {
+	var prefixes []RAPrefix
+	var router string
+	var current *RAPrefix
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if match := radvdumpRouterRe.FindStringSubmatch(line); match != nil {
+			router = match[1]
+			continue
+		}
+		if match := radvdumpPrefixRe.FindStringSubmatch(line); match != nil {
+			prefixLen, err := strconv.Atoi(match[2])
+			addr, addrErr := netip.ParseAddr(match[1])
+			current = nil
+			if err != nil || addrErr != nil || !isPrefixLengthValid(prefixLen) || !addr.Is6() {
+				continue
 			}
+			prefixes = append(prefixes, RAPrefix{
+				Prefix:       netip.PrefixFrom(addr, prefixLen).Masked().String(),
+				PrefixLength: prefixLen,
+				Global:       !isNonGlobalPrefix(addr.As16()),
+				// radvd 的默认值
+				OnLink:            true,
+				Autonomous:        true,
+				ValidLifetime:     86400,
+				PreferredLifetime: 14400,
+				Router:            router,
+			})
+			current = &prefixes[len(prefixes)-1]
+			continue
+		}
+		if current == nil {
+			continue
 		}
+		if strings.HasPrefix(line, "};") {
+			current = nil
+			continue
+		}
+		match := radvdumpOptionRe.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		switch strings.ToLower(match[1]) {
+		case "advonlink":
+			current.OnLink = strings.EqualFold(match[2], "on")
+		case "advautonomous":
+			current.Autonomous = strings.EqualFold(match[2], "on")
+		case "advvalidlifetime":
+			current.ValidLifetime = parseRALifetime(match[2])
+		case "advpreferredlifetime":
+			current.PreferredLifetime = parseRALifetime(match[2])
+		}
+	}
+	return prefixes
+}
+
+func parseRALifetime(value string) uint32 {
+	if strings.EqualFold(value, "infinity") {
+		return 0xffffffff
 	}
+	lifetime, _ := strconv.ParseUint(value, 10, 32)
+	return uint32(lifetime)
+}
+
+// getPrefixFromRadvdump 使用 radvdump 在指定接口上监听RA报文，最多等待5秒
+func getPrefixFromRadvdump(ctx context.Context, report *IPv6PrefixReport, publicIPv6 netip.Addr) (int, error) {
+	if _, err := exec.LookPath("radvdump"); err != nil {
+		return 0, fmt.Errorf("未安装radvdump")
+	}
+	raCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	// radvdump 会持续运行，超时被终止时仍解析已输出的内容
+	output, _ := exec.CommandContext(raCtx, "radvdump", "-i", report.Interface).Output()
+	prefixes := parseRadvdump(string(output))
+	if len(prefixes) == 0 {
+		return 0, fmt.Errorf("radvdump 未收到包含前缀的RA报文")
+	}
+	report.RAPrefixes = append(report.RAPrefixes, prefixes...)
+	if prefixLen, ok := selectRAPrefix(prefixes, publicIPv6); ok {
+		return prefixLen, nil
+	}
+	return 0, fmt.Errorf("RA报文中没有全局前缀")
+}
+
+// getPrefixFromRA 发送Router Solicitation，在5秒窗口内收集所有路由器RA报文中的前缀后统一选择
+func getPrefixFromRA(ctx context.Context, report *IPv6PrefixReport, publicIPv6 netip.Addr) (int, error) {
+	interfaceName := report.Interface
 	intf, err := net.InterfaceByName(interfaceName)
 	if err != nil {
-		return "", fmt.Errorf("获取网络接口失败: %v", err)
+		return 0, fmt.Errorf("获取网络接口失败: %v", err)
 	}
 	fd, err := syscall.Socket(syscall.AF_INET6, syscall.SOCK_RAW, syscall.IPPROTO_ICMPV6)
 	if err != nil {
-		return "", fmt.Errorf("创建原始套接字失败: %v", err)
+		return 0, fmt.Errorf("创建原始套接字失败: %v", err)
 	}
 	defer syscall.Close(fd)
 	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, intf.Index); err != nil {
-		return "", fmt.Errorf("绑定套接字到接口失败: %v", err)
+		return 0, fmt.Errorf("绑定套接字到接口失败: %v", err)
 	}
 	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_RECVPKTINFO, 1); err != nil {
-		return "", fmt.Errorf("设置套接字选项失败: %v", err)
+		return 0, fmt.Errorf("设置套接字选项失败: %v", err)
 	}
+	// 较短的接收超时使循环能及时响应 ctx
 	tv := syscall.Timeval{
-		Sec:  5,
-		Usec: 0,
+		Sec:  0,
+		Usec: 500000,
 	}
 	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
-		return "", fmt.Errorf("设置接收超时失败: %v", err)
+		return 0, fmt.Errorf("设置接收超时失败: %v", err)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	raCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	err = sendRouterSolicitation(fd, interfaceName)
 	if err != nil {
-		return "", fmt.Errorf("发送Router Solicitation失败: %v", err)
+		return 0, fmt.Errorf("发送Router Solicitation失败: %v", err)
 	}
 	buffer := make([]byte, 1500)
-	for {
-		select {
-		case <-ctx.Done():
-			return "", fmt.Errorf("等待Router Advertisement超时")
-		default:
-			n, _, err := syscall.Recvfrom(fd, buffer, 0)
-			if err != nil {
-				if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK {
-					continue
-				}
-				return "", fmt.Errorf("接收数据失败: %v", err)
-			}
-			if n < 4 {
+	var prefixes []RAPrefix
+	for raCtx.Err() == nil {
+		n, from, err := syscall.Recvfrom(fd, buffer, 0)
+		if err != nil {
+			if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK || err == syscall.EINTR {
 				continue
 			}
-			if buffer[0] == ICMPv6RouterAdvertisement {
-				prefixLengths := extractPrefixFromRAOption(buffer[:n])
-				if len(prefixLengths) > 0 {
-					return prefixLengths[0], nil
-				}
-			}
+			return 0, fmt.Errorf("接收数据失败: %v", err)
 		}
+		if n < 4 || buffer[0] != ICMPv6RouterAdvertisement {
+			continue
+		}
+		var router string
+		if source, ok := from.(*syscall.SockaddrInet6); ok {
+			router = netip.AddrFrom16(source.Addr).String()
+		}
+		prefixes = append(prefixes, parseRAPrefixes(buffer[:n], router)...)
 	}
+	if len(prefixes) == 0 {
+		return 0, fmt.Errorf("等待Router Advertisement超时")
+	}
+	report.RAPrefixes = append(report.RAPrefixes, prefixes...)
+	if prefixLen, ok := selectRAPrefix(prefixes, publicIPv6); ok {
+		return prefixLen, nil
+	}
+	return 0, fmt.Errorf("RA报文中没有全局前缀")
 }
 
-func getPrefixFromIPCommand(interfaceName string) (string, error) {
-	cmd := exec.Command("ip", "-o", "-6", "addr", "show", interfaceName)
+func getPrefixFromIPCommand(ctx context.Context, interfaceName string) (string, error) {
+	cmd := exec.CommandContext(ctx, "ip", "-o", "-6", "addr", "show", interfaceName)
 	output, err := cmd.Output()
 	if err != nil {
 		return "", err
@@ -222,35 +298,16 @@ func getPrefixFromConfigFiles() (string, error) {
 	return "", fmt.Errorf("在配置文件中未找到IPv6前缀长度信息")
 }
 
-func GetIPv6Mask(publicIPv6, language string) (string, error) {
-	if publicIPv6 == "" {
-		return "", fmt.Errorf("无公网IPV6地址")
-	}
-	interfaceName, err := getInterface()
-	if err != nil || interfaceName == "" {
-		return "", fmt.Errorf("获取网络接口失败: %v", err)
-	}
-	var prefixLen string
-	// 优先级1：从RA报文获取前缀长度
-	prefixLen, err = getPrefixFromRA(interfaceName)
-	if err == nil && prefixLen != "" {
-		if len, err := strconv.Atoi(prefixLen); err == nil && isPrefixLengthValid(len) {
-			return formatIPv6Mask(prefixLen, language), nil
-		}
-	}
-	// 优先级2：从ip命令获取前缀长度
-	prefixLen, err = getPrefixFromIPCommand(interfaceName)
-	if err == nil && prefixLen != "" {
-		if len, err := strconv.Atoi(prefixLen); err == nil && isPrefixLengthValid(len) {
-			return formatIPv6Mask(prefixLen, language), nil
-		}
-	}
-	// 优先级3：从配置文件获取前缀长度
-	prefixLen, err = getPrefixFromConfigFiles()
-	if err == nil && prefixLen != "" {
-		if len, err := strconv.Atoi(prefixLen); err == nil && isPrefixLengthValid(len) {
-			return formatIPv6Mask(prefixLen, language), nil
-		}
+// prefixMethods Linux 上依次尝试RA报文、ip命令与网络配置文件
+func prefixMethods(interfaceName string) []prefixMethod {
+	return []prefixMethod{
+		{name: MethodRouterAdvertisement, run: getPrefixFromRA},
+		{name: MethodRadvdump, run: getPrefixFromRadvdump},
+		legacyPrefixMethod(MethodIPCommand, func(ctx context.Context) (string, error) {
+			return getPrefixFromIPCommand(ctx, interfaceName)
+		}),
+		legacyPrefixMethod(MethodConfigFiles, func(context.Context) (string, error) {
+			return getPrefixFromConfigFiles()
+		}),
 	}
-	return formatIPv6Mask("128", language), nil
 }
@@ -0,0 +1,82 @@
+//go:build linux
+// +build linux
+
+package ipv6
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+)
+
+func raPrefixOption(prefix string, flags byte, valid, preferred uint32) []byte {
+	parsed := netip.MustParsePrefix(prefix)
+	option := make([]byte, 32)
+	option[0], option[1], option[2], option[3] = ICMPv6OptionPrefix, 4, byte(parsed.Bits()), flags
+	binary.BigEndian.PutUint32(option[4:8], valid)
+	binary.BigEndian.PutUint32(option[8:12], preferred)
+	addr := parsed.Addr().As16()
+	copy(option[16:32], addr[:])
+	return option
+}
+
+func TestParseRAPrefixes(t *testing.T) {
+	message := make([]byte, 16)
+	message[0] = ICMPv6RouterAdvertisement
+	// The source link-layer address option must be skipped.
+	message = append(message, 1, 1, 0, 1, 2, 3, 4, 5)
+	message = append(message, raPrefixOption("fd00:1::/64", 0xc0, 3600, 1800)...)
+	message = append(message, raPrefixOption("2001:db8:1::/56", 0x80, 0xffffffff, 600)...)
+	prefixes := parseRAPrefixes(message, "fe80::1")
+	if len(prefixes) != 2 {
+		t.Fatalf("expected two prefixes, got %+v", prefixes)
+	}
+	ula := prefixes[0]
+	if ula.Prefix != "fd00:1::/64" || ula.Global || !ula.OnLink || !ula.Autonomous || ula.ValidLifetime != 3600 || ula.PreferredLifetime != 1800 || ula.Router != "fe80::1" {
+		t.Fatalf("unexpected ula prefix: %+v", ula)
+	}
+	global := prefixes[1]
+	if global.Prefix != "2001:db8:1::/56" || global.PrefixLength != 56 || !global.Global || global.Autonomous || global.ValidLifetime != 0xffffffff {
+		t.Fatalf("unexpected global prefix: %+v", global)
+	}
+	if truncated := parseRAPrefixes(message[:len(message)-4], ""); len(truncated) != 1 {
+		t.Fatalf("expected a truncated option to be ignored, got %+v", truncated)
+	}
+}
+
+func TestParseRadvdump(t *testing.T) {
+	output := `#
+# radvd configuration generated by radvdump 2.19
+# based on Router Advertisement from fe80::1
+# received by interface eth0
+#
+
+interface eth0
+{
+	AdvSendAdvert on;
+	prefix 2001:db8:1:2::/64
+	{
+		AdvValidLifetime 2592000;
+		AdvPreferredLifetime infinity;
+		AdvOnLink on;
+		AdvAutonomous off;
+	}; # End of prefix definition
+
+	prefix fd00::/64
+	{
+	}; # End of prefix definition
+
+}; # End of interface definition
+`
+	prefixes := parseRadvdump(output)
+	if len(prefixes) != 2 {
+		t.Fatalf("expected two prefixes, got %+v", prefixes)
+	}
+	first := prefixes[0]
+	if first.Prefix != "2001:db8:1:2::/64" || !first.Global || !first.OnLink || first.Autonomous || first.ValidLifetime != 2592000 || first.PreferredLifetime != 0xffffffff || first.Router != "fe80::1" {
+		t.Fatalf("unexpected prefix: %+v", first)
+	}
+	if second := prefixes[1]; second.Global || second.ValidLifetime != 86400 || !second.Autonomous {
+		t.Fatalf("expected radvd defaults for an empty prefix block, got %+v", second)
+	}
+}
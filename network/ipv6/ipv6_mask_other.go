@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package ipv6
+
+// prefixMethods 其他平台没有可用的方法，只报告接口地址
+func prefixMethods(interfaceName string) []prefixMethod {
+	return nil
+}
@@ -4,6 +4,7 @@
 package ipv6
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 	"regexp"
@@ -12,8 +13,8 @@ import (
 )
 
 // Windows上获取前缀长度
-func getPrefixFromNetsh(interfaceName string) (string, error) {
-	cmd := exec.Command("netsh", "interface", "ipv6", "show", "addresses")
+func getPrefixFromNetsh(ctx context.Context, interfaceName string) (string, error) {
+	cmd := exec.CommandContext(ctx, "netsh", "interface", "ipv6", "show", "addresses")
 	output, err := cmd.Output()
 	if err != nil {
 		return "", err
@@ -54,8 +55,8 @@ func getPrefixFromNetsh(interfaceName string) (string, error) {
 }
 
 // Windows特有的PowerShell方法获取IPv6信息
-func getPrefixFromPowerShell(interfaceName string) (string, error) {
-	cmd := exec.Command("powershell", "-Command",
+func getPrefixFromPowerShell(ctx context.Context, interfaceName string) (string, error) {
+	cmd := exec.CommandContext(ctx, "powershell", "-Command",
 		"Get-NetIPAddress -AddressFamily IPv6 | Where-Object { $_.InterfaceAlias -like '*"+interfaceName+"*' -and $_.PrefixOrigin -ne 'WellKnown' } | Select-Object IPAddress, PrefixLength | ConvertTo-Json")
 	output, err := cmd.Output()
 	if err != nil {
@@ -88,22 +89,14 @@ func getPrefixFromPowerShell(interfaceName string) (string, error) {
 	return "", fmt.Errorf("未找到全局IPv6地址")
 }
 
-// 获取 IPv6 子网掩码
-func GetIPv6Mask(publicIPv6, language string) (string, error) {
-	if publicIPv6 == "" {
-		return "", fmt.Errorf("无公网IPV6地址")
+// prefixMethods Windows 上依次尝试netsh与PowerShell
+func prefixMethods(interfaceName string) []prefixMethod {
+	return []prefixMethod{
+		legacyPrefixMethod(MethodNetsh, func(ctx context.Context) (string, error) {
+			return getPrefixFromNetsh(ctx, interfaceName)
+		}),
+		legacyPrefixMethod(MethodPowerShell, func(ctx context.Context) (string, error) {
+			return getPrefixFromPowerShell(ctx, interfaceName)
+		}),
 	}
-	interfaceName, err := getInterface()
-	if err != nil || interfaceName == "" {
-		return "", fmt.Errorf("获取网络接口失败: %v", err)
-	}
-	prefixLen, err := getPrefixFromNetsh(interfaceName)
-	if err == nil && prefixLen != "" {
-		return formatIPv6Mask(prefixLen, language), nil
-	}
-	prefixLen, err = getPrefixFromPowerShell(interfaceName)
-	if err == nil && prefixLen != "" {
-		return formatIPv6Mask(prefixLen, language), nil
-	}
-	return formatIPv6Mask("128", language), nil
 }
@@ -0,0 +1,316 @@
+package ipv6
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+)
+
+// PrefixLengthUnknown 所有方法都未能确定前缀长度时 IPv6PrefixReport.PrefixLength 的取值
+const PrefixLengthUnknown = "unknown"
+
+// 确定前缀长度的方法，各平台只使用其中一部分
+const (
+	MethodRouterAdvertisement = "router_advertisement"
+	MethodRadvdump            = "radvdump"
+	MethodIPCommand           = "ip"
+	MethodIfconfig            = "ifconfig"
+	MethodNetworksetup        = "networksetup"
+	MethodNetsh               = "netsh"
+	MethodPowerShell          = "powershell"
+	MethodConfigFiles         = "config_files"
+	MethodUnknown             = "unknown"
+)
+
+// 探测接口的选择方式
+const (
+	InterfaceSelectionRequested = "requested"
+	InterfaceSelectionOwner     = "owns_public_ip"
+	// InterfaceSelectionSubnet 接口未配置该公网IPv6，仅其网段包含该地址
+	InterfaceSelectionSubnet  = "subnet"
+	InterfaceSelectionDefault = "default"
+)
+
+// IPv6PrefixOptions GetIPv6PrefixReportWithOptions 的可选配置，零值自动选择接口
+type IPv6PrefixOptions struct {
+	// Interface 指定探测的网络接口，为空时选择持有公网IPv6的接口，
+	// 找不到时退回第一个以 eth 或 en 开头的接口
+	Interface string
+}
+
+// IPv6PrefixReport 公网IPv6所在网段的结构化信息
+type IPv6PrefixReport struct {
+	Interface string `json:"interface,omitempty"`
+	// InterfaceSelection 探测接口的选择方式，见 InterfaceSelection* 常量
+	InterfaceSelection string `json:"interface_selection,omitempty"`
+	// PrefixLength 最终确定的前缀长度，无法确定时为 PrefixLengthUnknown
+	PrefixLength string `json:"prefix_length"`
+	// Prefix 公网IPv6按 PrefixLength 截取得到的网段，例如 2001:db8::/64
+	Prefix string `json:"prefix,omitempty"`
+	// Method 给出 PrefixLength 的方法，见 Method* 常量
+	Method string `json:"method"`
+	// RAPrefixes Router Advertisement 中出现的全部前缀，包括非全局前缀
+	RAPrefixes []RAPrefix `json:"ra_prefixes,omitempty"`
+	// Addresses 接口上配置的IPv6地址及其前缀长度
+	Addresses []InterfaceAddress `json:"addresses,omitempty"`
+	// Attempts 按尝试顺序记录未能给出结果的方法及原因
+	Attempts []PrefixAttempt `json:"attempts,omitempty"`
+	// Interfaces 多个接口配置了全局IPv6地址时，按接口列出各自的前缀
+	Interfaces []InterfaceIPv6 `json:"interfaces,omitempty"`
+}
+
+// InterfaceIPv6 一个配置了全局IPv6地址的接口
+type InterfaceIPv6 struct {
+	Interface string             `json:"interface"`
+	Prefixes  []string           `json:"prefixes"`
+	Addresses []InterfaceAddress `json:"addresses"`
+}
+
+// RAPrefix Router Advertisement 中的一个前缀信息选项
+// 生存期单位为秒，0xffffffff 表示无限
+type RAPrefix struct {
+	Prefix            string `json:"prefix"`
+	PrefixLength      int    `json:"prefix_length"`
+	Global            bool   `json:"global"`
+	OnLink            bool   `json:"on_link"`
+	Autonomous        bool   `json:"autonomous"`
+	ValidLifetime     uint32 `json:"valid_lifetime_s"`
+	PreferredLifetime uint32 `json:"preferred_lifetime_s"`
+	Router            string `json:"router,omitempty"`
+}
+
+// InterfaceAddress 接口上的一个IPv6地址
+type InterfaceAddress struct {
+	Address      string `json:"address"`
+	PrefixLength int    `json:"prefix_length"`
+	Global       bool   `json:"global"`
+}
+
+// PrefixAttempt 一个未能给出前缀长度的方法
+type PrefixAttempt struct {
+	Method string `json:"method"`
+	Error  string `json:"error"`
+}
+
+// prefixMethod 一种获取前缀长度的方法，可以在 report 中补充 RAPrefixes 等信息
+type prefixMethod struct {
+	name string
+	run  func(ctx context.Context, report *IPv6PrefixReport, publicIPv6 netip.Addr) (int, error)
+}
+
+// legacyPrefixMethod 包装只返回前缀长度字符串的平台方法
+func legacyPrefixMethod(name string, fetch func(ctx context.Context) (string, error)) prefixMethod {
+	return prefixMethod{name: name, run: func(ctx context.Context, _ *IPv6PrefixReport, _ netip.Addr) (int, error) {
+		prefixLen, err := fetch(ctx)
+		if err != nil {
+			return 0, err
+		}
+		value, err := strconv.Atoi(prefixLen)
+		if err != nil || !isPrefixLengthValid(value) {
+			return 0, fmt.Errorf("无效的IPv6前缀长度: %s", prefixLen)
+		}
+		return value, nil
+	}}
+}
+
+// GetIPv6PrefixReport 自动选择接口，依次尝试当前平台的各个方法确定公网IPv6的前缀长度，
+// 并记录接口地址、RA 前缀以及失败的方法
+func GetIPv6PrefixReport(ctx context.Context, publicIPv6 string) (*IPv6PrefixReport, error) {
+	return GetIPv6PrefixReportWithOptions(ctx, publicIPv6, IPv6PrefixOptions{})
+}
+
+// GetIPv6PrefixReportWithOptions 与 GetIPv6PrefixReport 相同，可指定探测的网络接口
+func GetIPv6PrefixReportWithOptions(ctx context.Context, publicIPv6 string, options IPv6PrefixOptions) (*IPv6PrefixReport, error) {
+	if publicIPv6 == "" {
+		return nil, fmt.Errorf("无公网IPV6地址")
+	}
+	publicAddr, err := netip.ParseAddr(publicIPv6)
+	if err != nil || !publicAddr.Is6() {
+		return nil, fmt.Errorf("无效的公网IPV6地址: %s", publicIPv6)
+	}
+	addresses, err := listIPv6Addresses()
+	if err != nil {
+		return nil, fmt.Errorf("获取网络接口失败: %v", err)
+	}
+	interfaceName, selection, err := selectIPv6Interface(addresses, publicAddr, options.Interface)
+	if err != nil {
+		return nil, err
+	}
+	report := collectIPv6PrefixReport(ctx, publicAddr, interfaceName, prefixMethods(interfaceName))
+	report.InterfaceSelection = selection
+	report.Interfaces = globalIPv6Interfaces(addresses)
+	return report, nil
+}
+
+func collectIPv6PrefixReport(ctx context.Context, publicAddr netip.Addr, interfaceName string, methods []prefixMethod) *IPv6PrefixReport {
+	report := &IPv6PrefixReport{
+		Interface:    interfaceName,
+		PrefixLength: PrefixLengthUnknown,
+		Method:       MethodUnknown,
+		Addresses:    interfaceIPv6Addresses(interfaceName),
+	}
+	for _, method := range methods {
+		if err := ctx.Err(); err != nil {
+			report.Attempts = append(report.Attempts, PrefixAttempt{Method: method.name, Error: err.Error()})
+			continue
+		}
+		prefixLen, err := method.run(ctx, report, publicAddr)
+		if err != nil {
+			report.Attempts = append(report.Attempts, PrefixAttempt{Method: method.name, Error: err.Error()})
+			continue
+		}
+		report.PrefixLength = strconv.Itoa(prefixLen)
+		report.Prefix = netip.PrefixFrom(publicAddr, prefixLen).Masked().String()
+		report.Method = method.name
+		break
+	}
+	return report
+}
+
+// GetIPv6PrefixLength 获取公网IPv6所在网段的前缀长度，无法确定时返回错误
+//
+// Deprecated: 请使用 GetIPv6PrefixLengthContext，以便调用方取消请求。
+func GetIPv6PrefixLength(publicIPv6 string) (string, error) {
+	return GetIPv6PrefixLengthContext(context.Background(), publicIPv6)
+}
+
+// GetIPv6PrefixLengthContext 获取公网IPv6所在网段的前缀长度，无法确定时返回错误
+func GetIPv6PrefixLengthContext(ctx context.Context, publicIPv6 string) (string, error) {
+	report, err := GetIPv6PrefixReport(ctx, publicIPv6)
+	if err != nil {
+		return "", err
+	}
+	if report.PrefixLength == PrefixLengthUnknown {
+		return "", fmt.Errorf("无法确定IPv6前缀长度")
+	}
+	return report.PrefixLength, nil
+}
+
+// selectRAPrefix 优先选择包含公网IPv6的前缀，否则选择第一个全局前缀
+func selectRAPrefix(prefixes []RAPrefix, publicIPv6 netip.Addr) (int, bool) {
+	for _, prefix := range prefixes {
+		if parsed, err := netip.ParsePrefix(prefix.Prefix); err == nil && parsed.Contains(publicIPv6) {
+			return prefix.PrefixLength, true
+		}
+	}
+	for _, prefix := range prefixes {
+		if prefix.Global {
+			return prefix.PrefixLength, true
+		}
+	}
+	return 0, false
+}
+
+// interfaceIPv6 一个接口及其上配置的IPv6地址
+type interfaceIPv6 struct {
+	name     string
+	prefixes []netip.Prefix
+}
+
+var listIPv6Addresses = systemIPv6Addresses
+
+// systemIPv6Addresses 按接口顺序返回各接口上配置的IPv6地址
+func systemIPv6Addresses() ([]interfaceIPv6, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var res []interfaceIPv6
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		entry := interfaceIPv6{name: iface.Name}
+		for _, addr := range addrs {
+			prefix, err := netip.ParsePrefix(addr.String())
+			if err != nil || !prefix.Addr().Is6() || prefix.Addr().Is4In6() {
+				continue
+			}
+			entry.prefixes = append(entry.prefixes, prefix)
+		}
+		res = append(res, entry)
+	}
+	return res, nil
+}
+
+// selectIPv6Interface 选择探测的接口：优先使用调用方指定的接口，
+// 其次是配置了该公网IPv6的接口，再次是网段包含该地址的接口，最后退回默认接口
+func selectIPv6Interface(addresses []interfaceIPv6, publicAddr netip.Addr, requested string) (string, string, error) {
+	if requested != "" {
+		for _, entry := range addresses {
+			if entry.name == requested {
+				return requested, InterfaceSelectionRequested, nil
+			}
+		}
+		return "", "", fmt.Errorf("网络接口不存在: %s", requested)
+	}
+	for _, entry := range addresses {
+		for _, prefix := range entry.prefixes {
+			if prefix.Addr() == publicAddr {
+				return entry.name, InterfaceSelectionOwner, nil
+			}
+		}
+	}
+	for _, entry := range addresses {
+		for _, prefix := range entry.prefixes {
+			if !isNonGlobalPrefix(prefix.Addr().As16()) && prefix.Masked().Contains(publicAddr) {
+				return entry.name, InterfaceSelectionSubnet, nil
+			}
+		}
+	}
+	interfaceName, err := getInterface()
+	if err != nil || interfaceName == "" {
+		return "", "", fmt.Errorf("获取网络接口失败: %v", err)
+	}
+	return interfaceName, InterfaceSelectionDefault, nil
+}
+
+// globalIPv6Interfaces 多个接口配置了全局IPv6地址时按接口返回各自的前缀，否则返回 nil
+func globalIPv6Interfaces(addresses []interfaceIPv6) []InterfaceIPv6 {
+	var res []InterfaceIPv6
+	for _, entry := range addresses {
+		item := InterfaceIPv6{Interface: entry.name}
+		for _, prefix := range entry.prefixes {
+			if isNonGlobalPrefix(prefix.Addr().As16()) {
+				continue
+			}
+			item.Addresses = append(item.Addresses, InterfaceAddress{Address: prefix.Addr().String(), PrefixLength: prefix.Bits(), Global: true})
+			if masked := prefix.Masked().String(); !slices.Contains(item.Prefixes, masked) {
+				item.Prefixes = append(item.Prefixes, masked)
+			}
+		}
+		if len(item.Addresses) > 0 {
+			res = append(res, item)
+		}
+	}
+	if len(res) < 2 {
+		return nil
+	}
+	return res
+}
+
+// interfaceIPv6Addresses 返回接口上配置的全部IPv6地址
+func interfaceIPv6Addresses(interfaceName string) []InterfaceAddress {
+	addresses, err := listIPv6Addresses()
+	if err != nil {
+		return nil
+	}
+	var res []InterfaceAddress
+	for _, entry := range addresses {
+		if entry.name != interfaceName {
+			continue
+		}
+		for _, prefix := range entry.prefixes {
+			res = append(res, InterfaceAddress{
+				Address:      prefix.Addr().String(),
+				PrefixLength: prefix.Bits(),
+				Global:       !isNonGlobalPrefix(prefix.Addr().As16()),
+			})
+		}
+	}
+	return res
+}
@@ -0,0 +1,139 @@
+package ipv6
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestCollectIPv6PrefixReportFallsBackToUnknown(t *testing.T) {
+	failing := func(name string) prefixMethod {
+		return prefixMethod{name: name, run: func(context.Context, *IPv6PrefixReport, netip.Addr) (int, error) {
+			return 0, errors.New(name + " failed")
+		}}
+	}
+	report := collectIPv6PrefixReport(context.Background(), netip.MustParseAddr("2001:db8::7"), "missing0",
+		[]prefixMethod{failing(MethodRouterAdvertisement), failing(MethodIPCommand)})
+	if report.PrefixLength != PrefixLengthUnknown || report.Method != MethodUnknown || report.Prefix != "" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if len(report.Attempts) != 2 || report.Attempts[1].Method != MethodIPCommand || report.Attempts[1].Error != "ip failed" {
+		t.Fatalf("expected every failed method to be recorded, got %+v", report.Attempts)
+	}
+	if got := formatIPv6Mask(report.PrefixLength, "en"); got != " IPv6 Mask           : unknown\n" {
+		t.Fatalf("unexpected mask line %q", got)
+	}
+}
+
+func TestCollectIPv6PrefixReportUsesFirstSuccessfulMethod(t *testing.T) {
+	methods := []prefixMethod{
+		{name: MethodRouterAdvertisement, run: func(_ context.Context, report *IPv6PrefixReport, publicIPv6 netip.Addr) (int, error) {
+			report.RAPrefixes = append(report.RAPrefixes,
+				RAPrefix{Prefix: "fd00::/64", PrefixLength: 64},
+				RAPrefix{Prefix: "2001:db8::/56", PrefixLength: 56, Global: true})
+			if prefixLen, ok := selectRAPrefix(report.RAPrefixes, publicIPv6); ok {
+				return prefixLen, nil
+			}
+			return 0, errors.New("no global prefix")
+		}},
+		legacyPrefixMethod(MethodIPCommand, func(context.Context) (string, error) {
+			t.Fatal("later methods must not run after a success")
+			return "", nil
+		}),
+	}
+	report := collectIPv6PrefixReport(context.Background(), netip.MustParseAddr("2001:db8:0:ab::7"), "missing0", methods)
+	if report.PrefixLength != "56" || report.Prefix != "2001:db8::/56" || report.Method != MethodRouterAdvertisement || len(report.Attempts) != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if got := formatIPv6Mask(report.PrefixLength, "en"); got != " IPv6 Mask           : /56\n" {
+		t.Fatalf("unexpected mask line %q", got)
+	}
+}
+
+func TestLegacyPrefixMethodRejectsInvalidLength(t *testing.T) {
+	method := legacyPrefixMethod(MethodConfigFiles, func(context.Context) (string, error) { return "129", nil })
+	if _, err := method.run(context.Background(), &IPv6PrefixReport{}, netip.Addr{}); err == nil {
+		t.Fatal("expected an invalid prefix length to be rejected")
+	}
+}
+
+func TestSelectRAPrefixPrefersContainingPrefix(t *testing.T) {
+	prefixes := []RAPrefix{
+		{Prefix: "2001:db8:1::/64", PrefixLength: 64, Global: true},
+		{Prefix: "2001:db8:2::/48", PrefixLength: 48, Global: true},
+	}
+	if prefixLen, ok := selectRAPrefix(prefixes, netip.MustParseAddr("2001:db8:2::9")); !ok || prefixLen != 48 {
+		t.Fatalf("expected the containing prefix, got %d %v", prefixLen, ok)
+	}
+	if prefixLen, ok := selectRAPrefix(prefixes, netip.MustParseAddr("2001:db8:3::9")); !ok || prefixLen != 64 {
+		t.Fatalf("expected the first global prefix, got %d %v", prefixLen, ok)
+	}
+	if _, ok := selectRAPrefix([]RAPrefix{{Prefix: "fe80::/64", PrefixLength: 64}}, netip.MustParseAddr("2001:db8::1")); ok {
+		t.Fatal("expected no prefix without a global one")
+	}
+}
+
+func stubIPv6Addresses(t *testing.T, addresses map[string][]string, order ...string) {
+	t.Helper()
+	old := listIPv6Addresses
+	t.Cleanup(func() { listIPv6Addresses = old })
+	listIPv6Addresses = func() ([]interfaceIPv6, error) {
+		var res []interfaceIPv6
+		for _, name := range order {
+			entry := interfaceIPv6{name: name}
+			for _, value := range addresses[name] {
+				entry.prefixes = append(entry.prefixes, netip.MustParsePrefix(value))
+			}
+			res = append(res, entry)
+		}
+		return res, nil
+	}
+}
+
+func TestGetIPv6PrefixReportSelectsOwningInterface(t *testing.T) {
+	stubIPv6Addresses(t, map[string][]string{
+		"eth0":      {"fe80::1/64", "2001:db8:1::5/64"},
+		"bond0.100": {"fe80::2/64", "2001:db8:2::7/56"},
+		"wg0":       {"2001:db8:3::1/128"},
+	}, "eth0", "bond0.100", "wg0")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := GetIPv6PrefixReportWithOptions(ctx, "2001:db8:2::7", IPv6PrefixOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Interface != "bond0.100" || report.InterfaceSelection != InterfaceSelectionOwner || len(report.Addresses) != 2 {
+		t.Fatalf("unexpected interface selection: %+v", report)
+	}
+	if len(report.Interfaces) != 3 || report.Interfaces[1].Prefixes[0] != "2001:db8:2::/56" || report.Interfaces[2].Prefixes[0] != "2001:db8:3::1/128" {
+		t.Fatalf("unexpected per interface prefixes: %+v", report.Interfaces)
+	}
+	if got := formatIPv6Prefixes(report.Interfaces, "en"); got != " IPv6 Prefixes       : eth0 2001:db8:1::/64, bond0.100 2001:db8:2::/56, wg0 2001:db8:3::1/128\n" {
+		t.Fatalf("unexpected prefixes line %q", got)
+	}
+	// An address behind prefix translation is matched by the containing prefix.
+	report, err = GetIPv6PrefixReportWithOptions(ctx, "2001:db8:1::99", IPv6PrefixOptions{})
+	if err != nil || report.Interface != "eth0" || report.InterfaceSelection != InterfaceSelectionSubnet {
+		t.Fatalf("unexpected selection by prefix: %+v %v", report, err)
+	}
+}
+
+func TestGetIPv6PrefixReportUsesRequestedInterface(t *testing.T) {
+	stubIPv6Addresses(t, map[string][]string{
+		"eth0": {"2001:db8:1::5/64"},
+		"wg0":  {"fd00::1/64"},
+	}, "eth0", "wg0")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := GetIPv6PrefixReportWithOptions(ctx, "2001:db8:1::5", IPv6PrefixOptions{Interface: "wg0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Interface != "wg0" || report.InterfaceSelection != InterfaceSelectionRequested || report.Interfaces != nil {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if _, err := GetIPv6PrefixReportWithOptions(ctx, "2001:db8:1::5", IPv6PrefixOptions{Interface: "missing0"}); err == nil {
+		t.Fatal("expected an unknown interface to be rejected")
+	}
+}
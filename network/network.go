@@ -1,16 +1,18 @@
 package network
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/oneclickvirt/basics/model"
 	"github.com/oneclickvirt/basics/network/baseinfo"
 	"github.com/oneclickvirt/basics/network/ipv6"
+	networkutils "github.com/oneclickvirt/basics/network/utils"
+	"github.com/oneclickvirt/basics/system"
 	. "github.com/oneclickvirt/defaultset"
 )
 
-var runIpCheck = baseinfo.RunIpCheck
-
 // sortAndTranslateText 对原始文本进行排序和翻译
 // func sortAndTranslateText(orginList []string, language string, fields []string) string {
 // 	var result string
@@ -39,7 +41,7 @@ var runIpCheck = baseinfo.RunIpCheck
 // }
 
 // processPrintIPInfo 处理IP信息
-func processPrintIPInfo(ipVersion, language string, ipResult *model.IpInfo) string {
+func processPrintIPInfo(ctx context.Context, ipVersion, language string, ipResult *model.IpInfo, options NetworkCheckOptions) string {
 	if ipResult == nil {
 		return ""
 	}
@@ -83,30 +85,29 @@ func processPrintIPInfo(ipVersion, language string, ipResult *model.IpInfo) stri
 			InitLogger()
 			defer Logger.Sync()
 		}
-		subnetCidrIp := baseinfo.MaskIP(ipResult.Ip)
-		subnetActive, subnetTotal, err1 := baseinfo.GetActiveIpsCount(subnetCidrIp, 24)
-		cidrIp, cidrPrefix := baseinfo.GetCIDRPrefix(ipResult.Ip)
-		prefixActive, prefixTotal, err2 := baseinfo.GetActiveIpsCount(cidrIp, cidrPrefix)
-		if (err1 == nil && subnetActive > 0 && subnetTotal > 0) || (err2 == nil && prefixActive > 0 && prefixTotal > 0) {
+		subnet, prefix := collectIPv4ActiveIPs(ctx, ipResult.Ip)
+		subnetOK := hasActiveIPs(subnet)
+		prefixOK := hasActiveIPs(prefix)
+		if subnetOK || prefixOK {
 			info += " IPV4 Active IPs     :"
-			if err1 == nil && subnetActive > 0 && subnetTotal > 0 {
-				info += fmt.Sprintf(" %d/%d (subnet /24)", subnetActive, subnetTotal)
-			} else if err1 != nil && model.EnableLoger {
-				Logger.Info(fmt.Sprintf("subnet /24 data unavailable: %s", err1.Error()))
+			if subnetOK {
+				info += fmt.Sprintf(" %d/%d (subnet /24)", subnet.Active, subnet.Total)
+			} else if subnet.Error != "" && model.EnableLoger {
+				Logger.Info(fmt.Sprintf("subnet /24 data unavailable: %s", subnet.Error))
 			}
-			if err2 == nil && prefixActive > 0 && prefixTotal > 0 {
-				if cidrPrefix != 24 {
-					info += fmt.Sprintf(" %d/%d (prefix /%d)", prefixActive, prefixTotal, cidrPrefix)
+			if prefixOK {
+				if prefix.PrefixLength != 24 {
+					info += fmt.Sprintf(" %d/%d (prefix /%d)", prefix.Active, prefix.Total, prefix.PrefixLength)
 				}
-			} else if err2 != nil && model.EnableLoger {
-				Logger.Info(fmt.Sprintf("prefix data unavailable: %s", err2.Error()))
+			} else if prefix.Error != "" && model.EnableLoger {
+				Logger.Info(fmt.Sprintf("prefix data unavailable: %s", prefix.Error))
 			}
 			info += "\n"
 		}
 	}
 	// 处理 Ipv6 的Mask信息
 	if ipVersion == "ipv6" && ipResult.Ip != "" {
-		maskInfoV6, err := ipv6.GetIPv6Mask(ipResult.Ip, language)
+		maskInfoV6, err := getIPv6Mask(ctx, ipResult.Ip, language, ipv6.IPv6PrefixOptions{Interface: options.IPv6Interface})
 		if err == nil {
 			info += maskInfoV6
 		}
@@ -114,49 +115,78 @@ func processPrintIPInfo(ipVersion, language string, ipResult *model.IpInfo) stri
 	return info
 }
 
+func hasActiveIPs(report *ActiveIPsReport) bool {
+	return report != nil && report.Availability == system.AvailabilityAvailable && report.Active > 0 && report.Total > 0
+}
+
 // NetworkCheck 查询网络信息
 // checkType 可选 both ipv4 ipv6
 // language 暂时仅支持 en 或 zh
+//
+// Deprecated: 请使用 NetworkCheckContext，以便调用方取消请求。
 func NetworkCheck(checkType string, enableSecurityCheck bool, language string) (string, string, string, string, error) {
+	return NetworkCheckContext(context.Background(), checkType, enableSecurityCheck, language, NetworkCheckOptions{})
+}
+
+// NetworkCheckOptions 控制 NetworkCheckContext 的可选行为，零值即默认行为
+type NetworkCheckOptions struct {
+	// IPv6Interface 指定探测IPv6前缀的网络接口，为空时自动选择
+	IPv6Interface string
+	// IPConflicts 为 true 时额外输出各提供商取值不一致的字段
+	IPConflicts bool
+}
+
+// NetworkCheckContext 查询网络信息
+// checkType 可选 both ipv4 ipv6
+// language 暂时仅支持 en 或 zh
+// ctx 的截止时间约束整个查询过程，超时后进行中的请求会被中止
+func NetworkCheckContext(ctx context.Context, checkType string, enableSecurityCheck bool, language string, options NetworkCheckOptions) (string, string, string, string, error) {
 	if model.EnableLoger {
 		InitLogger()
 		defer Logger.Sync()
 	}
+	if checkType != "both" && checkType != "ipv4" && checkType != "ipv6" {
+		return "", "", "", "", fmt.Errorf("wrong in NetworkCheckContext")
+	}
 	var ipv4, ipv6, ipInfo string
-	if checkType == "both" {
-		ipInfoV4Result, ipInfoV6Result, err := runIpCheck("both")
-		if err != nil && model.EnableLoger {
-			Logger.Info(err.Error())
-		}
-		if ipInfoV4Result != nil {
-			ipInfo += processPrintIPInfo("ipv4", language, ipInfoV4Result)
-			ipv4 = ipInfoV4Result.Ip
-		}
-		if ipInfoV6Result != nil {
-			ipInfo += processPrintIPInfo("ipv6", language, ipInfoV6Result)
-			ipv6 = ipInfoV6Result.Ip
-		}
-		return ipv4, ipv6, ipInfo, "", nil
-	} else if checkType == "ipv4" {
-		ipInfoV4Result, _, err := runIpCheck("ipv4")
-		if err != nil && model.EnableLoger {
-			Logger.Info(err.Error())
-		}
-		if ipInfoV4Result != nil {
-			ipInfo += processPrintIPInfo("ipv4", language, ipInfoV4Result)
-			ipv4 = ipInfoV4Result.Ip
-		}
-		return ipv4, ipv6, ipInfo, "", nil
-	} else if checkType == "ipv6" {
-		_, ipInfoV6Result, err := runIpCheck("ipv6")
-		if err != nil && model.EnableLoger {
-			Logger.Info(err.Error())
+	ipInfoV4Result, ipInfoV6Result, err := runIpCheckWithSources(ctx, checkType)
+	if err != nil && model.EnableLoger {
+		Logger.Info(err.Error())
+	}
+	if checkType != "ipv6" && ipInfoV4Result != nil && ipInfoV4Result.Info != nil {
+		ipInfo += processPrintIPInfo(ctx, "ipv4", language, ipInfoV4Result.Info, options)
+		ipInfo += formatIPConflicts("ipv4", ipInfoV4Result, options.IPConflicts)
+		ipv4 = ipInfoV4Result.Info.Ip
+	}
+	if checkType != "ipv4" && ipInfoV6Result != nil && ipInfoV6Result.Info != nil {
+		ipInfo += processPrintIPInfo(ctx, "ipv6", language, ipInfoV6Result.Info, options)
+		ipInfo += formatIPConflicts("ipv6", ipInfoV6Result, options.IPConflicts)
+		ipv6 = ipInfoV6Result.Info.Ip
+	}
+	return ipv4, ipv6, ipInfo, "", nil
+}
+
+// formatIPConflicts 在 enabled 为 true 时输出各提供商取值不一致的字段，
+// 例如 " IPV4 Conflicts      : country NL (ipinfo) vs DE (cloudflare)"
+func formatIPConflicts(ipVersion string, result *baseinfo.IpCheckResult, enabled bool) string {
+	if !enabled || len(result.Conflicts) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, field := range networkutils.IpInfoFieldNames {
+		conflicts := result.Conflicts[field]
+		if len(conflicts) == 0 {
+			continue
 		}
-		if ipInfoV6Result != nil {
-			ipInfo += processPrintIPInfo("ipv6", language, ipInfoV6Result)
-			ipv6 = ipInfoV6Result.Ip
+		part := fmt.Sprintf("%s %s (%s)", field, networkutils.IpInfoField(result.Info, field), result.FieldSources[field])
+		for _, conflict := range conflicts {
+			part += fmt.Sprintf(" vs %s (%s)", conflict.Value, conflict.Source)
 		}
-		return ipv4, ipv6, ipInfo, "", nil
+		parts = append(parts, part)
+	}
+	head := " IPV4 Conflicts      : "
+	if ipVersion == "ipv6" {
+		head = " IPV6 Conflicts      : "
 	}
-	return "", "", "", "", fmt.Errorf("wrong in NetworkCheck")
+	return head + strings.Join(parts, "; ") + "\n"
 }
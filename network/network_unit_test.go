@@ -1,24 +1,42 @@
 package network
 
 import (
+	"context"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/oneclickvirt/basics/model"
+	"github.com/oneclickvirt/basics/network/baseinfo"
+	"github.com/oneclickvirt/basics/network/ipv6"
+	networkutils "github.com/oneclickvirt/basics/network/utils"
+)
+
+// The signatures from before the context variants are kept for existing
+// importers.
+var (
+	_ func(string, bool, string) (string, string, string, string, error)     = NetworkCheck
+	_ func(string) (*model.IpInfo, *model.IpInfo, error)                     = baseinfo.RunIpCheck
+	_ func(string) (*baseinfo.IpCheckResult, *baseinfo.IpCheckResult, error) = baseinfo.RunIpCheckWithSources
+	_ func(string) (*model.IpInfo, error)                                    = baseinfo.FetchIPInfoIo
+	_ func(string, string) (*model.IpInfo, error)                            = baseinfo.FetchIPApiASN
+	_ func(string) (string, int)                                             = baseinfo.GetCIDRPrefix
+	_ func(string, int) (int, int, error)                                    = baseinfo.GetActiveIpsCount
+	_ func(string, string) (string, error)                                   = ipv6.GetIPv6Mask
 )
 
 func TestNetworkCheckIPv6UsesSecondResult(t *testing.T) {
-	old := runIpCheck
-	t.Cleanup(func() { runIpCheck = old })
+	old := runIpCheckWithSources
+	t.Cleanup(func() { runIpCheckWithSources = old })
 
-	runIpCheck = func(checkType string) (*model.IpInfo, *model.IpInfo, error) {
+	runIpCheckWithSources = func(ctx context.Context, checkType string) (*baseinfo.IpCheckResult, *baseinfo.IpCheckResult, error) {
 		if checkType != "ipv6" {
 			t.Fatalf("unexpected checkType: %s", checkType)
 		}
-		return nil, &model.IpInfo{Ip: "2001:db8::1"}, nil
+		return nil, &baseinfo.IpCheckResult{Info: &model.IpInfo{Ip: "2001:db8::1"}}, nil
 	}
 
-	ipv4, ipv6, _, _, err := NetworkCheck("ipv6", false, "en")
+	ipv4, ipv6, _, _, err := NetworkCheckContext(context.Background(), "ipv6", false, "en", NetworkCheckOptions{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -30,15 +48,30 @@ func TestNetworkCheckIPv6UsesSecondResult(t *testing.T) {
 	}
 }
 
+func TestNetworkCheckPassesIPv6Interface(t *testing.T) {
+	oldCheck, oldMask := runIpCheckWithSources, getIPv6Mask
+	t.Cleanup(func() { runIpCheckWithSources, getIPv6Mask = oldCheck, oldMask })
+	runIpCheckWithSources = func(ctx context.Context, checkType string) (*baseinfo.IpCheckResult, *baseinfo.IpCheckResult, error) {
+		return nil, &baseinfo.IpCheckResult{Info: &model.IpInfo{Ip: "2001:db8::1"}}, nil
+	}
+	getIPv6Mask = func(ctx context.Context, ip, language string, options ipv6.IPv6PrefixOptions) (string, error) {
+		return " IPV6 Mask           : /64 via " + options.Interface + "\n", nil
+	}
+	_, _, ipInfo, _, _ := NetworkCheckContext(context.Background(), "ipv6", false, "en", NetworkCheckOptions{IPv6Interface: "wg0"})
+	if !strings.Contains(ipInfo, "/64 via wg0") {
+		t.Fatalf("interface not passed to the prefix probe: %q", ipInfo)
+	}
+}
+
 func TestNetworkCheckKeepsRunningWhenRunIpCheckErrors(t *testing.T) {
-	old := runIpCheck
-	t.Cleanup(func() { runIpCheck = old })
+	old := runIpCheckWithSources
+	t.Cleanup(func() { runIpCheckWithSources = old })
 
-	runIpCheck = func(checkType string) (*model.IpInfo, *model.IpInfo, error) {
+	runIpCheckWithSources = func(ctx context.Context, checkType string) (*baseinfo.IpCheckResult, *baseinfo.IpCheckResult, error) {
 		return nil, nil, errors.New("upstream failed")
 	}
 
-	ipv4, ipv6, ipInfo, _, err := NetworkCheck("both", false, "en")
+	ipv4, ipv6, ipInfo, _, err := NetworkCheckContext(context.Background(), "both", false, "en", NetworkCheckOptions{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -46,3 +79,27 @@ func TestNetworkCheckKeepsRunningWhenRunIpCheckErrors(t *testing.T) {
 		t.Fatalf("expected empty result when all providers fail, got ipv4=%q ipv6=%q ipInfo=%q", ipv4, ipv6, ipInfo)
 	}
 }
+
+func TestNetworkCheckPrintsConflictsWhenEnabled(t *testing.T) {
+	old := runIpCheckWithSources
+	t.Cleanup(func() { runIpCheckWithSources = old })
+
+	runIpCheckWithSources = func(ctx context.Context, checkType string) (*baseinfo.IpCheckResult, *baseinfo.IpCheckResult, error) {
+		return nil, &baseinfo.IpCheckResult{
+			Info:         &model.IpInfo{Ip: "2001:db8::1", Country: "NL", City: "Amsterdam"},
+			FieldSources: map[string]string{"country": "ipinfo", "city": "ipinfo"},
+			Conflicts: map[string][]networkutils.SourcedValue{
+				"city":    {{Source: "ipsb", Value: "Rotterdam"}},
+				"country": {{Source: "cloudflare", Value: "DE"}, {Source: "ipsb", Value: "Germany"}},
+			},
+		}, nil
+	}
+	want := " IPV6 Conflicts      : country NL (ipinfo) vs DE (cloudflare) vs Germany (ipsb); city Amsterdam (ipinfo) vs Rotterdam (ipsb)\n"
+
+	if _, _, ipInfo, _, _ := NetworkCheckContext(context.Background(), "ipv6", false, "en", NetworkCheckOptions{}); strings.Contains(ipInfo, "Conflicts") {
+		t.Fatalf("conflicts must only be printed when enabled, got %q", ipInfo)
+	}
+	if _, _, ipInfo, _, _ := NetworkCheckContext(context.Background(), "ipv6", false, "en", NetworkCheckOptions{IPConflicts: true}); !strings.HasSuffix(ipInfo, want) {
+		t.Fatalf("expected conflicts line %q, got %q", want, ipInfo)
+	}
+}
@@ -0,0 +1,285 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oneclickvirt/basics/network/baseinfo"
+	"github.com/oneclickvirt/basics/network/ipv6"
+	networkutils "github.com/oneclickvirt/basics/network/utils"
+	"github.com/oneclickvirt/basics/system"
+	"github.com/oneclickvirt/basics/utils"
+)
+
+// NetworkReport 是 NetworkCheckContext 文本输出对应的结构化结果，
+// Availability/Error 的约定与 system.ReportSection 一致
+type NetworkReport struct {
+	system.ReportSection
+	// StackType 来自 utils.CheckPublicAccess: IPv4 IPv6 DualStack None
+	StackType string         `json:"stack_type,omitempty"`
+	IPv4      IPFamilyReport `json:"ipv4"`
+	IPv6      IPFamilyReport `json:"ipv6"`
+	// NAT 通过 STUN 判断的 NAT 类型，优先使用 IPv4
+	NAT *system.NATReport `json:"nat,omitempty"`
+}
+
+// IPFamilyReport 单个协议族的公网IP信息
+type IPFamilyReport struct {
+	system.ReportSection
+	IP      string `json:"ip,omitempty"`
+	ASN     string `json:"asn,omitempty"`
+	Org     string `json:"org,omitempty"`
+	Country string `json:"country,omitempty"`
+	Region  string `json:"region,omitempty"`
+	City    string `json:"city,omitempty"`
+	// Sources 按合并顺序列出返回了数据的提供商
+	Sources []string `json:"sources,omitempty"`
+	// FieldSources 记录每个字段最终取自哪个提供商
+	FieldSources map[string]string `json:"field_sources,omitempty"`
+	// Conflicts 记录其他提供商给出的与最终取值不一致的值
+	Conflicts map[string][]networkutils.SourcedValue `json:"conflicts,omitempty"`
+	// SubnetActiveIPs 与 PrefixActiveIPs 仅对 IPv4 收集
+	SubnetActiveIPs *ActiveIPsReport `json:"subnet_active_ips,omitempty"`
+	PrefixActiveIPs *ActiveIPsReport `json:"prefix_active_ips,omitempty"`
+	// PrefixLength 与 IPv6Prefix 仅对 IPv6 收集，前缀长度未知时 PrefixLength 为空
+	PrefixLength *int                   `json:"prefix_length,omitempty"`
+	IPv6Prefix   *ipv6.IPv6PrefixReport `json:"ipv6_prefix,omitempty"`
+	// PublicIP 不依赖IP信息提供商的出口地址探测与寻址方式判断
+	PublicIP *PublicIPReport `json:"public_ip,omitempty"`
+}
+
+// PublicIPReport 出口地址探测结果，未能确定出口地址时为 unavailable
+type PublicIPReport struct {
+	system.ReportSection
+	baseinfo.PublicIPDiscovery
+}
+
+// NetworkReportOptions CollectNetworkReportWithOptions 的可选配置，零值使用默认值
+type NetworkReportOptions struct {
+	PublicIP baseinfo.PublicIPDiscoveryConfig
+	// NAT.IPVersion 为空时按连通的协议族选择
+	NAT system.NATProbeConfig
+	// IPv6Prefix.Interface 为空时自动选择持有公网IPv6的接口
+	IPv6Prefix ipv6.IPv6PrefixOptions
+}
+
+// ActiveIPsReport 某个网段在 bgp.tools 上的活跃IP估算
+type ActiveIPsReport struct {
+	system.ReportSection
+	Network      string `json:"network,omitempty"`
+	PrefixLength int    `json:"prefix_length,omitempty"`
+	Active       int    `json:"active"`
+	Total        int    `json:"total"`
+}
+
+var (
+	checkPublicAccess     = utils.CheckPublicAccess
+	runIpCheckWithSources = baseinfo.RunIpCheckWithSourcesContext
+	getCIDRPrefix         = baseinfo.GetCIDRPrefixContext
+	getActiveIpsCount     = baseinfo.GetActiveIpsCountContext
+	getIPv6PrefixReport   = ipv6.GetIPv6PrefixReportWithOptions
+	getIPv6Mask           = ipv6.GetIPv6MaskWithOptions
+	hasOfflineProvider    = baseinfo.HasOfflineIPInfoProvider
+	discoverPublicIP      = baseinfo.DiscoverPublicIP
+	collectNATReport      = system.CollectNATReport
+)
+
+// CollectNetworkReport 检测公网连通性并收集各协议族的IP信息
+// ctx 结束时中止进行中的请求，未完成的分区标记为 canceled
+func CollectNetworkReport(ctx context.Context) *NetworkReport {
+	return CollectNetworkReportWithOptions(ctx, NetworkReportOptions{})
+}
+
+// CollectNetworkReportWithOptions 与 CollectNetworkReport 相同，可指定出口地址探测等配置
+func CollectNetworkReportWithOptions(ctx context.Context, options NetworkReportOptions) *NetworkReport {
+	if err := ctx.Err(); err != nil {
+		report := &NetworkReport{ReportSection: canceledSection(err)}
+		report.IPv4.ReportSection = report.ReportSection
+		report.IPv6.ReportSection = report.ReportSection
+		return report
+	}
+	probeTimeout := 3 * time.Second
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < probeTimeout {
+		probeTimeout = time.Until(deadline)
+	}
+	access := checkPublicAccess(probeTimeout)
+	report := &NetworkReport{StackType: access.StackType}
+	checkType := checkTypeForStack(access.StackType)
+	online := access.Connected && checkType != ""
+	if !online && hasOfflineProvider() {
+		// 无公网连通性时仍可由离线数据库根据本机网卡地址给出结果
+		checkType = "both"
+	} else if !online {
+		report.ReportSection = unavailableSection("no public network access")
+		report.IPv4.ReportSection = unavailableSection("no public network access")
+		report.IPv6.ReportSection = unavailableSection("no public network access")
+		return report
+	}
+	// 出口地址探测与IP信息查询相互独立，并行进行
+	var discoveries [2]*baseinfo.PublicIPDiscovery
+	var wg sync.WaitGroup
+	if online {
+		for index, family := range []string{"ipv4", "ipv6"} {
+			if checkType != "both" && checkType != family {
+				continue
+			}
+			wg.Add(1)
+			go func(index int, family string) {
+				defer wg.Done()
+				discoveries[index] = discoverPublicIP(ctx, family, options.PublicIP)
+			}(index, family)
+		}
+		natConfig := options.NAT
+		if natConfig.IPVersion == "" {
+			natConfig.IPVersion = "ipv4"
+			if checkType == "ipv6" {
+				natConfig.IPVersion = "ipv6"
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nat := collectNATReport(ctx, natConfig)
+			report.NAT = &nat
+		}()
+	}
+	ipv4Result, ipv6Result, err := runIpCheckWithSources(ctx, checkType)
+	wg.Wait()
+	if err != nil {
+		report.ReportSection = system.ReportSection{Availability: system.AvailabilityError, Error: err.Error()}
+		report.IPv4.ReportSection = report.ReportSection
+		report.IPv6.ReportSection = report.ReportSection
+		return report
+	}
+	report.IPv4 = collectIPFamilyReport(ctx, "ipv4", checkType == "both" || checkType == "ipv4", online, ipv4Result, options)
+	report.IPv6 = collectIPFamilyReport(ctx, "ipv6", checkType == "both" || checkType == "ipv6", online, ipv6Result, options)
+	report.IPv4.PublicIP = publicIPReport(ctx, discoveries[0])
+	report.IPv6.PublicIP = publicIPReport(ctx, discoveries[1])
+	if err := ctx.Err(); err != nil {
+		report.ReportSection = canceledSection(err)
+		for _, family := range []*IPFamilyReport{&report.IPv4, &report.IPv6} {
+			if family.Availability != system.AvailabilityAvailable {
+				family.ReportSection = canceledSection(err)
+			}
+		}
+		return report
+	}
+	if report.IPv4.Availability == system.AvailabilityAvailable || report.IPv6.Availability == system.AvailabilityAvailable {
+		report.Availability = system.AvailabilityAvailable
+	} else {
+		report.ReportSection = unavailableSection("no IP information provider answered")
+	}
+	return report
+}
+
+// checkTypeForStack 将 CheckPublicAccess 的栈类型转换为 NetworkCheckContext 的 checkType
+func checkTypeForStack(stackType string) string {
+	switch stackType {
+	case "DualStack":
+		return "both"
+	case "IPv4":
+		return "ipv4"
+	case "IPv6":
+		return "ipv6"
+	}
+	return ""
+}
+
+// online 为 false 时跳过需要访问 bgp.tools 的活跃IP统计
+func collectIPFamilyReport(ctx context.Context, ipVersion string, checked, online bool, result *baseinfo.IpCheckResult, options NetworkReportOptions) IPFamilyReport {
+	if !checked {
+		return IPFamilyReport{ReportSection: unavailableSection("no " + familyLabel(ipVersion) + " connectivity")}
+	}
+	if result == nil || result.Info == nil {
+		return IPFamilyReport{ReportSection: unavailableSection("no IP information provider answered")}
+	}
+	info := result.Info
+	report := IPFamilyReport{
+		ReportSection: system.ReportSection{Availability: system.AvailabilityAvailable},
+		IP:            info.Ip,
+		ASN:           info.ASN,
+		Org:           info.Org,
+		Country:       info.Country,
+		Region:        info.Region,
+		City:          info.City,
+		Sources:       result.Sources,
+		FieldSources:  result.FieldSources,
+		Conflicts:     result.Conflicts,
+	}
+	if ipVersion == "ipv4" && online {
+		report.SubnetActiveIPs, report.PrefixActiveIPs = collectIPv4ActiveIPs(ctx, info.Ip)
+	}
+	if ipVersion == "ipv6" && info.Ip != "" {
+		if prefixReport, err := getIPv6PrefixReport(ctx, info.Ip, options.IPv6Prefix); err == nil {
+			report.IPv6Prefix = prefixReport
+			if value, err := strconv.Atoi(prefixReport.PrefixLength); err == nil {
+				report.PrefixLength = &value
+			}
+		}
+	}
+	return report
+}
+
+func publicIPReport(ctx context.Context, discovery *baseinfo.PublicIPDiscovery) *PublicIPReport {
+	if discovery == nil {
+		return nil
+	}
+	report := &PublicIPReport{PublicIPDiscovery: *discovery}
+	switch {
+	case discovery.EgressIP != "":
+		report.Availability = system.AvailabilityAvailable
+	case ctx.Err() != nil:
+		report.ReportSection = canceledSection(ctx.Err())
+	default:
+		report.ReportSection = unavailableSection("no egress address discovered")
+	}
+	return report
+}
+
+// collectIPv4ActiveIPs 查询公网IPv4所在 /24 与 BGP 前缀的活跃IP数量
+func collectIPv4ActiveIPs(ctx context.Context, ip string) (*ActiveIPsReport, *ActiveIPsReport) {
+	subnetIP := baseinfo.MaskIP(ip)
+	if subnetIP == "" {
+		return nil, nil
+	}
+	subnet := countActiveIPs(ctx, subnetIP, 24)
+	cidrIP, cidrPrefix := getCIDRPrefix(ctx, ip)
+	if cidrIP == "" || cidrPrefix < 0 {
+		return subnet, &ActiveIPsReport{ReportSection: unavailableSection("BGP prefix not found")}
+	}
+	return subnet, countActiveIPs(ctx, cidrIP, cidrPrefix)
+}
+
+func countActiveIPs(ctx context.Context, ip string, prefixLength int) *ActiveIPsReport {
+	report := &ActiveIPsReport{Network: fmt.Sprintf("%s/%d", ip, prefixLength), PrefixLength: prefixLength}
+	active, total, err := getActiveIpsCount(ctx, ip, prefixLength)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			report.ReportSection = canceledSection(ctxErr)
+			return report
+		}
+		report.ReportSection = unavailableSection(err.Error())
+		return report
+	}
+	report.Availability = system.AvailabilityAvailable
+	report.Active, report.Total = active, total
+	return report
+}
+
+func unavailableSection(reason string) system.ReportSection {
+	return system.ReportSection{Availability: system.AvailabilityUnavailable, Error: reason}
+}
+
+func canceledSection(err error) system.ReportSection {
+	return system.ReportSection{Availability: system.AvailabilityCanceled, Error: err.Error()}
+}
+
+func familyLabel(ipVersion string) string {
+	if ipVersion == "ipv6" {
+		return "IPv6"
+	}
+	return "IPv4"
+}
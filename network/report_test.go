@@ -0,0 +1,262 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oneclickvirt/basics/model"
+	"github.com/oneclickvirt/basics/network/baseinfo"
+	"github.com/oneclickvirt/basics/network/ipv6"
+	networkutils "github.com/oneclickvirt/basics/network/utils"
+	"github.com/oneclickvirt/basics/system"
+	"github.com/oneclickvirt/basics/utils"
+)
+
+func stubNetworkReport(t *testing.T, access utils.NetCheckResult, v4, v6 *baseinfo.IpCheckResult) {
+	t.Helper()
+	oldAccess, oldRun, oldCIDR, oldActive, oldPrefix, oldOffline := checkPublicAccess, runIpCheckWithSources, getCIDRPrefix, getActiveIpsCount, getIPv6PrefixReport, hasOfflineProvider
+	t.Cleanup(func() {
+		checkPublicAccess, runIpCheckWithSources, getCIDRPrefix, getActiveIpsCount, getIPv6PrefixReport, hasOfflineProvider = oldAccess, oldRun, oldCIDR, oldActive, oldPrefix, oldOffline
+	})
+	hasOfflineProvider = func() bool { return false }
+	checkPublicAccess = func(time.Duration) utils.NetCheckResult { return access }
+	runIpCheckWithSources = func(ctx context.Context, checkType string) (*baseinfo.IpCheckResult, *baseinfo.IpCheckResult, error) {
+		return v4, v6, nil
+	}
+	getCIDRPrefix = func(ctx context.Context, ip string) (string, int) { return "203.0.112.0", 22 }
+	getActiveIpsCount = func(ctx context.Context, ip string, prefix int) (int, int, error) {
+		if prefix == 24 {
+			return 12, 256, nil
+		}
+		return 0, 0, errors.New("bgp.tools unavailable")
+	}
+	getIPv6PrefixReport = func(ctx context.Context, ip string, options ipv6.IPv6PrefixOptions) (*ipv6.IPv6PrefixReport, error) {
+		return &ipv6.IPv6PrefixReport{Interface: "eth0", PrefixLength: "64", Prefix: "2001:db8::/64", Method: ipv6.MethodRouterAdvertisement}, nil
+	}
+	oldDiscover, oldNAT := discoverPublicIP, collectNATReport
+	t.Cleanup(func() { discoverPublicIP, collectNATReport = oldDiscover, oldNAT })
+	collectNATReport = func(ctx context.Context, config system.NATProbeConfig) system.NATReport {
+		return system.NATReport{ReportSection: system.ReportSection{Availability: system.AvailabilityAvailable}, NATType: "Full Cone", Method: system.NATMethodRFC5389}
+	}
+	discoverPublicIP = func(ctx context.Context, family string, config baseinfo.PublicIPDiscoveryConfig) *baseinfo.PublicIPDiscovery {
+		return &baseinfo.PublicIPDiscovery{Family: family, Addressing: baseinfo.AddressingUnknown}
+	}
+}
+
+func TestCollectNetworkReportDualStack(t *testing.T) {
+	stubNetworkReport(t,
+		utils.NetCheckResult{Connected: true, HasIPv4: true, HasIPv6: true, StackType: "DualStack"},
+		&baseinfo.IpCheckResult{
+			Info:         &model.IpInfo{Ip: "203.0.113.7", ASN: "64500", Org: "Example Net", Country: "NL", City: "Amsterdam"},
+			Sources:      []string{"ipinfo", "cloudflare"},
+			FieldSources: map[string]string{"ip": "cloudflare", "asn": "ipinfo"},
+			Conflicts:    map[string][]networkutils.SourcedValue{"city": {{Source: "cloudflare", Value: "Rotterdam"}}},
+		},
+		&baseinfo.IpCheckResult{Info: &model.IpInfo{Ip: "2001:db8::7"}, Sources: []string{"ipsb"}},
+	)
+	report := CollectNetworkReport(context.Background())
+	if report.Availability != system.AvailabilityAvailable || report.StackType != "DualStack" {
+		t.Fatalf("unexpected report header: %+v", report.ReportSection)
+	}
+	v4 := report.IPv4
+	if v4.IP != "203.0.113.7" || v4.ASN != "64500" || v4.FieldSources["asn"] != "ipinfo" || len(v4.Sources) != 2 {
+		t.Fatalf("unexpected ipv4 report: %+v", v4)
+	}
+	if v4.SubnetActiveIPs == nil || v4.SubnetActiveIPs.Network != "203.0.113.0/24" || v4.SubnetActiveIPs.Active != 12 || v4.SubnetActiveIPs.Total != 256 {
+		t.Fatalf("unexpected subnet active ips: %+v", v4.SubnetActiveIPs)
+	}
+	if v4.PrefixActiveIPs == nil || v4.PrefixActiveIPs.Availability != system.AvailabilityUnavailable || v4.PrefixActiveIPs.PrefixLength != 22 {
+		t.Fatalf("expected unavailable prefix active ips, got %+v", v4.PrefixActiveIPs)
+	}
+	v6 := report.IPv6
+	if v6.Availability != system.AvailabilityAvailable || v6.PrefixLength == nil || *v6.PrefixLength != 64 || v6.SubnetActiveIPs != nil {
+		t.Fatalf("unexpected ipv6 report: %+v", v6)
+	}
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"stack_type":"DualStack"`, `"field_sources":{"asn":"ipinfo","ip":"cloudflare"}`, `"prefix_length":64`, `"ipv6_prefix":{"interface":"eth0","prefix_length":"64","prefix":"2001:db8::/64","method":"router_advertisement"}`, `"conflicts":{"city":[{"source":"cloudflare","value":"Rotterdam"}]}`} {
+		if !strings.Contains(string(encoded), key) {
+			t.Fatalf("expected %s in %s", key, encoded)
+		}
+	}
+}
+
+func TestCollectNetworkReportIPv4OnlyMarksIPv6Unavailable(t *testing.T) {
+	stubNetworkReport(t,
+		utils.NetCheckResult{Connected: true, HasIPv4: true, StackType: "IPv4"},
+		&baseinfo.IpCheckResult{Info: &model.IpInfo{Ip: "203.0.113.7"}},
+		nil,
+	)
+	report := CollectNetworkReport(context.Background())
+	if report.IPv4.Availability != system.AvailabilityAvailable {
+		t.Fatalf("expected ipv4 available, got %+v", report.IPv4.ReportSection)
+	}
+	if report.IPv6.Availability != system.AvailabilityUnavailable || report.IPv6.Error != "no IPv6 connectivity" {
+		t.Fatalf("expected ipv6 unavailable, got %+v", report.IPv6.ReportSection)
+	}
+}
+
+func TestCollectNetworkReportWithoutPublicAccess(t *testing.T) {
+	stubNetworkReport(t, utils.NetCheckResult{StackType: "None"}, nil, nil)
+	runIpCheckWithSources = func(context.Context, string) (*baseinfo.IpCheckResult, *baseinfo.IpCheckResult, error) {
+		t.Fatal("providers must not be queried without public access")
+		return nil, nil, nil
+	}
+	report := CollectNetworkReport(context.Background())
+	if report.Availability != system.AvailabilityUnavailable || report.IPv4.Availability != system.AvailabilityUnavailable {
+		t.Fatalf("expected unavailable report, got %+v", report)
+	}
+}
+
+func TestCollectNetworkReportNoProviderAnswered(t *testing.T) {
+	stubNetworkReport(t, utils.NetCheckResult{Connected: true, HasIPv4: true, StackType: "IPv4"}, nil, nil)
+	report := CollectNetworkReport(context.Background())
+	if report.Availability != system.AvailabilityUnavailable || report.IPv4.Error != "no IP information provider answered" {
+		t.Fatalf("expected unavailable report, got %+v", report)
+	}
+}
+
+func TestProcessPrintIPInfoUsesActiveIPReports(t *testing.T) {
+	stubNetworkReport(t, utils.NetCheckResult{}, nil, nil)
+	getActiveIpsCount = func(ctx context.Context, ip string, prefix int) (int, int, error) {
+		if prefix == 24 {
+			return 12, 256, nil
+		}
+		return 300, 1024, nil
+	}
+	info := processPrintIPInfo(context.Background(), "ipv4", "en", &model.IpInfo{Ip: "203.0.113.7"}, NetworkCheckOptions{})
+	if info != " IPV4 Active IPs     : 12/256 (subnet /24) 300/1024 (prefix /22)\n" {
+		t.Fatalf("unexpected text: %q", info)
+	}
+}
+
+func TestCollectNetworkReportMarksUnfinishedFamiliesCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stubNetworkReport(t,
+		utils.NetCheckResult{Connected: true, HasIPv4: true, HasIPv6: true, StackType: "DualStack"},
+		&baseinfo.IpCheckResult{Info: &model.IpInfo{Ip: "203.0.113.7"}},
+		nil,
+	)
+	getActiveIpsCount = func(ctx context.Context, ip string, prefix int) (int, int, error) {
+		cancel()
+		return 0, 0, ctx.Err()
+	}
+	report := CollectNetworkReport(ctx)
+	if report.Availability != system.AvailabilityCanceled || report.IPv6.Availability != system.AvailabilityCanceled {
+		t.Fatalf("expected canceled report, got %+v", report)
+	}
+	if report.IPv4.Availability != system.AvailabilityAvailable || report.IPv4.SubnetActiveIPs.Availability != system.AvailabilityCanceled {
+		t.Fatalf("expected ipv4 data kept with canceled active ips, got %+v", report.IPv4)
+	}
+}
+
+func TestCollectNetworkReportSkipsProbesAfterDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stubNetworkReport(t, utils.NetCheckResult{}, nil, nil)
+	checkPublicAccess = func(time.Duration) utils.NetCheckResult {
+		t.Fatal("public access must not be probed after the deadline")
+		return utils.NetCheckResult{}
+	}
+	if report := CollectNetworkReport(ctx); report.Availability != system.AvailabilityCanceled {
+		t.Fatalf("expected canceled report, got %+v", report.ReportSection)
+	}
+}
+
+func TestCollectNetworkReportUsesOfflineProvidersWithoutPublicAccess(t *testing.T) {
+	stubNetworkReport(t, utils.NetCheckResult{StackType: "None"},
+		&baseinfo.IpCheckResult{Info: &model.IpInfo{Ip: "203.0.113.7", ASN: "64500"}, Sources: []string{"mmdb"}},
+		nil,
+	)
+	hasOfflineProvider = func() bool { return true }
+	getActiveIpsCount = func(context.Context, string, int) (int, int, error) {
+		t.Fatal("active IPs must not be queried without public access")
+		return 0, 0, nil
+	}
+	report := CollectNetworkReport(context.Background())
+	if report.Availability != system.AvailabilityAvailable || report.IPv4.ASN != "64500" || report.IPv4.SubnetActiveIPs != nil {
+		t.Fatalf("expected offline ipv4 data, got %+v", report)
+	}
+}
+
+func TestCollectNetworkReportDiscoversPublicIPPerFamily(t *testing.T) {
+	stubNetworkReport(t,
+		utils.NetCheckResult{Connected: true, HasIPv4: true, StackType: "IPv4"},
+		&baseinfo.IpCheckResult{Info: &model.IpInfo{Ip: "203.0.113.7"}},
+		nil,
+	)
+	var families []string
+	discoverPublicIP = func(ctx context.Context, family string, config baseinfo.PublicIPDiscoveryConfig) *baseinfo.PublicIPDiscovery {
+		families = append(families, family)
+		if config.URL != "http://127.0.0.1/ip" {
+			t.Fatalf("discovery options not passed through: %+v", config)
+		}
+		return &baseinfo.PublicIPDiscovery{Family: family, EgressIP: "203.0.113.7", InterfaceIPs: []string{"203.0.113.7"}, Addressing: baseinfo.AddressingDirect}
+	}
+	report := CollectNetworkReportWithOptions(context.Background(), NetworkReportOptions{PublicIP: baseinfo.PublicIPDiscoveryConfig{URL: "http://127.0.0.1/ip"}})
+	if len(families) != 1 || families[0] != "ipv4" || report.IPv6.PublicIP != nil {
+		t.Fatalf("expected discovery only for ipv4, got %v", families)
+	}
+	publicIP := report.IPv4.PublicIP
+	if publicIP == nil || publicIP.Availability != system.AvailabilityAvailable || publicIP.Addressing != baseinfo.AddressingDirect {
+		t.Fatalf("unexpected public ip report: %+v", publicIP)
+	}
+	encoded, err := json.Marshal(report.IPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(encoded), `"public_ip":{"availability":"available","family":"ipv4","egress_ip":"203.0.113.7","interface_ips":["203.0.113.7"],"addressing":"direct"}`) {
+		t.Fatalf("unexpected json: %s", encoded)
+	}
+}
+
+func TestCollectNetworkReportIncludesNATForConnectedFamily(t *testing.T) {
+	stubNetworkReport(t,
+		utils.NetCheckResult{Connected: true, HasIPv6: true, StackType: "IPv6"},
+		nil,
+		&baseinfo.IpCheckResult{Info: &model.IpInfo{Ip: "2001:db8::7"}},
+	)
+	collectNATReport = func(ctx context.Context, config system.NATProbeConfig) system.NATReport {
+		if config.IPVersion != "ipv6" || len(config.Servers) != 1 || config.Servers[0] != "127.0.0.1:3478" {
+			t.Fatalf("unexpected NAT config: %+v", config)
+		}
+		return system.NATReport{ReportSection: system.ReportSection{Availability: system.AvailabilityAvailable}, NATType: "Symmetric"}
+	}
+	report := CollectNetworkReportWithOptions(context.Background(), NetworkReportOptions{NAT: system.NATProbeConfig{Servers: []string{"127.0.0.1:3478"}}})
+	if report.NAT == nil || report.NAT.NATType != "Symmetric" {
+		t.Fatalf("unexpected NAT report: %+v", report.NAT)
+	}
+}
+
+func TestCollectNetworkReportSkipsNATWithoutPublicAccess(t *testing.T) {
+	stubNetworkReport(t, utils.NetCheckResult{StackType: "None"}, nil, nil)
+	collectNATReport = func(context.Context, system.NATProbeConfig) system.NATReport {
+		t.Fatal("STUN must not be probed without public access")
+		return system.NATReport{}
+	}
+	if report := CollectNetworkReport(context.Background()); report.NAT != nil {
+		t.Fatalf("unexpected NAT report: %+v", report.NAT)
+	}
+}
+
+func TestCollectNetworkReportPassesIPv6Interface(t *testing.T) {
+	stubNetworkReport(t,
+		utils.NetCheckResult{Connected: true, HasIPv6: true, StackType: "IPv6"},
+		nil,
+		&baseinfo.IpCheckResult{Info: &model.IpInfo{Ip: "2001:db8::7"}},
+	)
+	getIPv6PrefixReport = func(ctx context.Context, ip string, options ipv6.IPv6PrefixOptions) (*ipv6.IPv6PrefixReport, error) {
+		return &ipv6.IPv6PrefixReport{Interface: options.Interface, InterfaceSelection: ipv6.InterfaceSelectionRequested, PrefixLength: ipv6.PrefixLengthUnknown, Method: ipv6.MethodUnknown}, nil
+	}
+	report := CollectNetworkReportWithOptions(context.Background(), NetworkReportOptions{IPv6Prefix: ipv6.IPv6PrefixOptions{Interface: "wg0"}})
+	prefix := report.IPv6.IPv6Prefix
+	if prefix == nil || prefix.Interface != "wg0" || report.IPv6.PrefixLength != nil {
+		t.Fatalf("expected the requested interface and no prefix length, got %+v %v", prefix, report.IPv6.PrefixLength)
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/oneclickvirt/basics/model"
 )
@@ -30,4 +31,83 @@ func CompareAndMergeIpInfo(dst, src *model.IpInfo) (res *model.IpInfo, err error
 	dst.Region = chooseString(src.Region, dst.Region)
 	dst.City = chooseString(src.City, dst.City)
 	return dst, nil
-}
\ No newline at end of file
+}
+
+// IpInfoFieldNames 为 IpInfo 各字段在来源记录中使用的名称
+var IpInfoFieldNames = []string{"ip", "asn", "org", "country", "region", "city"}
+
+// IpInfoField 按 IpInfoFieldNames 中的名称返回字段值
+func IpInfoField(info *model.IpInfo, field string) string {
+	switch field {
+	case "ip":
+		return info.Ip
+	case "asn":
+		return info.ASN
+	case "org":
+		return info.Org
+	case "country":
+		return info.Country
+	case "region":
+		return info.Region
+	case "city":
+		return info.City
+	}
+	return ""
+}
+
+// SourcedValue 某个提供商给出的字段取值
+type SourcedValue struct {
+	Source string `json:"source"`
+	Value  string `json:"value"`
+}
+
+// IpInfoProvenance 按字段记录合并过程中各提供商给出的非空取值，按合并顺序排列
+type IpInfoProvenance map[string][]SourcedValue
+
+// CompareAndMergeIpInfoFrom 与 CompareAndMergeIpInfo 相同，同时将 src 的非空字段以 source 为来源记录到 provenance
+func CompareAndMergeIpInfoFrom(dst, src *model.IpInfo, source string, provenance IpInfoProvenance) (*model.IpInfo, error) {
+	res, err := CompareAndMergeIpInfo(dst, src)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range IpInfoFieldNames {
+		if value := IpInfoField(src, field); value != "" {
+			provenance[field] = append(provenance[field], SourcedValue{Source: source, Value: value})
+		}
+	}
+	return res, nil
+}
+
+// Source 返回字段最终取值的来源，即最后合并的非空取值的提供商
+func (p IpInfoProvenance) Source(field string) string {
+	values := p[field]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1].Source
+}
+
+// Conflicts 返回与最终取值不一致的其他取值
+// 比较时忽略大小写与首尾空白，ASN 忽略 "AS" 前缀
+func (p IpInfoProvenance) Conflicts(field string) []SourcedValue {
+	values := p[field]
+	if len(values) < 2 {
+		return nil
+	}
+	winner := normalizeFieldValue(field, values[len(values)-1].Value)
+	var conflicts []SourcedValue
+	for _, value := range values[:len(values)-1] {
+		if normalizeFieldValue(field, value.Value) != winner {
+			conflicts = append(conflicts, value)
+		}
+	}
+	return conflicts
+}
+
+func normalizeFieldValue(field, value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if field == "asn" {
+		value = strings.TrimPrefix(value, "as")
+	}
+	return value
+}
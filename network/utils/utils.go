@@ -13,13 +13,21 @@ import (
 	"github.com/imroc/req/v3"
 )
 
-// FetchJsonFromURL 函数用于从指定的 URL 获取信息
+// FetchJsonFromURL 函数用于从指定的 URL 获取 json 信息
+//
+// Deprecated: 请使用 FetchJsonFromURLContext，以便调用方取消请求。
+func FetchJsonFromURL(url, netType string, enableHeader bool, additionalHeader string) (map[string]interface{}, error) {
+	return FetchJsonFromURLContext(context.Background(), url, netType, enableHeader, additionalHeader)
+}
+
+// FetchJsonFromURLContext 函数用于从指定的 URL 获取信息
 // url 参数表示要获取信息的 URL
 // netType 参数表示网络类型，只能为 "tcp4" 或 "tcp6"。
 // enableHeader 参数表示是否启用请求头信息。
 // additionalHeader 参数表示传入的额外的请求头信息(用于传输api的key)。
+// ctx 结束时正在进行的请求会被中止。
 // 返回一个解析 json 得到的 map 和 一个可能发生的错误 。
-func FetchJsonFromURL(url, netType string, enableHeader bool, additionalHeader string) (map[string]interface{}, error) {
+func FetchJsonFromURLContext(ctx context.Context, url, netType string, enableHeader bool, additionalHeader string) (map[string]interface{}, error) {
 	if netType != "tcp4" && netType != "tcp6" {
 		return nil, fmt.Errorf("Invalid netType: %s. Expected 'tcp4' or 'tcp6'.", netType)
 	}
@@ -58,9 +66,9 @@ func FetchJsonFromURL(url, netType string, enableHeader bool, additionalHeader s
 			}
 		}
 	}
-	resp, err := client.R().Get(url)
+	resp, err := client.R().SetContext(ctx).Get(url)
 	if err != nil {
-		return nil, fmt.Errorf("Error fetching %s info: %v", url, err)
+		return nil, fmt.Errorf("Error fetching %s info: %w", url, err)
 	}
 	if !resp.IsSuccessState() {
 		return nil, fmt.Errorf("Error fetching %s info: status code %d", url, resp.StatusCode)
@@ -73,6 +81,33 @@ func FetchJsonFromURL(url, netType string, enableHeader bool, additionalHeader s
 	return data, nil
 }
 
+// FetchTextFromURL 从指定的 URL 获取纯文本响应，返回去除首尾空白后的内容
+// netType 只能为 "tcp4" 或 "tcp6"，用于限定出口协议族
+// ctx 结束时正在进行的请求会被中止
+func FetchTextFromURL(ctx context.Context, url, netType string) (string, error) {
+	if netType != "tcp4" && netType != "tcp6" {
+		return "", fmt.Errorf("Invalid netType: %s. Expected 'tcp4' or 'tcp6'.", netType)
+	}
+	client := req.C()
+	client.SetTimeout(12 * time.Second).
+		SetDial(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{
+				Timeout:   6 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext(ctx, netType, addr)
+		}).
+		SetTLSHandshakeTimeout(5 * time.Second).
+		SetResponseHeaderTimeout(10 * time.Second)
+	resp, err := client.R().SetContext(ctx).Get(url)
+	if err != nil {
+		return "", fmt.Errorf("Error fetching %s: %w", url, err)
+	}
+	if !resp.IsSuccessState() {
+		return "", fmt.Errorf("Error fetching %s: status code %d", url, resp.StatusCode)
+	}
+	return strings.TrimSpace(resp.String()), nil
+}
+
 // BoolToString 将布尔值转换为对应的字符串表示，true 则返回 "Yes"，false 则返回 "No"
 func BoolToString(value bool) string {
 	if value {
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchJsonFromURLAbortsWhenContextExpires(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err := FetchJsonFromURLContext(ctx, server.URL, "tcp4", false, "")
+	if err == nil {
+		t.Fatal("expected an error once the context expired")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("request was not aborted by the context, took %s", elapsed)
+	}
+}
+
+func TestFetchJsonFromURLDecodesResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ip":"203.0.113.7"}`))
+	}))
+	defer server.Close()
+
+	data, err := FetchJsonFromURLContext(context.Background(), server.URL, "tcp4", false, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data["ip"] != "203.0.113.7" {
+		t.Fatalf("unexpected data: %v", data)
+	}
+	// The deprecated signature is kept for existing importers.
+	if data, err := FetchJsonFromURL(server.URL, "tcp4", false, ""); err != nil || data["ip"] != "203.0.113.7" {
+		t.Fatalf("FetchJsonFromURL = %v, %v", data, err)
+	}
+}
+
+func TestFetchTextFromURLTrimsResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(" 203.0.113.7\n"))
+	}))
+	defer server.Close()
+	text, err := FetchTextFromURL(context.Background(), server.URL, "tcp4")
+	if err != nil || text != "203.0.113.7" {
+		t.Fatalf("unexpected result: %q, %v", text, err)
+	}
+	if _, err := FetchTextFromURL(context.Background(), server.URL, "udp"); err == nil {
+		t.Fatal("expected an invalid netType to be rejected")
+	}
+}
@@ -0,0 +1,305 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultCPUContentionWindow = time.Second
+
+// cpuStatUserHZ is the USER_HZ tick rate of the /proc/stat counters, which
+// the kernel fixes at 100 on every architecture.
+const cpuStatUserHZ = 100
+
+var cpuContentionPressureResources = []string{"cpu", "memory", "io"}
+
+// CPUContentionReport compares two samples of /proc/stat, /proc/schedstat
+// and /proc/pressure taken WindowMS apart. WindowMS is derived from the
+// /proc/stat counters, so it is the actual time between the samples.
+// Percentages are shares of all CPU time in the window; steal is time the
+// hypervisor ran something else while this guest wanted the CPU.
+type CPUContentionReport struct {
+	ReportSection
+	WindowMS      int64    `json:"window_ms,omitempty"`
+	BusyPercent   *float64 `json:"busy_percent,omitempty"`
+	StealPercent  *float64 `json:"steal_percent,omitempty"`
+	IOWaitPercent *float64 `json:"iowait_percent,omitempty"`
+	// IRQPercent includes softirq time.
+	IRQPercent *float64 `json:"irq_percent,omitempty"`
+	// BusyImbalancePercent is the busy percentage of the busiest CPU minus
+	// that of the idlest one.
+	BusyImbalancePercent *float64 `json:"busy_imbalance_percent,omitempty"`
+	MaxStealPercent      *float64 `json:"max_steal_percent,omitempty"`
+	// RunDelayMSPerSecond is the time runnable tasks waited for a CPU, per
+	// CPU and second, from /proc/schedstat.
+	RunDelayMSPerSecond *float64              `json:"run_delay_ms_per_second,omitempty"`
+	CPUs                []CPUContentionCPU    `json:"cpus,omitempty"`
+	Pressure            []PressureStallReport `json:"pressure,omitempty"`
+}
+
+type CPUContentionCPU struct {
+	CPU           string  `json:"cpu"`
+	BusyPercent   float64 `json:"busy_percent"`
+	StealPercent  float64 `json:"steal_percent"`
+	IOWaitPercent float64 `json:"iowait_percent"`
+}
+
+// PressureStallReport holds the kernel averages of one /proc/pressure file.
+// Full is absent for resources or kernels that do not report it.
+type PressureStallReport struct {
+	Resource string             `json:"resource"`
+	Some     PressureStallLine  `json:"some"`
+	Full     *PressureStallLine `json:"full,omitempty"`
+}
+
+// PressureStallLine has the kernel 10s, 60s and 300s averages and the share
+// of the sample window stalled, from the total counter.
+type PressureStallLine struct {
+	Avg10         float64  `json:"avg10"`
+	Avg60         float64  `json:"avg60"`
+	Avg300        float64  `json:"avg300"`
+	WindowPercent *float64 `json:"window_percent,omitempty"`
+}
+
+type cpuContentionSample struct {
+	// cpus maps "cpu" (the aggregate) and "cpuN" to /proc/stat counters.
+	cpus     map[string]cpuStatTimes
+	order    []string
+	runDelay map[string]uint64
+	pressure map[string]pressureStallSample
+}
+
+type cpuStatTimes struct {
+	user, nice, system, idle, iowait, irq, softirq, steal uint64
+}
+
+func (t cpuStatTimes) total() uint64 {
+	return t.user + t.nice + t.system + t.idle + t.iowait + t.irq + t.softirq + t.steal
+}
+
+type pressureStallSample struct {
+	some, full           PressureStallLine
+	someTotal, fullTotal uint64
+	hasFull              bool
+}
+
+// collectCPUContentionReport compares files with a second sample taken window
+// later. When after is nil, files must be the running host: it is read twice
+// with a pause of window in between. Any other reader holds a single sample,
+// so the section is unavailable without one. window is only the fallback for
+// the elapsed time when the /proc/stat counters cannot provide it; on the
+// running host the measured time between the reads is used instead.
+func collectCPUContentionReport(ctx context.Context, files, after ReportFileReader, operatingSystem string, window time.Duration) CPUContentionReport {
+	result := CPUContentionReport{ReportSection: ReportSection{Availability: AvailabilityUnsupported}}
+	if operatingSystem != "linux" {
+		return result
+	}
+	first, err := readCPUContentionSample(files)
+	if err != nil {
+		result.Availability, result.Error = AvailabilityUnavailable, err.Error()
+		return result
+	}
+	elapsed, started := window, time.Now()
+	if after == nil {
+		if !isLiveReportFileReader(files) {
+			result.Availability, result.Error = AvailabilityUnavailable, "a snapshot holds a single sample and no second sample was given"
+			return result
+		}
+		after = files
+		timer := time.NewTimer(window)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			result.Availability, result.Error = AvailabilityCanceled, ctx.Err().Error()
+			return result
+		case <-timer.C:
+		}
+		elapsed = time.Since(started)
+	}
+	second, err := readCPUContentionSample(after)
+	if err != nil {
+		result.Availability, result.Error = AvailabilityUnavailable, err.Error()
+		return result
+	}
+	return compareCPUContentionSamples(first, second, elapsed)
+}
+
+func readCPUContentionSample(files ReportFileReader) (cpuContentionSample, error) {
+	sample := cpuContentionSample{cpus: make(map[string]cpuStatTimes), runDelay: make(map[string]uint64), pressure: make(map[string]pressureStallSample)}
+	content, err := files.ReadFile("/proc/stat")
+	if err != nil {
+		return sample, err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 9 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		values := make([]uint64, 8)
+		for index := range values {
+			values[index], _ = strconv.ParseUint(fields[index+1], 10, 64)
+		}
+		sample.cpus[fields[0]] = cpuStatTimes{values[0], values[1], values[2], values[3], values[4], values[5], values[6], values[7]}
+		if fields[0] != "cpu" {
+			sample.order = append(sample.order, fields[0])
+		}
+	}
+	if _, ok := sample.cpus["cpu"]; !ok {
+		return sample, errors.New("/proc/stat has no aggregate cpu line")
+	}
+	// /proc/schedstat cpu lines carry the run queue delay in nanoseconds as
+	// the eighth counter.
+	if content, err := files.ReadFile("/proc/schedstat"); err == nil {
+		for _, line := range strings.Split(string(content), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 9 || !strings.HasPrefix(fields[0], "cpu") {
+				continue
+			}
+			if delay, err := strconv.ParseUint(fields[8], 10, 64); err == nil {
+				sample.runDelay[fields[0]] = delay
+			}
+		}
+	}
+	for _, resource := range cpuContentionPressureResources {
+		if content, err := files.ReadFile("/proc/pressure/" + resource); err == nil {
+			if pressure, ok := parsePressureStall(string(content)); ok {
+				sample.pressure[resource] = pressure
+			}
+		}
+	}
+	return sample, nil
+}
+
+// parsePressureStall parses "some avg10=0.00 avg60=0.00 avg300=0.00
+// total=0" and the matching "full" line.
+func parsePressureStall(content string) (pressureStallSample, bool) {
+	var sample pressureStallSample
+	var hasSome bool
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || (fields[0] != "some" && fields[0] != "full") {
+			continue
+		}
+		var parsed PressureStallLine
+		var total uint64
+		for _, field := range fields[1:] {
+			key, value, _ := strings.Cut(field, "=")
+			switch key {
+			case "avg10":
+				parsed.Avg10, _ = strconv.ParseFloat(value, 64)
+			case "avg60":
+				parsed.Avg60, _ = strconv.ParseFloat(value, 64)
+			case "avg300":
+				parsed.Avg300, _ = strconv.ParseFloat(value, 64)
+			case "total":
+				total, _ = strconv.ParseUint(value, 10, 64)
+			}
+		}
+		if fields[0] == "some" {
+			sample.some, sample.someTotal, hasSome = parsed, total, true
+		} else {
+			sample.full, sample.fullTotal, sample.hasFull = parsed, total, true
+		}
+	}
+	return sample, hasSome
+}
+
+// compareCPUContentionSamples reports the shares and rates between two
+// samples. The elapsed time is the aggregate /proc/stat delta spread over
+// the CPUs; fallback is used when no per-CPU line allows that.
+func compareCPUContentionSamples(before, after cpuContentionSample, fallback time.Duration) CPUContentionReport {
+	result := CPUContentionReport{ReportSection: ReportSection{Availability: AvailabilityAvailable}}
+	aggregate, ok := cpuStatDelta(before.cpus["cpu"], after.cpus["cpu"])
+	if !ok {
+		result.Availability, result.Error = AvailabilityUnavailable, "no CPU time elapsed between the two samples"
+		return result
+	}
+	result.BusyPercent = float64Ptr(aggregate.busy)
+	result.StealPercent = float64Ptr(aggregate.steal)
+	result.IOWaitPercent = float64Ptr(aggregate.iowait)
+	result.IRQPercent = float64Ptr(aggregate.irq)
+
+	var runDelay uint64
+	var runDelayCPUs int
+	for _, name := range after.order {
+		delta, ok := cpuStatDelta(before.cpus[name], after.cpus[name])
+		if !ok {
+			// Offline or hot-plugged between the samples.
+			continue
+		}
+		result.CPUs = append(result.CPUs, CPUContentionCPU{CPU: name, BusyPercent: delta.busy, StealPercent: delta.steal, IOWaitPercent: delta.iowait})
+		first, hadFirst := before.runDelay[name]
+		second, hasSecond := after.runDelay[name]
+		if hadFirst && hasSecond && second >= first {
+			runDelay += second - first
+			runDelayCPUs++
+		}
+	}
+	if len(result.CPUs) > 1 {
+		busiest, idlest, maxSteal := result.CPUs[0].BusyPercent, result.CPUs[0].BusyPercent, 0.0
+		for _, cpu := range result.CPUs {
+			busiest, idlest, maxSteal = max(busiest, cpu.BusyPercent), min(idlest, cpu.BusyPercent), max(maxSteal, cpu.StealPercent)
+		}
+		result.BusyImbalancePercent = float64Ptr(busiest - idlest)
+		result.MaxStealPercent = float64Ptr(maxSteal)
+	}
+	window := fallback
+	if len(result.CPUs) > 0 {
+		ticks := float64(after.cpus["cpu"].total() - before.cpus["cpu"].total())
+		window = time.Duration(ticks / float64(len(result.CPUs)) / cpuStatUserHZ * float64(time.Second))
+	}
+	result.WindowMS = window.Milliseconds()
+	if runDelayCPUs > 0 && window > 0 {
+		result.RunDelayMSPerSecond = float64Ptr(float64(runDelay) / 1e6 / float64(runDelayCPUs) / window.Seconds())
+	}
+
+	for _, resource := range cpuContentionPressureResources {
+		second, ok := after.pressure[resource]
+		if !ok {
+			continue
+		}
+		first, hadFirst := before.pressure[resource]
+		stallPercent := func(from, to uint64) *float64 {
+			if !hadFirst || window <= 0 || to < from {
+				return nil
+			}
+			return float64Ptr(float64(to-from) / float64(window.Microseconds()) * 100)
+		}
+		report := PressureStallReport{Resource: resource, Some: second.some}
+		report.Some.WindowPercent = stallPercent(first.someTotal, second.someTotal)
+		if second.hasFull {
+			full := second.full
+			if first.hasFull {
+				full.WindowPercent = stallPercent(first.fullTotal, second.fullTotal)
+			}
+			report.Full = &full
+		}
+		result.Pressure = append(result.Pressure, report)
+	}
+	return result
+}
+
+type cpuStatShares struct {
+	busy, steal, iowait, irq float64
+}
+
+// cpuStatDelta returns the shares of the elapsed CPU time; ok is false when
+// no time elapsed or a counter went backwards.
+func cpuStatDelta(before, after cpuStatTimes) (cpuStatShares, bool) {
+	if after.total() <= before.total() || after.idle < before.idle || after.iowait < before.iowait || after.steal < before.steal {
+		return cpuStatShares{}, false
+	}
+	total := float64(after.total() - before.total())
+	share := func(from, to uint64) float64 {
+		if to < from {
+			return 0
+		}
+		return float64(to-from) / total * 100
+	}
+	irq := share(before.irq+before.softirq, after.irq+after.softirq)
+	idle := share(before.idle+before.iowait, after.idle+after.iowait)
+	return cpuStatShares{busy: 100 - idle, steal: share(before.steal, after.steal), iowait: share(before.iowait, after.iowait), irq: irq}, true
+}
@@ -0,0 +1,130 @@
+package system
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+var cpuContentionBefore = reportFixture{files: map[string]string{
+	"/proc/stat":            "cpu  1000 0 500 8000 200 50 50 200 0 0\ncpu0 600 0 300 3900 100 25 25 50 0 0\ncpu1 400 0 200 4100 100 25 25 150 0 0\nintr 1 2 3\nctxt 100\n",
+	"/proc/schedstat":       "version 15\ntimestamp 4294892366\ncpu0 0 0 0 0 0 0 1000 5000000 10\ndomain0 3 1 2 3\ncpu1 0 0 0 0 0 0 1000 1000000 10\n",
+	"/proc/pressure/cpu":    "some avg10=1.50 avg60=1.00 avg300=0.50 total=100000\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+	"/proc/pressure/memory": "some avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+}}
+
+var cpuContentionAfter = reportFixture{files: map[string]string{
+	"/proc/stat":            "cpu  1800 0 650 8800 260 65 65 360 0 0\ncpu0 1300 0 400 4000 120 35 35 110 0 0\ncpu1 500 0 250 4800 140 30 30 250 0 0\nintr 4 5 6\nctxt 200\n",
+	"/proc/schedstat":       "version 15\ntimestamp 4294892616\ncpu0 0 0 0 0 0 0 2000 35000000 20\ndomain0 3 1 2 3\ncpu1 0 0 0 0 0 0 2000 11000000 20\n",
+	"/proc/pressure/cpu":    "some avg10=2.50 avg60=1.20 avg300=0.60 total=150000\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+	"/proc/pressure/memory": "some avg10=0.10 avg60=0.00 avg300=0.00 total=2000\n",
+	"/proc/pressure/io":     "some avg10=3.00 avg60=2.00 avg300=1.00 total=900000\nfull avg10=1.00 avg60=0.50 avg300=0.20 total=400000\n",
+}}
+
+func TestCollectCPUContentionReportFromTwoSnapshots(t *testing.T) {
+	report := collectCPUContentionReport(context.Background(), cpuContentionBefore, cpuContentionAfter, "linux", time.Second)
+	if report.Availability != AvailabilityAvailable || report.WindowMS != 10000 {
+		t.Fatalf("unexpected contention report: %+v", report)
+	}
+	for name, test := range map[string]struct {
+		got  *float64
+		want float64
+	}{
+		"busy":      {report.BusyPercent, 57},
+		"steal":     {report.StealPercent, 8},
+		"iowait":    {report.IOWaitPercent, 3},
+		"irq":       {report.IRQPercent, 1.5},
+		"imbalance": {report.BusyImbalancePercent, 62},
+		"max steal": {report.MaxStealPercent, 10},
+		"run delay": {report.RunDelayMSPerSecond, 2},
+	} {
+		if test.got == nil || math.Abs(*test.got-test.want) > 1e-9 {
+			t.Fatalf("%s = %v, want %v", name, test.got, test.want)
+		}
+	}
+	if len(report.CPUs) != 2 || report.CPUs[0].CPU != "cpu0" || report.CPUs[0].BusyPercent != 88 || report.CPUs[1].StealPercent != 10 || report.CPUs[1].IOWaitPercent != 4 {
+		t.Fatalf("unexpected per-CPU shares: %+v", report.CPUs)
+	}
+	if len(report.Pressure) != 3 {
+		t.Fatalf("unexpected pressure: %+v", report.Pressure)
+	}
+	cpu, memory, io := report.Pressure[0], report.Pressure[1], report.Pressure[2]
+	if cpu.Resource != "cpu" || cpu.Some.Avg10 != 2.5 || cpu.Some.WindowPercent == nil || *cpu.Some.WindowPercent != 0.5 || cpu.Full == nil || *cpu.Full.WindowPercent != 0 {
+		t.Fatalf("unexpected cpu pressure: %+v", cpu)
+	}
+	if memory.Full != nil || memory.Some.WindowPercent == nil || math.Abs(*memory.Some.WindowPercent-0.02) > 1e-9 {
+		t.Fatalf("unexpected memory pressure: %+v", memory)
+	}
+	// io pressure appeared only in the second sample, so only the kernel
+	// averages are reported.
+	if io.Some.Avg300 != 1 || io.Some.WindowPercent != nil || io.Full == nil || io.Full.Avg10 != 1 || io.Full.WindowPercent != nil {
+		t.Fatalf("unexpected io pressure: %+v", io)
+	}
+
+	text := renderHardwareReportText(&SystemReport{CPUContention: report}, "en")
+	for _, want := range []string{"8.0% / 3.0% / 1.5%", "62.0% (2 CPUs)", "2.0 ms/s", "cpu 2.5%, memory 0.1%, io 3.0%"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("contention text missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestCollectCPUContentionReportUnavailable(t *testing.T) {
+	if report := collectCPUContentionReport(context.Background(), cpuContentionBefore, cpuContentionAfter, "darwin", 0); report.Availability != AvailabilityUnsupported {
+		t.Fatalf("non-linux contention = %+v", report)
+	}
+	if report := collectCPUContentionReport(context.Background(), reportFixture{}, cpuContentionAfter, "linux", time.Hour); report.Availability != AvailabilityUnavailable {
+		t.Fatalf("missing /proc/stat = %+v", report)
+	}
+	if report := collectCPUContentionReport(context.Background(), cpuContentionAfter, cpuContentionAfter, "linux", time.Second); report.Availability != AvailabilityUnavailable || report.Error == "" {
+		t.Fatalf("unchanged counters = %+v", report)
+	}
+	// A snapshot without a second sample is not slept on.
+	started := time.Now()
+	if report := collectCPUContentionReport(context.Background(), cpuContentionBefore, nil, "linux", time.Hour); report.Availability != AvailabilityUnavailable || time.Since(started) > time.Second {
+		t.Fatalf("single snapshot = %+v", report)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report := collectCPUContentionReport(ctx, liveReportFixture{cpuContentionBefore}, nil, "linux", time.Hour); report.Availability != AvailabilityCanceled {
+		t.Fatalf("canceled contention = %+v", report)
+	}
+}
+
+type liveReportFixture struct {
+	reportFixture
+}
+
+func (liveReportFixture) live() bool { return true }
+
+func TestCPUContentionSectionSecondSample(t *testing.T) {
+	filter := ReportSectionFilter{Enable: []string{"cpu_contention"}}
+	started := time.Now()
+	report := CollectSystemReportFromWithOptions(context.Background(), cpuContentionBefore, "linux", ReportOptions{Filter: filter, ContentionWindow: time.Hour, ContentionSecondSample: cpuContentionAfter})
+	if report.CPUContention.Availability != AvailabilityAvailable || report.CPUContention.StealPercent == nil || *report.CPUContention.StealPercent != 8 || time.Since(started) > time.Second {
+		t.Fatalf("two snapshot contention = %+v", report.CPUContention)
+	}
+	if !isLiveReportFileReader(NewRecordingReportFileReader(OSReportFileReader{})) || isLiveReportFileReader(NewRecordingReportFileReader(cpuContentionBefore)) {
+		t.Fatal("recording reader does not report the liveness of its inner reader")
+	}
+}
+
+func TestCompareCPUContentionSamplesFallsBackWithoutPerCPULines(t *testing.T) {
+	before := cpuContentionSample{cpus: map[string]cpuStatTimes{"cpu": {user: 100, idle: 100}}}
+	after := cpuContentionSample{cpus: map[string]cpuStatTimes{"cpu": {user: 200, idle: 300}}}
+	if report := compareCPUContentionSamples(before, after, 3*time.Second); report.Availability != AvailabilityAvailable || report.WindowMS != 3000 {
+		t.Fatalf("fallback window = %+v", report)
+	}
+}
+
+func TestCPUStatDeltaSkipsCountersThatWentBackwards(t *testing.T) {
+	before := cpuStatTimes{user: 100, idle: 100, steal: 50}
+	if _, ok := cpuStatDelta(before, cpuStatTimes{user: 300, idle: 200, steal: 10}); ok {
+		t.Fatal("expected a steal counter reset to be rejected")
+	}
+	if _, ok := cpuStatDelta(before, before); ok {
+		t.Fatal("expected no elapsed time to be rejected")
+	}
+}
@@ -0,0 +1,319 @@
+package system
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CPU benchmark defaults. The memory passes use the Size option.
+const (
+	cpuBenchDefaultDuration   = 10 * time.Second
+	cpuBenchDefaultMemorySize = 64 << 20
+	cpuBenchMinimumMemorySize = 1 << 20
+	// cpuBenchThrottleDrop is the drop from the first to the last quarter of
+	// the sustained all-core phase reported as throttling.
+	cpuBenchThrottleDrop = 10.0
+	cpuBenchSamples      = 20
+)
+
+// CPUBenchReport is the DeepToolResult.Data of the CPU benchmark. Scores are
+// totals across the threads of a run: millions of integer operations or
+// floating point multiply-adds and SHA-256 bytes per second.
+type CPUBenchReport struct {
+	LogicalCPUs    int                 `json:"logical_cpus"`
+	QuotaCores     *float64            `json:"quota_cores,omitempty"`
+	Threads        []CPUBenchThreadRun `json:"threads"`
+	Memory         CPUBenchMemory      `json:"memory"`
+	Throttling     CPUBenchThrottling  `json:"throttling"`
+	AllCoreScaling *float64            `json:"all_core_scaling,omitempty"`
+}
+
+type CPUBenchThreadRun struct {
+	Threads              int     `json:"threads"`
+	IntegerMops          float64 `json:"integer_mops"`
+	FloatMops            float64 `json:"float_mops"`
+	HashBytesPerSecond   float64 `json:"hash_bytes_per_second"`
+	IntegerMopsPerThread float64 `json:"integer_mops_per_thread"`
+}
+
+// CPUBenchMemory holds a single-thread copy bandwidth and the dependent load
+// latency of a random pointer chase over a buffer of BufferBytes.
+type CPUBenchMemory struct {
+	BufferBytes            uint64  `json:"buffer_bytes"`
+	CopyBytesPerSecond     float64 `json:"copy_bytes_per_second"`
+	RandomLoadLatencyNanos float64 `json:"random_load_latency_ns"`
+}
+
+// CPUBenchThrottling compares the integer rate of the first and last quarter
+// of the all-core integer run.
+type CPUBenchThrottling struct {
+	EarlyMops   float64 `json:"early_mops"`
+	LateMops    float64 `json:"late_mops"`
+	DropPercent float64 `json:"drop_percent"`
+	Throttled   bool    `json:"throttled"`
+}
+
+// cpuBenchWorkload runs one fixed chunk of work and returns a value that
+// keeps the compiler from removing it.
+type cpuBenchWorkload struct {
+	name          string
+	unitsPerChunk float64
+	chunk         func(seed uint64) uint64
+}
+
+var cpuBenchSink atomic.Uint64
+
+var cpuBenchHashInput = func() []byte {
+	data := make([]byte, 16<<10)
+	for index := range data {
+		data[index] = byte(index * 131)
+	}
+	return data
+}()
+
+var cpuBenchWorkloads = []cpuBenchWorkload{
+	{name: "integer", unitsPerChunk: 1 << 16, chunk: func(seed uint64) uint64 {
+		x := seed | 1
+		for index := 0; index < 1<<16; index++ {
+			x ^= x << 13
+			x ^= x >> 7
+			x ^= x << 17
+			x = x*0x9e3779b97f4a7c15 + uint64(index)
+		}
+		return x
+	}},
+	{name: "float", unitsPerChunk: 1 << 16, chunk: func(seed uint64) uint64 {
+		x, y := float64(seed%1000)/1000+1, 0.5
+		for index := 0; index < 1<<15; index++ {
+			x = x*0.999999 + y
+			y = y*0.999998 - x*1e-9
+		}
+		return math.Float64bits(x + y)
+	}},
+	{name: "hash", unitsPerChunk: float64(len(cpuBenchHashInput)), chunk: func(seed uint64) uint64 {
+		sum := sha256.Sum256(cpuBenchHashInput)
+		return binary.LittleEndian.Uint64(sum[:8]) ^ seed
+	}},
+}
+
+// RunCPUBench measures integer, floating point and SHA-256 throughput on one
+// thread and on every usable core, then memory copy bandwidth and random
+// load latency, within duration. The all-core run uses no more threads than
+// the cgroup CPU quota allows. size is the memory buffer ("64M" by default).
+func RunCPUBench(ctx context.Context, size string, duration time.Duration) DeepToolResult {
+	var quota *float64
+	if cgroup := collectCgroupReport(OSReportFileReader{}, runtime.GOOS); cgroup.Availability == AvailabilityAvailable {
+		quota = cgroup.CPUQuotaCores
+	}
+	return runCPUBench(ctx, size, duration, runtime.NumCPU(), quota)
+}
+
+func runCPUBench(ctx context.Context, size string, duration time.Duration, logicalCPUs int, quota *float64) (result DeepToolResult) {
+	result = DeepToolResult{SchemaVersion: "goecs.cpu/bench-v1", Status: "error", Target: "cpu"}
+	memorySize := uint64(cpuBenchDefaultMemorySize)
+	if strings.TrimSpace(size) != "" {
+		memorySize = parseSize(size)
+		if memorySize < cpuBenchMinimumMemorySize {
+			result.Error = fmt.Sprintf("memory buffer must be at least %s", formatCompactBytes(cpuBenchMinimumMemorySize))
+			return result
+		}
+	}
+	if duration <= 0 {
+		duration = cpuBenchDefaultDuration
+	}
+	started := time.Now()
+	defer func() { result.DurationMS = time.Since(started).Milliseconds() }()
+
+	report := CPUBenchReport{LogicalCPUs: logicalCPUs, QuotaCores: quota}
+	threadCounts := []int{1}
+	if allCore := cpuBenchThreads(logicalCPUs, quota); allCore > 1 {
+		threadCounts = append(threadCounts, allCore)
+	}
+	// CPU phases share 80% of the duration and the two memory passes the rest.
+	phase := duration * 8 / 10 / time.Duration(len(threadCounts)*len(cpuBenchWorkloads))
+	for _, threads := range threadCounts {
+		run := CPUBenchThreadRun{Threads: threads}
+		for _, workload := range cpuBenchWorkloads {
+			rate, samples := runCPUBenchPhase(ctx, workload, threads, phase)
+			if err := ctx.Err(); err != nil {
+				return failedDeepTool(result, ctx, nil, err)
+			}
+			switch workload.name {
+			case "integer":
+				run.IntegerMops = rate / 1e6
+				run.IntegerMopsPerThread = run.IntegerMops / float64(threads)
+				// The last thread count is the sustained all-core run.
+				report.Throttling = cpuBenchThrottle(samples, phase, workload.unitsPerChunk)
+			case "float":
+				run.FloatMops = rate / 1e6
+			case "hash":
+				run.HashBytesPerSecond = rate
+			}
+		}
+		report.Threads = append(report.Threads, run)
+	}
+	if len(report.Threads) > 1 && report.Threads[0].IntegerMops > 0 {
+		scaling := report.Threads[1].IntegerMops / report.Threads[0].IntegerMops
+		report.AllCoreScaling = &scaling
+	}
+	memory, err := runCPUBenchMemory(ctx, memorySize, duration/10)
+	if err != nil {
+		return failedDeepTool(result, ctx, nil, err)
+	}
+	report.Memory = memory
+	result.Status, result.Data, result.Output = "ok", report, renderCPUBenchOutput(report)
+	return result
+}
+
+// cpuBenchThreads is the all-core thread count: the logical CPUs, limited
+// to the cgroup quota rounded up.
+func cpuBenchThreads(logicalCPUs int, quota *float64) int {
+	threads := logicalCPUs
+	if quota != nil && *quota > 0 {
+		if limit := int(math.Ceil(*quota)); limit < threads {
+			threads = limit
+		}
+	}
+	if threads < 1 {
+		threads = 1
+	}
+	return threads
+}
+
+// runCPUBenchPhase runs workload on threads goroutines for d and returns
+// the total units per second and the cumulative chunk counts sampled at
+// equal intervals.
+func runCPUBenchPhase(ctx context.Context, workload cpuBenchWorkload, threads int, d time.Duration) (float64, []uint64) {
+	var chunks atomic.Uint64
+	var wait sync.WaitGroup
+	deadline := time.Now().Add(d)
+	started := time.Now()
+	for thread := 0; thread < threads; thread++ {
+		wait.Add(1)
+		go func(seed uint64) {
+			defer wait.Done()
+			var sink uint64
+			for time.Now().Before(deadline) && ctx.Err() == nil {
+				sink ^= workload.chunk(seed + sink)
+				chunks.Add(1)
+			}
+			cpuBenchSink.Add(sink)
+		}(uint64(thread + 1))
+	}
+	samples := make([]uint64, 0, cpuBenchSamples)
+	ticker := time.NewTicker(max(d/cpuBenchSamples, time.Millisecond))
+sampling:
+	for len(samples) < cpuBenchSamples {
+		select {
+		case <-ctx.Done():
+			break sampling
+		case <-ticker.C:
+			samples = append(samples, chunks.Load())
+		}
+	}
+	ticker.Stop()
+	wait.Wait()
+	elapsed := time.Since(started)
+	if elapsed <= 0 {
+		return 0, samples
+	}
+	return float64(chunks.Load()) * workload.unitsPerChunk / elapsed.Seconds(), samples
+}
+
+// cpuBenchThrottle compares the first and last quarter of the sampled chunk
+// counts.
+func cpuBenchThrottle(samples []uint64, d time.Duration, unitsPerChunk float64) CPUBenchThrottling {
+	var throttling CPUBenchThrottling
+	quarter := len(samples) / 4
+	if quarter == 0 || d <= 0 {
+		return throttling
+	}
+	interval := (d / cpuBenchSamples).Seconds()
+	rate := func(from, to int) float64 {
+		var before uint64
+		if from > 0 {
+			before = samples[from-1]
+		}
+		return float64(samples[to-1]-before) * unitsPerChunk / (float64(to-from) * interval) / 1e6
+	}
+	throttling.EarlyMops = rate(0, quarter)
+	throttling.LateMops = rate(len(samples)-quarter, len(samples))
+	if throttling.EarlyMops > 0 {
+		throttling.DropPercent = (throttling.EarlyMops - throttling.LateMops) / throttling.EarlyMops * 100
+		throttling.Throttled = throttling.DropPercent >= cpuBenchThrottleDrop
+	}
+	return throttling
+}
+
+// runCPUBenchMemory copies between two buffers of size/2 for half of d, then
+// follows a single random cycle through a size byte index for the other half,
+// so each load depends on the previous one.
+func runCPUBenchMemory(ctx context.Context, size uint64, d time.Duration) (CPUBenchMemory, error) {
+	memory := CPUBenchMemory{BufferBytes: size}
+	source, target := make([]byte, size/2), make([]byte, size/2)
+	for index := range source {
+		source[index] = byte(index)
+	}
+	var copied uint64
+	started := time.Now()
+	for time.Since(started) < d/2 {
+		if err := ctx.Err(); err != nil {
+			return memory, err
+		}
+		copied += uint64(copy(target, source))
+	}
+	if elapsed := time.Since(started); elapsed > 0 {
+		memory.CopyBytesPerSecond = float64(copied) / elapsed.Seconds()
+	}
+	source, target = nil, nil
+
+	// Sattolo's algorithm builds one cycle covering every slot.
+	next := make([]uint32, size/4)
+	for index := range next {
+		next[index] = uint32(index)
+	}
+	random := rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0x6d656d))
+	for index := len(next) - 1; index > 0; index-- {
+		swap := random.IntN(index)
+		next[index], next[swap] = next[swap], next[index]
+	}
+	var loads uint64
+	position := uint32(0)
+	started = time.Now()
+	for time.Since(started) < d/2 {
+		if err := ctx.Err(); err != nil {
+			return memory, err
+		}
+		for step := 0; step < 1<<14; step++ {
+			position = next[position]
+		}
+		loads += 1 << 14
+	}
+	cpuBenchSink.Add(uint64(position))
+	if loads > 0 {
+		memory.RandomLoadLatencyNanos = float64(time.Since(started).Nanoseconds()) / float64(loads)
+	}
+	return memory, nil
+}
+
+func renderCPUBenchOutput(report CPUBenchReport) string {
+	lines := make([]string, 0, len(report.Threads)+2)
+	for _, run := range report.Threads {
+		lines = append(lines, fmt.Sprintf("%d thread(s): integer %.0f Mops/s, float %.0f Mops/s, sha256 %s/s", run.Threads, run.IntegerMops, run.FloatMops, formatCompactBytes(int64(run.HashBytesPerSecond))))
+	}
+	lines = append(lines, fmt.Sprintf("memory copy %s/s, random load latency %.1f ns", formatCompactBytes(int64(report.Memory.CopyBytesPerSecond)), report.Memory.RandomLoadLatencyNanos))
+	throttle := fmt.Sprintf("throttling: early %.0f Mops/s, late %.0f Mops/s (%.1f%% drop)", report.Throttling.EarlyMops, report.Throttling.LateMops, report.Throttling.DropPercent)
+	if report.Throttling.Throttled {
+		throttle += ", throttled"
+	}
+	return strings.Join(append(lines, throttle), "\n")
+}
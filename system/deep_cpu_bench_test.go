@@ -0,0 +1,100 @@
+package system
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCPUBench(t *testing.T) {
+	if testing.Short() {
+		t.Skip("CPU benchmark loads every core")
+	}
+	quota := 1.5
+	result := runCPUBench(context.Background(), "1M", 300*time.Millisecond, 4, &quota)
+	if result.Status != "ok" || result.SchemaVersion != "goecs.cpu/bench-v1" || result.Target != "cpu" {
+		t.Fatalf("unexpected CPU benchmark result: %+v", result)
+	}
+	report, ok := result.Data.(CPUBenchReport)
+	if !ok || report.LogicalCPUs != 4 || report.QuotaCores == nil || len(report.Threads) != 2 {
+		t.Fatalf("unexpected CPU benchmark data: %#v", result.Data)
+	}
+	if report.Threads[0].Threads != 1 || report.Threads[1].Threads != 2 || report.AllCoreScaling == nil {
+		t.Fatalf("quota was not applied to the all-core run: %+v", report)
+	}
+	for _, run := range report.Threads {
+		if run.IntegerMops <= 0 || run.FloatMops <= 0 || run.HashBytesPerSecond <= 0 {
+			t.Fatalf("CPU benchmark phase did not run: %+v", run)
+		}
+	}
+	if report.Memory.BufferBytes != 1<<20 || report.Memory.CopyBytesPerSecond <= 0 || report.Memory.RandomLoadLatencyNanos <= 0 {
+		t.Fatalf("memory passes did not run: %+v", report.Memory)
+	}
+	if !strings.Contains(result.Output, "2 thread(s)") || !strings.Contains(result.Output, "random load latency") {
+		t.Fatalf("unexpected CPU benchmark output: %q", result.Output)
+	}
+
+	quota = 1
+	result = runCPUBench(context.Background(), "1M", 100*time.Millisecond, 2, &quota)
+	if report, ok := result.Data.(CPUBenchReport); result.Status != "ok" || !ok || len(report.Threads) != 1 || report.AllCoreScaling != nil {
+		t.Fatalf("single core quota = %+v", result)
+	}
+}
+
+func TestRunCPUBenchValidatesAndCancels(t *testing.T) {
+	for _, size := range []string{"512K", "lots"} {
+		if result := runCPUBench(context.Background(), size, time.Millisecond, 1, nil); result.Status != "error" {
+			t.Fatalf("runCPUBench(%q) = %+v", size, result)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if result := runCPUBench(ctx, "1M", time.Second, 2, nil); result.Status != "canceled" {
+		t.Fatalf("canceled CPU benchmark = %+v", result)
+	}
+}
+
+func TestCPUBenchThreads(t *testing.T) {
+	half, two, large := 0.5, 2.2, 64.0
+	for _, test := range []struct {
+		cpus  int
+		quota *float64
+		want  int
+	}{
+		{8, nil, 8},
+		{8, &half, 1},
+		{8, &two, 3},
+		{8, &large, 8},
+		{0, nil, 1},
+	} {
+		if got := cpuBenchThreads(test.cpus, test.quota); got != test.want {
+			t.Fatalf("cpuBenchThreads(%d, %v) = %d, want %d", test.cpus, test.quota, got, test.want)
+		}
+	}
+}
+
+func TestCPUBenchThrottle(t *testing.T) {
+	// 20 samples over 2s: 100 chunks per interval early, 50 late.
+	var samples []uint64
+	var total uint64
+	for index := 0; index < cpuBenchSamples; index++ {
+		if index < cpuBenchSamples/2 {
+			total += 100
+		} else {
+			total += 50
+		}
+		samples = append(samples, total)
+	}
+	throttling := cpuBenchThrottle(samples, 2*time.Second, 1e6)
+	if throttling.EarlyMops != 1000 || throttling.LateMops != 500 || throttling.DropPercent != 50 || !throttling.Throttled {
+		t.Fatalf("unexpected throttling: %+v", throttling)
+	}
+	steady := []uint64{10, 20, 30, 40, 50, 60, 70, 80}
+	if throttling := cpuBenchThrottle(steady, 2*time.Second, 1e6); throttling.Throttled || throttling.DropPercent != 0 {
+		t.Fatalf("steady samples reported throttling: %+v", throttling)
+	}
+	if throttling := cpuBenchThrottle([]uint64{1, 2}, time.Second, 1); throttling != (CPUBenchThrottling{}) {
+		t.Fatalf("too few samples = %+v", throttling)
+	}
+}
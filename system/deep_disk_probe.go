@@ -0,0 +1,287 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// Disk probe defaults and block sizes.
+const (
+	diskProbeDefaultSize     = 256 << 20
+	diskProbeMinimumSize     = 4 << 20
+	diskProbeDefaultDuration = 10 * time.Second
+	diskProbeSequentialBlock = 1 << 20
+	diskProbeRandomBlock     = 4 << 10
+)
+
+// DiskProbeReport is the DeepToolResult.Data of the disk probe. Each phase
+// gets a fifth of the duration; sequential phases also stop at the end of
+// the test file, so a phase may cover less than the whole file.
+type DiskProbeReport struct {
+	Directory       string              `json:"directory"`
+	FileSizeBytes   uint64              `json:"file_size_bytes"`
+	DirectIO        bool                `json:"direct_io"`
+	SequentialWrite DiskProbeThroughput `json:"sequential_write"`
+	SequentialRead  DiskProbeThroughput `json:"sequential_read"`
+	RandomRead      DiskProbeRandomIO   `json:"random_read_4k"`
+	RandomWrite     DiskProbeRandomIO   `json:"random_write_4k"`
+	Fsync           DiskProbeLatency    `json:"fsync"`
+}
+
+type DiskProbeThroughput struct {
+	Bytes          uint64  `json:"bytes"`
+	DurationMS     int64   `json:"duration_ms"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+}
+
+type DiskProbeRandomIO struct {
+	IOPS    float64          `json:"iops"`
+	Latency DiskProbeLatency `json:"latency"`
+}
+
+// DiskProbeLatency summarizes per-operation latencies in microseconds.
+type DiskProbeLatency struct {
+	Operations int     `json:"operations"`
+	MeanUS     float64 `json:"mean_us"`
+	P50US      float64 `json:"p50_us"`
+	P95US      float64 `json:"p95_us"`
+	P99US      float64 `json:"p99_us"`
+	MaxUS      float64 `json:"max_us"`
+}
+
+// RunDiskProbe measures sequential and 4K random throughput and fsync latency
+// in a temporary file under directory. size is the test file size (for
+// example "256M") and duration the total run time; zero values use the
+// defaults. The file is removed when the probe ends, including on
+// cancellation.
+func RunDiskProbe(ctx context.Context, directory, size string, duration time.Duration) (result DeepToolResult) {
+	directory = strings.TrimSpace(directory)
+	result = DeepToolResult{SchemaVersion: "goecs.disk/probe-v1", Status: "skipped", Target: directory}
+	if directory == "" {
+		result.Error = "explicit probe directory is not configured"
+		return result
+	}
+	fileSize := uint64(diskProbeDefaultSize)
+	if strings.TrimSpace(size) != "" {
+		fileSize = parseSize(size)
+		if fileSize < diskProbeMinimumSize {
+			result.Status, result.Error = "error", fmt.Sprintf("probe size must be at least %s", formatCompactBytes(diskProbeMinimumSize))
+			return result
+		}
+	}
+	if duration <= 0 {
+		duration = diskProbeDefaultDuration
+	}
+	if info, err := os.Stat(directory); err != nil || !info.IsDir() {
+		result.Status, result.Error = "error", "probe directory does not exist or is not a directory"
+		return result
+	}
+	started := time.Now()
+	defer func() { result.DurationMS = time.Since(started).Milliseconds() }()
+	report, err := runDiskProbe(ctx, directory, fileSize-fileSize%diskProbeSequentialBlock, duration/5)
+	if err != nil {
+		return failedDeepTool(result, ctx, nil, err)
+	}
+	result.Status, result.Data, result.Output = "ok", report, renderDiskProbeOutput(report)
+	return result
+}
+
+func runDiskProbe(ctx context.Context, directory string, size uint64, phase time.Duration) (report DiskProbeReport, err error) {
+	report.Directory = directory
+	file, err := os.CreateTemp(directory, ".basics-disk-probe-*")
+	if err != nil {
+		return report, err
+	}
+	path := file.Name()
+	file.Close()
+	defer os.Remove(path)
+
+	direct, directIO, err := openDiskProbeFile(path)
+	if err != nil {
+		return report, err
+	}
+	defer func() { direct.Close() }()
+	report.DirectIO = directIO
+	buffer := alignedDiskProbeBuffer(diskProbeSequentialBlock)
+	random := rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0x62617369))
+	for index := range buffer {
+		buffer[index] = byte(random.Uint32())
+	}
+
+	// Sequential write fills the file used by the later phases.
+	started := time.Now()
+	var written uint64
+	for written < size && time.Since(started) < phase {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if _, err := direct.WriteAt(buffer, int64(written)); err != nil {
+			if written == 0 && report.DirectIO && diskProbeDirectIORejected(err) {
+				// Some file systems accept O_DIRECT on open and reject
+				// the first aligned write.
+				direct.Close()
+				if direct, err = os.OpenFile(path, os.O_RDWR, 0); err != nil {
+					return report, err
+				}
+				report.DirectIO = false
+				continue
+			}
+			return report, err
+		}
+		written += diskProbeSequentialBlock
+	}
+	if err := direct.Sync(); err != nil {
+		return report, err
+	}
+	report.FileSizeBytes = written
+	report.SequentialWrite = diskProbeThroughput(written, time.Since(started))
+	if written == 0 {
+		return report, errors.New("no data written within the probe duration")
+	}
+
+	started = time.Now()
+	var read uint64
+	for read < written && time.Since(started) < phase {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if _, err := direct.ReadAt(buffer, int64(read)); err != nil {
+			return report, err
+		}
+		read += diskProbeSequentialBlock
+	}
+	report.SequentialRead = diskProbeThroughput(read, time.Since(started))
+
+	blocks := written / diskProbeRandomBlock
+	block := buffer[:diskProbeRandomBlock]
+	if report.RandomRead, err = diskProbeRandomPhase(ctx, phase, func() error {
+		_, err := direct.ReadAt(block, int64(random.Uint64N(blocks)*diskProbeRandomBlock))
+		return err
+	}); err != nil {
+		return report, err
+	}
+	if report.RandomWrite, err = diskProbeRandomPhase(ctx, phase, func() error {
+		_, err := direct.WriteAt(block, int64(random.Uint64N(blocks)*diskProbeRandomBlock))
+		return err
+	}); err != nil {
+		return report, err
+	}
+
+	// fsync latency is measured on a buffered handle, after a 4K write
+	// that leaves something to flush.
+	buffered, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return report, err
+	}
+	defer buffered.Close()
+	var latencies []time.Duration
+	started = time.Now()
+	for time.Since(started) < phase {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if _, err := buffered.WriteAt(block, int64(random.Uint64N(blocks)*diskProbeRandomBlock)); err != nil {
+			return report, err
+		}
+		syncStarted := time.Now()
+		if err := buffered.Sync(); err != nil {
+			return report, err
+		}
+		latencies = append(latencies, time.Since(syncStarted))
+	}
+	report.Fsync = summarizeDiskProbeLatencies(latencies)
+	return report, nil
+}
+
+func diskProbeRandomPhase(ctx context.Context, phase time.Duration, operation func() error) (DiskProbeRandomIO, error) {
+	var latencies []time.Duration
+	started := time.Now()
+	for time.Since(started) < phase {
+		if err := ctx.Err(); err != nil {
+			return DiskProbeRandomIO{}, err
+		}
+		operationStarted := time.Now()
+		if err := operation(); err != nil {
+			return DiskProbeRandomIO{}, err
+		}
+		latencies = append(latencies, time.Since(operationStarted))
+	}
+	elapsed := time.Since(started)
+	result := DiskProbeRandomIO{Latency: summarizeDiskProbeLatencies(latencies)}
+	if elapsed > 0 {
+		result.IOPS = float64(len(latencies)) / elapsed.Seconds()
+	}
+	return result, nil
+}
+
+func diskProbeThroughput(bytes uint64, elapsed time.Duration) DiskProbeThroughput {
+	throughput := DiskProbeThroughput{Bytes: bytes, DurationMS: elapsed.Milliseconds()}
+	if elapsed > 0 {
+		throughput.BytesPerSecond = float64(bytes) / elapsed.Seconds()
+	}
+	return throughput
+}
+
+// summarizeDiskProbeLatencies uses nearest-rank percentiles.
+func summarizeDiskProbeLatencies(latencies []time.Duration) DiskProbeLatency {
+	summary := DiskProbeLatency{Operations: len(latencies)}
+	if len(latencies) == 0 {
+		return summary
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	microseconds := func(value time.Duration) float64 { return float64(value) / float64(time.Microsecond) }
+	percentile := func(p float64) float64 {
+		rank := int(p*float64(len(sorted))+0.999999) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		return microseconds(sorted[rank])
+	}
+	var total time.Duration
+	for _, latency := range sorted {
+		total += latency
+	}
+	summary.MeanUS = microseconds(total / time.Duration(len(sorted)))
+	summary.P50US, summary.P95US, summary.P99US = percentile(0.50), percentile(0.95), percentile(0.99)
+	summary.MaxUS = microseconds(sorted[len(sorted)-1])
+	return summary
+}
+
+func renderDiskProbeOutput(report DiskProbeReport) string {
+	mode := "buffered"
+	if report.DirectIO {
+		mode = "O_DIRECT"
+	}
+	rate := func(throughput DiskProbeThroughput) string {
+		return formatCompactBytes(int64(throughput.BytesPerSecond)) + "/s"
+	}
+	random := func(result DiskProbeRandomIO) string {
+		return fmt.Sprintf("%.0f IOPS, p99 %.2f ms", result.IOPS, result.Latency.P99US/1000)
+	}
+	return strings.Join([]string{
+		fmt.Sprintf("file %s, %s", formatCompactBytes(int64(report.FileSizeBytes)), mode),
+		fmt.Sprintf("sequential write %s, read %s", rate(report.SequentialWrite), rate(report.SequentialRead)),
+		fmt.Sprintf("4K random read %s", random(report.RandomRead)),
+		fmt.Sprintf("4K random write %s", random(report.RandomWrite)),
+		fmt.Sprintf("fsync p50 %.2f ms, p99 %.2f ms (%d ops)", report.Fsync.P50US/1000, report.Fsync.P99US/1000, report.Fsync.Operations),
+	}, "\n")
+}
+
+// alignedDiskProbeBuffer returns a buffer aligned for O_DIRECT.
+func alignedDiskProbeBuffer(size int) []byte {
+	const alignment = 4096
+	buffer := make([]byte, size+alignment)
+	offset := int(uintptr(unsafe.Pointer(&buffer[0])) & (alignment - 1))
+	if offset != 0 {
+		offset = alignment - offset
+	}
+	return buffer[offset : offset+size]
+}
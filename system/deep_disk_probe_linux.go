@@ -0,0 +1,28 @@
+//go:build linux
+
+package system
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// openDiskProbeFile opens path with O_DIRECT so the page cache does not
+// inflate the results, falling back to buffered I/O on file systems such as
+// tmpfs that reject it.
+func openDiskProbeFile(path string) (*os.File, bool, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|syscall.O_DIRECT, 0)
+	if err == nil {
+		return file, true, nil
+	}
+	if !diskProbeDirectIORejected(err) {
+		return nil, false, err
+	}
+	file, err = os.OpenFile(path, os.O_RDWR, 0)
+	return file, false, err
+}
+
+func diskProbeDirectIORejected(err error) bool {
+	return errors.Is(err, syscall.EINVAL)
+}
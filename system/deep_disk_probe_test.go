@@ -0,0 +1,81 @@
+package system
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunDiskProbe(t *testing.T) {
+	if testing.Short() {
+		t.Skip("disk probe writes a test file")
+	}
+	dir := t.TempDir()
+	result := RunDiskProbe(context.Background(), dir, "4M", 250*time.Millisecond)
+	if result.Status != "ok" || result.SchemaVersion != "goecs.disk/probe-v1" || result.Target != dir {
+		t.Fatalf("unexpected disk probe result: %+v", result)
+	}
+	report, ok := result.Data.(DiskProbeReport)
+	if !ok || report.FileSizeBytes == 0 || report.FileSizeBytes > 4<<20 || report.FileSizeBytes%diskProbeSequentialBlock != 0 {
+		t.Fatalf("unexpected disk probe data: %#v", result.Data)
+	}
+	if report.SequentialWrite.BytesPerSecond <= 0 || report.SequentialRead.Bytes == 0 || report.RandomRead.Latency.Operations == 0 || report.RandomWrite.IOPS <= 0 || report.Fsync.Operations == 0 {
+		t.Fatalf("disk probe phases did not run: %+v", report)
+	}
+	if !strings.Contains(result.Output, "4K random read") || !strings.Contains(result.Output, "fsync p50") {
+		t.Fatalf("unexpected disk probe output: %q", result.Output)
+	}
+	assertDiskProbeDirectoryEmpty(t, dir)
+}
+
+func TestRunDiskProbeRemovesFileOnCancel(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if result := RunDiskProbe(ctx, dir, "4M", time.Second); result.Status != "canceled" {
+		t.Fatalf("canceled disk probe = %+v", result)
+	}
+	assertDiskProbeDirectoryEmpty(t, dir)
+}
+
+func TestRunDiskProbeValidatesOptions(t *testing.T) {
+	if result := RunDiskProbe(context.Background(), "", "", 0); result.Status != "skipped" {
+		t.Fatalf("probe without directory = %+v", result)
+	}
+	for _, test := range []struct{ directory, size string }{
+		{t.TempDir(), "1M"},
+		{t.TempDir(), "lots"},
+		{t.TempDir() + "/missing", ""},
+	} {
+		if result := RunDiskProbe(context.Background(), test.directory, test.size, time.Millisecond); result.Status != "error" {
+			t.Fatalf("RunDiskProbe(%q, %q) = %+v", test.directory, test.size, result)
+		}
+	}
+}
+
+func TestSummarizeDiskProbeLatencies(t *testing.T) {
+	var latencies []time.Duration
+	for value := 100; value >= 1; value-- {
+		latencies = append(latencies, time.Duration(value)*time.Microsecond)
+	}
+	summary := summarizeDiskProbeLatencies(latencies)
+	if summary.Operations != 100 || summary.P50US != 50 || summary.P95US != 95 || summary.P99US != 99 || summary.MaxUS != 100 || summary.MeanUS != 50.5 {
+		t.Fatalf("unexpected latency summary: %+v", summary)
+	}
+	if empty := summarizeDiskProbeLatencies(nil); empty.Operations != 0 || empty.P99US != 0 {
+		t.Fatalf("unexpected empty summary: %+v", empty)
+	}
+}
+
+func assertDiskProbeDirectoryEmpty(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("disk probe left %d files behind in %s", len(entries), dir)
+	}
+}
@@ -0,0 +1,195 @@
+package system
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DeepTool is an opt-in test that stresses or exercises hardware and is
+// therefore never part of the default report. Run receives only explicit
+// options; a tool without a required target reports "skipped".
+type DeepTool struct {
+	Name        string
+	Description string
+	// DefaultTimeout bounds a run when the caller sets no timeout.
+	DefaultTimeout time.Duration
+	// KindTimeouts replaces DefaultTimeout for the variants that take much
+	// longer, keyed by DeepToolOptions.Kind.
+	KindTimeouts map[string]time.Duration
+	Run          func(context.Context, DeepToolOptions) DeepToolResult
+}
+
+// DeepToolOptions are the explicit inputs of one deep tool run. Device is
+// the target, a device or for the disk probe a directory; Kind selects a
+// tool specific variant, such as the SMART self-test type.
+type DeepToolOptions struct {
+	Device string
+	Kind   string
+	// Size and Duration bound tools that generate load, such as the test
+	// file size ("256M") and run time of the disk probe.
+	Size     string
+	Duration time.Duration
+	// Progress, when set, receives the completed percentage of tools that
+	// report it.
+	Progress func(percent int)
+}
+
+// DeepToolRun requests one run of a registered tool.
+type DeepToolRun struct {
+	Tool    string
+	Options DeepToolOptions
+	Timeout time.Duration
+}
+
+var deepToolNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+var deepToolRegistry = struct {
+	sync.RWMutex
+	tools map[string]DeepTool
+}{tools: make(map[string]DeepTool)}
+
+func init() {
+	for _, tool := range []DeepTool{
+		{
+			Name: "smart-selftest", Description: "SMART short or extended self-test (--device /dev/sdX, --kind short|extended)",
+			DefaultTimeout: 15 * time.Minute,
+			// Drives recommend hours for an extended test, over a day on large
+			// disks, and canceling the run aborts the test on the drive.
+			KindTimeouts: map[string]time.Duration{SMARTSelfTestExtended: 48 * time.Hour},
+			Run: func(ctx context.Context, options DeepToolOptions) DeepToolResult {
+				return RunSMARTSelfTestWithOptions(ctx, options.Device, SMARTSelfTestOptions{Kind: options.Kind, Progress: options.Progress})
+			},
+		},
+		{
+			Name: "cpu-bench", Description: "Single-thread and all-core integer, float and SHA-256 scores with memory bandwidth and latency (--size 64M, --duration 10s)",
+			DefaultTimeout: 2 * time.Minute,
+			Run: func(ctx context.Context, options DeepToolOptions) DeepToolResult {
+				return RunCPUBench(ctx, options.Size, options.Duration)
+			},
+		},
+		{
+			Name: "disk-probe", Description: "Sequential and 4K random I/O with fsync latency in a directory (--device dir, --size 256M, --duration 10s)",
+			DefaultTimeout: 2 * time.Minute,
+			Run: func(ctx context.Context, options DeepToolOptions) DeepToolResult {
+				return RunDiskProbe(ctx, options.Device, options.Size, options.Duration)
+			},
+		},
+		{
+			Name: "gpu-compute", Description: "OpenCL compute benchmark with clpeak (--device selector)",
+			DefaultTimeout: 5 * time.Minute,
+			Run: func(ctx context.Context, options DeepToolOptions) DeepToolResult {
+				return RunGPUCompute(ctx, options.Device)
+			},
+		},
+	} {
+		if err := RegisterDeepTool(tool); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterDeepTool adds a tool to the registry. Names must be lower-case
+// and may contain hyphens, as they are used as CLI arguments.
+func RegisterDeepTool(tool DeepTool) error {
+	tool.Name = strings.TrimSpace(tool.Name)
+	if !deepToolNamePattern.MatchString(tool.Name) {
+		return fmt.Errorf("invalid deep tool name %q", tool.Name)
+	}
+	if tool.Run == nil {
+		return fmt.Errorf("deep tool %q has no run function", tool.Name)
+	}
+	deepToolRegistry.Lock()
+	defer deepToolRegistry.Unlock()
+	if _, exists := deepToolRegistry.tools[tool.Name]; exists {
+		return fmt.Errorf("deep tool %q is already registered", tool.Name)
+	}
+	deepToolRegistry.tools[tool.Name] = tool
+	return nil
+}
+
+// UnregisterDeepTool removes a previously registered tool.
+func UnregisterDeepTool(name string) {
+	deepToolRegistry.Lock()
+	defer deepToolRegistry.Unlock()
+	delete(deepToolRegistry.tools, name)
+}
+
+// LookupDeepTool returns the registered tool called name.
+func LookupDeepTool(name string) (DeepTool, bool) {
+	deepToolRegistry.RLock()
+	defer deepToolRegistry.RUnlock()
+	tool, ok := deepToolRegistry.tools[strings.TrimSpace(name)]
+	return tool, ok
+}
+
+// DeepTools lists the registered tools in name order.
+func DeepTools() []DeepTool {
+	deepToolRegistry.RLock()
+	defer deepToolRegistry.RUnlock()
+	tools := make([]DeepTool, 0, len(deepToolRegistry.tools))
+	for _, tool := range deepToolRegistry.tools {
+		tools = append(tools, tool)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools
+}
+
+// RunDeepTools runs the requested tools one after another, since they
+// usually load the same hardware, each under its own timeout. Results keep
+// the request order and carry the tool name; an unknown tool yields an
+// "error" result instead of stopping the others.
+func RunDeepTools(ctx context.Context, runs []DeepToolRun) []DeepToolResult {
+	results := make([]DeepToolResult, 0, len(runs))
+	for _, run := range runs {
+		tool, ok := LookupDeepTool(run.Tool)
+		if !ok {
+			results = append(results, DeepToolResult{Tool: run.Tool, Status: "error", Target: run.Options.Device, Error: fmt.Sprintf("unknown deep tool %q", run.Tool)})
+			continue
+		}
+		timeout := run.Timeout
+		if timeout <= 0 {
+			timeout = tool.DefaultTimeout
+			if kindTimeout, ok := tool.KindTimeouts[run.Options.Kind]; ok {
+				timeout = kindTimeout
+			}
+		}
+		runCtx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			runCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		result := tool.Run(runCtx, run.Options)
+		cancel()
+		result.Tool = tool.Name
+		results = append(results, result)
+	}
+	return results
+}
+
+// RenderDeepToolResultsText prints one row per result followed by the tool
+// output, indented.
+func RenderDeepToolResultsText(results []DeepToolResult, language string) string {
+	zh := strings.EqualFold(strings.TrimSpace(language), "zh")
+	var builder strings.Builder
+	for _, result := range results {
+		value := joinReportValues(" ", result.Status, result.Target, fmt.Sprintf("(%s)", time.Duration(result.DurationMS)*time.Millisecond))
+		label := "Deep " + result.Tool
+		if zh {
+			label = "深度测试 " + result.Tool
+		}
+		builder.WriteString(formatReportRow(label, value))
+		if result.Error != "" {
+			builder.WriteString("  " + result.Error + "\n")
+		}
+		for _, line := range strings.Split(result.Output, "\n") {
+			if line = strings.TrimRight(line, " \r"); line != "" {
+				builder.WriteString("  " + line + "\n")
+			}
+		}
+	}
+	return builder.String()
+}
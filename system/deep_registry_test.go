@@ -0,0 +1,106 @@
+package system
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegisterDeepToolValidation(t *testing.T) {
+	run := func(context.Context, DeepToolOptions) DeepToolResult { return DeepToolResult{} }
+	for _, tool := range []DeepTool{
+		{Name: "Bad Name", Run: run},
+		{Name: "no-run"},
+		{Name: "smart-selftest", Run: run},
+	} {
+		if err := RegisterDeepTool(tool); err == nil {
+			t.Fatalf("RegisterDeepTool(%q) accepted", tool.Name)
+		}
+	}
+	var names []string
+	for _, tool := range DeepTools() {
+		names = append(names, tool.Name)
+	}
+	if strings.Join(names, ",") != "cpu-bench,disk-probe,gpu-compute,smart-selftest" {
+		t.Fatalf("unexpected built-in deep tools: %v", names)
+	}
+}
+
+func TestRunDeepToolsAppliesTimeoutsInOrder(t *testing.T) {
+	var deadlines []time.Duration
+	if err := RegisterDeepTool(DeepTool{
+		Name: "fixture-sleep", DefaultTimeout: time.Hour,
+		Run: func(ctx context.Context, options DeepToolOptions) DeepToolResult {
+			deadline, _ := ctx.Deadline()
+			deadlines = append(deadlines, time.Until(deadline))
+			return DeepToolResult{SchemaVersion: "fixture/v1", Status: "ok", Target: options.Device}
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterDeepTool("fixture-sleep")
+
+	results := RunDeepTools(context.Background(), []DeepToolRun{
+		{Tool: "fixture-sleep", Options: DeepToolOptions{Device: "a"}, Timeout: time.Minute},
+		{Tool: "missing"},
+		{Tool: "fixture-sleep", Options: DeepToolOptions{Device: "b"}},
+	})
+	if len(results) != 3 || results[0].Tool != "fixture-sleep" || results[0].Target != "a" || results[2].Target != "b" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if results[1].Status != "error" || !strings.Contains(results[1].Error, "unknown deep tool") {
+		t.Fatalf("unknown tool result = %+v", results[1])
+	}
+	if len(deadlines) != 2 || deadlines[0] > time.Minute || deadlines[1] <= time.Minute {
+		t.Fatalf("timeouts were not applied per run: %v", deadlines)
+	}
+}
+
+func TestRunDeepToolsAppliesKindTimeouts(t *testing.T) {
+	var deadlines []time.Duration
+	if err := RegisterDeepTool(DeepTool{
+		Name: "fixture-kind", DefaultTimeout: time.Minute, KindTimeouts: map[string]time.Duration{"long": 48 * time.Hour},
+		Run: func(ctx context.Context, options DeepToolOptions) DeepToolResult {
+			deadline, _ := ctx.Deadline()
+			deadlines = append(deadlines, time.Until(deadline))
+			return DeepToolResult{Status: "ok"}
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterDeepTool("fixture-kind")
+
+	RunDeepTools(context.Background(), []DeepToolRun{
+		{Tool: "fixture-kind"},
+		{Tool: "fixture-kind", Options: DeepToolOptions{Kind: "long"}},
+		{Tool: "fixture-kind", Options: DeepToolOptions{Kind: "long"}, Timeout: time.Second},
+	})
+	if len(deadlines) != 3 || deadlines[0] > time.Minute || deadlines[1] <= 47*time.Hour || deadlines[2] > time.Second {
+		t.Fatalf("kind timeouts were not applied: %v", deadlines)
+	}
+	if tool, _ := LookupDeepTool("smart-selftest"); tool.KindTimeouts[SMARTSelfTestExtended] < 24*time.Hour {
+		t.Fatalf("extended SMART self-test timeout = %s", tool.KindTimeouts[SMARTSelfTestExtended])
+	}
+}
+
+func TestRenderDeepToolResultsText(t *testing.T) {
+	text := RenderDeepToolResultsText([]DeepToolResult{
+		{Tool: "smart-selftest", Status: "failed", Target: "/dev/sda", DurationMS: 1500, Output: "ata short self-test: read_failure", Error: "self-test result: read_failure"},
+		{Tool: "gpu-compute", Status: "skipped", Error: "explicit GPU device is not configured"},
+	}, "en")
+	for _, want := range []string{
+		" Deep smart-selftest",
+		": failed /dev/sda (1.5s)\n",
+		"  self-test result: read_failure\n  ata short self-test: read_failure\n",
+		" Deep gpu-compute",
+		": skipped (0s)\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("deep text missing %q:\n%s", want, text)
+		}
+	}
+	if zh := RenderDeepToolResultsText([]DeepToolResult{{Tool: "gpu-compute", Status: "ok"}}, "zh"); !strings.HasPrefix(zh, " 深度测试 gpu-compute") {
+		t.Fatalf("unexpected zh text: %q", zh)
+	}
+}
@@ -0,0 +1,129 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SMART self-test kinds accepted by RunSMARTSelfTestWithOptions.
+const (
+	SMARTSelfTestShort    = "short"
+	SMARTSelfTestExtended = "extended"
+)
+
+const nvmeSelfTestLogSize = 564
+
+// SMARTSelfTestOptions selects the self-test and how it is followed. The
+// zero value runs a short test and polls every two seconds.
+type SMARTSelfTestOptions struct {
+	Kind         string
+	PollInterval time.Duration
+	// Progress, when set, receives the completed percentage each time the
+	// drive reports a running test.
+	Progress func(percent int)
+}
+
+// smartSelfTestDevice starts, polls and aborts a self-test through the
+// native ATA or NVMe passthrough.
+type smartSelfTestDevice interface {
+	Protocol() string
+	Start(kind string) error
+	Poll() (smartSelfTestStatus, error)
+	Abort() error
+	Close() error
+}
+
+type smartSelfTestOpener func(device string) (smartSelfTestDevice, error)
+
+// errSMARTSelfTestPassthroughUnsupported is returned by an opener when the
+// device rejects the native commands, so the smartctl path is tried instead.
+var errSMARTSelfTestPassthroughUnsupported = errors.New("native SMART self-test passthrough unsupported")
+
+type smartSelfTestStatus struct {
+	Running          bool
+	CompletedPercent int
+	Result           string
+	Failed           bool
+}
+
+// pollNativeSMARTSelfTest waits for a started self-test to finish, aborting it
+// on the drive when ctx is canceled.
+func pollNativeSMARTSelfTest(ctx context.Context, device smartSelfTestDevice, kind string, result DeepToolResult, options SMARTSelfTestOptions) DeepToolResult {
+	interval := options.PollInterval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			_ = device.Abort()
+			return failedDeepTool(result, ctx, nil, ctx.Err())
+		case <-ticker.C:
+			status, err := device.Poll()
+			if err != nil {
+				return failedDeepTool(result, ctx, nil, err)
+			}
+			if status.Running {
+				if options.Progress != nil {
+					options.Progress(status.CompletedPercent)
+				}
+				continue
+			}
+			result.Output = fmt.Sprintf("%s %s self-test: %s", device.Protocol(), kind, status.Result)
+			switch {
+			case status.Failed:
+				result.Status, result.Error = "failed", "self-test result: "+status.Result
+			case status.Result != "completed":
+				result.Status, result.Error = "error", "self-test result: "+status.Result
+			default:
+				result.Status = "ok"
+			}
+			return result
+		}
+	}
+}
+
+// parseATASelfTestExecutionStatus decodes byte 363 of the SMART READ DATA
+// page. The low nibble counts the remaining work in tenths.
+func parseATASelfTestExecutionStatus(value byte) smartSelfTestStatus {
+	code := value >> 4
+	if code == 0x0f {
+		remaining := int(value&0x0f) * 10
+		return smartSelfTestStatus{Running: true, CompletedPercent: 100 - remaining}
+	}
+	status := smartSelfTestStatus{Result: "unknown", Failed: code >= 3 && code <= 8}
+	if int(code) < len(ataSelfTestStatuses) {
+		status.Result = ataSelfTestStatuses[code]
+	}
+	return status
+}
+
+var nvmeSelfTestResults = []string{
+	"completed", "aborted_by_command", "aborted_by_reset", "aborted_namespace_removed",
+	"aborted_by_format", "fatal_error", "unknown_segment_failure", "segment_failure",
+	"aborted_unknown", "aborted_by_sanitize",
+}
+
+// parseNVMeSelfTestLog decodes the Device Self-test log (log page 06h). The
+// newest result descriptor follows the four byte header.
+func parseNVMeSelfTestLog(data []byte) (smartSelfTestStatus, error) {
+	if len(data) < nvmeSelfTestLogSize {
+		return smartSelfTestStatus{}, fmt.Errorf("NVMe self-test log is %d bytes; require %d", len(data), nvmeSelfTestLogSize)
+	}
+	if data[0]&0x0f != 0 {
+		return smartSelfTestStatus{Running: true, CompletedPercent: int(data[1] & 0x7f)}, nil
+	}
+	code := data[4] & 0x0f
+	if code == 0x0f {
+		return smartSelfTestStatus{}, errors.New("NVMe self-test log has no result")
+	}
+	status := smartSelfTestStatus{Result: "unknown", Failed: code >= 5 && code <= 7}
+	if int(code) < len(nvmeSelfTestResults) {
+		status.Result = nvmeSelfTestResults[code]
+	}
+	return status, nil
+}
@@ -0,0 +1,117 @@
+//go:build linux
+
+package system
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// ATA SMART EXECUTE OFF-LINE IMMEDIATE subcommands and NVMe Device Self-test
+// codes.
+const (
+	ataSelfTestShort     = 0x01
+	ataSelfTestExtended  = 0x02
+	ataSelfTestAbort     = 0x7f
+	nvmeSelfTestShort    = 0x1
+	nvmeSelfTestExtended = 0x2
+	nvmeSelfTestAbort    = 0xf
+	nvmeSelfTestLogPage  = 0x06
+)
+
+// openSMARTSelfTestDevice opens device and probes the passthrough matching
+// its name: NVMe admin commands for nvme* devices, ATA PASS-THROUGH otherwise.
+func openSMARTSelfTestDevice(device string) (smartSelfTestDevice, error) {
+	file, err := os.Open(device)
+	if err != nil {
+		return nil, err
+	}
+	var opened smartSelfTestDevice = ataSMARTSelfTestDevice{file: file}
+	if nvmeControllerPattern.MatchString(filepath.Base(device)) {
+		opened = nvmeSMARTSelfTestDevice{file: file}
+	}
+	if _, err := opened.Poll(); err != nil {
+		file.Close()
+		if errors.Is(err, errATAPassthroughUnsupported) || errors.Is(err, errNVMeCommandRejected) || errors.Is(err, syscall.ENOTTY) || errors.Is(err, syscall.EOPNOTSUPP) {
+			return nil, errSMARTSelfTestPassthroughUnsupported
+		}
+		return nil, err
+	}
+	return opened, nil
+}
+
+type ataSMARTSelfTestDevice struct{ file *os.File }
+
+func (ataSMARTSelfTestDevice) Protocol() string { return "ata" }
+
+func (device ataSMARTSelfTestDevice) Start(kind string) error {
+	if kind == SMARTSelfTestExtended {
+		return device.execute(ataSelfTestExtended)
+	}
+	return device.execute(ataSelfTestShort)
+}
+
+func (device ataSMARTSelfTestDevice) Poll() (smartSelfTestStatus, error) {
+	data, err := readATASMARTPage(device.file.Fd(), 0xd0, 0)
+	if err != nil {
+		return smartSelfTestStatus{}, err
+	}
+	return parseATASelfTestExecutionStatus(data[363]), nil
+}
+
+func (device ataSMARTSelfTestDevice) Abort() error { return device.execute(ataSelfTestAbort) }
+
+func (device ataSMARTSelfTestDevice) Close() error { return device.file.Close() }
+
+// execute issues SMART EXECUTE OFF-LINE IMMEDIATE with the subcommand in
+// LBA low.
+func (device ataSMARTSelfTestDevice) execute(subcommand byte) error {
+	command := make([]byte, 16)
+	command[0] = 0x85   // ATA PASS-THROUGH (16)
+	command[1] = 3 << 1 // non-data
+	command[4] = 0xd4
+	command[8] = subcommand
+	command[10] = 0x4f
+	command[12] = 0xc2
+	command[14] = 0xb0 // SMART
+	_, err := sgIORead(device.file.Fd(), command, nil)
+	if errors.Is(err, errSGIOCommandRejected) {
+		return errATAPassthroughUnsupported
+	}
+	return err
+}
+
+type nvmeSMARTSelfTestDevice struct{ file *os.File }
+
+func (nvmeSMARTSelfTestDevice) Protocol() string { return "nvme" }
+
+func (device nvmeSMARTSelfTestDevice) Start(kind string) error {
+	if kind == SMARTSelfTestExtended {
+		return device.execute(nvmeSelfTestExtended)
+	}
+	return device.execute(nvmeSelfTestShort)
+}
+
+func (device nvmeSMARTSelfTestDevice) Poll() (smartSelfTestStatus, error) {
+	data := make([]byte, nvmeSelfTestLogSize)
+	if err := nvmeGetLogPage(device.file.Fd(), nvmeSelfTestLogPage, data); err != nil {
+		return smartSelfTestStatus{}, err
+	}
+	status, err := parseNVMeSelfTestLog(data)
+	if err != nil && data[4]&0x0f == 0x0f {
+		// A drive that never ran a self-test has an empty log.
+		return smartSelfTestStatus{Result: "no_result"}, nil
+	}
+	return status, err
+}
+
+func (device nvmeSMARTSelfTestDevice) Abort() error { return device.execute(nvmeSelfTestAbort) }
+
+func (device nvmeSMARTSelfTestDevice) Close() error { return device.file.Close() }
+
+// execute issues Device Self-test for the controller and all namespaces.
+func (device nvmeSMARTSelfTestDevice) execute(code uint32) error {
+	return nvmeAdmin(device.file.Fd(), 0x14, ^uint32(0), code, nil)
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package system
+
+func openSMARTSelfTestDevice(string) (smartSelfTestDevice, error) {
+	return nil, errSMARTSelfTestPassthroughUnsupported
+}
@@ -0,0 +1,126 @@
+package system
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+type fakeSMARTSelfTestDevice struct {
+	polls   []smartSelfTestStatus
+	started string
+	aborted bool
+	closed  bool
+}
+
+func (*fakeSMARTSelfTestDevice) Protocol() string { return "ata" }
+
+func (device *fakeSMARTSelfTestDevice) Start(kind string) error {
+	device.started = kind
+	return nil
+}
+
+func (device *fakeSMARTSelfTestDevice) Poll() (smartSelfTestStatus, error) {
+	status := device.polls[0]
+	if len(device.polls) > 1 {
+		device.polls = device.polls[1:]
+	}
+	return status, nil
+}
+
+func (device *fakeSMARTSelfTestDevice) Abort() error {
+	device.aborted = true
+	return nil
+}
+
+func (device *fakeSMARTSelfTestDevice) Close() error {
+	device.closed = true
+	return nil
+}
+
+func TestRunSMARTSelfTestNativeReportsProgress(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Linux-only self-test")
+	}
+	device := &fakeSMARTSelfTestDevice{polls: []smartSelfTestStatus{
+		parseATASelfTestExecutionStatus(0xf9), parseATASelfTestExecutionStatus(0xf3), parseATASelfTestExecutionStatus(0x00),
+	}}
+	var progress []int
+	result := runSMARTSelfTest(context.Background(), "/dev/sda", SMARTSelfTestOptions{
+		Kind: SMARTSelfTestExtended, PollInterval: time.Millisecond,
+		Progress: func(percent int) { progress = append(progress, percent) },
+	}, func(string) (smartSelfTestDevice, error) { return device, nil }, func(_ context.Context, name string, _ ...string) ([]byte, error) {
+		t.Fatalf("smartctl used despite native passthrough: %s", name)
+		return nil, nil
+	})
+	if result.Status != "ok" || result.Output != "ata extended self-test: completed" || result.SchemaVersion != "goecs.smart/selftest-v1" {
+		t.Fatalf("unexpected native result: %+v", result)
+	}
+	if device.started != SMARTSelfTestExtended || !device.closed || len(progress) != 2 || progress[0] != 10 || progress[1] != 70 {
+		t.Fatalf("unexpected native run: device=%+v progress=%v", device, progress)
+	}
+}
+
+func TestRunSMARTSelfTestNativeFailureAndAbort(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Linux-only self-test")
+	}
+	device := &fakeSMARTSelfTestDevice{polls: []smartSelfTestStatus{parseATASelfTestExecutionStatus(0x79)}}
+	open := func(string) (smartSelfTestDevice, error) { return device, nil }
+	result := runSMARTSelfTest(context.Background(), "/dev/sda", SMARTSelfTestOptions{PollInterval: time.Millisecond}, open, nil)
+	if result.Status != "failed" || result.Error != "self-test result: read_failure" || device.started != SMARTSelfTestShort {
+		t.Fatalf("unexpected failed self-test: %+v", result)
+	}
+
+	device = &fakeSMARTSelfTestDevice{polls: []smartSelfTestStatus{{Running: true}}}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	result = runSMARTSelfTest(ctx, "/dev/sda", SMARTSelfTestOptions{PollInterval: time.Millisecond}, open, nil)
+	if result.Status != "canceled" || !device.aborted {
+		t.Fatalf("self-test was not aborted on cancel: result=%+v device=%+v", result, device)
+	}
+}
+
+func TestRunSMARTSelfTestFallsBackToSmartctl(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Linux-only self-test")
+	}
+	var commands [][]string
+	result := runSMARTSelfTest(context.Background(), "/dev/sdb", SMARTSelfTestOptions{Kind: SMARTSelfTestExtended, PollInterval: time.Millisecond}, func(string) (smartSelfTestDevice, error) {
+		return nil, errSMARTSelfTestPassthroughUnsupported
+	}, func(_ context.Context, name string, args ...string) ([]byte, error) {
+		commands = append(commands, append([]string{name}, args...))
+		return []byte("Self-test execution status: completed"), nil
+	})
+	if result.Status != "ok" || len(commands) != 2 || commands[0][2] != "long" || commands[1][1] != "-c" {
+		t.Fatalf("unexpected fallback: result=%+v commands=%v", result, commands)
+	}
+	if result := runSMARTSelfTest(context.Background(), "/dev/sdb", SMARTSelfTestOptions{Kind: "conveyance"}, nil, nil); result.Status != "error" {
+		t.Fatalf("unsupported kind accepted: %+v", result)
+	}
+}
+
+func TestParseNVMeSelfTestLog(t *testing.T) {
+	data := make([]byte, nvmeSelfTestLogSize)
+	data[0], data[1] = 0x2, 45
+	if status, err := parseNVMeSelfTestLog(data); err != nil || !status.Running || status.CompletedPercent != 45 {
+		t.Fatalf("running NVMe self-test = %+v, %v", status, err)
+	}
+	data[0], data[1] = 0, 0
+	data[4] = 0x1<<4 | 0x7
+	if status, err := parseNVMeSelfTestLog(data); err != nil || status.Running || !status.Failed || status.Result != "segment_failure" {
+		t.Fatalf("failed NVMe self-test = %+v, %v", status, err)
+	}
+	data[4] = 0x2<<4 | 0x1
+	if status, err := parseNVMeSelfTestLog(data); err != nil || status.Failed || status.Result != "aborted_by_command" {
+		t.Fatalf("aborted NVMe self-test = %+v, %v", status, err)
+	}
+	data[4] = 0x0f
+	if _, err := parseNVMeSelfTestLog(data); err == nil {
+		t.Fatal("empty NVMe self-test log accepted")
+	}
+	if _, err := parseNVMeSelfTestLog(data[:64]); err == nil {
+		t.Fatal("short NVMe self-test log accepted")
+	}
+}
@@ -11,21 +11,33 @@ import (
 )
 
 type DeepToolResult struct {
+	// Tool is the registry name, set by RunDeepTools.
+	Tool          string `json:"tool,omitempty"`
 	SchemaVersion string `json:"schema_version"`
 	Status        string `json:"status"`
 	Target        string `json:"target,omitempty"`
 	DurationMS    int64  `json:"duration_ms"`
 	Output        string `json:"output,omitempty"`
 	Error         string `json:"error,omitempty"`
+	// Data holds the structured numbers of tools that measure something.
+	Data any `json:"data,omitempty"`
 }
 
 type deepCommandRunner func(context.Context, string, ...string) ([]byte, error)
 
+// RunSMARTSelfTest runs a short SMART self-test on device and waits for it.
 func RunSMARTSelfTest(ctx context.Context, device string) DeepToolResult {
-	return runSMARTSelfTest(ctx, strings.TrimSpace(device), runDeepCommand)
+	return RunSMARTSelfTestWithOptions(ctx, device, SMARTSelfTestOptions{})
 }
 
-func runSMARTSelfTest(ctx context.Context, device string, runner deepCommandRunner) (result DeepToolResult) {
+// RunSMARTSelfTestWithOptions starts and polls the self-test through the
+// native ATA or NVMe passthrough, falling back to smartctl for devices that
+// reject it. Canceling ctx aborts the running test on the drive.
+func RunSMARTSelfTestWithOptions(ctx context.Context, device string, options SMARTSelfTestOptions) DeepToolResult {
+	return runSMARTSelfTest(ctx, strings.TrimSpace(device), options, openSMARTSelfTestDevice, runDeepCommand)
+}
+
+func runSMARTSelfTest(ctx context.Context, device string, options SMARTSelfTestOptions, open smartSelfTestOpener, runner deepCommandRunner) (result DeepToolResult) {
 	result = DeepToolResult{SchemaVersion: "goecs.smart/selftest-v1", Status: "skipped", Target: device}
 	if device == "" {
 		result.Error = "explicit SMART device is not configured"
@@ -39,14 +51,37 @@ func runSMARTSelfTest(ctx context.Context, device string, runner deepCommandRunn
 		result.Status, result.Error = "error", "invalid explicit SMART device"
 		return result
 	}
+	kind := options.Kind
+	if kind == "" {
+		kind = SMARTSelfTestShort
+	}
+	if kind != SMARTSelfTestShort && kind != SMARTSelfTestExtended {
+		result.Status, result.Error = "error", fmt.Sprintf("unsupported SMART self-test kind %q", kind)
+		return result
+	}
 	started := time.Now()
 	defer func() { result.DurationMS = time.Since(started).Milliseconds() }()
-	output, err := runner(ctx, "smartctl", "-t", "short", device)
+	native, err := open(device)
+	if err == nil {
+		defer native.Close()
+		if err := native.Start(kind); err != nil {
+			return failedDeepTool(result, ctx, nil, err)
+		}
+		return pollNativeSMARTSelfTest(ctx, native, kind, result, options)
+	}
+	if !errors.Is(err, errSMARTSelfTestPassthroughUnsupported) {
+		return failedDeepTool(result, ctx, nil, err)
+	}
+	smartctlKind := "short"
+	if kind == SMARTSelfTestExtended {
+		smartctlKind = "long"
+	}
+	output, err := runner(ctx, "smartctl", "-t", smartctlKind, device)
 	if err != nil {
 		return failedDeepTool(result, ctx, output, err)
 	}
 	result.Output = boundedDeepOutput(output)
-	return pollSMARTSelfTest(ctx, device, result, runner, 2*time.Second)
+	return pollSMARTSelfTest(ctx, device, result, runner, options.PollInterval)
 }
 
 func pollSMARTSelfTest(ctx context.Context, device string, result DeepToolResult, runner deepCommandRunner, interval time.Duration) DeepToolResult {
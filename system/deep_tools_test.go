@@ -23,7 +23,10 @@ func TestRunSMARTSelfTestRejectsUnsafeDevice(t *testing.T) {
 		t.Skip("Linux-only validation")
 	}
 	called := false
-	result := runSMARTSelfTest(context.Background(), "/dev/disk/by-id/unsafe", func(context.Context, string, ...string) ([]byte, error) {
+	result := runSMARTSelfTest(context.Background(), "/dev/disk/by-id/unsafe", SMARTSelfTestOptions{}, func(string) (smartSelfTestDevice, error) {
+		called = true
+		return nil, errSMARTSelfTestPassthroughUnsupported
+	}, func(context.Context, string, ...string) ([]byte, error) {
 		called = true
 		return nil, nil
 	})
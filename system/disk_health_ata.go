@@ -3,18 +3,35 @@ package system
 import (
 	"encoding/binary"
 	"fmt"
+	"sort"
 )
 
 const ataSMARTPageSize = 512
 
+// ATAThresholdExceeded is an ATA SMART attribute whose normalized value is at
+// or below the vendor threshold.
+type ATAThresholdExceeded struct {
+	ID        uint8 `json:"id"`
+	Current   uint8 `json:"current"`
+	Threshold uint8 `json:"threshold"`
+	Prefail   bool  `json:"prefail"`
+}
+
 type ataSMARTAttribute struct {
 	id      byte
 	flags   uint16
 	current byte
+	worst   byte
 	raw     uint64
 }
 
 func parseATASMARTData(data, thresholds []byte) (DiskHealthReport, DiskTemperatureReport) {
+	return parseATASMARTDataForModel(data, thresholds, "")
+}
+
+// parseATASMARTDataForModel also fills the full attribute table. The model
+// selects vendor specific raw value layouts.
+func parseATASMARTDataForModel(data, thresholds []byte, model string) (DiskHealthReport, DiskTemperatureReport) {
 	health := DiskHealthReport{
 		ReportSection: ReportSection{Availability: AvailabilityError},
 		Protocol:      "ata",
@@ -46,7 +63,8 @@ func parseATASMARTData(data, thresholds []byte) (DiskHealthReport, DiskTemperatu
 		health.OfflineUncorrectable = uint64Ptr(attribute.raw)
 	}
 	if attribute, ok := attributes[9]; ok {
-		health.PowerOnHours = uint64Ptr(attribute.raw)
+		// Some vendors keep minutes or milliseconds above the low 32 bits.
+		health.PowerOnHours = uint64Ptr(attribute.raw & 0xffffffff)
 	}
 	if attribute, ok := attributes[12]; ok {
 		health.PowerCycles = uint64Ptr(attribute.raw)
@@ -54,13 +72,29 @@ func parseATASMARTData(data, thresholds []byte) (DiskHealthReport, DiskTemperatu
 	if attribute, ok := attributes[192]; ok {
 		health.UnsafeShutdowns = uint64Ptr(attribute.raw)
 	}
-	if parsedThresholds, ok := parseATASMARTThresholds(thresholds); ok {
+	parsedThresholds, hasThresholds := parseATASMARTThresholds(thresholds)
+	health.ATA = &ATASMARTReport{Attributes: ataAttributeTable(attributes, parsedThresholds, model)}
+	if hasThresholds {
 		health.Status = "passed"
-		for id, threshold := range parsedThresholds {
-			attribute, found := attributes[id]
-			if found && attribute.flags&1 != 0 && threshold > 0 && attribute.current <= threshold {
+		ids := make([]int, 0, len(parsedThresholds))
+		for id := range parsedThresholds {
+			ids = append(ids, int(id))
+		}
+		sort.Ints(ids)
+		for _, id := range ids {
+			threshold := parsedThresholds[byte(id)]
+			attribute, found := attributes[byte(id)]
+			if !found || threshold == 0 || attribute.current > threshold {
+				continue
+			}
+			// Bit 0 of the flags marks pre-failure attributes; crossing
+			// their threshold is the drive's own failure prediction.
+			prefail := attribute.flags&1 != 0
+			health.ThresholdsExceeded = append(health.ThresholdsExceeded, ATAThresholdExceeded{
+				ID: attribute.id, Current: attribute.current, Threshold: threshold, Prefail: prefail,
+			})
+			if prefail {
 				health.Status = "failed"
-				break
 			}
 		}
 	}
@@ -110,7 +144,7 @@ func parseATASMARTAttributes(data []byte) map[byte]ataSMARTAttribute {
 			raw |= uint64(entry[5+index]) << (8 * index)
 		}
 		attributes[id] = ataSMARTAttribute{
-			id: id, flags: binary.LittleEndian.Uint16(entry[1:3]), current: entry[3], raw: raw,
+			id: id, flags: binary.LittleEndian.Uint16(entry[1:3]), current: entry[3], worst: entry[4], raw: raw,
 		}
 	}
 	return attributes
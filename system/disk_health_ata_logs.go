@@ -0,0 +1,233 @@
+package system
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ATA SMART READ LOG addresses.
+const (
+	ataSMARTErrorLog    = 0x01
+	ataSMARTSelfTestLog = 0x06
+)
+
+// ATASMARTReport holds the complete ATA SMART data of one disk.
+type ATASMARTReport struct {
+	Attributes []ATASMARTAttributeReport `json:"attributes,omitempty"`
+	SelfTests  []ATASelfTestReport       `json:"self_tests,omitempty"`
+	// ErrorCount is the lifetime count of errors recorded by the drive; Errors
+	// holds only the most recent entries still kept in the summary log.
+	ErrorCount *uint64          `json:"error_count,omitempty"`
+	Errors     []ATAErrorReport `json:"errors,omitempty"`
+}
+
+// ATASMARTAttributeReport is one row of the SMART attribute table. WhenFailed
+// is "now" when the normalized value is at or below the threshold and "past"
+// when only the worst value was.
+type ATASMARTAttributeReport struct {
+	ID         uint8  `json:"id"`
+	Name       string `json:"name"`
+	Value      uint8  `json:"value"`
+	Worst      uint8  `json:"worst"`
+	Threshold  *uint8 `json:"threshold,omitempty"`
+	Raw        uint64 `json:"raw"`
+	RawDecoded string `json:"raw_decoded,omitempty"`
+	Prefail    bool   `json:"prefail"`
+	WhenFailed string `json:"when_failed,omitempty"`
+}
+
+// ATASelfTestReport is one entry of the SMART self-test log, most recent
+// first.
+type ATASelfTestReport struct {
+	Type             string  `json:"type"`
+	Status           string  `json:"status"`
+	RemainingPercent uint8   `json:"remaining_percent"`
+	LifetimeHours    uint16  `json:"lifetime_hours"`
+	FirstErrorLBA    *uint32 `json:"first_error_lba,omitempty"`
+	Failed           bool    `json:"failed"`
+}
+
+// ATAErrorReport is one entry of the SMART summary error log, most recent
+// first.
+type ATAErrorReport struct {
+	LifetimeHours uint16 `json:"lifetime_hours"`
+	Error         uint8  `json:"error"`
+	Status        uint8  `json:"status"`
+	LBA           uint32 `json:"lba"`
+	State         string `json:"state,omitempty"`
+}
+
+var ataAttributeNames = map[byte]string{
+	1: "Raw_Read_Error_Rate", 2: "Throughput_Performance", 3: "Spin_Up_Time",
+	4: "Start_Stop_Count", 5: "Reallocated_Sector_Ct", 7: "Seek_Error_Rate",
+	8: "Seek_Time_Performance", 9: "Power_On_Hours", 10: "Spin_Retry_Count",
+	11: "Calibration_Retry_Count", 12: "Power_Cycle_Count", 170: "Available_Reservd_Space",
+	171: "Program_Fail_Count", 172: "Erase_Fail_Count", 174: "Unexpect_Power_Loss_Ct",
+	177: "Wear_Leveling_Count", 179: "Used_Rsvd_Blk_Cnt_Tot", 181: "Program_Fail_Cnt_Total",
+	182: "Erase_Fail_Count_Total", 183: "Runtime_Bad_Block", 184: "End-to-End_Error",
+	187: "Reported_Uncorrect", 188: "Command_Timeout", 189: "High_Fly_Writes",
+	190: "Airflow_Temperature_Cel", 191: "G-Sense_Error_Rate", 192: "Power-Off_Retract_Count",
+	193: "Load_Cycle_Count", 194: "Temperature_Celsius", 195: "Hardware_ECC_Recovered",
+	196: "Reallocated_Event_Count", 197: "Current_Pending_Sector", 198: "Offline_Uncorrectable",
+	199: "UDMA_CRC_Error_Count", 200: "Multi_Zone_Error_Rate", 233: "Media_Wearout_Indicator",
+	240: "Head_Flying_Hours", 241: "Total_LBAs_Written", 242: "Total_LBAs_Read",
+}
+
+func ataAttributeTable(attributes map[byte]ataSMARTAttribute, thresholds map[byte]byte, model string) []ATASMARTAttributeReport {
+	ids := make([]int, 0, len(attributes))
+	for id := range attributes {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	table := make([]ATASMARTAttributeReport, 0, len(ids))
+	for _, id := range ids {
+		attribute := attributes[byte(id)]
+		name, ok := ataAttributeNames[attribute.id]
+		if !ok {
+			name = "Unknown_Attribute"
+		}
+		row := ATASMARTAttributeReport{
+			ID: attribute.id, Name: name, Value: attribute.current, Worst: attribute.worst,
+			Raw: attribute.raw, RawDecoded: decodeATAAttributeRaw(attribute.id, attribute.raw, model),
+			Prefail: attribute.flags&1 != 0,
+		}
+		if threshold, ok := thresholds[attribute.id]; ok {
+			row.Threshold = &threshold
+			switch {
+			case threshold > 0 && attribute.current <= threshold:
+				row.WhenFailed = "now"
+			case threshold > 0 && attribute.worst <= threshold:
+				row.WhenFailed = "past"
+			}
+		}
+		table = append(table, row)
+	}
+	return table
+}
+
+// decodeATAAttributeRaw interprets raw values whose bytes are not a single
+// counter. It returns "" when the plain 48-bit value is meaningful.
+func decodeATAAttributeRaw(id byte, raw uint64, model string) string {
+	switch id {
+	case 3:
+		// Spin-up time keeps the current value in the low 16 bits.
+		return fmt.Sprintf("%d", raw&0xffff)
+	case 9:
+		if raw>>32 != 0 {
+			return fmt.Sprintf("%d", raw&0xffffffff)
+		}
+	case 190, 194:
+		current, low, high := byte(raw), byte(raw>>16), byte(raw>>32)
+		if low > 0 && low <= current && current <= high {
+			return fmt.Sprintf("%d (min/max %d/%d)", current, low, high)
+		}
+		if raw>>8 != 0 {
+			return fmt.Sprintf("%d", current)
+		}
+	case 1, 7, 195:
+		// Seagate packs an error count above a 32-bit operation count.
+		if isSeagateModel(model) {
+			return fmt.Sprintf("%d errors / %d operations", raw>>32, raw&0xffffffff)
+		}
+	}
+	return ""
+}
+
+func isSeagateModel(model string) bool {
+	model = strings.ToUpper(strings.TrimSpace(model))
+	return strings.HasPrefix(model, "ST") || strings.HasPrefix(model, "SEAGATE")
+}
+
+var ataSelfTestTypes = map[byte]string{
+	0x00: "offline", 0x01: "short", 0x02: "extended", 0x03: "conveyance", 0x04: "selective",
+	0x81: "short_captive", 0x82: "extended_captive", 0x83: "conveyance_captive", 0x84: "selective_captive",
+}
+
+var ataSelfTestStatuses = []string{
+	"completed", "aborted_by_host", "interrupted_by_reset", "fatal_error", "unknown_failure",
+	"electrical_failure", "servo_failure", "read_failure", "handling_damage",
+}
+
+// parseATASelfTestLog decodes the SMART self-test log (log address 0x06).
+// The 21 descriptors form a ring; byte 508 points at the most recent one.
+func parseATASelfTestLog(data []byte) ([]ATASelfTestReport, error) {
+	if err := validateATASMARTPage(data, "self-test log"); err != nil {
+		return nil, err
+	}
+	const descriptors, descriptorSize = 21, 24
+	latest := int(data[508])
+	if latest == 0 || latest > descriptors {
+		return nil, nil
+	}
+	var tests []ATASelfTestReport
+	for count := 0; count < descriptors; count++ {
+		index := (latest - 1 - count + descriptors) % descriptors
+		entry := data[2+index*descriptorSize : 2+(index+1)*descriptorSize]
+		if entry[0] == 0 && entry[1] == 0 && entry[2] == 0 && entry[3] == 0 {
+			continue
+		}
+		testType, ok := ataSelfTestTypes[entry[0]]
+		if !ok {
+			testType = fmt.Sprintf("vendor_0x%02x", entry[0])
+		}
+		code := entry[1] >> 4
+		status := "unknown"
+		switch {
+		case int(code) < len(ataSelfTestStatuses):
+			status = ataSelfTestStatuses[code]
+		case code == 0x0f:
+			status = "in_progress"
+		}
+		test := ATASelfTestReport{
+			Type: testType, Status: status, RemainingPercent: (entry[1] & 0x0f) * 10,
+			LifetimeHours: binary.LittleEndian.Uint16(entry[2:4]),
+			Failed:        code >= 3 && code <= 8,
+		}
+		if test.Failed {
+			if lba := binary.LittleEndian.Uint32(entry[5:9]); lba != 0xffffffff {
+				test.FirstErrorLBA = &lba
+			}
+		}
+		tests = append(tests, test)
+	}
+	return tests, nil
+}
+
+var ataErrorStates = map[byte]string{
+	0x0: "unknown", 0x1: "sleep", 0x2: "standby", 0x3: "active_or_idle", 0x4: "offline_or_self_test",
+}
+
+// parseATAErrorLog decodes the SMART summary error log (log address 0x01).
+// The log keeps the five most recent errors in a ring indexed by byte 1.
+func parseATAErrorLog(data []byte) (uint64, []ATAErrorReport, error) {
+	if err := validateATASMARTPage(data, "error log"); err != nil {
+		return 0, nil, err
+	}
+	const entries, entrySize = 5, 90
+	count := uint64(binary.LittleEndian.Uint16(data[452:454]))
+	latest := int(data[1])
+	if latest == 0 || latest > entries {
+		return count, nil, nil
+	}
+	var logged []ATAErrorReport
+	for index := 0; index < entries && uint64(index) < count; index++ {
+		slot := (latest - 1 - index + entries) % entries
+		// Each entry holds five 12 byte command records followed by the
+		// 30 byte error record.
+		record := data[2+slot*entrySize+60 : 2+(slot+1)*entrySize]
+		state, ok := ataErrorStates[record[27]&0x0f]
+		if !ok {
+			state = "vendor"
+		}
+		logged = append(logged, ATAErrorReport{
+			LifetimeHours: binary.LittleEndian.Uint16(record[28:30]),
+			Error:         record[1],
+			Status:        record[7],
+			LBA:           uint32(record[6]&0x0f)<<24 | uint32(record[5])<<16 | uint32(record[4])<<8 | uint32(record[3]),
+			State:         state,
+		})
+	}
+	return count, logged, nil
+}
@@ -0,0 +1,174 @@
+package system
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestParseATASMARTDataAttributeTable(t *testing.T) {
+	attributes := newATASMARTFixturePage()
+	putATASMARTAttribute(attributes, 0, 194, 0, 67, 45, 33|18<<16|55<<32)
+	putATASMARTAttribute(attributes, 1, 5, 1, 90, 8, 12)
+	putATASMARTAttribute(attributes, 2, 1, 1, 80, 64, 3<<32|1234567)
+	putATASMARTAttribute(attributes, 3, 250, 0, 100, 100, 7)
+	finalizeATASMARTFixturePage(attributes)
+	thresholds := newATASMARTFixturePage()
+	thresholds[2], thresholds[3] = 5, 10
+	thresholds[14], thresholds[15] = 1, 6
+	finalizeATASMARTFixturePage(thresholds)
+
+	health, _ := parseATASMARTDataForModel(attributes, thresholds, "ST4000DM004-2CV104")
+	if health.ATA == nil || len(health.ATA.Attributes) != 4 {
+		t.Fatalf("unexpected attribute table: %+v", health.ATA)
+	}
+	table := health.ATA.Attributes
+	if table[0].ID != 1 || table[0].Name != "Raw_Read_Error_Rate" || table[0].RawDecoded != "3 errors / 1234567 operations" || table[0].WhenFailed != "" {
+		t.Fatalf("unexpected Seagate read error row: %+v", table[0])
+	}
+	reallocated := table[1]
+	if reallocated.ID != 5 || !reallocated.Prefail || reallocated.Worst != 8 || reallocated.Threshold == nil || *reallocated.Threshold != 10 || reallocated.WhenFailed != "past" {
+		t.Fatalf("unexpected reallocated row: %+v", reallocated)
+	}
+	if table[2].ID != 194 || table[2].RawDecoded != "33 (min/max 18/55)" || table[2].Threshold != nil {
+		t.Fatalf("unexpected temperature row: %+v", table[2])
+	}
+	if table[3].Name != "Unknown_Attribute" || table[3].Raw != 7 || table[3].RawDecoded != "" {
+		t.Fatalf("unexpected vendor row: %+v", table[3])
+	}
+
+	health, _ = parseATASMARTDataForModel(attributes, thresholds, "WDC WD40EFRX-68N32N0")
+	if health.ATA.Attributes[0].RawDecoded != "" {
+		t.Fatalf("non-Seagate raw read errors decoded: %+v", health.ATA.Attributes[0])
+	}
+}
+
+func TestDecodeATAAttributeRaw(t *testing.T) {
+	for _, test := range []struct {
+		id   byte
+		raw  uint64
+		want string
+	}{
+		{3, 0x0001_0000_1f40, "8000"},
+		{9, 0x0012_0000_3039, "12345"},
+		{9, 12345, ""},
+		{194, 40, ""},
+		{194, 0x0003_0000_0028, "40"},
+		{5, 0x0001_0000_0000, ""},
+	} {
+		if got := decodeATAAttributeRaw(test.id, test.raw, ""); got != test.want {
+			t.Errorf("decodeATAAttributeRaw(%d, %#x) = %q, want %q", test.id, test.raw, got, test.want)
+		}
+	}
+}
+
+func TestParseATASelfTestLog(t *testing.T) {
+	page := newATASMARTFixturePage()
+	putATASelfTestDescriptor(page, 0, 0x01, 0x00, 1000, 0)
+	putATASelfTestDescriptor(page, 1, 0x02, 0x79, 1200, 0x00abcdef)
+	putATASelfTestDescriptor(page, 2, 0x01, 0xf3, 1300, 0)
+	page[508] = 3
+	finalizeATASMARTFixturePage(page)
+
+	tests, err := parseATASelfTestLog(page)
+	if err != nil || len(tests) != 3 {
+		t.Fatalf("parseATASelfTestLog() = %+v, %v", tests, err)
+	}
+	if tests[0].Type != "short" || tests[0].Status != "in_progress" || tests[0].RemainingPercent != 30 || tests[0].Failed {
+		t.Fatalf("unexpected latest self-test: %+v", tests[0])
+	}
+	if tests[1].Type != "extended" || tests[1].Status != "read_failure" || !tests[1].Failed || tests[1].LifetimeHours != 1200 || tests[1].FirstErrorLBA == nil || *tests[1].FirstErrorLBA != 0x00abcdef {
+		t.Fatalf("unexpected failed self-test: %+v", tests[1])
+	}
+	if tests[2].Status != "completed" || tests[2].FirstErrorLBA != nil {
+		t.Fatalf("unexpected oldest self-test: %+v", tests[2])
+	}
+
+	empty := newATASMARTFixturePage()
+	finalizeATASMARTFixturePage(empty)
+	if tests, err := parseATASelfTestLog(empty); err != nil || len(tests) != 0 {
+		t.Fatalf("empty self-test log = %+v, %v", tests, err)
+	}
+	page[100]++
+	if _, err := parseATASelfTestLog(page); err == nil {
+		t.Fatal("corrupt self-test log accepted")
+	}
+}
+
+func TestParseATAErrorLog(t *testing.T) {
+	page := newATASMARTFixturePage()
+	putATAErrorRecord(page, 4, 0x40, 0x51, 0x0123456, 0x03, 900)
+	putATAErrorRecord(page, 0, 0x84, 0x51, 0x0000010, 0x04, 950)
+	page[1] = 1
+	binary.LittleEndian.PutUint16(page[452:454], 7)
+	finalizeATASMARTFixturePage(page)
+
+	count, logged, err := parseATAErrorLog(page)
+	if err != nil || count != 7 || len(logged) != 5 {
+		t.Fatalf("parseATAErrorLog() = %d, %+v, %v", count, logged, err)
+	}
+	if logged[0] != (ATAErrorReport{LifetimeHours: 950, Error: 0x84, Status: 0x51, LBA: 0x10, State: "offline_or_self_test"}) {
+		t.Fatalf("unexpected latest error: %+v", logged[0])
+	}
+	if logged[1] != (ATAErrorReport{LifetimeHours: 900, Error: 0x40, Status: 0x51, LBA: 0x0123456, State: "active_or_idle"}) {
+		t.Fatalf("unexpected previous error: %+v", logged[1])
+	}
+
+	clean := newATASMARTFixturePage()
+	finalizeATASMARTFixturePage(clean)
+	if count, logged, err := parseATAErrorLog(clean); err != nil || count != 0 || len(logged) != 0 {
+		t.Fatalf("clean error log = %d, %+v, %v", count, logged, err)
+	}
+}
+
+func TestRenderDiskDetailsText(t *testing.T) {
+	threshold := uint8(10)
+	failingLBA := uint32(4096)
+	report := &SystemReport{Disks: []DiskReport{
+		{Name: "private-nvme"},
+		{Name: "private-sda", Health: DiskHealthReport{ATA: &ATASMARTReport{
+			Attributes: []ATASMARTAttributeReport{{ID: 5, Name: "Reallocated_Sector_Ct", Value: 90, Worst: 8, Threshold: &threshold, Raw: 12, Prefail: true, WhenFailed: "past"}},
+			SelfTests:  []ATASelfTestReport{{Type: "extended", Status: "read_failure", RemainingPercent: 90, LifetimeHours: 1200, FirstErrorLBA: &failingLBA, Failed: true}},
+			ErrorCount: uint64Ptr(7),
+			Errors:     []ATAErrorReport{{LifetimeHours: 950, Error: 0x84, Status: 0x51, LBA: 16, State: "active_or_idle"}},
+		}}},
+	}}
+	text := RenderDiskDetailsText(report, "en")
+	for _, want := range []string{
+		" Disk 2 SMART Attributes",
+		"Reallocated_Sector_Ct",
+		"prefail  past   12",
+		" Disk 2 Self-tests",
+		"extended           read_failure         remaining 90% at 1200h LBA 4096",
+		"Disk 2 Error Log",
+		": 7",
+		"at 950h error 0x84 status 0x51 LBA 16 active_or_idle",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("details missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "Disk 1") || strings.Contains(text, "private") {
+		t.Fatalf("details include disk without ATA data or device name:\n%s", text)
+	}
+	if zh := RenderDiskDetailsText(report, "zh"); !strings.Contains(zh, "物理盘 2 SMART属性") || !strings.Contains(zh, "物理盘 2 错误日志") {
+		t.Fatalf("unexpected zh details:\n%s", zh)
+	}
+}
+
+func putATASelfTestDescriptor(page []byte, index int, testType, status byte, hours uint16, lba uint32) {
+	offset := 2 + index*24
+	page[offset], page[offset+1] = testType, status
+	binary.LittleEndian.PutUint16(page[offset+2:offset+4], hours)
+	binary.LittleEndian.PutUint32(page[offset+5:offset+9], lba)
+}
+
+func putATAErrorRecord(page []byte, slot int, errorRegister, status byte, lba uint32, state byte, hours uint16) {
+	record := page[2+slot*90+60 : 2+(slot+1)*90]
+	record[1] = errorRegister
+	record[3], record[4], record[5] = byte(lba), byte(lba>>8), byte(lba>>16)
+	record[6] = 0xe0 | byte(lba>>24)&0x0f
+	record[7] = status
+	record[27] = state
+	binary.LittleEndian.PutUint16(record[28:30], hours)
+}
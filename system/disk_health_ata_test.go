@@ -32,6 +32,24 @@ func TestParseATASMARTData(t *testing.T) {
 	if temperature.Availability != AvailabilityAvailable || temperature.Celsius == nil || *temperature.Celsius != 33 {
 		t.Fatalf("unexpected ATA temperature: %+v", temperature)
 	}
+	if len(health.ThresholdsExceeded) != 1 || health.ThresholdsExceeded[0] != (ATAThresholdExceeded{ID: 5, Current: 5, Threshold: 10, Prefail: true}) {
+		t.Fatalf("unexpected exceeded thresholds: %+v", health.ThresholdsExceeded)
+	}
+}
+
+func TestParseATASMARTDataOldAgeThresholdDoesNotFail(t *testing.T) {
+	attributes := newATASMARTFixturePage()
+	putATASMARTAttribute(attributes, 0, 5, 1, 100, 100, 0)
+	putATASMARTAttribute(attributes, 1, 190, 0, 40, 35, 60)
+	finalizeATASMARTFixturePage(attributes)
+	thresholds := newATASMARTFixturePage()
+	thresholds[2], thresholds[3] = 5, 10
+	thresholds[14], thresholds[15] = 190, 45
+	finalizeATASMARTFixturePage(thresholds)
+	health, _ := parseATASMARTData(attributes, thresholds)
+	if health.Status != "passed" || len(health.ThresholdsExceeded) != 1 || health.ThresholdsExceeded[0].ID != 190 || health.ThresholdsExceeded[0].Prefail {
+		t.Fatalf("old-age threshold result = %+v", health)
+	}
 }
 
 func TestParseATASMARTDataWithoutThresholdsDoesNotClaimPassed(t *testing.T) {
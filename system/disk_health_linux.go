@@ -3,11 +3,14 @@
 package system
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 	"runtime"
+	"strings"
 	"syscall"
 	"unsafe"
 
@@ -16,7 +19,12 @@ import (
 
 var diskDeviceNamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
 
-var errATAPassthroughUnsupported = errors.New("ATA SMART passthrough unsupported")
+var (
+	errATAPassthroughUnsupported = errors.New("ATA SMART passthrough unsupported")
+	errSCSILogSenseUnsupported   = errors.New("SCSI LOG SENSE unsupported")
+	errSGIOCommandRejected       = errors.New("SG_IO command rejected")
+	errNVMeCommandRejected       = errors.New("NVMe admin command rejected")
+)
 
 type linuxDiskHealthCollector struct{}
 
@@ -69,23 +77,38 @@ type sgIOHeader struct {
 var nvmeAdminIOCTL = uintptr((3 << 30) | (uint32(unsafe.Sizeof(nvmeAdminCommand{})) << 16) | (uint32('N') << 8) | 0x41)
 
 const (
-	sgIO                 = uintptr(0x2285)
-	sgTransferFromDevice = int32(-3)
+	sgIO                   = uintptr(0x2285)
+	sgTransferNone         = int32(-1)
+	sgTransferFromDevice   = int32(-3)
+	scsiLogSenseAllocation = 4096
 )
 
 func defaultDiskHealthCollector() diskHealthCollector { return linuxDiskHealthCollector{} }
 
 func (linuxDiskHealthCollector) Collect(name string, files ReportFileReader) (DiskHealthReport, DiskTemperatureReport) {
 	protocol := detectStorageProtocol(name, files)
+	model := strings.TrimSpace(readString(files, filepath.Join("/sys/block", name, "device/model")))
 	hwmonTemperature := collectDiskHWMonTemperature(name, files)
 	if protocol != "nvme" {
-		if protocol != "ata" && protocol != "ata_or_scsi" && protocol != "scsi" {
+		switch protocol {
+		case "ata":
+			return collectATASMART(name, model, hwmonTemperature)
+		case "scsi":
+			return collectSCSILogSense(name, hwmonTemperature)
+		case "ata_or_scsi":
+			// Without a transport hint, SAS drives reject the ATA
+			// passthrough and are retried with LOG SENSE.
+			health, temperature := collectATASMART(name, model, hwmonTemperature)
+			if health.Availability != AvailabilityUnsupported {
+				return health, temperature
+			}
+			return collectSCSILogSense(name, hwmonTemperature)
+		default:
 			return DiskHealthReport{
 				ReportSection: ReportSection{Availability: AvailabilityUnsupported, Error: "passive SMART health is unsupported for this storage protocol"},
 				Protocol:      protocol,
 			}, hwmonTemperature
 		}
-		return collectATASMART(name, hwmonTemperature)
 	}
 	controller := nvmeControllerPattern.FindString(name)
 	if controller == "" {
@@ -98,24 +121,96 @@ func (linuxDiskHealthCollector) Collect(name string, files ReportFileReader) (Di
 	}
 	defer file.Close()
 	buffer := make([]byte, nvmeSMARTLogSize)
-	command := nvmeAdminCommand{
-		Opcode: 0x02, NamespaceID: ^uint32(0), Address: uint64(uintptr(unsafe.Pointer(&buffer[0]))),
-		DataLen: uint32(len(buffer)), Command10: 0x02 | (((uint32(len(buffer)) / 4) - 1) << 16), TimeoutMS: 2000,
-	}
-	_, _, errno := unix.Syscall(unix.SYS_IOCTL, file.Fd(), nvmeAdminIOCTL, uintptr(unsafe.Pointer(&command)))
-	runtime.KeepAlive(buffer)
-	if errno != 0 {
-		availability := storageHealthAvailability(errno)
-		return DiskHealthReport{ReportSection: ReportSection{Availability: availability, Error: classifyStorageHealthError(errno)}, Protocol: protocol, Source: "nvme_smart_log"}, hwmonTemperature
+	if err := nvmeGetLogPage(file.Fd(), 0x02, buffer); err != nil {
+		availability := storageHealthAvailability(err)
+		return DiskHealthReport{ReportSection: ReportSection{Availability: availability, Error: classifyStorageHealthError(err)}, Protocol: protocol, Source: "nvme_smart_log"}, hwmonTemperature
 	}
 	health, temperature := parseNVMeSMARTLog(buffer)
+	if health.Availability == AvailabilityAvailable {
+		health.NVMe = collectNVMeIdentify(file.Fd(), health.NVMe)
+	}
 	if temperature.Availability != AvailabilityAvailable && hwmonTemperature.Availability == AvailabilityAvailable {
 		temperature = hwmonTemperature
 	}
 	return health, temperature
 }
 
-func collectATASMART(name string, fallbackTemperature DiskTemperatureReport) (DiskHealthReport, DiskTemperatureReport) {
+// collectNVMeIdentify adds the Identify data, firmware slots and error log
+// to the report built from the SMART log. Each command is optional; a
+// controller rejecting one keeps the fields read so far.
+func collectNVMeIdentify(fd uintptr, report *NVMeReport) *NVMeReport {
+	if report == nil {
+		report = &NVMeReport{}
+	}
+	controller := make([]byte, nvmeIdentifySize)
+	if err := nvmeIdentify(fd, 0x01, 0, controller); err != nil {
+		return report
+	}
+	identified, err := parseNVMeIdentifyController(controller)
+	if err != nil {
+		return report
+	}
+	identified.TemperatureSensors = report.TemperatureSensors
+	report = &identified
+	slots := make([]byte, nvmeFirmwareSlotLogSize)
+	if err := nvmeGetLogPage(fd, nvmeFirmwareSlotLogPage, slots); err == nil {
+		report.FirmwareSlots, _ = parseNVMeFirmwareSlotLog(slots, nvmeFirmwareSlotCount(controller))
+	}
+	active := make([]byte, nvmeIdentifySize)
+	if err := nvmeIdentify(fd, 0x02, 0, active); err == nil {
+		for _, id := range parseNVMeActiveNamespaces(active) {
+			data := make([]byte, nvmeIdentifySize)
+			if err := nvmeIdentify(fd, 0x00, id, data); err != nil {
+				continue
+			}
+			if namespace, err := parseNVMeIdentifyNamespace(id, data); err == nil {
+				report.Namespaces = append(report.Namespaces, namespace)
+			}
+		}
+	}
+	entries := int(report.ErrorLogEntries)
+	if entries > nvmeMaxErrorEntries {
+		entries = nvmeMaxErrorEntries
+	}
+	if entries > 0 {
+		errorLog := make([]byte, entries*nvmeErrorLogEntrySize)
+		if err := nvmeGetLogPage(fd, nvmeErrorLogPage, errorLog); err == nil {
+			report.Errors = parseNVMeErrorLog(errorLog)
+		}
+	}
+	return report
+}
+
+// nvmeGetLogPage reads len(buffer) bytes of a controller-wide log page.
+func nvmeGetLogPage(fd uintptr, page byte, buffer []byte) error {
+	return nvmeAdmin(fd, 0x02, ^uint32(0), uint32(page)|((uint32(len(buffer))/4)-1)<<16, buffer)
+}
+
+// nvmeIdentify issues Identify with the given CNS value.
+func nvmeIdentify(fd uintptr, cns byte, namespace uint32, buffer []byte) error {
+	return nvmeAdmin(fd, 0x06, namespace, uint32(cns), buffer)
+}
+
+// nvmeAdmin runs an admin command reading into buffer; an empty buffer runs
+// it without a data transfer.
+func nvmeAdmin(fd uintptr, opcode uint8, namespace, command10 uint32, buffer []byte) error {
+	command := nvmeAdminCommand{Opcode: opcode, NamespaceID: namespace, Command10: command10, TimeoutMS: 2000}
+	if len(buffer) > 0 {
+		command.Address, command.DataLen = uint64(uintptr(unsafe.Pointer(&buffer[0]))), uint32(len(buffer))
+	}
+	status, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, nvmeAdminIOCTL, uintptr(unsafe.Pointer(&command)))
+	runtime.KeepAlive(buffer)
+	if errno != 0 {
+		return errno
+	}
+	// A positive return value is the NVMe completion status.
+	if status != 0 {
+		return errNVMeCommandRejected
+	}
+	return nil
+}
+
+func collectATASMART(name, model string, fallbackTemperature DiskTemperatureReport) (DiskHealthReport, DiskTemperatureReport) {
 	if !diskDeviceNamePattern.MatchString(name) {
 		return DiskHealthReport{ReportSection: ReportSection{Availability: AvailabilityError, Error: "invalid ATA device name"}, Protocol: "ata", Source: "ata_smart_attributes"}, fallbackTemperature
 	}
@@ -125,52 +220,139 @@ func collectATASMART(name string, fallbackTemperature DiskTemperatureReport) (Di
 		return DiskHealthReport{ReportSection: ReportSection{Availability: availability, Error: classifyStorageHealthError(err)}, Protocol: "ata", Source: "ata_smart_attributes"}, fallbackTemperature
 	}
 	defer file.Close()
-	attributes, err := readATASMARTPage(file.Fd(), 0xd0)
+	attributes, err := readATASMARTPage(file.Fd(), 0xd0, 0)
 	if err != nil {
 		availability := storageHealthAvailability(err)
 		return DiskHealthReport{ReportSection: ReportSection{Availability: availability, Error: classifyStorageHealthError(err)}, Protocol: "ata", Source: "ata_smart_attributes"}, fallbackTemperature
 	}
-	thresholds, _ := readATASMARTPage(file.Fd(), 0xd1)
-	health, temperature := parseATASMARTData(attributes, thresholds)
+	thresholds, _ := readATASMARTPage(file.Fd(), 0xd1, 0)
+	health, temperature := parseATASMARTDataForModel(attributes, thresholds, model)
+	if health.ATA != nil {
+		// The logs are optional; drives without SMART logging reject them.
+		if page, err := readATASMARTPage(file.Fd(), 0xd5, ataSMARTSelfTestLog); err == nil {
+			health.ATA.SelfTests, _ = parseATASelfTestLog(page)
+		}
+		if page, err := readATASMARTPage(file.Fd(), 0xd5, ataSMARTErrorLog); err == nil {
+			if count, logged, err := parseATAErrorLog(page); err == nil {
+				health.ATA.ErrorCount, health.ATA.Errors = uint64Ptr(count), logged
+			}
+		}
+	}
+	if temperature.Availability != AvailabilityAvailable && fallbackTemperature.Availability == AvailabilityAvailable {
+		temperature = fallbackTemperature
+	}
+	return health, temperature
+}
+
+func collectSCSILogSense(name string, fallbackTemperature DiskTemperatureReport) (DiskHealthReport, DiskTemperatureReport) {
+	if !diskDeviceNamePattern.MatchString(name) {
+		return DiskHealthReport{ReportSection: ReportSection{Availability: AvailabilityError, Error: "invalid SCSI device name"}, Protocol: "scsi", Source: "scsi_log_sense"}, fallbackTemperature
+	}
+	file, err := os.Open("/dev/" + name)
+	if err != nil {
+		availability := storageHealthAvailability(err)
+		return DiskHealthReport{ReportSection: ReportSection{Availability: availability, Error: classifyStorageHealthError(err)}, Protocol: "scsi", Source: "scsi_log_sense"}, fallbackTemperature
+	}
+	defer file.Close()
+	supportedPage, err := readSCSILogPage(file.Fd(), scsiLogSupportedPages)
+	if err != nil {
+		availability := storageHealthAvailability(err)
+		return DiskHealthReport{ReportSection: ReportSection{Availability: availability, Error: classifyStorageHealthError(err)}, Protocol: "scsi", Source: "scsi_log_sense"}, fallbackTemperature
+	}
+	supported, err := parseSCSISupportedLogPages(supportedPage)
+	if err != nil {
+		return DiskHealthReport{ReportSection: ReportSection{Availability: AvailabilityError, Error: err.Error()}, Protocol: "scsi", Source: "scsi_log_sense"}, fallbackTemperature
+	}
+	pages := make(map[byte][]byte)
+	for _, page := range scsiHealthLogPages {
+		if !supported[page] {
+			continue
+		}
+		if data, err := readSCSILogPage(file.Fd(), page); err == nil {
+			pages[page] = data
+		}
+	}
+	health, temperature := parseSCSILogPages(pages)
 	if temperature.Availability != AvailabilityAvailable && fallbackTemperature.Availability == AvailabilityAvailable {
 		temperature = fallbackTemperature
 	}
 	return health, temperature
 }
 
-func readATASMARTPage(fd uintptr, feature byte) ([]byte, error) {
+// readATASMARTPage issues SMART feature with the log address in LBA low,
+// which SMART READ LOG (0xd5) uses and the other features ignore.
+func readATASMARTPage(fd uintptr, feature, logAddress byte) ([]byte, error) {
 	data := make([]byte, ataSMARTPageSize)
 	command := make([]byte, 16)
-	sense := make([]byte, 32)
 	command[0] = 0x85   // ATA PASS-THROUGH (16)
 	command[1] = 4 << 1 // PIO data-in
 	command[2] = 0x0e   // data-in, block transfer, sector-count length
 	command[4] = feature
 	command[6] = 1
+	command[8] = logAddress
 	command[10] = 0x4f
 	command[12] = 0xc2
 	command[14] = 0xb0 // SMART
+	residual, err := sgIORead(fd, command, data)
+	if errors.Is(err, errSGIOCommandRejected) {
+		return nil, errATAPassthroughUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	if residual != 0 {
+		return nil, fmt.Errorf("short ATA SMART response: %d bytes missing", residual)
+	}
+	return data, nil
+}
+
+// readSCSILogPage issues LOG SENSE (10) for the cumulative values of page.
+// Pages are variable length, so a residual is expected and trimmed.
+func readSCSILogPage(fd uintptr, page byte) ([]byte, error) {
+	data := make([]byte, scsiLogSenseAllocation)
+	command := make([]byte, 10)
+	command[0] = 0x4d // LOG SENSE (10)
+	command[2] = 1<<6 | page
+	binary.BigEndian.PutUint16(command[7:9], uint16(len(data)))
+	residual, err := sgIORead(fd, command, data)
+	if errors.Is(err, errSGIOCommandRejected) {
+		return nil, errSCSILogSenseUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	if residual < 0 || int(residual) > len(data) {
+		residual = 0
+	}
+	return data[:len(data)-int(residual)], nil
+}
+
+// sgIORead runs a data-in SCSI command and returns the residual byte count.
+// An empty data buffer runs the command without a data transfer. Commands
+// that complete with a non-good status return errSGIOCommandRejected.
+func sgIORead(fd uintptr, command, data []byte) (int32, error) {
+	sense := make([]byte, 32)
 	header := sgIOHeader{
-		InterfaceID: int32('S'), TransferDirection: sgTransferFromDevice,
+		InterfaceID: int32('S'), TransferDirection: sgTransferNone,
 		CommandLength: uint8(len(command)), MaxSenseLength: uint8(len(sense)),
-		TransferLength: uint32(len(data)), TransferPointer: uintptr(unsafe.Pointer(&data[0])),
 		CommandPointer: uintptr(unsafe.Pointer(&command[0])), SensePointer: uintptr(unsafe.Pointer(&sense[0])),
 		TimeoutMS: 2000,
 	}
+	if len(data) > 0 {
+		header.TransferDirection = sgTransferFromDevice
+		header.TransferLength, header.TransferPointer = uint32(len(data)), uintptr(unsafe.Pointer(&data[0]))
+	}
 	_, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, sgIO, uintptr(unsafe.Pointer(&header)))
 	runtime.KeepAlive(data)
 	runtime.KeepAlive(command)
 	runtime.KeepAlive(sense)
 	if errno != 0 {
-		return nil, errno
+		return 0, errno
 	}
 	if header.HostStatus != 0 || header.Status != 0 || header.DriverStatus != 0 || header.Info&1 != 0 {
-		return nil, errATAPassthroughUnsupported
+		return 0, errSGIOCommandRejected
 	}
-	if header.Residual != 0 {
-		return nil, fmt.Errorf("short ATA SMART response: %d bytes missing", header.Residual)
-	}
-	return data, nil
+	return header.Residual, nil
 }
 
 func storageHealthAvailability(err error) Availability {
@@ -180,7 +362,7 @@ func storageHealthAvailability(err error) Availability {
 	if errors.Is(err, os.ErrNotExist) {
 		return AvailabilityUnavailable
 	}
-	if errors.Is(err, errATAPassthroughUnsupported) || errors.Is(err, syscall.ENOTTY) || errors.Is(err, syscall.EOPNOTSUPP) {
+	if errors.Is(err, errATAPassthroughUnsupported) || errors.Is(err, errSCSILogSenseUnsupported) || errors.Is(err, syscall.ENOTTY) || errors.Is(err, syscall.EOPNOTSUPP) {
 		return AvailabilityUnsupported
 	}
 	return AvailabilityError
@@ -194,6 +376,8 @@ func classifyStorageHealthError(err error) string {
 		return "controller device unavailable"
 	case errors.Is(err, errATAPassthroughUnsupported), errors.Is(err, syscall.ENOTTY), errors.Is(err, syscall.EOPNOTSUPP):
 		return "passive SMART passthrough unsupported"
+	case errors.Is(err, errSCSILogSenseUnsupported):
+		return "SCSI LOG SENSE unsupported"
 	default:
 		return "passive health read failed"
 	}
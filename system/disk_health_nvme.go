@@ -32,6 +32,9 @@ func parseNVMeSMARTLog(data []byte) (DiskHealthReport, DiskTemperatureReport) {
 		UnsafeShutdownsDecimal: unsafe, MediaErrorsDecimal: media,
 		CountersSaturated: readSaturated || writtenSaturated || cyclesSaturated || hoursSaturated || unsafeSaturated || mediaSaturated,
 	}
+	if sensors := parseNVMeTemperatureSensors(data); len(sensors) > 0 {
+		health.NVMe = &NVMeReport{TemperatureSensors: sensors}
+	}
 	if critical == 0 {
 		health.Status = "passed"
 	} else {
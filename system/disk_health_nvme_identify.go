@@ -0,0 +1,281 @@
+package system
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// NVMe admin data sizes and log pages read besides the SMART log.
+const (
+	nvmeIdentifySize        = 4096
+	nvmeFirmwareSlotLogSize = 512
+	nvmeErrorLogEntrySize   = 64
+	nvmeErrorLogPage        = 0x01
+	nvmeFirmwareSlotLogPage = 0x03
+	// nvmeMaxNamespaces and nvmeMaxErrorEntries bound the admin commands
+	// issued per controller.
+	nvmeMaxNamespaces   = 16
+	nvmeMaxErrorEntries = 16
+)
+
+// NVMeReport holds the Identify data and logs of an NVMe controller. The
+// serial number is never reported; SerialRedacted records that one exists.
+type NVMeReport struct {
+	Model                      string                  `json:"model,omitempty"`
+	SerialRedacted             bool                    `json:"serial_redacted"`
+	Firmware                   string                  `json:"firmware,omitempty"`
+	FirmwareSlots              []NVMeFirmwareSlot      `json:"firmware_slots,omitempty"`
+	FirmwareSlot1ReadOnly      bool                    `json:"firmware_slot1_read_only,omitempty"`
+	NamespaceCount             uint32                  `json:"namespace_count,omitempty"`
+	TotalCapacityBytes         string                  `json:"total_capacity_bytes,omitempty"`
+	Namespaces                 []NVMeNamespaceReport   `json:"namespaces,omitempty"`
+	PowerStates                []NVMePowerState        `json:"power_states,omitempty"`
+	WarningTemperatureCelsius  *float64                `json:"warning_temperature_celsius,omitempty"`
+	CriticalTemperatureCelsius *float64                `json:"critical_temperature_celsius,omitempty"`
+	TemperatureSensors         []NVMeTemperatureSensor `json:"temperature_sensors,omitempty"`
+	ErrorLogEntries            uint16                  `json:"error_log_entries,omitempty"`
+	Errors                     []NVMeErrorReport       `json:"errors,omitempty"`
+}
+
+type NVMeFirmwareSlot struct {
+	Slot     uint8  `json:"slot"`
+	Revision string `json:"revision,omitempty"`
+	Active   bool   `json:"active"`
+}
+
+type NVMeNamespaceReport struct {
+	ID               uint32          `json:"id"`
+	SizeBytes        *uint64         `json:"size_bytes,omitempty"`
+	CapacityBytes    *uint64         `json:"capacity_bytes,omitempty"`
+	UtilizationBytes *uint64         `json:"utilization_bytes,omitempty"`
+	LBAFormats       []NVMeLBAFormat `json:"lba_formats,omitempty"`
+}
+
+type NVMeLBAFormat struct {
+	Index               uint8  `json:"index"`
+	DataBytes           uint64 `json:"data_bytes"`
+	MetadataBytes       uint16 `json:"metadata_bytes"`
+	RelativePerformance string `json:"relative_performance"`
+	InUse               bool   `json:"in_use"`
+}
+
+// NVMePowerState is one power state descriptor. Latencies are in
+// microseconds and zero when the controller does not report them.
+type NVMePowerState struct {
+	State          uint8   `json:"state"`
+	MaxPowerWatts  float64 `json:"max_power_watts"`
+	NonOperational bool    `json:"non_operational"`
+	EntryLatencyUS uint32  `json:"entry_latency_us,omitempty"`
+	ExitLatencyUS  uint32  `json:"exit_latency_us,omitempty"`
+}
+
+type NVMeTemperatureSensor struct {
+	Sensor  uint8   `json:"sensor"`
+	Celsius float64 `json:"celsius"`
+}
+
+// NVMeErrorReport is one Error Information log entry, most recent first.
+type NVMeErrorReport struct {
+	ErrorCount             uint64 `json:"error_count"`
+	SubmissionQueueID      uint16 `json:"submission_queue_id"`
+	CommandID              uint16 `json:"command_id"`
+	StatusCodeType         uint8  `json:"status_code_type"`
+	StatusCode             uint8  `json:"status_code"`
+	DoNotRetry             bool   `json:"do_not_retry"`
+	ParameterErrorLocation uint16 `json:"parameter_error_location"`
+	LBA                    uint64 `json:"lba"`
+	NamespaceID            uint32 `json:"namespace_id"`
+}
+
+var nvmeRelativePerformance = []string{"best", "better", "good", "degraded"}
+
+// parseNVMeIdentifyController decodes Identify Controller (CNS 01h).
+func parseNVMeIdentifyController(data []byte) (NVMeReport, error) {
+	if len(data) < nvmeIdentifySize {
+		return NVMeReport{}, fmt.Errorf("NVMe Identify Controller data is %d bytes; require %d", len(data), nvmeIdentifySize)
+	}
+	report := NVMeReport{
+		Model:                 nvmeIdentifyString(data[24:64]),
+		SerialRedacted:        nvmeIdentifyString(data[4:24]) != "",
+		Firmware:              nvmeIdentifyString(data[64:72]),
+		FirmwareSlot1ReadOnly: data[260]&0x01 != 0,
+		ErrorLogEntries:       uint16(data[262]) + 1,
+		NamespaceCount:        binary.LittleEndian.Uint32(data[516:520]),
+	}
+	report.WarningTemperatureCelsius = nvmeKelvinToCelsius(binary.LittleEndian.Uint16(data[266:268]))
+	report.CriticalTemperatureCelsius = nvmeKelvinToCelsius(binary.LittleEndian.Uint16(data[268:270]))
+	if capacity, _, _ := parseNVMeCounter(data[280:296]); capacity != "0" {
+		report.TotalCapacityBytes = capacity
+	}
+	// NPSS is zero based; the descriptors start at byte 2048.
+	for state := 0; state <= int(data[263]) && state < 32; state++ {
+		descriptor := data[2048+state*32 : 2048+(state+1)*32]
+		power := float64(binary.LittleEndian.Uint16(descriptor[0:2]))
+		if descriptor[3]&0x01 != 0 {
+			power *= 0.0001
+		} else {
+			power *= 0.01
+		}
+		report.PowerStates = append(report.PowerStates, NVMePowerState{
+			State: uint8(state), MaxPowerWatts: power, NonOperational: descriptor[3]&0x02 != 0,
+			EntryLatencyUS: binary.LittleEndian.Uint32(descriptor[4:8]),
+			ExitLatencyUS:  binary.LittleEndian.Uint32(descriptor[8:12]),
+		})
+	}
+	return report, nil
+}
+
+// nvmeFirmwareSlotCount returns the number of firmware slots advertised in
+// Identify Controller.
+func nvmeFirmwareSlotCount(data []byte) int {
+	if len(data) < nvmeIdentifySize {
+		return 0
+	}
+	return int(data[260]>>1) & 0x07
+}
+
+// parseNVMeFirmwareSlotLog decodes the Firmware Slot Information log for the
+// first slots slots. Empty slots are skipped unless they are active.
+func parseNVMeFirmwareSlotLog(data []byte, slots int) ([]NVMeFirmwareSlot, error) {
+	if len(data) < nvmeFirmwareSlotLogSize {
+		return nil, fmt.Errorf("NVMe firmware slot log is %d bytes; require %d", len(data), nvmeFirmwareSlotLogSize)
+	}
+	if slots <= 0 || slots > 7 {
+		slots = 7
+	}
+	active := data[0] & 0x07
+	var result []NVMeFirmwareSlot
+	for slot := 1; slot <= slots; slot++ {
+		revision := nvmeIdentifyString(data[slot*8 : (slot+1)*8])
+		if revision == "" && uint8(slot) != active {
+			continue
+		}
+		result = append(result, NVMeFirmwareSlot{Slot: uint8(slot), Revision: revision, Active: uint8(slot) == active})
+	}
+	return result, nil
+}
+
+// parseNVMeActiveNamespaces decodes the Active Namespace ID list (CNS 02h).
+// The list is zero terminated.
+func parseNVMeActiveNamespaces(data []byte) []uint32 {
+	var namespaces []uint32
+	for offset := 0; offset+4 <= len(data) && len(namespaces) < nvmeMaxNamespaces; offset += 4 {
+		id := binary.LittleEndian.Uint32(data[offset : offset+4])
+		if id == 0 {
+			break
+		}
+		namespaces = append(namespaces, id)
+	}
+	return namespaces
+}
+
+// parseNVMeIdentifyNamespace decodes Identify Namespace (CNS 00h). Sizes are
+// converted from logical blocks of the format in use to bytes.
+func parseNVMeIdentifyNamespace(id uint32, data []byte) (NVMeNamespaceReport, error) {
+	if len(data) < nvmeIdentifySize {
+		return NVMeNamespaceReport{}, fmt.Errorf("NVMe Identify Namespace data is %d bytes; require %d", len(data), nvmeIdentifySize)
+	}
+	namespace := NVMeNamespaceReport{ID: id}
+	formats := int(data[25]) + 1
+	if formats > 64 {
+		formats = 64
+	}
+	inUse := data[26] & 0x0f
+	if formats > 16 {
+		inUse |= (data[26] >> 5 & 0x03) << 4
+	}
+	var blockBytes uint64
+	for index := 0; index < formats; index++ {
+		descriptor := data[128+index*4 : 128+(index+1)*4]
+		lbads := descriptor[2]
+		if lbads < 9 || lbads > 63 {
+			continue
+		}
+		format := NVMeLBAFormat{
+			Index: uint8(index), DataBytes: 1 << lbads,
+			MetadataBytes:       binary.LittleEndian.Uint16(descriptor[0:2]),
+			RelativePerformance: nvmeRelativePerformance[descriptor[3]&0x03],
+			InUse:               uint8(index) == inUse,
+		}
+		if format.InUse {
+			blockBytes = format.DataBytes
+		}
+		namespace.LBAFormats = append(namespace.LBAFormats, format)
+	}
+	if blockBytes != 0 {
+		for _, field := range []struct {
+			target **uint64
+			blocks uint64
+		}{
+			{&namespace.SizeBytes, binary.LittleEndian.Uint64(data[0:8])},
+			{&namespace.CapacityBytes, binary.LittleEndian.Uint64(data[8:16])},
+			{&namespace.UtilizationBytes, binary.LittleEndian.Uint64(data[16:24])},
+		} {
+			bytes := field.blocks * blockBytes
+			if field.blocks != 0 && bytes/field.blocks != blockBytes {
+				bytes = ^uint64(0)
+			}
+			*field.target = uint64Ptr(bytes)
+		}
+	}
+	return namespace, nil
+}
+
+// parseNVMeErrorLog decodes Error Information log entries. Entries with a
+// zero error count are unused.
+func parseNVMeErrorLog(data []byte) []NVMeErrorReport {
+	var entries []NVMeErrorReport
+	for offset := 0; offset+nvmeErrorLogEntrySize <= len(data); offset += nvmeErrorLogEntrySize {
+		entry := data[offset : offset+nvmeErrorLogEntrySize]
+		count := binary.LittleEndian.Uint64(entry[0:8])
+		if count == 0 {
+			continue
+		}
+		// Bit 0 of the status field is the phase tag.
+		status := binary.LittleEndian.Uint16(entry[12:14]) >> 1
+		entries = append(entries, NVMeErrorReport{
+			ErrorCount:             count,
+			SubmissionQueueID:      binary.LittleEndian.Uint16(entry[8:10]),
+			CommandID:              binary.LittleEndian.Uint16(entry[10:12]),
+			StatusCode:             uint8(status),
+			StatusCodeType:         uint8(status>>8) & 0x07,
+			DoNotRetry:             status&0x4000 != 0,
+			ParameterErrorLocation: binary.LittleEndian.Uint16(entry[14:16]),
+			LBA:                    binary.LittleEndian.Uint64(entry[16:24]),
+			NamespaceID:            binary.LittleEndian.Uint32(entry[24:28]),
+		})
+	}
+	return entries
+}
+
+// parseNVMeTemperatureSensors reads temperature sensors 1-8 from the SMART
+// log. Unimplemented sensors report zero.
+func parseNVMeTemperatureSensors(data []byte) []NVMeTemperatureSensor {
+	if len(data) < nvmeSMARTLogSize {
+		return nil
+	}
+	var sensors []NVMeTemperatureSensor
+	for sensor := 0; sensor < 8; sensor++ {
+		offset := 200 + sensor*2
+		if celsius := nvmeKelvinToCelsius(binary.LittleEndian.Uint16(data[offset : offset+2])); celsius != nil {
+			sensors = append(sensors, NVMeTemperatureSensor{Sensor: uint8(sensor + 1), Celsius: *celsius})
+		}
+	}
+	return sensors
+}
+
+func nvmeKelvinToCelsius(kelvin uint16) *float64 {
+	if kelvin == 0 || kelvin == 0xffff {
+		return nil
+	}
+	celsius := float64(kelvin) - 273.15
+	if celsius < -50 || celsius > 250 {
+		return nil
+	}
+	return &celsius
+}
+
+func nvmeIdentifyString(data []byte) string {
+	return strings.TrimSpace(strings.TrimRight(string(data), "\x00"))
+}
@@ -0,0 +1,154 @@
+package system
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseNVMeIdentifyController(t *testing.T) {
+	data := make([]byte, nvmeIdentifySize)
+	copy(data[4:24], "S4EWNX0R123456      ")
+	copy(data[24:64], "Samsung SSD 980 PRO 1TB                 ")
+	copy(data[64:72], "5B2QGXA7")
+	data[260] = 3<<1 | 0x01
+	data[262] = 63
+	data[263] = 2
+	binary.LittleEndian.PutUint16(data[266:268], 355)
+	binary.LittleEndian.PutUint16(data[268:270], 358)
+	binary.LittleEndian.PutUint64(data[280:288], 1000204886016)
+	binary.LittleEndian.PutUint32(data[516:520], 1)
+	putNVMePowerState(data, 0, 830, 0, 0, 0)
+	putNVMePowerState(data, 1, 63000, 0x01, 0, 200)
+	putNVMePowerState(data, 2, 5, 0x02, 1000, 9000)
+
+	report, err := parseNVMeIdentifyController(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Model != "Samsung SSD 980 PRO 1TB" || report.Firmware != "5B2QGXA7" || !report.SerialRedacted || !report.FirmwareSlot1ReadOnly {
+		t.Fatalf("unexpected identity: %+v", report)
+	}
+	if report.NamespaceCount != 1 || report.ErrorLogEntries != 64 || report.TotalCapacityBytes != "1000204886016" || nvmeFirmwareSlotCount(data) != 3 {
+		t.Fatalf("unexpected controller fields: %+v", report)
+	}
+	if report.WarningTemperatureCelsius == nil || *report.WarningTemperatureCelsius < 81.8 || *report.WarningTemperatureCelsius > 81.9 || report.CriticalTemperatureCelsius == nil || *report.CriticalTemperatureCelsius < 84.8 || *report.CriticalTemperatureCelsius > 84.9 {
+		t.Fatalf("unexpected temperature thresholds: %+v", report)
+	}
+	if len(report.PowerStates) != 3 || report.PowerStates[0].MaxPowerWatts < 8.29 || report.PowerStates[0].MaxPowerWatts > 8.31 || report.PowerStates[1].MaxPowerWatts < 6.29 || report.PowerStates[1].MaxPowerWatts > 6.31 {
+		t.Fatalf("unexpected power states: %+v", report.PowerStates)
+	}
+	if state := report.PowerStates[2]; !state.NonOperational || state.EntryLatencyUS != 1000 || state.ExitLatencyUS != 9000 {
+		t.Fatalf("unexpected non-operational state: %+v", state)
+	}
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(encoded), "S4EWNX0R123456") {
+		t.Fatalf("serial number leaked: %s", encoded)
+	}
+	if _, err := parseNVMeIdentifyController(make([]byte, 512)); err == nil {
+		t.Fatal("short Identify Controller data accepted")
+	}
+}
+
+func TestParseNVMeFirmwareSlotLog(t *testing.T) {
+	data := make([]byte, nvmeFirmwareSlotLogSize)
+	data[0] = 2
+	copy(data[8:16], "1B2QGXA7")
+	copy(data[16:24], "5B2QGXA7")
+	slots, err := parseNVMeFirmwareSlotLog(data, 3)
+	if err != nil || len(slots) != 2 {
+		t.Fatalf("parseNVMeFirmwareSlotLog() = %+v, %v", slots, err)
+	}
+	if slots[0] != (NVMeFirmwareSlot{Slot: 1, Revision: "1B2QGXA7"}) || slots[1] != (NVMeFirmwareSlot{Slot: 2, Revision: "5B2QGXA7", Active: true}) {
+		t.Fatalf("unexpected firmware slots: %+v", slots)
+	}
+}
+
+func TestParseNVMeIdentifyNamespace(t *testing.T) {
+	data := make([]byte, nvmeIdentifySize)
+	binary.LittleEndian.PutUint64(data[0:8], 1953525168)
+	binary.LittleEndian.PutUint64(data[8:16], 1953525168)
+	binary.LittleEndian.PutUint64(data[16:24], 1000)
+	data[25] = 2
+	data[26] = 1
+	data[128+2], data[128+3] = 9, 2
+	data[132+2], data[132+3] = 12, 0
+	binary.LittleEndian.PutUint16(data[136:138], 8)
+	data[136+2], data[136+3] = 12, 1
+
+	namespace, err := parseNVMeIdentifyNamespace(1, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if namespace.ID != 1 || namespace.SizeBytes == nil || *namespace.SizeBytes != 1953525168*4096 || namespace.UtilizationBytes == nil || *namespace.UtilizationBytes != 4096000 {
+		t.Fatalf("unexpected namespace sizes: %+v", namespace)
+	}
+	if len(namespace.LBAFormats) != 3 {
+		t.Fatalf("unexpected LBA formats: %+v", namespace.LBAFormats)
+	}
+	if format := namespace.LBAFormats[0]; format.DataBytes != 512 || format.RelativePerformance != "good" || format.InUse {
+		t.Fatalf("unexpected first LBA format: %+v", format)
+	}
+	if format := namespace.LBAFormats[1]; format.DataBytes != 4096 || format.RelativePerformance != "best" || !format.InUse {
+		t.Fatalf("unexpected in-use LBA format: %+v", format)
+	}
+	if format := namespace.LBAFormats[2]; format.MetadataBytes != 8 || format.RelativePerformance != "better" {
+		t.Fatalf("unexpected metadata LBA format: %+v", format)
+	}
+
+	list := make([]byte, nvmeIdentifySize)
+	binary.LittleEndian.PutUint32(list[0:4], 1)
+	binary.LittleEndian.PutUint32(list[4:8], 3)
+	if ids := parseNVMeActiveNamespaces(list); len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Fatalf("unexpected active namespaces: %v", ids)
+	}
+}
+
+func TestParseNVMeErrorLog(t *testing.T) {
+	data := make([]byte, 3*nvmeErrorLogEntrySize)
+	entry := data[:nvmeErrorLogEntrySize]
+	binary.LittleEndian.PutUint64(entry[0:8], 42)
+	binary.LittleEndian.PutUint16(entry[8:10], 3)
+	binary.LittleEndian.PutUint16(entry[10:12], 0x1234)
+	// DNR, status code type 2 (media error), status code 0x81, phase tag set.
+	binary.LittleEndian.PutUint16(entry[12:14], (0x4000|0x2<<8|0x81)<<1|1)
+	binary.LittleEndian.PutUint16(entry[14:16], 0x28)
+	binary.LittleEndian.PutUint64(entry[16:24], 0xdeadbeef)
+	binary.LittleEndian.PutUint32(entry[24:28], 1)
+	binary.LittleEndian.PutUint64(data[2*nvmeErrorLogEntrySize:2*nvmeErrorLogEntrySize+8], 41)
+
+	entries := parseNVMeErrorLog(data)
+	if len(entries) != 2 {
+		t.Fatalf("unexpected error entries: %+v", entries)
+	}
+	want := NVMeErrorReport{ErrorCount: 42, SubmissionQueueID: 3, CommandID: 0x1234, StatusCodeType: 2, StatusCode: 0x81, DoNotRetry: true, ParameterErrorLocation: 0x28, LBA: 0xdeadbeef, NamespaceID: 1}
+	if entries[0] != want || entries[1].ErrorCount != 41 {
+		t.Fatalf("unexpected error entries: %+v", entries)
+	}
+}
+
+func TestParseNVMeSMARTLogTemperatureSensors(t *testing.T) {
+	data := make([]byte, nvmeSMARTLogSize)
+	binary.LittleEndian.PutUint16(data[1:3], 313)
+	binary.LittleEndian.PutUint16(data[200:202], 318)
+	binary.LittleEndian.PutUint16(data[204:206], 303)
+	health, _ := parseNVMeSMARTLog(data)
+	if health.NVMe == nil || len(health.NVMe.TemperatureSensors) != 2 {
+		t.Fatalf("unexpected sensors: %+v", health.NVMe)
+	}
+	if sensor := health.NVMe.TemperatureSensors[1]; sensor.Sensor != 3 || sensor.Celsius < 29.8 || sensor.Celsius > 29.9 {
+		t.Fatalf("unexpected third sensor: %+v", sensor)
+	}
+}
+
+func putNVMePowerState(data []byte, state int, power uint16, flags byte, entryLatency, exitLatency uint32) {
+	descriptor := data[2048+state*32 : 2048+(state+1)*32]
+	binary.LittleEndian.PutUint16(descriptor[0:2], power)
+	descriptor[3] = flags
+	binary.LittleEndian.PutUint32(descriptor[4:8], entryLatency)
+	binary.LittleEndian.PutUint32(descriptor[8:12], exitLatency)
+}
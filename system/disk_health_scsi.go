@@ -0,0 +1,229 @@
+package system
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// SCSI LOG SENSE pages read for passive health.
+const (
+	scsiLogSupportedPages        = 0x00
+	scsiLogReadErrorCounters     = 0x03
+	scsiLogVerifyErrorCounters   = 0x05
+	scsiLogTemperature           = 0x0d
+	scsiLogStartStopCycles       = 0x0e
+	scsiLogSolidStateMedia       = 0x11
+	scsiLogInformationalExcepts  = 0x2f
+	scsiLogPageHeaderSize        = 4
+	scsiLogParameterHeaderSize   = 4
+	scsiErrorCounterCorrected    = 0x0003
+	scsiErrorCounterUncorrected  = 0x0006
+	scsiStartStopAccumulated     = 0x0004
+	scsiLoadUnloadAccumulated    = 0x0006
+	scsiSolidStatePercentageUsed = 0x0001
+)
+
+// scsiHealthLogPages are the pages read after the supported pages list, in
+// the order they are requested.
+var scsiHealthLogPages = []byte{
+	scsiLogReadErrorCounters, scsiLogVerifyErrorCounters, scsiLogTemperature,
+	scsiLogStartStopCycles, scsiLogSolidStateMedia, scsiLogInformationalExcepts,
+}
+
+type scsiLogParameter struct {
+	code  uint16
+	value []byte
+}
+
+// parseSCSILogPage splits a LOG SENSE response into its parameters. A
+// truncated final parameter is dropped rather than rejected.
+func parseSCSILogPage(data []byte, page byte) ([]scsiLogParameter, error) {
+	if len(data) < scsiLogPageHeaderSize {
+		return nil, fmt.Errorf("SCSI log page 0x%02x is %d bytes; require %d", page, len(data), scsiLogPageHeaderSize)
+	}
+	if data[0]&0x3f != page {
+		return nil, fmt.Errorf("SCSI log page 0x%02x response has page code 0x%02x", page, data[0]&0x3f)
+	}
+	end := scsiLogPageHeaderSize + int(binary.BigEndian.Uint16(data[2:4]))
+	if end > len(data) {
+		end = len(data)
+	}
+	var parameters []scsiLogParameter
+	for offset := scsiLogPageHeaderSize; offset+scsiLogParameterHeaderSize <= end; {
+		length := int(data[offset+3])
+		next := offset + scsiLogParameterHeaderSize + length
+		if next > end {
+			break
+		}
+		parameters = append(parameters, scsiLogParameter{
+			code:  binary.BigEndian.Uint16(data[offset : offset+2]),
+			value: data[offset+scsiLogParameterHeaderSize : next],
+		})
+		offset = next
+	}
+	return parameters, nil
+}
+
+// parseSCSISupportedLogPages returns the page codes listed by page 0x00.
+func parseSCSISupportedLogPages(data []byte) (map[byte]bool, error) {
+	if len(data) < scsiLogPageHeaderSize || data[0]&0x3f != scsiLogSupportedPages {
+		return nil, fmt.Errorf("invalid SCSI supported log pages response")
+	}
+	end := scsiLogPageHeaderSize + int(binary.BigEndian.Uint16(data[2:4]))
+	if end > len(data) {
+		end = len(data)
+	}
+	pages := make(map[byte]bool)
+	for _, page := range data[scsiLogPageHeaderSize:end] {
+		pages[page&0x3f] = true
+	}
+	return pages, nil
+}
+
+// scsiLogCounter decodes a big-endian counter of any width, saturating when
+// it does not fit in 64 bits.
+func scsiLogCounter(value []byte) (uint64, bool) {
+	if len(value) == 0 {
+		return 0, false
+	}
+	for len(value) > 8 {
+		if value[0] != 0 {
+			return ^uint64(0), true
+		}
+		value = value[1:]
+	}
+	var counter uint64
+	for _, b := range value {
+		counter = counter<<8 | uint64(b)
+	}
+	return counter, true
+}
+
+func findSCSILogParameter(parameters []scsiLogParameter, code uint16) ([]byte, bool) {
+	for _, parameter := range parameters {
+		if parameter.code == code {
+			return parameter.value, true
+		}
+	}
+	return nil, false
+}
+
+// parseSCSILogPages builds the health report from raw LOG SENSE responses
+// keyed by page code. Missing pages are skipped. Uncorrected read and verify
+// errors are also summed into MediaErrors so the verdict and diff rules apply
+// to SCSI drives the same way as to NVMe.
+func parseSCSILogPages(pages map[byte][]byte) (DiskHealthReport, DiskTemperatureReport) {
+	health := DiskHealthReport{ReportSection: ReportSection{Availability: AvailabilityUnavailable, Error: "no SCSI health log pages available"}, Protocol: "scsi", Source: "scsi_log_sense"}
+	temperature := DiskTemperatureReport{ReportSection: ReportSection{Availability: AvailabilityUnavailable}, Source: "scsi_log_sense"}
+	codes := make([]int, 0, len(pages))
+	for code := range pages {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+	parsed := make(map[byte][]scsiLogParameter, len(pages))
+	var failures []string
+	for _, code := range codes {
+		parameters, err := parseSCSILogPage(pages[byte(code)], byte(code))
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		parsed[byte(code)] = parameters
+	}
+	if len(parsed) == 0 {
+		if len(failures) > 0 {
+			health.Availability, health.Error = AvailabilityError, failures[0]
+		}
+		return health, temperature
+	}
+	health.Availability, health.Error = AvailabilityAvailable, ""
+	health.Status = "log_pages_available"
+
+	var uncorrected *uint64
+	for _, counter := range []struct {
+		page                   byte
+		corrected, uncorrected **uint64
+	}{
+		{scsiLogReadErrorCounters, &health.ReadErrorsCorrected, &health.ReadErrorsUncorrected},
+		{scsiLogVerifyErrorCounters, &health.VerifyErrorsCorrected, &health.VerifyErrorsUncorrected},
+	} {
+		parameters, ok := parsed[counter.page]
+		if !ok {
+			continue
+		}
+		if value, ok := findSCSILogParameter(parameters, scsiErrorCounterCorrected); ok {
+			if count, ok := scsiLogCounter(value); ok {
+				*counter.corrected = uint64Ptr(count)
+			}
+		}
+		if value, ok := findSCSILogParameter(parameters, scsiErrorCounterUncorrected); ok {
+			if count, ok := scsiLogCounter(value); ok {
+				*counter.uncorrected = uint64Ptr(count)
+				total := count
+				if uncorrected != nil {
+					total += *uncorrected
+					if total < count {
+						total = ^uint64(0)
+					}
+				}
+				uncorrected = uint64Ptr(total)
+			}
+		}
+	}
+	health.MediaErrors = uncorrected
+
+	if parameters, ok := parsed[scsiLogStartStopCycles]; ok {
+		if value, ok := findSCSILogParameter(parameters, scsiStartStopAccumulated); ok {
+			if count, ok := scsiLogCounter(value); ok {
+				health.StartStopCycles = uint64Ptr(count)
+			}
+		}
+		if value, ok := findSCSILogParameter(parameters, scsiLoadUnloadAccumulated); ok {
+			if count, ok := scsiLogCounter(value); ok {
+				health.LoadUnloadCycles = uint64Ptr(count)
+			}
+		}
+	}
+	if parameters, ok := parsed[scsiLogSolidStateMedia]; ok {
+		// The endurance indicator is the last byte of a four byte value
+		// and may exceed 100 once the rated endurance is used up.
+		if value, ok := findSCSILogParameter(parameters, scsiSolidStatePercentageUsed); ok && len(value) >= 4 {
+			used := value[3]
+			health.PercentageUsed = &used
+		}
+	}
+	if parameters, ok := parsed[scsiLogTemperature]; ok {
+		if value, ok := findSCSILogParameter(parameters, 0x0000); ok && len(value) >= 2 {
+			setSCSITemperature(&temperature, value[1])
+		}
+	}
+	if parameters, ok := parsed[scsiLogInformationalExcepts]; ok {
+		if value, ok := findSCSILogParameter(parameters, 0x0000); ok && len(value) >= 2 {
+			asc, ascq := value[0], value[1]
+			health.InformationalExceptionASC, health.InformationalExceptionASCQ = &asc, &ascq
+			// ASC 0x5D reports that a failure prediction threshold was
+			// exceeded; ASC 0 means no exception is pending.
+			if asc == 0 {
+				health.Status = "passed"
+			} else {
+				health.Status = "failed"
+			}
+			if len(value) >= 3 && temperature.Availability != AvailabilityAvailable {
+				setSCSITemperature(&temperature, value[2])
+			}
+		}
+	}
+	return health, temperature
+}
+
+// setSCSITemperature records a temperature in degrees Celsius. 0xFF means
+// the drive has no valid reading.
+func setSCSITemperature(temperature *DiskTemperatureReport, value byte) {
+	if value == 0 || value == 0xff {
+		return
+	}
+	celsius := float64(value)
+	temperature.Availability = AvailabilityAvailable
+	temperature.Celsius = &celsius
+}
@@ -0,0 +1,116 @@
+package system
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseSCSILogPages(t *testing.T) {
+	pages := map[byte][]byte{
+		scsiLogReadErrorCounters: newSCSILogPageFixture(scsiLogReadErrorCounters,
+			scsiLogParameterFixture(0x0000, 0, 0, 0, 0, 0, 0, 0, 9),
+			scsiLogParameterFixture(0x0003, 0, 0, 0, 0, 0, 0, 0x01, 0x2c),
+			scsiLogParameterFixture(0x0006, 0, 0, 0, 2)),
+		scsiLogVerifyErrorCounters: newSCSILogPageFixture(scsiLogVerifyErrorCounters,
+			scsiLogParameterFixture(0x0003, 0, 0, 0, 0, 0, 0, 0, 5),
+			scsiLogParameterFixture(0x0006, 0, 0, 0, 0, 0, 0, 0, 1)),
+		scsiLogTemperature: newSCSILogPageFixture(scsiLogTemperature,
+			scsiLogParameterFixture(0x0000, 0, 38),
+			scsiLogParameterFixture(0x0001, 0, 60)),
+		scsiLogStartStopCycles: newSCSILogPageFixture(scsiLogStartStopCycles,
+			scsiLogParameterFixture(0x0001, '2', '0', '1', '9', '0', '4'),
+			scsiLogParameterFixture(0x0003, 0, 0, 0xc3, 0x50),
+			scsiLogParameterFixture(0x0004, 0, 0, 0, 42),
+			scsiLogParameterFixture(0x0006, 0, 0, 0x01, 0x00)),
+		scsiLogSolidStateMedia: newSCSILogPageFixture(scsiLogSolidStateMedia,
+			scsiLogParameterFixture(0x0001, 0, 0, 0, 4)),
+		scsiLogInformationalExcepts: newSCSILogPageFixture(scsiLogInformationalExcepts,
+			scsiLogParameterFixture(0x0000, 0, 0, 37)),
+	}
+	health, temperature := parseSCSILogPages(pages)
+	if health.Availability != AvailabilityAvailable || health.Protocol != "scsi" || health.Source != "scsi_log_sense" || health.Status != "passed" {
+		t.Fatalf("unexpected SCSI health: %+v", health)
+	}
+	if health.ReadErrorsCorrected == nil || *health.ReadErrorsCorrected != 300 || health.ReadErrorsUncorrected == nil || *health.ReadErrorsUncorrected != 2 ||
+		health.VerifyErrorsCorrected == nil || *health.VerifyErrorsCorrected != 5 || health.VerifyErrorsUncorrected == nil || *health.VerifyErrorsUncorrected != 1 {
+		t.Fatalf("unexpected SCSI error counters: %+v", health)
+	}
+	if health.MediaErrors == nil || *health.MediaErrors != 3 {
+		t.Fatalf("uncorrected errors were not summed into media errors: %+v", health.MediaErrors)
+	}
+	if health.StartStopCycles == nil || *health.StartStopCycles != 42 || health.LoadUnloadCycles == nil || *health.LoadUnloadCycles != 256 {
+		t.Fatalf("unexpected start-stop counters: %+v", health)
+	}
+	if health.PercentageUsed == nil || *health.PercentageUsed != 4 || health.InformationalExceptionASC == nil || *health.InformationalExceptionASC != 0 {
+		t.Fatalf("unexpected endurance or exception data: %+v", health)
+	}
+	if temperature.Availability != AvailabilityAvailable || temperature.Celsius == nil || *temperature.Celsius != 38 {
+		t.Fatalf("unexpected SCSI temperature: %+v", temperature)
+	}
+}
+
+func TestParseSCSILogPagesFailurePrediction(t *testing.T) {
+	health, temperature := parseSCSILogPages(map[byte][]byte{
+		scsiLogTemperature:          newSCSILogPageFixture(scsiLogTemperature, scsiLogParameterFixture(0x0000, 0, 0xff)),
+		scsiLogInformationalExcepts: newSCSILogPageFixture(scsiLogInformationalExcepts, scsiLogParameterFixture(0x0000, 0x5d, 0x10, 51)),
+	})
+	if health.Status != "failed" || health.InformationalExceptionASC == nil || *health.InformationalExceptionASC != 0x5d || *health.InformationalExceptionASCQ != 0x10 {
+		t.Fatalf("failure prediction not reported: %+v", health)
+	}
+	if temperature.Celsius == nil || *temperature.Celsius != 51 {
+		t.Fatalf("informational exceptions temperature was not used as fallback: %+v", temperature)
+	}
+	if verdict := EvaluateDiskHealth(DiskReport{Health: health, Temperature: temperature}, DefaultDiskHealthThresholds()); verdict.Status != DiskVerdictFailing {
+		t.Fatalf("verdict = %+v", verdict)
+	}
+}
+
+func TestParseSCSILogPagesRejectsMalformedPages(t *testing.T) {
+	health, _ := parseSCSILogPages(nil)
+	if health.Availability != AvailabilityUnavailable {
+		t.Fatalf("health without pages = %+v", health)
+	}
+	wrongPage := newSCSILogPageFixture(scsiLogTemperature, scsiLogParameterFixture(0x0000, 0, 40))
+	health, _ = parseSCSILogPages(map[byte][]byte{scsiLogReadErrorCounters: wrongPage, scsiLogVerifyErrorCounters: {0x05}})
+	if health.Availability != AvailabilityError || health.Error == "" {
+		t.Fatalf("malformed pages accepted: %+v", health)
+	}
+	truncated := newSCSILogPageFixture(scsiLogReadErrorCounters, scsiLogParameterFixture(0x0003, 0, 0, 0, 7), scsiLogParameterFixture(0x0006, 0, 0, 0, 0, 0, 0, 0, 1))
+	health, _ = parseSCSILogPages(map[byte][]byte{scsiLogReadErrorCounters: truncated[:len(truncated)-3]})
+	if health.ReadErrorsCorrected == nil || *health.ReadErrorsCorrected != 7 || health.ReadErrorsUncorrected != nil {
+		t.Fatalf("truncated parameter handling = %+v", health)
+	}
+}
+
+func TestParseSCSISupportedLogPages(t *testing.T) {
+	pages, err := parseSCSISupportedLogPages([]byte{0x00, 0x00, 0x00, 0x04, 0x00, 0x03, 0x0d, 0x2f})
+	if err != nil || !pages[scsiLogReadErrorCounters] || !pages[scsiLogTemperature] || !pages[scsiLogInformationalExcepts] || pages[scsiLogSolidStateMedia] {
+		t.Fatalf("supported pages = %v, %v", pages, err)
+	}
+	if _, err := parseSCSISupportedLogPages([]byte{0x0d, 0x00}); err == nil {
+		t.Fatal("expected an invalid supported pages response to be rejected")
+	}
+}
+
+func TestSCSILogCounterSaturates(t *testing.T) {
+	if value, ok := scsiLogCounter([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 5}); !ok || value != 5 {
+		t.Fatalf("wide counter = %d, %v", value, ok)
+	}
+	if value, ok := scsiLogCounter([]byte{1, 0, 0, 0, 0, 0, 0, 0, 0}); !ok || value != ^uint64(0) {
+		t.Fatalf("overflowing counter = %d, %v", value, ok)
+	}
+}
+
+func newSCSILogPageFixture(page byte, parameters ...[]byte) []byte {
+	data := []byte{page, 0, 0, 0}
+	for _, parameter := range parameters {
+		data = append(data, parameter...)
+	}
+	binary.BigEndian.PutUint16(data[2:4], uint16(len(data)-scsiLogPageHeaderSize))
+	return data
+}
+
+func scsiLogParameterFixture(code uint16, value ...byte) []byte {
+	parameter := []byte{byte(code >> 8), byte(code), 0x03, byte(len(value))}
+	return append(parameter, value...)
+}
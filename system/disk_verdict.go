@@ -0,0 +1,199 @@
+package system
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Disk verdict statuses, from best to worst. Unknown means no health or
+// temperature data was available to judge.
+const (
+	DiskVerdictUnknown = "unknown"
+	DiskVerdictOK      = "ok"
+	DiskVerdictWarning = "warning"
+	DiskVerdictFailing = "failing"
+)
+
+// DiskVerdict is the judgement derived from DiskHealthReport and the disk
+// temperature by EvaluateDiskHealth.
+type DiskVerdict struct {
+	Status  string              `json:"status"`
+	Reasons []DiskVerdictReason `json:"reasons,omitempty"`
+}
+
+type DiskVerdictReason struct {
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// DiskHealthThresholds are the limits applied to the passive health
+// counters. A counter reaching a warning or failing limit sets that verdict;
+// a zero limit disables the rule. NVMe critical warning bits, a spare below
+// the drive's own threshold and ATA pre-failure attributes at their vendor
+// threshold are always evaluated.
+type DiskHealthThresholds struct {
+	PercentageUsedWarning       uint64  `json:"percentage_used_warning"`
+	PercentageUsedFailing       uint64  `json:"percentage_used_failing"`
+	AvailableSpareWarning       uint64  `json:"available_spare_warning"`
+	MediaErrorsWarning          uint64  `json:"media_errors_warning"`
+	MediaErrorsFailing          uint64  `json:"media_errors_failing"`
+	ReallocatedSectorsWarning   uint64  `json:"reallocated_sectors_warning"`
+	ReallocatedSectorsFailing   uint64  `json:"reallocated_sectors_failing"`
+	PendingSectorsWarning       uint64  `json:"pending_sectors_warning"`
+	PendingSectorsFailing       uint64  `json:"pending_sectors_failing"`
+	OfflineUncorrectableWarning uint64  `json:"offline_uncorrectable_warning"`
+	OfflineUncorrectableFailing uint64  `json:"offline_uncorrectable_failing"`
+	TemperatureWarningCelsius   float64 `json:"temperature_warning_celsius"`
+	TemperatureFailingCelsius   float64 `json:"temperature_failing_celsius"`
+}
+
+// DefaultDiskHealthThresholds returns the built-in limits. AvailableSpareWarning
+// warns while the spare is still above the drive's own threshold.
+func DefaultDiskHealthThresholds() DiskHealthThresholds {
+	return DiskHealthThresholds{
+		PercentageUsedWarning:       80,
+		PercentageUsedFailing:       100,
+		AvailableSpareWarning:       20,
+		MediaErrorsWarning:          1,
+		ReallocatedSectorsWarning:   1,
+		ReallocatedSectorsFailing:   100,
+		PendingSectorsWarning:       1,
+		PendingSectorsFailing:       10,
+		OfflineUncorrectableWarning: 1,
+		OfflineUncorrectableFailing: 10,
+		TemperatureWarningCelsius:   70,
+	}
+}
+
+// LoadDiskHealthThresholds reads a JSON file overriding some or all of the
+// default thresholds. Unknown keys are rejected so a typo does not silently
+// fall back to a default.
+func LoadDiskHealthThresholds(path string) (DiskHealthThresholds, error) {
+	thresholds := DefaultDiskHealthThresholds()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return thresholds, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&thresholds); err != nil {
+		return DefaultDiskHealthThresholds(), fmt.Errorf("%s: %w", path, err)
+	}
+	return thresholds, nil
+}
+
+// nvmeCriticalWarningBits describes the NVMe SMART critical warning bits.
+var nvmeCriticalWarningBits = []struct {
+	mask     uint8
+	code     string
+	severity string
+	message  string
+}{
+	{0x01, "nvme_spare_below_threshold", DiskVerdictFailing, "available spare is below the drive threshold"},
+	{0x02, "nvme_temperature", DiskVerdictWarning, "temperature is outside the drive limits"},
+	{0x04, "nvme_reliability_degraded", DiskVerdictFailing, "NVM subsystem reliability is degraded"},
+	{0x08, "nvme_read_only", DiskVerdictFailing, "media has been placed in read-only mode"},
+	{0x10, "nvme_volatile_backup_failed", DiskVerdictWarning, "volatile memory backup device has failed"},
+	{0x20, "nvme_pmr_read_only", DiskVerdictWarning, "persistent memory region has become read-only"},
+}
+
+// EvaluateDiskHealth derives the verdict of one disk. It only reads the
+// collected report and never touches the device.
+func EvaluateDiskHealth(disk DiskReport, thresholds DiskHealthThresholds) DiskVerdict {
+	verdict := DiskVerdict{Status: DiskVerdictUnknown}
+	add := func(code, severity, message string) {
+		verdict.Reasons = append(verdict.Reasons, DiskVerdictReason{Code: code, Severity: severity, Message: message})
+		if severity == DiskVerdictFailing || verdict.Status != DiskVerdictFailing {
+			verdict.Status = severity
+		}
+	}
+	health := disk.Health
+	if health.Availability == AvailabilityAvailable {
+		verdict.Status = DiskVerdictOK
+		if health.Status == "failed" {
+			add("smart_status_failed", DiskVerdictFailing, "drive reports SMART status failed")
+		}
+		spareBitSet := false
+		if health.CriticalWarning != nil {
+			for _, bit := range nvmeCriticalWarningBits {
+				if *health.CriticalWarning&bit.mask != 0 {
+					spareBitSet = spareBitSet || bit.mask == 0x01
+					add(bit.code, bit.severity, bit.message)
+				}
+			}
+		}
+		if health.AvailableSparePct != nil {
+			spare := uint64(*health.AvailableSparePct)
+			switch {
+			case health.SpareThresholdPct != nil && spare < uint64(*health.SpareThresholdPct):
+				if !spareBitSet {
+					add("available_spare_below_threshold", DiskVerdictFailing, fmt.Sprintf("available spare %d%% is below the drive threshold %d%%", spare, *health.SpareThresholdPct))
+				}
+			case thresholds.AvailableSpareWarning > 0 && spare < thresholds.AvailableSpareWarning:
+				add("low_available_spare", DiskVerdictWarning, fmt.Sprintf("available spare %d%% is below %d%%", spare, thresholds.AvailableSpareWarning))
+			}
+		}
+		var percentageUsed *uint64
+		if health.PercentageUsed != nil {
+			percentageUsed = uint64Ptr(uint64(*health.PercentageUsed))
+		}
+		for _, counter := range []struct {
+			code             string
+			label            string
+			value            *uint64
+			warning, failing uint64
+		}{
+			{"percentage_used", "percentage used", percentageUsed, thresholds.PercentageUsedWarning, thresholds.PercentageUsedFailing},
+			{"media_errors", "media errors", health.MediaErrors, thresholds.MediaErrorsWarning, thresholds.MediaErrorsFailing},
+			{"reallocated_sectors", "reallocated sectors", health.ReallocatedSectors, thresholds.ReallocatedSectorsWarning, thresholds.ReallocatedSectorsFailing},
+			{"pending_sectors", "pending sectors", health.PendingSectors, thresholds.PendingSectorsWarning, thresholds.PendingSectorsFailing},
+			{"offline_uncorrectable", "offline uncorrectable sectors", health.OfflineUncorrectable, thresholds.OfflineUncorrectableWarning, thresholds.OfflineUncorrectableFailing},
+		} {
+			if counter.value == nil {
+				continue
+			}
+			switch value := *counter.value; {
+			case counter.failing > 0 && value >= counter.failing:
+				add(counter.code, DiskVerdictFailing, fmt.Sprintf("%s %d reached %d", counter.label, value, counter.failing))
+			case counter.warning > 0 && value >= counter.warning:
+				add(counter.code, DiskVerdictWarning, fmt.Sprintf("%s %d reached %d", counter.label, value, counter.warning))
+			}
+		}
+		for _, attribute := range health.ThresholdsExceeded {
+			severity, kind := DiskVerdictWarning, "old-age"
+			if attribute.Prefail {
+				severity, kind = DiskVerdictFailing, "pre-failure"
+			}
+			add(fmt.Sprintf("ata_attribute_%d", attribute.ID), severity, fmt.Sprintf("%s attribute %d value %d is at or below threshold %d", kind, attribute.ID, attribute.Current, attribute.Threshold))
+		}
+	}
+	if disk.Temperature.Celsius != nil {
+		if verdict.Status == DiskVerdictUnknown {
+			verdict.Status = DiskVerdictOK
+		}
+		celsius := *disk.Temperature.Celsius
+		switch {
+		case thresholds.TemperatureFailingCelsius > 0 && celsius >= thresholds.TemperatureFailingCelsius:
+			add("temperature", DiskVerdictFailing, fmt.Sprintf("temperature %.1f C reached %.1f C", celsius, thresholds.TemperatureFailingCelsius))
+		case thresholds.TemperatureWarningCelsius > 0 && celsius >= thresholds.TemperatureWarningCelsius:
+			add("temperature", DiskVerdictWarning, fmt.Sprintf("temperature %.1f C reached %.1f C", celsius, thresholds.TemperatureWarningCelsius))
+		}
+	}
+	return verdict
+}
+
+// WorstDiskVerdict returns the most severe verdict status among disks, or
+// DiskVerdictUnknown when no disk could be judged.
+func WorstDiskVerdict(disks []DiskReport) string {
+	rank := map[string]int{DiskVerdictUnknown: 0, DiskVerdictOK: 1, DiskVerdictWarning: 2, DiskVerdictFailing: 3}
+	worst := DiskVerdictUnknown
+	for _, disk := range disks {
+		if rank[disk.Verdict.Status] > rank[worst] {
+			worst = disk.Verdict.Status
+		}
+	}
+	return worst
+}
@@ -0,0 +1,108 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateDiskHealthNVMe(t *testing.T) {
+	available := ReportSection{Availability: AvailabilityAvailable}
+	disk := DiskReport{Name: "nvme0n1", Health: DiskHealthReport{
+		ReportSection: available, Protocol: "nvme", Status: "passed", CriticalWarning: uint8Ptr(0),
+		AvailableSparePct: uint8Ptr(100), SpareThresholdPct: uint8Ptr(10), PercentageUsed: uint8Ptr(3), MediaErrors: uint64Ptr(0),
+	}, Temperature: DiskTemperatureReport{ReportSection: available, Celsius: float64Ptr(41)}}
+	if verdict := EvaluateDiskHealth(disk, DefaultDiskHealthThresholds()); verdict.Status != DiskVerdictOK || len(verdict.Reasons) != 0 {
+		t.Fatalf("healthy disk verdict = %+v", verdict)
+	}
+
+	disk.Health.PercentageUsed, disk.Health.AvailableSparePct = uint8Ptr(85), uint8Ptr(15)
+	disk.Temperature.Celsius = float64Ptr(72)
+	verdict := EvaluateDiskHealth(disk, DefaultDiskHealthThresholds())
+	if verdict.Status != DiskVerdictWarning || reasonCodes(verdict) != "low_available_spare,percentage_used,temperature" {
+		t.Fatalf("worn disk verdict = %+v", verdict)
+	}
+
+	disk.Health.CriticalWarning, disk.Health.AvailableSparePct = uint8Ptr(0x09), uint8Ptr(5)
+	verdict = EvaluateDiskHealth(disk, DefaultDiskHealthThresholds())
+	if verdict.Status != DiskVerdictFailing || reasonCodes(verdict) != "nvme_spare_below_threshold,nvme_read_only,percentage_used,temperature" {
+		t.Fatalf("failing disk verdict = %+v", verdict)
+	}
+}
+
+func TestEvaluateDiskHealthATA(t *testing.T) {
+	disk := DiskReport{Name: "sda", Health: DiskHealthReport{
+		ReportSection: ReportSection{Availability: AvailabilityAvailable}, Protocol: "ata", Status: "passed",
+		ReallocatedSectors: uint64Ptr(8), PendingSectors: uint64Ptr(0), OfflineUncorrectable: uint64Ptr(0),
+		ThresholdsExceeded: []ATAThresholdExceeded{{ID: 190, Current: 40, Threshold: 45}},
+	}}
+	verdict := EvaluateDiskHealth(disk, DefaultDiskHealthThresholds())
+	if verdict.Status != DiskVerdictWarning || reasonCodes(verdict) != "reallocated_sectors,ata_attribute_190" {
+		t.Fatalf("ATA warning verdict = %+v", verdict)
+	}
+	disk.Health.Status = "failed"
+	disk.Health.PendingSectors = uint64Ptr(12)
+	disk.Health.ThresholdsExceeded = append(disk.Health.ThresholdsExceeded, ATAThresholdExceeded{ID: 5, Current: 9, Threshold: 10, Prefail: true})
+	verdict = EvaluateDiskHealth(disk, DefaultDiskHealthThresholds())
+	if verdict.Status != DiskVerdictFailing || reasonCodes(verdict) != "smart_status_failed,reallocated_sectors,pending_sectors,ata_attribute_190,ata_attribute_5" {
+		t.Fatalf("ATA failing verdict = %+v", verdict)
+	}
+	if !strings.Contains(verdict.Reasons[4].Message, "pre-failure attribute 5 value 9") {
+		t.Fatalf("unexpected reason message: %+v", verdict.Reasons[4])
+	}
+}
+
+func TestEvaluateDiskHealthUnknownWithoutData(t *testing.T) {
+	disk := DiskReport{Name: "vda", Health: DiskHealthReport{ReportSection: ReportSection{Availability: AvailabilityUnsupported}}}
+	if verdict := EvaluateDiskHealth(disk, DefaultDiskHealthThresholds()); verdict.Status != DiskVerdictUnknown {
+		t.Fatalf("verdict without data = %+v", verdict)
+	}
+	if worst := WorstDiskVerdict([]DiskReport{{Verdict: DiskVerdict{Status: DiskVerdictOK}}, {Verdict: DiskVerdict{Status: DiskVerdictWarning}}, {}}); worst != DiskVerdictWarning {
+		t.Fatalf("worst verdict = %s", worst)
+	}
+}
+
+func TestLoadDiskHealthThresholds(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "thresholds.json")
+	if err := os.WriteFile(path, []byte(`{"reallocated_sectors_warning": 50, "temperature_warning_celsius": 0}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	thresholds, err := LoadDiskHealthThresholds(path)
+	if err != nil {
+		t.Fatalf("LoadDiskHealthThresholds returned error: %v", err)
+	}
+	if thresholds.ReallocatedSectorsWarning != 50 || thresholds.TemperatureWarningCelsius != 0 || thresholds.PendingSectorsFailing != 10 {
+		t.Fatalf("unexpected thresholds: %+v", thresholds)
+	}
+	disk := DiskReport{Health: DiskHealthReport{ReportSection: ReportSection{Availability: AvailabilityAvailable}, ReallocatedSectors: uint64Ptr(8)}, Temperature: DiskTemperatureReport{Celsius: float64Ptr(75)}}
+	if verdict := EvaluateDiskHealth(disk, thresholds); verdict.Status != DiskVerdictOK {
+		t.Fatalf("overridden thresholds were not applied: %+v", verdict)
+	}
+	if err := os.WriteFile(path, []byte(`{"reallocated_sector_warning": 50}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDiskHealthThresholds(path); err == nil {
+		t.Fatal("expected an unknown key to be rejected")
+	}
+}
+
+func TestRenderDiskRowsIncludesVerdict(t *testing.T) {
+	report := &SystemReport{Disks: []DiskReport{{Name: "sda", Health: DiskHealthReport{ReportSection: ReportSection{Availability: AvailabilityAvailable}, Protocol: "ata", Status: "passed"},
+		Verdict: DiskVerdict{Status: DiskVerdictWarning, Reasons: []DiskVerdictReason{{Code: "reallocated_sectors"}, {Code: "temperature"}}}}}}
+	if text := RenderSystemReportText(report, "zh"); !strings.Contains(text, "协议 ata / 健康 passed / 判定 warning (reallocated_sectors, temperature)") {
+		t.Fatalf("zh report missing verdict:\n%s", text)
+	}
+	if text := RenderSystemReportText(report, "en"); !strings.Contains(text, "verdict warning (reallocated_sectors, temperature)") {
+		t.Fatalf("en report missing verdict:\n%s", text)
+	}
+}
+
+func reasonCodes(verdict DiskVerdict) string {
+	codes := make([]string, 0, len(verdict.Reasons))
+	for _, reason := range verdict.Reasons {
+		codes = append(codes, reason.Code)
+	}
+	return strings.Join(codes, ",")
+}
@@ -1,55 +1,194 @@
 package system
 
 import (
+	"context"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
 	"github.com/oneclickvirt/gostun/model"
 	"github.com/oneclickvirt/gostun/stuncheck"
 )
 
-func getNatType() string {
-	model.EnableLoger = false
-	model.Verbose = 0
-	model.Timeout = 3
-	model.IPVersion = "ipv4"
-	addrStrList := model.GetDefaultServers(model.IPVersion)
-	rfcMethods := []string{"RFC5780", "RFC5389", "RFC3489"}
-	successfulDetection := false
-	for _, rfcMethod := range rfcMethods {
-		if successfulDetection {
-			break
+// NAT discovery methods reported in NATReport.Method.
+const (
+	NATMethodRFC5780 = "RFC5780"
+	NATMethodRFC5389 = "RFC5389"
+)
+
+// NATReport is the STUN based NAT classification. The behaviour fields use
+// the RFC 4787 wording of gostun, for example "endpoint independent".
+type NATReport struct {
+	ReportSection
+	NATType           string `json:"nat_type,omitempty"`
+	MappingBehavior   string `json:"mapping_behavior,omitempty"`
+	FilteringBehavior string `json:"filtering_behavior,omitempty"`
+	// Method is the discovery method that produced the classification.
+	Method        string       `json:"method,omitempty"`
+	Server        string       `json:"server,omitempty"`
+	MappedAddress string       `json:"mapped_address,omitempty"`
+	MappedPort    int          `json:"mapped_port,omitempty"`
+	Attempts      []NATAttempt `json:"attempts,omitempty"`
+}
+
+// NATAttempt is the outcome of probing one STUN server.
+type NATAttempt struct {
+	Server            string `json:"server"`
+	Status            string `json:"status"`
+	MappedAddress     string `json:"mapped_address,omitempty"`
+	MappingBehavior   string `json:"mapping_behavior,omitempty"`
+	FilteringBehavior string `json:"filtering_behavior,omitempty"`
+	Error             string `json:"error,omitempty"`
+}
+
+// NATProbeConfig selects the STUN servers used by CollectNATReport. The zero
+// value probes the gostun default IPv4 servers with a 3 second timeout.
+type NATProbeConfig struct {
+	Servers   []string
+	IPVersion string
+	Timeout   time.Duration
+}
+
+var (
+	probeNATServers   = stuncheck.ProbeNAT
+	natInterfaceAddrs = net.InterfaceAddrs
+)
+
+// CollectNATReport probes every configured STUN server concurrently and
+// classifies the NAT from the first server, in configuration order, that
+// completed the RFC 5780 mapping and filtering tests. When no server supports
+// RFC 5780 the first plain binding response is used instead (RFC5389). It
+// keeps no state between calls and is safe for concurrent use.
+func CollectNATReport(ctx context.Context, config NATProbeConfig) NATReport {
+	if err := ctx.Err(); err != nil {
+		return NATReport{ReportSection: ReportSection{Availability: AvailabilityCanceled, Error: err.Error()}}
+	}
+	family := config.IPVersion
+	if family == "" {
+		family = "ipv4"
+	}
+	servers := config.Servers
+	if len(servers) == 0 {
+		servers = model.GetDefaultServers(family)
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	summary := probeNATServers(ctx, stuncheck.ProbeConfig{
+		Servers:       servers,
+		IPVersion:     family,
+		Timeout:       timeout,
+		MaxConcurrent: len(servers),
+	})
+	report := NATReport{}
+	var binding *stuncheck.NATReport
+	for index := range summary.Results {
+		result := summary.Results[index]
+		attempt := NATAttempt{
+			Server:        result.Server,
+			Status:        string(result.Status),
+			MappedAddress: result.MappedAddress,
+			Error:         result.Error,
 		}
-		for _, addrStr := range addrStrList {
-			model.NatMappingBehavior = ""
-			model.NatFilteringBehavior = ""
-			var err1, err2 error
-			switch rfcMethod {
-			case "RFC5780":
-				err1 = stuncheck.MappingTests(addrStr)
-				if err1 != nil {
-					model.NatMappingBehavior = "inconclusive"
-				}
-				err2 = stuncheck.FilteringTests(addrStr)
-				if err2 != nil {
-					model.NatFilteringBehavior = "inconclusive"
-				}
-			case "RFC5389":
-				err1 = stuncheck.MappingTestsRFC5389(addrStr)
-				if err1 != nil {
-					model.NatMappingBehavior = "inconclusive"
-					model.NatFilteringBehavior = "inconclusive"
-				}
-			case "RFC3489":
-				err1 = stuncheck.MappingTestsRFC3489(addrStr)
-				if err1 != nil {
-					model.NatMappingBehavior = "inconclusive"
-					model.NatFilteringBehavior = "inconclusive"
+		if result.MappedAddress != "" {
+			attempt.MappingBehavior, attempt.FilteringBehavior = result.MappingBehavior, result.FilteringBehavior
+		}
+		report.Attempts = append(report.Attempts, attempt)
+		if result.MappedAddress == "" {
+			continue
+		}
+		if report.Method == "" && knownNATBehavior(result.MappingBehavior) && knownNATBehavior(result.FilteringBehavior) {
+			report.Method = NATMethodRFC5780
+			report.MappingBehavior, report.FilteringBehavior = result.MappingBehavior, result.FilteringBehavior
+			report.setMapped(result.Server, result.MappedAddress)
+		}
+		if binding == nil {
+			binding = &summary.Results[index]
+		}
+	}
+	if report.Method == "" && binding != nil {
+		report.Method = NATMethodRFC5389
+		report.MappingBehavior, report.FilteringBehavior = bindingNATBehavior(binding.MappedAddress)
+		report.setMapped(binding.Server, binding.MappedAddress)
+	}
+	switch {
+	case report.Method != "":
+		report.Availability = AvailabilityAvailable
+		report.NATType = natTypeName(report.MappingBehavior, report.FilteringBehavior)
+	case ctx.Err() != nil:
+		report.ReportSection = ReportSection{Availability: AvailabilityCanceled, Error: ctx.Err().Error()}
+	case summary.Error != "":
+		report.ReportSection = ReportSection{Availability: AvailabilityUnavailable, Error: summary.Error}
+	default:
+		report.ReportSection = ReportSection{Availability: AvailabilityUnavailable, Error: "no STUN server returned a mapped address"}
+	}
+	return report
+}
+
+func (r *NATReport) setMapped(server, mapped string) {
+	r.Server = server
+	host, port, err := net.SplitHostPort(mapped)
+	if err != nil {
+		r.MappedAddress = mapped
+		return
+	}
+	r.MappedAddress = host
+	r.MappedPort, _ = strconv.Atoi(port)
+}
+
+func knownNATBehavior(behavior string) bool {
+	switch behavior {
+	case "", "unsupported", "timeout", "error", "inconclusive":
+		return false
+	}
+	return true
+}
+
+// bindingNATBehavior classifies a plain binding response. A mapped address
+// found on a local interface means there is no NAT; otherwise RFC 5389 cannot
+// tell the behaviours apart, so the conservative estimate is reported, as the
+// gostun RFC5389 test does.
+func bindingNATBehavior(mapped string) (string, string) {
+	host, _, err := net.SplitHostPort(mapped)
+	if err == nil {
+		if ip, parseErr := netip.ParseAddr(host); parseErr == nil {
+			if addrs, addrsErr := natInterfaceAddrs(); addrsErr == nil {
+				for _, addr := range addrs {
+					if prefix, prefixErr := netip.ParsePrefix(addr.String()); prefixErr == nil && prefix.Addr().Unmap() == ip.Unmap() {
+						return "endpoint independent (no NAT)", "endpoint independent"
+					}
 				}
 			}
-			if model.NatMappingBehavior != "inconclusive" && model.NatFilteringBehavior != "inconclusive" &&
-				model.NatMappingBehavior != "" && model.NatFilteringBehavior != "" {
-				successfulDetection = true
-				break
-			}
 		}
 	}
-	return stuncheck.CheckType()
+	return "address and port dependent", "address and port dependent"
+}
+
+// natTypeName mirrors stuncheck.CheckType without reading its globals.
+func natTypeName(mapping, filtering string) string {
+	switch {
+	case mapping == "endpoint independent (no NAT)" && filtering == "endpoint independent":
+		return "Full Cone"
+	case mapping == "endpoint independent" && filtering == "endpoint independent":
+		return "Full Cone"
+	case mapping == "endpoint independent" && filtering == "address dependent":
+		return "Restricted Cone"
+	case mapping == "endpoint independent" && filtering == "address and port dependent":
+		return "Port Restricted Cone"
+	case mapping == "address and port dependent" && filtering == "address and port dependent":
+		return "Symmetric"
+	case knownNATBehavior(mapping) && knownNATBehavior(filtering):
+		return mapping + "[NatMappingBehavior] " + filtering + "[NatFilteringBehavior]"
+	}
+	return "Inconclusive"
+}
+
+func getNatType() string {
+	report := CollectNATReport(context.Background(), NATProbeConfig{IPVersion: "ipv4"})
+	if report.NATType == "" {
+		return "Inconclusive"
+	}
+	return report.NATType
 }
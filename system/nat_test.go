@@ -0,0 +1,132 @@
+package system
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oneclickvirt/gostun/stuncheck"
+	"github.com/pion/stun/v2"
+)
+
+// startSTUNStandIn answers binding requests on 127.0.0.1 with the sender's
+// address, or with mapped when it is set.
+func startSTUNStandIn(t *testing.T, mapped *net.UDPAddr) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	go func() {
+		buffer := make([]byte, 1500)
+		for {
+			read, source, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			request := &stun.Message{Raw: append([]byte(nil), buffer[:read]...)}
+			if request.Decode() != nil || request.Type != stun.BindingRequest {
+				continue
+			}
+			address := source
+			if mapped != nil {
+				address = mapped
+			}
+			response := stun.MustBuild(request, stun.BindingSuccess, &stun.XORMappedAddress{IP: address.IP, Port: address.Port}, stun.Fingerprint)
+			_, _ = conn.WriteToUDP(response.Raw, source)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func silentUDPServer(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn.LocalAddr().String()
+}
+
+func TestCollectNATReportBindingWithoutNAT(t *testing.T) {
+	silent := silentUDPServer(t)
+	standIn := startSTUNStandIn(t, nil)
+	report := CollectNATReport(context.Background(), NATProbeConfig{
+		Servers: []string{silent, standIn},
+		Timeout: 300 * time.Millisecond,
+	})
+	if report.Availability != AvailabilityAvailable || report.Method != NATMethodRFC5389 || report.Server != standIn {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.MappingBehavior != "endpoint independent (no NAT)" || report.NATType != "Full Cone" {
+		t.Fatalf("expected loopback mapping to be classified as no NAT, got %+v", report)
+	}
+	if report.MappedAddress != "127.0.0.1" || report.MappedPort == 0 {
+		t.Fatalf("unexpected mapped address: %s:%d", report.MappedAddress, report.MappedPort)
+	}
+	if len(report.Attempts) != 2 || report.Attempts[0].Server != silent || report.Attempts[0].Status != "timeout" || report.Attempts[0].Error == "" {
+		t.Fatalf("expected the silent server attempt to be reported, got %+v", report.Attempts)
+	}
+}
+
+func TestCollectNATReportBindingBehindNAT(t *testing.T) {
+	standIn := startSTUNStandIn(t, &net.UDPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 40000})
+	report := CollectNATReport(context.Background(), NATProbeConfig{Servers: []string{standIn}, Timeout: 200 * time.Millisecond})
+	if report.Method != NATMethodRFC5389 || report.MappedAddress != "203.0.113.7" || report.MappedPort != 40000 || report.NATType != "Symmetric" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
+
+func TestCollectNATReportIsSafeForConcurrentUse(t *testing.T) {
+	standIn := startSTUNStandIn(t, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report := CollectNATReport(context.Background(), NATProbeConfig{Servers: []string{standIn}, Timeout: 300 * time.Millisecond})
+			if report.Availability != AvailabilityAvailable {
+				t.Errorf("unexpected report: %+v", report)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCollectNATReportPrefersRFC5780(t *testing.T) {
+	old := probeNATServers
+	t.Cleanup(func() { probeNATServers = old })
+	probeNATServers = func(ctx context.Context, config stuncheck.ProbeConfig) stuncheck.NATSummary {
+		if config.IPVersion != "ipv6" || config.Timeout != time.Second || len(config.Servers) != 3 {
+			t.Fatalf("unexpected probe config: %+v", config)
+		}
+		return stuncheck.NATSummary{Results: []stuncheck.NATReport{
+			{Server: "a:3478", Status: stuncheck.CapabilityAvailable, MappedAddress: "[2001:db8::7]:1000", MappingBehavior: "unsupported", FilteringBehavior: "unsupported"},
+			{Server: "b:3478", Status: stuncheck.CapabilityTimeout, Error: "timeout"},
+			{Server: "c:3478", Status: stuncheck.CapabilityAvailable, MappedAddress: "[2001:db8::7]:1002", MappingBehavior: "endpoint independent", FilteringBehavior: "address dependent"},
+		}}
+	}
+	report := CollectNATReport(context.Background(), NATProbeConfig{Servers: []string{"a:3478", "b:3478", "c:3478"}, IPVersion: "ipv6", Timeout: time.Second})
+	if report.Method != NATMethodRFC5780 || report.Server != "c:3478" || report.NATType != "Restricted Cone" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.MappedAddress != "2001:db8::7" || report.MappedPort != 1002 || len(report.Attempts) != 3 || report.Attempts[1].Error != "timeout" {
+		t.Fatalf("unexpected report details: %+v", report)
+	}
+}
+
+func TestCollectNATReportWithoutAnswers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report := CollectNATReport(ctx, NATProbeConfig{}); report.Availability != AvailabilityCanceled {
+		t.Fatalf("expected canceled report, got %+v", report)
+	}
+	report := CollectNATReport(context.Background(), NATProbeConfig{Servers: []string{silentUDPServer(t)}, Timeout: 100 * time.Millisecond})
+	if report.Availability != AvailabilityUnavailable || report.NATType != "" || len(report.Attempts) != 1 {
+		t.Fatalf("expected unavailable report, got %+v", report)
+	}
+}
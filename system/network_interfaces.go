@@ -0,0 +1,471 @@
+package system
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math/bits"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NetworkInterfacesReport lists the host's own interfaces and default routes
+// as exposed by /sys/class/net and /proc/net.
+type NetworkInterfacesReport struct {
+	ReportSection
+	Interfaces    []NetworkInterfaceReport `json:"interfaces,omitempty"`
+	DefaultRoutes []DefaultRouteReport     `json:"default_routes,omitempty"`
+	// UnattributedIPv4 holds the local IPv4 addresses that could not be
+	// assigned to one interface. It is only used when the addresses are
+	// rebuilt from procfs, as in a replayed snapshot.
+	UnattributedIPv4 []InterfaceAddressReport `json:"unattributed_ipv4,omitempty"`
+}
+
+// interfaceAddressLister is implemented by readers backed by the running
+// host. procfs has no per-interface IPv4 address list, so the live reader
+// asks the kernel directly.
+type interfaceAddressLister interface {
+	InterfaceAddresses() (map[string][]netip.Prefix, error)
+}
+
+func (OSReportFileReader) InterfaceAddresses() (map[string][]netip.Prefix, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]netip.Prefix, len(interfaces))
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip, ok := netip.AddrFromSlice(ipNet.IP)
+			ones, _ := ipNet.Mask.Size()
+			if ok {
+				result[iface.Name] = append(result[iface.Name], netip.PrefixFrom(ip.Unmap(), ones))
+			}
+		}
+	}
+	return result, nil
+}
+
+type NetworkInterfaceReport struct {
+	Name string `json:"name"`
+	// Kind is the kernel DEVTYPE (bond, bridge, vlan, wireguard, ...), or
+	// loopback, physical for device backed interfaces and virtual otherwise.
+	Kind        string `json:"kind,omitempty"`
+	MACAddress  string `json:"mac_address,omitempty"`
+	MACRedacted bool   `json:"mac_redacted"`
+	MTU         *int   `json:"mtu,omitempty"`
+	OperState   string `json:"operstate,omitempty"`
+	SpeedMbps   *int   `json:"speed_mbps,omitempty"`
+	Duplex      string `json:"duplex,omitempty"`
+	Driver      string `json:"driver,omitempty"`
+	// PCIAddress matches PCIDeviceReport.Address of the backing device.
+	PCIAddress string `json:"pci_address,omitempty"`
+	// Master is the bond or bridge this interface is enslaved to.
+	Master     string                   `json:"master,omitempty"`
+	Members    []string                 `json:"members,omitempty"`
+	BondMode   string                   `json:"bond_mode,omitempty"`
+	VLANID     *int                     `json:"vlan_id,omitempty"`
+	VLANParent string                   `json:"vlan_parent,omitempty"`
+	IPv4       []InterfaceAddressReport `json:"ipv4,omitempty"`
+	IPv6       []InterfaceAddressReport `json:"ipv6,omitempty"`
+}
+
+type InterfaceAddressReport struct {
+	Address      string `json:"address"`
+	PrefixLength int    `json:"prefix_length"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type DefaultRouteReport struct {
+	Family    string `json:"family"`
+	Interface string `json:"interface"`
+	Gateway   string `json:"gateway,omitempty"`
+	Metric    int    `json:"metric"`
+}
+
+func collectNetworkInterfacesReport(files ReportFileReader, operatingSystem string, includeMAC bool) NetworkInterfacesReport {
+	result := NetworkInterfacesReport{ReportSection: ReportSection{Availability: AvailabilityUnsupported}}
+	if operatingSystem != "linux" {
+		return result
+	}
+	paths, err := files.Glob("/sys/class/net/*")
+	if err != nil {
+		result.Availability = AvailabilityError
+		result.Error = "network interface enumeration failed"
+		return result
+	}
+	sort.Strings(paths)
+	pciAddresses := networkInterfacePCIAddresses(files)
+	vlans := parseVLANConfig(readString(files, "/proc/net/vlan/config"))
+	byName := make(map[string]*NetworkInterfaceReport, len(paths))
+	for _, path := range paths {
+		name := filepath.Base(path)
+		uevent := parseKeyValues(readString(files, filepath.Join(path, "uevent")))
+		device := parseKeyValues(readString(files, filepath.Join(path, "device/uevent")))
+		iface := NetworkInterfaceReport{
+			Name:       name,
+			Kind:       strings.TrimSpace(uevent["DEVTYPE"]),
+			OperState:  strings.TrimSpace(readString(files, filepath.Join(path, "operstate"))),
+			Duplex:     strings.TrimSpace(readString(files, filepath.Join(path, "duplex"))),
+			Driver:     device["DRIVER"],
+			PCIAddress: pciAddresses[name],
+		}
+		iface.MACAddress, iface.MACRedacted = reportMACAddress(readString(files, filepath.Join(path, "address")), includeMAC)
+		if mtu, err := strconv.Atoi(strings.TrimSpace(readString(files, filepath.Join(path, "mtu")))); err == nil && mtu > 0 {
+			iface.MTU = intPtr(mtu)
+		}
+		// speed reads -1 or fails with EINVAL while the link is down.
+		if speed, err := strconv.Atoi(strings.TrimSpace(readString(files, filepath.Join(path, "speed")))); err == nil && speed > 0 {
+			iface.SpeedMbps = intPtr(speed)
+		}
+		if iface.Kind == "" {
+			switch {
+			case name == "lo" || strings.TrimSpace(readString(files, filepath.Join(path, "type"))) == "772":
+				iface.Kind = "loopback"
+			case len(device) > 0 || iface.PCIAddress != "":
+				iface.Kind = "physical"
+			default:
+				iface.Kind = "virtual"
+			}
+		}
+		if slaves := strings.Fields(readString(files, filepath.Join(path, "bonding/slaves"))); len(slaves) > 0 {
+			iface.Members = slaves
+		}
+		if mode := strings.Fields(readString(files, filepath.Join(path, "bonding/mode"))); len(mode) > 0 {
+			iface.BondMode = mode[0]
+		}
+		if ports, _ := files.Glob(filepath.Join(path, "brif/*")); len(ports) > 0 {
+			for _, port := range ports {
+				iface.Members = append(iface.Members, filepath.Base(port))
+			}
+			sort.Strings(iface.Members)
+		}
+		if vlan, ok := vlans[name]; ok {
+			iface.VLANID, iface.VLANParent = intPtr(vlan.id), vlan.parent
+		}
+		result.Interfaces = append(result.Interfaces, iface)
+	}
+	if len(result.Interfaces) == 0 {
+		result.Availability = AvailabilityUnavailable
+		result.Error = "network interfaces are unavailable"
+		return result
+	}
+	for index := range result.Interfaces {
+		byName[result.Interfaces[index].Name] = &result.Interfaces[index]
+	}
+	for _, iface := range result.Interfaces {
+		for _, member := range iface.Members {
+			if port, ok := byName[member]; ok {
+				port.Master = iface.Name
+			}
+		}
+	}
+	routes := readString(files, "/proc/net/route")
+	var ipv4 map[string][]InterfaceAddressReport
+	if lister, ok := files.(interfaceAddressLister); ok {
+		if prefixes, err := lister.InterfaceAddresses(); err == nil {
+			ipv4 = ipv4InterfaceAddresses(prefixes)
+		}
+	}
+	if ipv4 == nil {
+		ipv4, result.UnattributedIPv4 = parseIPv4InterfaceAddresses(readString(files, "/proc/net/fib_trie"), routes)
+	}
+	for name, addresses := range ipv4 {
+		if iface, ok := byName[name]; ok {
+			iface.IPv4 = addresses
+		}
+	}
+	for name, addresses := range parseIfInet6(readString(files, "/proc/net/if_inet6")) {
+		if iface, ok := byName[name]; ok {
+			iface.IPv6 = addresses
+		}
+	}
+	result.DefaultRoutes = append(parseIPv4DefaultRoutes(routes), parseIPv6DefaultRoutes(readString(files, "/proc/net/ipv6_route"))...)
+	result.Availability = AvailabilityAvailable
+	return result
+}
+
+// networkInterfacePCIAddresses maps interface names to the PCI function that
+// provides them. virtio NICs hang one level deeper, below the virtioN device.
+func networkInterfacePCIAddresses(files ReportFileReader) map[string]string {
+	addresses := make(map[string]string)
+	for _, pattern := range []string{"/sys/bus/pci/devices/*/net/*", "/sys/bus/pci/devices/*/*/net/*"} {
+		matches, _ := files.Glob(pattern)
+		for _, match := range matches {
+			relative := strings.TrimPrefix(filepath.Clean(match), "/sys/bus/pci/devices/")
+			parts := strings.Split(relative, "/")
+			if len(parts) < 3 {
+				continue
+			}
+			if _, exists := addresses[parts[len(parts)-1]]; !exists {
+				addresses[parts[len(parts)-1]] = parts[0]
+			}
+		}
+	}
+	return addresses
+}
+
+// reportMACAddress keeps the vendor prefix of a MAC address and redacts the
+// device specific part unless includeMAC is set.
+func reportMACAddress(value string, includeMAC bool) (string, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" || strings.Trim(value, "0:") == "" {
+		return "", false
+	}
+	if includeMAC && !strings.Contains(value, "xx") {
+		return value, false
+	}
+	return redactMACAddress(value), true
+}
+
+func redactMACAddress(value string) string {
+	octets := strings.Split(strings.TrimSpace(value), ":")
+	if len(octets) != 6 {
+		return redactedSnapshotValue
+	}
+	return strings.Join(octets[:3], ":") + ":xx:xx:xx"
+}
+
+type vlanConfig struct {
+	id     int
+	parent string
+}
+
+// parseVLANConfig reads /proc/net/vlan/config, whose entries look like
+// "eth0.100 | 100 | eth0" after two header lines.
+func parseVLANConfig(content string) map[string]vlanConfig {
+	vlans := make(map[string]vlanConfig)
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) != 3 {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err != nil {
+			continue
+		}
+		vlans[strings.TrimSpace(fields[0])] = vlanConfig{id: id, parent: strings.TrimSpace(fields[2])}
+	}
+	return vlans
+}
+
+type ipv4Route struct {
+	iface   string
+	network netip.Prefix
+	gateway netip.Addr
+	flags   uint64
+	metric  int
+}
+
+// parseIPv4Routes parses /proc/net/route, which stores addresses as
+// little-endian hexadecimal words.
+func parseIPv4Routes(content string) []ipv4Route {
+	var routes []ipv4Route
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 8 || fields[0] == "Iface" {
+			continue
+		}
+		destination, okDestination := parseProcIPv4(fields[1])
+		gateway, okGateway := parseProcIPv4(fields[2])
+		mask, okMask := parseProcIPv4(fields[7])
+		flags, err := strconv.ParseUint(fields[3], 16, 16)
+		if !okDestination || !okGateway || !okMask || err != nil {
+			continue
+		}
+		metric, _ := strconv.Atoi(fields[6])
+		maskBytes := mask.As4()
+		ones := bits.OnesCount32(binary.BigEndian.Uint32(maskBytes[:]))
+		routes = append(routes, ipv4Route{iface: fields[0], network: netip.PrefixFrom(destination, ones), gateway: gateway, flags: flags, metric: metric})
+	}
+	return routes
+}
+
+func parseProcIPv4(value string) (netip.Addr, bool) {
+	raw, err := hex.DecodeString(value)
+	if err != nil || len(raw) != 4 {
+		return netip.Addr{}, false
+	}
+	return netip.AddrFrom4([4]byte{raw[3], raw[2], raw[1], raw[0]}), true
+}
+
+func parseIPv4DefaultRoutes(content string) []DefaultRouteReport {
+	var result []DefaultRouteReport
+	for _, route := range parseIPv4Routes(content) {
+		// RTF_UP must be set and the destination must be 0.0.0.0/0.
+		if route.flags&0x1 == 0 || route.network.Bits() != 0 || !route.network.Addr().IsUnspecified() {
+			continue
+		}
+		report := DefaultRouteReport{Family: "ipv4", Interface: route.iface, Metric: route.metric}
+		if !route.gateway.IsUnspecified() {
+			report.Gateway = route.gateway.String()
+		}
+		result = append(result, report)
+	}
+	return result
+}
+
+// ipv4InterfaceAddresses keeps the IPv4 addresses listed by the kernel.
+func ipv4InterfaceAddresses(prefixes map[string][]netip.Prefix) map[string][]InterfaceAddressReport {
+	result := make(map[string][]InterfaceAddressReport)
+	for name, list := range prefixes {
+		for _, prefix := range list {
+			if prefix.Addr().Is4() {
+				result[name] = append(result[name], InterfaceAddressReport{Address: prefix.Addr().String(), PrefixLength: prefix.Bits(), Scope: ipv4AddressScope(prefix.Addr())})
+			}
+		}
+		sortInterfaceAddresses(result[name])
+	}
+	return result
+}
+
+// parseIPv4InterfaceAddresses combines the local addresses of the fib_trie
+// with the directly connected routes of /proc/net/route. It is the fallback
+// for readers that cannot list addresses: an address without a connected
+// route, such as a lone /32 or a point-to-point peer, or whose subnet is
+// connected on several interfaces, is returned as unattributed with the
+// prefix of its route, or 32 without one. Loopback addresses are assigned
+// to lo.
+func parseIPv4InterfaceAddresses(trie, routes string) (map[string][]InterfaceAddressReport, []InterfaceAddressReport) {
+	var connected []ipv4Route
+	for _, route := range parseIPv4Routes(routes) {
+		if route.flags&0x2 == 0 && route.gateway.IsUnspecified() && route.network.Bits() > 0 {
+			connected = append(connected, route)
+		}
+	}
+	result := make(map[string][]InterfaceAddressReport)
+	var unattributed []InterfaceAddressReport
+	seen := make(map[string]struct{})
+	lines := strings.Split(trie, "\n")
+	for index, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "|-- ") || index+1 >= len(lines) {
+			continue
+		}
+		if !strings.Contains(lines[index+1], "/32 host LOCAL") {
+			continue
+		}
+		addr, err := netip.ParseAddr(strings.TrimPrefix(trimmed, "|-- "))
+		if err != nil || !addr.Is4() {
+			continue
+		}
+		if _, duplicate := seen[addr.String()]; duplicate {
+			continue
+		}
+		seen[addr.String()] = struct{}{}
+		if addr.IsLoopback() {
+			result["lo"] = append(result["lo"], InterfaceAddressReport{Address: addr.String(), PrefixLength: 8, Scope: "host"})
+			continue
+		}
+		var best *ipv4Route
+		ambiguous := false
+		for routeIndex := range connected {
+			route := &connected[routeIndex]
+			switch {
+			case !route.network.Contains(addr):
+			case best == nil || route.network.Bits() > best.network.Bits():
+				best, ambiguous = route, false
+			case route.network.Bits() == best.network.Bits() && route.iface != best.iface:
+				ambiguous = true
+			}
+		}
+		report := InterfaceAddressReport{Address: addr.String(), PrefixLength: 32, Scope: ipv4AddressScope(addr)}
+		if best != nil {
+			report.PrefixLength = best.network.Bits()
+		}
+		if best == nil || ambiguous {
+			unattributed = append(unattributed, report)
+			continue
+		}
+		result[best.iface] = append(result[best.iface], report)
+	}
+	for _, addresses := range result {
+		sortInterfaceAddresses(addresses)
+	}
+	sortInterfaceAddresses(unattributed)
+	return result, unattributed
+}
+
+func ipv4AddressScope(addr netip.Addr) string {
+	switch {
+	case addr.IsLoopback():
+		return "host"
+	case addr.IsLinkLocalUnicast():
+		return "link"
+	}
+	return "global"
+}
+
+func sortInterfaceAddresses(addresses []InterfaceAddressReport) {
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i].Address < addresses[j].Address })
+}
+
+// parseIfInet6 reads /proc/net/if_inet6:
+// address, ifindex, prefix length, scope, flags and name.
+func parseIfInet6(content string) map[string][]InterfaceAddressReport {
+	scopes := map[uint64]string{0x00: "global", 0x10: "host", 0x20: "link", 0x40: "site"}
+	result := make(map[string][]InterfaceAddressReport)
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		addr, ok := parseProcIPv6(fields[0])
+		prefixLength, errPrefix := strconv.ParseUint(fields[2], 16, 8)
+		scope, errScope := strconv.ParseUint(fields[3], 16, 8)
+		if !ok || errPrefix != nil || errScope != nil {
+			continue
+		}
+		result[fields[5]] = append(result[fields[5]], InterfaceAddressReport{Address: addr.String(), PrefixLength: int(prefixLength), Scope: scopes[scope]})
+	}
+	return result
+}
+
+func parseProcIPv6(value string) (netip.Addr, bool) {
+	raw, err := hex.DecodeString(value)
+	if err != nil || len(raw) != 16 {
+		return netip.Addr{}, false
+	}
+	return netip.AddrFrom16([16]byte(raw)), true
+}
+
+// parseIPv6DefaultRoutes reads /proc/net/ipv6_route: destination, prefix
+// length, source, source prefix length, next hop, metric, refcount, use,
+// flags and device. Unreachable placeholders and lo routes are skipped.
+func parseIPv6DefaultRoutes(content string) []DefaultRouteReport {
+	var result []DefaultRouteReport
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 10 || fields[9] == "lo" {
+			continue
+		}
+		destination, okDestination := parseProcIPv6(fields[0])
+		nextHop, okNextHop := parseProcIPv6(fields[4])
+		metric, errMetric := strconv.ParseUint(fields[5], 16, 32)
+		flags, errFlags := strconv.ParseUint(fields[8], 16, 32)
+		if !okDestination || !okNextHop || errMetric != nil || errFlags != nil {
+			continue
+		}
+		// RTF_UP must be set and RTF_REJECT must not.
+		if fields[1] != "00" || !destination.IsUnspecified() || flags&0x1 == 0 || flags&0x200 != 0 {
+			continue
+		}
+		report := DefaultRouteReport{Family: "ipv6", Interface: fields[9], Metric: int(metric)}
+		if !nextHop.IsUnspecified() {
+			report.Gateway = nextHop.String()
+		}
+		result = append(result, report)
+	}
+	return result
+}
@@ -0,0 +1,183 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func networkInterfacesFixture() reportFixture {
+	return reportFixture{
+		files: map[string]string{
+			"/sys/class/net/lo/address":           "00:00:00:00:00:00\n",
+			"/sys/class/net/lo/type":              "772\n",
+			"/sys/class/net/lo/operstate":         "unknown\n",
+			"/sys/class/net/lo/mtu":               "65536\n",
+			"/sys/class/net/eth0/address":         "52:54:00:12:34:56\n",
+			"/sys/class/net/eth0/operstate":       "up\n",
+			"/sys/class/net/eth0/mtu":             "1500\n",
+			"/sys/class/net/eth0/speed":           "10000\n",
+			"/sys/class/net/eth0/duplex":          "full\n",
+			"/sys/class/net/eth0/device/uevent":   "DRIVER=virtio_net\nMODALIAS=virtio:d00000001v00001AF4\n",
+			"/sys/class/net/eth1/address":         "52:54:00:ab:cd:ef\n",
+			"/sys/class/net/eth1/operstate":       "down\n",
+			"/sys/class/net/eth1/speed":           "-1\n",
+			"/sys/class/net/eth1/device/uevent":   "DRIVER=ixgbe\nPCI_SLOT_NAME=0000:03:00.0\n",
+			"/sys/class/net/bond0/uevent":         "DEVTYPE=bond\nINTERFACE=bond0\n",
+			"/sys/class/net/bond0/operstate":      "up\n",
+			"/sys/class/net/bond0/bonding/slaves": "eth1\n",
+			"/sys/class/net/bond0/bonding/mode":   "802.3ad 4\n",
+			"/sys/class/net/bond0.100/uevent":     "DEVTYPE=vlan\nINTERFACE=bond0.100\n",
+			"/sys/class/net/bond0.100/operstate":  "up\n",
+			"/sys/class/net/br0/uevent":           "DEVTYPE=bridge\nINTERFACE=br0\n",
+			"/sys/class/net/br0/operstate":        "up\n",
+			"/sys/class/net/br0/brif/veth1":       "",
+			"/sys/class/net/veth1/operstate":      "up\n",
+			"/sys/class/net/wg0/uevent":           "DEVTYPE=wireguard\nINTERFACE=wg0\n",
+			"/sys/class/net/wg0/operstate":        "unknown\n",
+			"/sys/class/net/wg0/mtu":              "1420\n",
+			"/proc/net/vlan/config":               "VLAN Dev name    | VLAN ID\nName-Type: VLAN_NAME_TYPE_RAW_PLUS_VID_NO_PAD\nbond0.100      | 100  | bond0\n",
+			"/proc/net/route":                     "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\neth0\t00000000\t0100000A\t0003\t0\t0\t100\t00000000\t0\t0\t0\neth0\t0000000A\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\nbond0.100\t0010A8C0\t00000000\t0001\t0\t0\t0\t00F0FFFF\t0\t0\t0\n",
+			"/proc/net/fib_trie":                  "Main:\n  +-- 0.0.0.0/0 3 0 5\n     |-- 0.0.0.0\n        /0 universe UNICAST\n     +-- 10.0.0.0/24 2 0 2\n        |-- 10.0.0.0\n           /24 link UNICAST\n        |-- 10.0.0.5\n           /32 host LOCAL\n     |-- 10.8.0.2\n        /32 host LOCAL\n     |-- 192.168.16.9\n        /32 host LOCAL\n  +-- 127.0.0.0/8 2 0 2\n     |-- 127.0.0.1\n        /32 host LOCAL\nLocal:\n     |-- 10.0.0.5\n        /32 host LOCAL\n",
+			"/proc/net/if_inet6":                  "00000000000000000000000000000001 01 80 10 80       lo\n20010db8000000000000000000000005 02 40 00 00     eth0\nfe80000000000000505400fffe123456 02 40 20 80     eth0\n",
+			"/proc/net/ipv6_route":                "00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00000003     eth0\n00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200       lo\n20010db8000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0\n",
+		},
+		globs: map[string][]string{
+			"/sys/class/net/*":               {"/sys/class/net/lo", "/sys/class/net/eth0", "/sys/class/net/eth1", "/sys/class/net/bond0", "/sys/class/net/bond0.100", "/sys/class/net/br0", "/sys/class/net/veth1", "/sys/class/net/wg0"},
+			"/sys/bus/pci/devices/*/net/*":   {"/sys/bus/pci/devices/0000:03:00.0/net/eth1"},
+			"/sys/bus/pci/devices/*/*/net/*": {"/sys/bus/pci/devices/0000:00:03.0/virtio0/net/eth0"},
+		},
+	}
+}
+
+func TestCollectNetworkInterfacesReportFixture(t *testing.T) {
+	report := collectNetworkInterfacesReport(networkInterfacesFixture(), "linux", false)
+	if report.Availability != AvailabilityAvailable || len(report.Interfaces) != 8 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	byName := make(map[string]NetworkInterfaceReport)
+	for _, iface := range report.Interfaces {
+		byName[iface.Name] = iface
+	}
+	eth0 := byName["eth0"]
+	if eth0.Kind != "physical" || eth0.Driver != "virtio_net" || eth0.PCIAddress != "0000:00:03.0" || eth0.SpeedMbps == nil || *eth0.SpeedMbps != 10000 || eth0.Duplex != "full" || eth0.MTU == nil || *eth0.MTU != 1500 {
+		t.Fatalf("unexpected eth0: %+v", eth0)
+	}
+	if eth0.MACAddress != "52:54:00:xx:xx:xx" || !eth0.MACRedacted {
+		t.Fatalf("expected the MAC address to be redacted by default, got %+v", eth0)
+	}
+	if len(eth0.IPv4) != 1 || eth0.IPv4[0] != (InterfaceAddressReport{Address: "10.0.0.5", PrefixLength: 24, Scope: "global"}) {
+		t.Fatalf("unexpected eth0 IPv4 addresses: %+v", eth0.IPv4)
+	}
+	if len(eth0.IPv6) != 2 || eth0.IPv6[0].Address != "2001:db8::5" || eth0.IPv6[0].PrefixLength != 64 || eth0.IPv6[1].Scope != "link" {
+		t.Fatalf("unexpected eth0 IPv6 addresses: %+v", eth0.IPv6)
+	}
+	if eth1 := byName["eth1"]; eth1.SpeedMbps != nil || eth1.PCIAddress != "0000:03:00.0" || eth1.Master != "bond0" {
+		t.Fatalf("unexpected eth1: %+v", eth1)
+	}
+	if bond := byName["bond0"]; bond.Kind != "bond" || bond.BondMode != "802.3ad" || len(bond.Members) != 1 || bond.Members[0] != "eth1" {
+		t.Fatalf("unexpected bond0: %+v", bond)
+	}
+	if vlan := byName["bond0.100"]; vlan.Kind != "vlan" || vlan.VLANID == nil || *vlan.VLANID != 100 || vlan.VLANParent != "bond0" || len(vlan.IPv4) != 1 || vlan.IPv4[0].PrefixLength != 20 {
+		t.Fatalf("unexpected bond0.100: %+v", vlan)
+	}
+	if bridge, port := byName["br0"], byName["veth1"]; bridge.Kind != "bridge" || len(bridge.Members) != 1 || port.Master != "br0" || port.Kind != "virtual" {
+		t.Fatalf("unexpected bridge: %+v %+v", bridge, port)
+	}
+	if wg := byName["wg0"]; wg.Kind != "wireguard" || len(wg.IPv4) != 0 {
+		t.Fatalf("unexpected wg0: %+v", wg)
+	}
+	// 10.8.0.2 has no connected route, so procfs cannot tell its interface.
+	if len(report.UnattributedIPv4) != 1 || report.UnattributedIPv4[0] != (InterfaceAddressReport{Address: "10.8.0.2", PrefixLength: 32, Scope: "global"}) {
+		t.Fatalf("unexpected unattributed addresses: %+v", report.UnattributedIPv4)
+	}
+	if lo := byName["lo"]; lo.Kind != "loopback" || lo.MACAddress != "" || lo.MACRedacted || len(lo.IPv4) != 1 || lo.IPv4[0].PrefixLength != 8 || len(lo.IPv6) != 1 {
+		t.Fatalf("unexpected lo: %+v", lo)
+	}
+	want := []DefaultRouteReport{{Family: "ipv4", Interface: "eth0", Gateway: "10.0.0.1", Metric: 100}, {Family: "ipv6", Interface: "eth0", Gateway: "fe80::1", Metric: 1024}}
+	if len(report.DefaultRoutes) != 2 || report.DefaultRoutes[0] != want[0] || report.DefaultRoutes[1] != want[1] {
+		t.Fatalf("unexpected default routes: %+v", report.DefaultRoutes)
+	}
+}
+
+func TestParseIPv4InterfaceAddressesSharedSubnet(t *testing.T) {
+	routes := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\neth0\t0000000A\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\neth1\t0000000A\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n"
+	trie := "Main:\n     |-- 10.0.0.5\n        /32 host LOCAL\n     |-- 10.0.0.6\n        /32 host LOCAL\n"
+	attributed, unattributed := parseIPv4InterfaceAddresses(trie, routes)
+	if len(attributed) != 0 || len(unattributed) != 2 || unattributed[0].Address != "10.0.0.5" || unattributed[0].PrefixLength != 24 {
+		t.Fatalf("shared subnet = %+v, %+v", attributed, unattributed)
+	}
+}
+
+type interfaceAddressFixture struct {
+	reportFixture
+	addresses map[string][]netip.Prefix
+}
+
+func (f interfaceAddressFixture) InterfaceAddresses() (map[string][]netip.Prefix, error) {
+	return f.addresses, nil
+}
+
+func TestCollectNetworkInterfacesReportListsLiveAddresses(t *testing.T) {
+	fixture := interfaceAddressFixture{reportFixture: networkInterfacesFixture(), addresses: map[string][]netip.Prefix{
+		"eth0": {netip.MustParsePrefix("10.0.0.5/24"), netip.MustParsePrefix("203.0.113.7/32"), netip.MustParsePrefix("2001:db8::5/64")},
+		"wg0":  {netip.MustParsePrefix("10.8.0.2/32")},
+		"lo":   {netip.MustParsePrefix("127.0.0.1/8")},
+	}}
+	report := collectNetworkInterfacesReport(fixture, "linux", false)
+	byName := make(map[string]NetworkInterfaceReport)
+	for _, iface := range report.Interfaces {
+		byName[iface.Name] = iface
+	}
+	if eth0 := byName["eth0"]; len(eth0.IPv4) != 2 || eth0.IPv4[1] != (InterfaceAddressReport{Address: "203.0.113.7", PrefixLength: 32, Scope: "global"}) || len(eth0.IPv6) != 2 {
+		t.Fatalf("unexpected eth0: %+v", eth0)
+	}
+	if wg, lo := byName["wg0"], byName["lo"]; len(wg.IPv4) != 1 || wg.IPv4[0].Address != "10.8.0.2" || len(lo.IPv4) != 1 || lo.IPv4[0].Scope != "host" {
+		t.Fatalf("unexpected wg0 or lo: %+v %+v", wg, lo)
+	}
+	if len(byName["bond0.100"].IPv4) != 0 || len(report.UnattributedIPv4) != 0 {
+		t.Fatalf("fib_trie was used alongside the live addresses: %+v", report)
+	}
+}
+
+func TestCollectNetworkInterfacesReportIncludesMACWhenEnabled(t *testing.T) {
+	filter := ReportSectionFilter{Enable: []string{"interfaces"}}
+	report := CollectSystemReportFromWithOptions(context.Background(), networkInterfacesFixture(), "linux", ReportOptions{Filter: filter, IncludeMACAddresses: true})
+	if eth0 := report.Interfaces.Interfaces[3]; eth0.Name != "eth0" || eth0.MACAddress != "52:54:00:12:34:56" || eth0.MACRedacted {
+		t.Fatalf("unexpected eth0: %+v", eth0)
+	}
+}
+
+func TestNetworkInterfacesSectionInSystemReport(t *testing.T) {
+	report := CollectSystemReportFromWithFilter(context.Background(), networkInterfacesFixture(), "linux", ReportSectionFilter{Enable: []string{"interfaces"}})
+	if report.Interfaces.Availability != AvailabilityAvailable || report.Network.Availability != AvailabilityDisabled {
+		t.Fatalf("unexpected sections: %+v %+v", report.Interfaces.ReportSection, report.Network.ReportSection)
+	}
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(encoded), "12:34:56") || !strings.Contains(string(encoded), `"pci_address":"0000:03:00.0"`) {
+		t.Fatalf("unexpected JSON: %s", encoded)
+	}
+	text := RenderSystemReportText(report, "en")
+	for _, want := range []string{"Interface Count", "7 (up 5)", "Default Route", "eth0 (IPv4), eth0 (IPv6)"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("text missing %q:\n%s", want, text)
+		}
+	}
+	if unsupported := collectNetworkInterfacesReport(networkInterfacesFixture(), "windows", false); unsupported.Availability != AvailabilityUnsupported {
+		t.Fatalf("expected unsupported outside Linux, got %+v", unsupported)
+	}
+}
+
+func TestScrubSnapshotFileRedactsMACAddresses(t *testing.T) {
+	if got := string(scrubSnapshotFile("/sys/class/net/eth0/address", []byte("52:54:00:12:34:56\n"))); got != "52:54:00:xx:xx:xx\n" {
+		t.Fatalf("unexpected scrubbed address %q", got)
+	}
+	if got := string(scrubSnapshotFile("/sys/class/net/lo/address", []byte("00:00:00:00:00:00\n"))); got != "00:00:00:00:00:00\n" {
+		t.Fatalf("unexpected scrubbed loopback address %q", got)
+	}
+}
@@ -0,0 +1,167 @@
+package system
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tuning advisory severities.
+const (
+	TuningSeverityInfo    = "info"
+	TuningSeverityWarning = "warning"
+)
+
+// InterfaceQueueReport describes the transmit and receive queues of one
+// interface.
+type InterfaceQueueReport struct {
+	Interface  string `json:"interface"`
+	TXQueues   int    `json:"tx_queues"`
+	RXQueues   int    `json:"rx_queues"`
+	TXQueueLen *int64 `json:"tx_queue_len,omitempty"`
+	// ExpectedQdisc is a guess, not an observation: the root qdisc the kernel
+	// attaches by default, which is noqueue when tx_queue_len is 0, mq on
+	// multi-queue devices and default_qdisc otherwise. A qdisc installed with
+	// tc is not visible in sysfs, so no advisory is based on this field.
+	ExpectedQdisc string `json:"expected_qdisc,omitempty"`
+}
+
+// TuningAdvisory is one rule based finding of the network tuning audit.
+type TuningAdvisory struct {
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	// messageZH is the Chinese text used by the compact text report.
+	messageZH string
+}
+
+// Thresholds of the network tuning advisories.
+const (
+	conntrackNearlyFullPercent = 90
+	lowSomaxconn               = 1024
+	smallSocketBufferMax       = 4 << 20
+)
+
+func collectNetworkSysctls(result *NetworkTuningReport, files ReportFileReader) {
+	result.RMemMax = parseSignedLimit(readString(files, "/proc/sys/net/core/rmem_max"))
+	result.WMemMax = parseSignedLimit(readString(files, "/proc/sys/net/core/wmem_max"))
+	result.Somaxconn = parseSignedLimit(readString(files, "/proc/sys/net/core/somaxconn"))
+	result.TCPFastOpen = parseSignedLimit(readString(files, "/proc/sys/net/ipv4/tcp_fastopen"))
+	result.TCPMTUProbing = parseSignedLimit(readString(files, "/proc/sys/net/ipv4/tcp_mtu_probing"))
+	result.TCPTWReuse = parseSignedLimit(readString(files, "/proc/sys/net/ipv4/tcp_tw_reuse"))
+	result.IPForward = parseBool(readString(files, "/proc/sys/net/ipv4/ip_forward"))
+	result.IPv6Disabled = parseBool(readString(files, "/proc/sys/net/ipv6/conf/all/disable_ipv6"))
+	if content, ok := readFirst(files, "/proc/sys/net/netfilter/nf_conntrack_max", "/proc/sys/net/nf_conntrack_max"); ok {
+		result.ConntrackMax = parseSignedLimit(string(content))
+	}
+	result.ConntrackCount = parseSignedLimit(readString(files, "/proc/sys/net/netfilter/nf_conntrack_count"))
+}
+
+func collectInterfaceQueues(files ReportFileReader, defaultQdisc string) []InterfaceQueueReport {
+	paths, _ := files.Glob("/sys/class/net/*")
+	sort.Strings(paths)
+	var result []InterfaceQueueReport
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if name == "lo" {
+			continue
+		}
+		tx, _ := files.Glob(filepath.Join(path, "queues/tx-*"))
+		rx, _ := files.Glob(filepath.Join(path, "queues/rx-*"))
+		if len(tx) == 0 && len(rx) == 0 {
+			continue
+		}
+		queues := InterfaceQueueReport{Interface: name, TXQueues: len(tx), RXQueues: len(rx), TXQueueLen: parseSignedLimit(readString(files, filepath.Join(path, "tx_queue_len")))}
+		switch {
+		case queues.TXQueueLen != nil && *queues.TXQueueLen == 0:
+			queues.ExpectedQdisc = "noqueue"
+		case len(tx) > 1:
+			queues.ExpectedQdisc = "mq"
+		default:
+			queues.ExpectedQdisc = defaultQdisc
+		}
+		result = append(result, queues)
+	}
+	return result
+}
+
+type interfaceMTU struct {
+	name string
+	mtu  int
+}
+
+func interfaceMTUs(files ReportFileReader) []interfaceMTU {
+	paths, _ := files.Glob("/sys/class/net/*")
+	sort.Strings(paths)
+	var result []interfaceMTU
+	for _, path := range paths {
+		if name := filepath.Base(path); name != "lo" {
+			if mtu, err := strconv.Atoi(strings.TrimSpace(readString(files, filepath.Join(path, "mtu")))); err == nil && mtu > 0 {
+				result = append(result, interfaceMTU{name: name, mtu: mtu})
+			}
+		}
+	}
+	return result
+}
+
+// networkTuningAdvisories applies the audit rules. Rules whose inputs are
+// missing are skipped rather than reported.
+func networkTuningAdvisories(report NetworkTuningReport, mtus []interfaceMTU) []TuningAdvisory {
+	var advisories []TuningAdvisory
+	add := func(code, severity, message, messageZH string) {
+		advisories = append(advisories, TuningAdvisory{Code: code, Severity: severity, Message: message, messageZH: messageZH})
+	}
+	congestion := strings.TrimSpace(report.CongestionControl)
+	if congestion != "" && congestion != "bbr" && containsString(report.AvailableCongestionControl, "bbr") {
+		add("bbr_available_not_used", TuningSeverityInfo,
+			fmt.Sprintf("BBR is available but %s is in use", congestion),
+			fmt.Sprintf("BBR 可用但当前使用 %s", congestion))
+	}
+	// Only the sysctl is known; an interface may still have fq installed
+	// with tc.
+	if congestion == "bbr" && report.DefaultQdisc != "" && report.DefaultQdisc != "fq" {
+		add("bbr_without_fq", TuningSeverityInfo,
+			fmt.Sprintf("BBR is in use with default_qdisc %s; unless fq is installed with tc, fq paces more efficiently", report.DefaultQdisc),
+			fmt.Sprintf("BBR 搭配的 default_qdisc 为 %s，除非已通过 tc 配置 fq，否则使用 fq 调度更高效", report.DefaultQdisc))
+	}
+	if report.ConntrackMax != nil && report.ConntrackCount != nil && *report.ConntrackMax > 0 {
+		if percent := *report.ConntrackCount * 100 / *report.ConntrackMax; percent >= conntrackNearlyFullPercent {
+			add("conntrack_nearly_full", TuningSeverityWarning,
+				fmt.Sprintf("conntrack table %d%% full (%d/%d)", percent, *report.ConntrackCount, *report.ConntrackMax),
+				fmt.Sprintf("conntrack 表已使用 %d%% (%d/%d)", percent, *report.ConntrackCount, *report.ConntrackMax))
+		}
+	}
+	if report.Somaxconn != nil && *report.Somaxconn < lowSomaxconn {
+		add("low_somaxconn", TuningSeverityInfo,
+			fmt.Sprintf("net.core.somaxconn is %d; busy servers usually need at least %d", *report.Somaxconn, lowSomaxconn),
+			fmt.Sprintf("net.core.somaxconn 为 %d，高并发服务通常至少需要 %d", *report.Somaxconn, lowSomaxconn))
+	}
+	for _, limit := range []struct {
+		name  string
+		value *int64
+	}{{"rmem_max", report.RMemMax}, {"wmem_max", report.WMemMax}} {
+		if limit.value != nil && *limit.value < smallSocketBufferMax {
+			add("small_"+limit.name, TuningSeverityInfo,
+				fmt.Sprintf("net.core.%s is %s; explicit socket buffers are capped below %s", limit.name, formatCompactBytes(*limit.value), formatCompactBytes(smallSocketBufferMax)),
+				fmt.Sprintf("net.core.%s 为 %s，显式设置的套接字缓冲区无法超过该值", limit.name, formatCompactBytes(*limit.value)))
+		}
+	}
+	if report.TCPMTUProbing != nil && *report.TCPMTUProbing == 0 {
+		for _, iface := range mtus {
+			if iface.mtu < 1500 {
+				add("mtu_probing_disabled", TuningSeverityInfo,
+					fmt.Sprintf("%s has MTU %d but tcp_mtu_probing is off; connections may stall behind PMTU black holes", iface.name, iface.mtu),
+					fmt.Sprintf("%s 的 MTU 为 %d 但未开启 tcp_mtu_probing，遇到 PMTU 黑洞时连接可能卡住", iface.name, iface.mtu))
+				break
+			}
+		}
+	}
+	if report.IPv6Disabled != nil && *report.IPv6Disabled {
+		add("ipv6_disabled", TuningSeverityInfo,
+			"IPv6 is disabled by net.ipv6.conf.all.disable_ipv6",
+			"IPv6 已被 net.ipv6.conf.all.disable_ipv6 禁用")
+	}
+	return advisories
+}
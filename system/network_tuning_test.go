@@ -0,0 +1,112 @@
+package system
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func networkTuningFixture() reportFixture {
+	return reportFixture{
+		files: map[string]string{
+			"/proc/sys/net/ipv4/tcp_congestion_control":           "cubic\n",
+			"/proc/sys/net/ipv4/tcp_available_congestion_control": "reno cubic bbr\n",
+			"/proc/sys/net/core/default_qdisc":                    "fq_codel\n",
+			"/proc/sys/net/ipv4/tcp_rmem":                         "4096 131072 6291456\n",
+			"/proc/sys/net/ipv4/tcp_wmem":                         "4096 16384 4194304\n",
+			"/proc/sys/net/core/rmem_max":                         "212992\n",
+			"/proc/sys/net/core/wmem_max":                         "16777216\n",
+			"/proc/sys/net/core/somaxconn":                        "128\n",
+			"/proc/sys/net/ipv4/tcp_fastopen":                     "1\n",
+			"/proc/sys/net/ipv4/tcp_mtu_probing":                  "0\n",
+			"/proc/sys/net/ipv4/tcp_tw_reuse":                     "2\n",
+			"/proc/sys/net/ipv4/ip_forward":                       "1\n",
+			"/proc/sys/net/ipv6/conf/all/disable_ipv6":            "1\n",
+			"/proc/sys/net/netfilter/nf_conntrack_max":            "262144\n",
+			"/proc/sys/net/netfilter/nf_conntrack_count":          "240000\n",
+			"/sys/class/net/eth0/mtu":                             "1500\n",
+			"/sys/class/net/eth0/tx_queue_len":                    "1000\n",
+			"/sys/class/net/wg0/mtu":                              "1420\n",
+			"/sys/class/net/wg0/tx_queue_len":                     "0\n",
+			"/sys/class/net/eth1/mtu":                             "1500\n",
+			"/sys/class/net/eth1/tx_queue_len":                    "1000\n",
+		},
+		globs: map[string][]string{
+			"/sys/class/net/*":                {"/sys/class/net/eth0", "/sys/class/net/eth1", "/sys/class/net/lo", "/sys/class/net/wg0"},
+			"/sys/class/net/eth0/queues/tx-*": {"/sys/class/net/eth0/queues/tx-0", "/sys/class/net/eth0/queues/tx-1"},
+			"/sys/class/net/eth0/queues/rx-*": {"/sys/class/net/eth0/queues/rx-0", "/sys/class/net/eth0/queues/rx-1"},
+			"/sys/class/net/eth1/queues/tx-*": {"/sys/class/net/eth1/queues/tx-0"},
+			"/sys/class/net/wg0/queues/tx-*":  {"/sys/class/net/wg0/queues/tx-0"},
+			"/sys/class/net/wg0/queues/rx-*":  {"/sys/class/net/wg0/queues/rx-0"},
+		},
+	}
+}
+
+func TestCollectNetworkTuningReportAudit(t *testing.T) {
+	report := collectNetworkTuningReport(networkTuningFixture(), "linux")
+	if report.Availability != AvailabilityAvailable {
+		t.Fatalf("unexpected availability: %+v", report.ReportSection)
+	}
+	if report.RMemMax == nil || *report.RMemMax != 212992 || report.Somaxconn == nil || *report.Somaxconn != 128 || report.TCPTWReuse == nil || *report.TCPTWReuse != 2 {
+		t.Fatalf("unexpected sysctls: %+v", report)
+	}
+	if report.IPForward == nil || !*report.IPForward || report.IPv6Disabled == nil || !*report.IPv6Disabled || report.ConntrackCount == nil || *report.ConntrackCount != 240000 {
+		t.Fatalf("unexpected flags or conntrack: %+v", report)
+	}
+	want := []InterfaceQueueReport{
+		{Interface: "eth0", TXQueues: 2, RXQueues: 2, ExpectedQdisc: "mq"},
+		{Interface: "eth1", TXQueues: 1, RXQueues: 0, ExpectedQdisc: "fq_codel"},
+		{Interface: "wg0", TXQueues: 1, RXQueues: 1, ExpectedQdisc: "noqueue"},
+	}
+	if len(report.InterfaceQueues) != len(want) {
+		t.Fatalf("unexpected interface queues: %+v", report.InterfaceQueues)
+	}
+	for index, queues := range report.InterfaceQueues {
+		queues.TXQueueLen = nil
+		if queues != want[index] {
+			t.Fatalf("interface queue %d = %+v, want %+v", index, queues, want[index])
+		}
+	}
+	if encoded, err := json.Marshal(want[0]); err != nil || !strings.Contains(string(encoded), `"expected_qdisc":"mq"`) {
+		t.Fatalf("unexpected queue JSON: %s, %v", encoded, err)
+	}
+	var codes []string
+	for _, advisory := range report.Advisories {
+		codes = append(codes, advisory.Code)
+	}
+	if got := strings.Join(codes, ","); got != "bbr_available_not_used,conntrack_nearly_full,low_somaxconn,small_rmem_max,mtu_probing_disabled,ipv6_disabled" {
+		t.Fatalf("unexpected advisories: %s", got)
+	}
+	if conntrack := report.Advisories[1]; conntrack.Severity != TuningSeverityWarning || conntrack.Message != "conntrack table 91% full (240000/262144)" {
+		t.Fatalf("unexpected conntrack advisory: %+v", conntrack)
+	}
+	if !strings.Contains(report.Advisories[4].Message, "wg0 has MTU 1420") {
+		t.Fatalf("unexpected MTU advisory: %+v", report.Advisories[4])
+	}
+}
+
+func TestNetworkTuningAdvisoriesSkipMissingInputs(t *testing.T) {
+	report := NetworkTuningReport{CongestionControl: "bbr", DefaultQdisc: "fq", AvailableCongestionControl: []string{"cubic", "bbr"}, TCPMTUProbing: int64Ptr(0)}
+	if advisories := networkTuningAdvisories(report, []interfaceMTU{{name: "eth0", mtu: 1500}}); len(advisories) != 0 {
+		t.Fatalf("expected no advisories, got %+v", advisories)
+	}
+	report.DefaultQdisc = "pfifo_fast"
+	if advisories := networkTuningAdvisories(report, nil); len(advisories) != 1 || advisories[0].Code != "bbr_without_fq" {
+		t.Fatalf("expected a bbr_without_fq advisory, got %+v", advisories)
+	}
+}
+
+func TestRenderSystemReportTextIncludesTuningAdvice(t *testing.T) {
+	report := &SystemReport{Network: collectNetworkTuningReport(networkTuningFixture(), "linux")}
+	zh := RenderSystemReportText(report, "zh")
+	for _, want := range []string{"连接跟踪", "240000 / 262144", "调优建议", "BBR 可用但当前使用 cubic", "conntrack 表已使用 91%"} {
+		if !strings.Contains(zh, want) {
+			t.Fatalf("report missing %q:\n%s", want, zh)
+		}
+	}
+	en := RenderSystemReportText(report, "en")
+	if !strings.Contains(en, "Tuning Advice") || !strings.Contains(en, "BBR is available but cubic is in use") {
+		t.Fatalf("English report missing advice:\n%s", en)
+	}
+	assertReportRowsAligned(t, zh)
+}
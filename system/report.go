@@ -9,6 +9,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Availability string
@@ -20,8 +22,12 @@ const (
 	AvailabilityPermissionDenied Availability = "permission_denied"
 	AvailabilityError            Availability = "error"
 	AvailabilityCanceled         Availability = "canceled"
+	AvailabilityDisabled         Availability = "disabled"
 )
 
+// ReportFileReader abstracts the files read by the structured collectors.
+// Sections are collected concurrently, so implementations must be safe for
+// concurrent use.
 type ReportFileReader interface {
 	ReadFile(path string) ([]byte, error)
 	Glob(pattern string) ([]string, error)
@@ -33,9 +39,23 @@ func (OSReportFileReader) ReadFile(path string) ([]byte, error) { return os.Read
 
 func (OSReportFileReader) Glob(pattern string) ([]string, error) { return filepath.Glob(pattern) }
 
+func (OSReportFileReader) live() bool { return true }
+
+// liveReportFileReader is implemented by readers of the running host, whose
+// files change between two reads.
+type liveReportFileReader interface {
+	live() bool
+}
+
+func isLiveReportFileReader(files ReportFileReader) bool {
+	reader, ok := files.(liveReportFileReader)
+	return ok && reader.live()
+}
+
 type ReportSection struct {
 	Availability Availability `json:"availability"`
 	Error        string       `json:"error,omitempty"`
+	DurationMS   *int64       `json:"duration_ms,omitempty"`
 }
 
 type CPUReport struct {
@@ -57,6 +77,13 @@ type MemoryReport struct {
 	AvailableBytes *int64 `json:"available_bytes,omitempty"`
 	SwapTotalBytes *int64 `json:"swap_total_bytes,omitempty"`
 	SwapFreeBytes  *int64 `json:"swap_free_bytes,omitempty"`
+	// VirtioBalloon is set when the virtio_balloon driver is loaded, which
+	// lets the hypervisor reclaim guest memory.
+	VirtioBalloon *bool `json:"virtio_balloon,omitempty"`
+	// KSMRunning and KSMPagesSharing describe kernel samepage merging inside
+	// this kernel.
+	KSMRunning      *bool  `json:"ksm_running,omitempty"`
+	KSMPagesSharing *int64 `json:"ksm_pages_sharing,omitempty"`
 }
 
 type CgroupReport struct {
@@ -117,6 +144,7 @@ type DiskReport struct {
 	Rotational      *bool                 `json:"rotational,omitempty"`
 	Health          DiskHealthReport      `json:"health"`
 	Temperature     DiskTemperatureReport `json:"temperature"`
+	Verdict         DiskVerdict           `json:"verdict"`
 }
 
 // DiskHealthReport contains passive health information. No self-test or write
@@ -146,6 +174,21 @@ type DiskHealthReport struct {
 	ReallocatedSectors      *uint64 `json:"reallocated_sectors,omitempty"`
 	PendingSectors          *uint64 `json:"pending_sectors,omitempty"`
 	OfflineUncorrectable    *uint64 `json:"offline_uncorrectable,omitempty"`
+	// ThresholdsExceeded lists ATA attributes at or below their threshold.
+	ThresholdsExceeded []ATAThresholdExceeded `json:"thresholds_exceeded,omitempty"`
+	// ATA is the full attribute table and the SMART logs of ATA drives.
+	ATA *ATASMARTReport `json:"ata,omitempty"`
+	// NVMe is the Identify data and logs of NVMe controllers.
+	NVMe *NVMeReport `json:"nvme,omitempty"`
+	// SCSI LOG SENSE counters.
+	ReadErrorsCorrected        *uint64 `json:"read_errors_corrected,omitempty"`
+	ReadErrorsUncorrected      *uint64 `json:"read_errors_uncorrected,omitempty"`
+	VerifyErrorsCorrected      *uint64 `json:"verify_errors_corrected,omitempty"`
+	VerifyErrorsUncorrected    *uint64 `json:"verify_errors_uncorrected,omitempty"`
+	StartStopCycles            *uint64 `json:"start_stop_cycles,omitempty"`
+	LoadUnloadCycles           *uint64 `json:"load_unload_cycles,omitempty"`
+	InformationalExceptionASC  *uint8  `json:"informational_exception_asc,omitempty"`
+	InformationalExceptionASCQ *uint8  `json:"informational_exception_ascq,omitempty"`
 }
 
 type DiskTemperatureReport struct {
@@ -160,11 +203,24 @@ type diskHealthCollector interface {
 
 type NetworkTuningReport struct {
 	ReportSection
-	CongestionControl          string   `json:"congestion_control,omitempty"`
-	AvailableCongestionControl []string `json:"available_congestion_control,omitempty"`
-	DefaultQdisc               string   `json:"default_qdisc,omitempty"`
-	TCPRMem                    []int64  `json:"tcp_rmem,omitempty"`
-	TCPWMem                    []int64  `json:"tcp_wmem,omitempty"`
+	CongestionControl          string                 `json:"congestion_control,omitempty"`
+	AvailableCongestionControl []string               `json:"available_congestion_control,omitempty"`
+	DefaultQdisc               string                 `json:"default_qdisc,omitempty"`
+	TCPRMem                    []int64                `json:"tcp_rmem,omitempty"`
+	TCPWMem                    []int64                `json:"tcp_wmem,omitempty"`
+	RMemMax                    *int64                 `json:"rmem_max,omitempty"`
+	WMemMax                    *int64                 `json:"wmem_max,omitempty"`
+	Somaxconn                  *int64                 `json:"somaxconn,omitempty"`
+	TCPFastOpen                *int64                 `json:"tcp_fastopen,omitempty"`
+	TCPMTUProbing              *int64                 `json:"tcp_mtu_probing,omitempty"`
+	TCPTWReuse                 *int64                 `json:"tcp_tw_reuse,omitempty"`
+	IPForward                  *bool                  `json:"ip_forward,omitempty"`
+	IPv6Disabled               *bool                  `json:"ipv6_disabled,omitempty"`
+	ConntrackMax               *int64                 `json:"conntrack_max,omitempty"`
+	ConntrackCount             *int64                 `json:"conntrack_count,omitempty"`
+	InterfaceQueues            []InterfaceQueueReport `json:"interface_queues,omitempty"`
+	// Advisories are rule based hints derived from the values above.
+	Advisories []TuningAdvisory `json:"advisories,omitempty"`
 }
 
 type FirmwareReport struct {
@@ -228,42 +284,107 @@ type RAIDReport struct {
 }
 
 type SystemReport struct {
-	SchemaVersion  string               `json:"schema_version"`
-	Availability   Availability         `json:"availability"`
-	Error          string               `json:"error,omitempty"`
-	CPU            CPUReport            `json:"cpu"`
-	Memory         MemoryReport         `json:"memory"`
-	Cgroup         CgroupReport         `json:"cgroup"`
-	Virtualization VirtualizationReport `json:"virtualization"`
-	GPUs           []GPUReport          `json:"gpus,omitempty"`
-	PCI            PCIReport            `json:"pci"`
-	Disks          []DiskReport         `json:"disks,omitempty"`
-	Network        NetworkTuningReport  `json:"network"`
-	Firmware       FirmwareReport       `json:"firmware"`
-	MemoryTopology MemoryTopologyReport `json:"memory_topology"`
-	RAID           RAIDReport           `json:"raid"`
+	SchemaVersion  string                  `json:"schema_version"`
+	Availability   Availability            `json:"availability"`
+	Error          string                  `json:"error,omitempty"`
+	CPU            CPUReport               `json:"cpu"`
+	Memory         MemoryReport            `json:"memory"`
+	Cgroup         CgroupReport            `json:"cgroup"`
+	CPUContention  CPUContentionReport     `json:"cpu_contention"`
+	Virtualization VirtualizationReport    `json:"virtualization"`
+	GPUs           []GPUReport             `json:"gpus,omitempty"`
+	PCI            PCIReport               `json:"pci"`
+	Disks          []DiskReport            `json:"disks,omitempty"`
+	Network        NetworkTuningReport     `json:"network"`
+	Interfaces     NetworkInterfacesReport `json:"interfaces"`
+	Firmware       FirmwareReport          `json:"firmware"`
+	MemoryTopology MemoryTopologyReport    `json:"memory_topology"`
+	RAID           RAIDReport              `json:"raid"`
+	// SectionStatus holds the availability and duration of the list sections
+	// (gpus and disks), which have no ReportSection of their own. Reports
+	// written before it existed leave it empty.
+	SectionStatus map[string]ReportSection `json:"section_status,omitempty"`
+	// Quality is derived from the sections above by EvaluateVPSQuality.
+	Quality *QualityReport `json:"quality,omitempty"`
+	// Extensions holds the sections added through RegisterReportCollector.
+	Extensions map[string]ExtensionReport `json:"extensions,omitempty"`
+	// DeepTools holds opt-in deep tool results added by the caller; the
+	// collectors never run them.
+	DeepTools []DeepToolResult `json:"deep_tools,omitempty"`
 }
 
 func GetSystemReport() *SystemReport {
 	return CollectSystemReport(context.Background())
 }
 
+// ReportOptions configures a report collection. The zero value collects every
+// section with the default budgets.
+type ReportOptions struct {
+	Filter ReportSectionFilter
+	// SectionTimeout bounds every section. When zero it is derived from the
+	// context deadline, or defaults to 5s when the context has none.
+	SectionTimeout time.Duration
+	// DiskHealthTimeout bounds the passive health read of every disk. The
+	// disks are read concurrently after the listing, so the disks section
+	// takes at most SectionTimeout plus DiskHealthTimeout. When zero it is
+	// four fifths of the section timeout.
+	DiskHealthTimeout time.Duration
+	// DiskThresholds sets the disk verdict limits, for example from
+	// LoadDiskHealthThresholds. Nil uses DefaultDiskHealthThresholds.
+	DiskThresholds *DiskHealthThresholds
+	// IncludeMACAddresses reports full MAC addresses in the interfaces
+	// section. By default only the vendor prefix is kept.
+	IncludeMACAddresses bool
+	// ContentionWindow is the time between the two samples of the
+	// cpu_contention section, 1s when zero. The section timeout is extended
+	// by the window.
+	ContentionWindow time.Duration
+	// ContentionSecondSample is read as the second cpu_contention sample,
+	// taken after the files being collected. The time between them comes
+	// from the /proc/stat counters, or ContentionWindow when they lack
+	// per-CPU lines. Without it only a reader of the running host is sampled
+	// twice; a snapshot reports the section as unavailable.
+	ContentionSecondSample ReportFileReader
+}
+
 func CollectSystemReport(ctx context.Context) *SystemReport {
-	return collectSystemReport(ctx, OSReportFileReader{}, defaultDiskHealthCollector(), runtime.GOOS)
+	return CollectSystemReportWithOptions(ctx, ReportOptions{})
+}
+
+// CollectSystemReportWithFilter collects only the sections selected by filter.
+// Sections that are filtered out are reported as disabled.
+func CollectSystemReportWithFilter(ctx context.Context, filter ReportSectionFilter) *SystemReport {
+	return CollectSystemReportWithOptions(ctx, ReportOptions{Filter: filter})
+}
+
+func CollectSystemReportWithOptions(ctx context.Context, options ReportOptions) *SystemReport {
+	return collectSystemReport(ctx, OSReportFileReader{}, defaultDiskHealthCollector(), runtime.GOOS, options)
 }
 
 func CollectSystemReportFrom(ctx context.Context, files ReportFileReader, operatingSystem string) *SystemReport {
-	return collectSystemReport(ctx, files, nil, operatingSystem)
+	return CollectSystemReportFromWithOptions(ctx, files, operatingSystem, ReportOptions{})
+}
+
+// CollectSystemReportFromWithFilter is the fixture-friendly variant of
+// CollectSystemReportWithFilter.
+func CollectSystemReportFromWithFilter(ctx context.Context, files ReportFileReader, operatingSystem string, filter ReportSectionFilter) *SystemReport {
+	return CollectSystemReportFromWithOptions(ctx, files, operatingSystem, ReportOptions{Filter: filter})
+}
+
+// CollectSystemReportFromWithOptions is the fixture-friendly variant of
+// CollectSystemReportWithOptions.
+func CollectSystemReportFromWithOptions(ctx context.Context, files ReportFileReader, operatingSystem string, options ReportOptions) *SystemReport {
+	return collectSystemReport(ctx, files, nil, operatingSystem, options)
 }
 
 // CollectSystemReportFromWithDiskHealth is the fixture-friendly entrypoint for
 // callers that want to inject a passive health reader. The regular reader is
 // intentionally kept separate so tests never need access to /dev devices.
 func CollectSystemReportFromWithDiskHealth(ctx context.Context, files ReportFileReader, collector diskHealthCollector, operatingSystem string) *SystemReport {
-	return collectSystemReport(ctx, files, collector, operatingSystem)
+	return collectSystemReport(ctx, files, collector, operatingSystem, ReportOptions{})
 }
 
-func collectSystemReport(ctx context.Context, files ReportFileReader, collector diskHealthCollector, operatingSystem string) *SystemReport {
+func collectSystemReport(ctx context.Context, files ReportFileReader, collector diskHealthCollector, operatingSystem string, options ReportOptions) *SystemReport {
 	report := &SystemReport{SchemaVersion: "goecs.system/v1", Availability: AvailabilityAvailable}
 	if ctx == nil {
 		ctx = context.Background()
@@ -272,69 +393,46 @@ func collectSystemReport(ctx context.Context, files ReportFileReader, collector
 		cancelSystemReport(report, err)
 		return report
 	}
-	report.CPU = collectCPUReport(files, operatingSystem)
-	if err := ctx.Err(); err != nil {
-		cancelSystemReport(report, err)
-		return report
+	options = options.withDefaults(ctx)
+	filter := options.Filter
+	if collector != nil {
+		collector = timedDiskHealthCollector{ctx: ctx, timeout: options.DiskHealthTimeout, inner: collector}
 	}
-	report.Memory = collectMemoryReport(files, operatingSystem)
-	if err := ctx.Err(); err != nil {
-		cancelSystemReport(report, err)
-		return report
-	}
-	report.Cgroup = collectCgroupReport(files, operatingSystem)
-	if err := ctx.Err(); err != nil {
-		cancelSystemReport(report, err)
-		return report
-	}
-	report.Virtualization = collectVirtualizationReport(files, operatingSystem)
-	if err := ctx.Err(); err != nil {
-		cancelSystemReport(report, err)
-		return report
-	}
-	report.GPUs = collectGPUReports(files, operatingSystem)
-	if err := ctx.Err(); err != nil {
-		cancelSystemReport(report, err)
-		return report
-	}
-	report.PCI = collectPCIReport(files, operatingSystem)
-	if err := ctx.Err(); err != nil {
-		cancelSystemReport(report, err)
-		return report
-	}
-	report.Disks = collectDiskReports(files, operatingSystem, collector)
-	if err := ctx.Err(); err != nil {
-		cancelSystemReport(report, err)
-		return report
-	}
-	report.Network = collectNetworkTuningReport(files, operatingSystem)
-	if err := ctx.Err(); err != nil {
-		cancelSystemReport(report, err)
-		return report
-	}
-	report.Firmware = collectFirmwareReport(files, operatingSystem)
-	if err := ctx.Err(); err != nil {
-		cancelSystemReport(report, err)
-		return report
-	}
-	report.MemoryTopology = collectMemoryTopologyReport(files, operatingSystem)
-	if err := ctx.Err(); err != nil {
-		cancelSystemReport(report, err)
-		return report
+	disableReportSections(report)
+	sections := append(builtinReportSections(report, files, collector, operatingSystem, options), extensionReportSections(report, files, operatingSystem, options)...)
+	var wg sync.WaitGroup
+	for _, section := range sections {
+		if !filter.Allows(section.name) {
+			continue
+		}
+		wg.Add(1)
+		go func(run func(context.Context)) {
+			defer wg.Done()
+			run(ctx)
+		}(section.run)
+	}
+	wg.Wait()
+	if filter.Allows("raid") {
+		report.RAID.Controllers = raidControllersFromPCI(report.PCI)
+		if len(report.RAID.Controllers) > 0 && report.RAID.Availability != AvailabilityAvailable {
+			report.RAID.Availability = AvailabilityAvailable
+			report.RAID.Error = ""
+		}
 	}
-	report.RAID = collectRAIDReport(files, operatingSystem)
 	if err := ctx.Err(); err != nil {
 		cancelSystemReport(report, err)
 		return report
 	}
-	report.RAID.Controllers = raidControllersFromPCI(report.PCI)
-	if len(report.RAID.Controllers) > 0 && report.RAID.Availability != AvailabilityAvailable {
-		report.RAID.Availability = AvailabilityAvailable
-		report.RAID.Error = ""
+	var core []ReportSection
+	for _, section := range []ReportSection{report.CPU.ReportSection, report.Memory.ReportSection, report.Cgroup.ReportSection, report.Virtualization.ReportSection} {
+		if section.Availability != AvailabilityDisabled {
+			core = append(core, section)
+		}
 	}
-	if !hasAvailableSection(report.CPU.ReportSection, report.Memory.ReportSection, report.Cgroup.ReportSection, report.Virtualization.ReportSection) {
+	if len(core) > 0 && !hasAvailableSection(core...) {
 		report.Availability = AvailabilityUnavailable
 	}
+	report.Quality = EvaluateVPSQuality(report)
 	return report
 }
 
@@ -547,11 +645,15 @@ func collectNetworkTuningReport(files ReportFileReader, operatingSystem string)
 	result.DefaultQdisc = strings.TrimSpace(readString(files, "/proc/sys/net/core/default_qdisc"))
 	result.TCPRMem = parseInt64Fields(readString(files, "/proc/sys/net/ipv4/tcp_rmem"))
 	result.TCPWMem = parseInt64Fields(readString(files, "/proc/sys/net/ipv4/tcp_wmem"))
-	if result.CongestionControl == "" && result.DefaultQdisc == "" && len(result.TCPRMem) == 0 && len(result.TCPWMem) == 0 {
+	collectNetworkSysctls(&result, files)
+	if result.CongestionControl == "" && result.DefaultQdisc == "" && len(result.TCPRMem) == 0 && len(result.TCPWMem) == 0 &&
+		result.RMemMax == nil && result.Somaxconn == nil && result.ConntrackMax == nil {
 		result.Availability = AvailabilityUnavailable
 		result.Error = "network tuning parameters are unavailable"
 		return result
 	}
+	result.InterfaceQueues = collectInterfaceQueues(files, result.DefaultQdisc)
+	result.Advisories = networkTuningAdvisories(result, interfaceMTUs(files))
 	result.Availability = AvailabilityAvailable
 	return result
 }
@@ -654,6 +756,15 @@ func collectMemoryReport(files ReportFileReader, operatingSystem string) MemoryR
 		result.Error = "meminfo contains no MemTotal"
 		return result
 	}
+	// The balloon driver is either a module or built in and bound.
+	if modules, err := files.ReadFile("/proc/modules"); err == nil {
+		bound, _ := files.Glob("/sys/bus/virtio/drivers/virtio_balloon/virtio*")
+		result.VirtioBalloon = boolPtr(strings.Contains(string(modules), "virtio_balloon") || len(bound) > 0)
+	}
+	if run := strings.TrimSpace(readString(files, "/sys/kernel/mm/ksm/run")); run != "" {
+		result.KSMRunning = boolPtr(run == "1")
+		result.KSMPagesSharing = parseSignedLimit(readString(files, "/sys/kernel/mm/ksm/pages_sharing"))
+	}
 	result.Availability = AvailabilityAvailable
 	return result
 }
@@ -774,7 +885,14 @@ func collectGPUReports(files ReportFileReader, operatingSystem string) []GPURepo
 	return reports
 }
 
-func collectDiskReports(files ReportFileReader, operatingSystem string, collector diskHealthCollector) []DiskReport {
+func collectDiskReports(files ReportFileReader, operatingSystem string, collector diskHealthCollector, thresholds DiskHealthThresholds) []DiskReport {
+	reports := listDiskReports(files, operatingSystem)
+	collectDiskHealth(reports, files, collector, thresholds)
+	return reports
+}
+
+// listDiskReports reads the sysfs attributes of every physical disk.
+func listDiskReports(files ReportFileReader, operatingSystem string) []DiskReport {
 	if operatingSystem != "linux" {
 		return nil
 	}
@@ -801,9 +919,6 @@ func collectDiskReports(files ReportFileReader, operatingSystem string, collecto
 			Health:          DiskHealthReport{ReportSection: ReportSection{Availability: AvailabilityUnavailable, Error: "passive health data unavailable"}, Protocol: storageProtocol(name)},
 			Temperature:     DiskTemperatureReport{ReportSection: ReportSection{Availability: AvailabilityUnavailable}},
 		}
-		if collector != nil {
-			report.Health, report.Temperature = collector.Collect(name, files)
-		}
 		if sectors > 0 {
 			// Linux sysfs exposes /sys/block/<dev>/size in 512-byte
 			// sectors, regardless of the device logical block size. Keep
@@ -829,6 +944,27 @@ func collectDiskReports(files ReportFileReader, operatingSystem string, collecto
 	return reports
 }
 
+// collectDiskHealth fills in the health data of every disk and evaluates the
+// verdicts.
+func collectDiskHealth(reports []DiskReport, files ReportFileReader, collector diskHealthCollector, thresholds DiskHealthThresholds) {
+	if collector != nil {
+		// Health reads address different devices and may block in the kernel,
+		// so each disk is queried independently.
+		var wg sync.WaitGroup
+		for index := range reports {
+			wg.Add(1)
+			go func(report *DiskReport) {
+				defer wg.Done()
+				report.Health, report.Temperature = collector.Collect(report.Name, files)
+			}(&reports[index])
+		}
+		wg.Wait()
+	}
+	for index := range reports {
+		reports[index].Verdict = EvaluateDiskHealth(reports[index], thresholds)
+	}
+}
+
 func isPhysicalDiskName(name string) bool {
 	name = strings.ToLower(strings.TrimSpace(name))
 	if name == "" {
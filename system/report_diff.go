@@ -0,0 +1,563 @@
+package system
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Report diff severities. Critical changes are regressions of capacity,
+// limits or device health and make ReportDiff.Regressed return true.
+const (
+	DiffSeverityInfo     = "info"
+	DiffSeverityWarning  = "warning"
+	DiffSeverityCritical = "critical"
+)
+
+// Report diff change kinds.
+const (
+	DiffChanged = "changed"
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+)
+
+// ReportChange is one semantic difference between two system reports. Item
+// names the entity within the section, such as a disk name or PCI address.
+type ReportChange struct {
+	Section  string `json:"section"`
+	Item     string `json:"item,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	Before   string `json:"before,omitempty"`
+	After    string `json:"after,omitempty"`
+}
+
+type ReportDiff struct {
+	Changes     []ReportChange `json:"changes"`
+	Regressions int            `json:"regressions"`
+}
+
+// Regressed reports whether any critical field regressed.
+func (d *ReportDiff) Regressed() bool { return d != nil && d.Regressions > 0 }
+
+// LoadSystemReport reads a document written by --json. The public network
+// section, if present, is ignored.
+func LoadSystemReport(path string) (*SystemReport, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report SystemReport
+	if err := json.Unmarshal(content, &report); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if !strings.HasPrefix(report.SchemaVersion, "goecs.system/") {
+		return nil, fmt.Errorf("%s: not a system report (schema_version %q)", path, report.SchemaVersion)
+	}
+	return &report, nil
+}
+
+// DiffSystemReports compares the fields that matter across migrations and
+// kernel upgrades. Volatile values such as usage, temperatures and uptime
+// counters are ignored. Sections that are not available in both reports only
+// record their availability change, so a run without root does not look like
+// a regression.
+func DiffSystemReports(before, after *SystemReport) *ReportDiff {
+	d := &reportDiffer{}
+	if before == nil || after == nil {
+		return d.result()
+	}
+	if d.sections("cpu", before.CPU.ReportSection, after.CPU.ReportSection) {
+		diffCPUReports(d, before.CPU, after.CPU)
+	}
+	if d.sections("memory", before.Memory.ReportSection, after.Memory.ReportSection) {
+		d.bytes("memory", "", "total_bytes", before.Memory.TotalBytes, after.Memory.TotalBytes, DiffSeverityCritical)
+		d.bytes("memory", "", "swap_total_bytes", before.Memory.SwapTotalBytes, after.Memory.SwapTotalBytes, DiffSeverityWarning)
+	}
+	if d.sections("cgroup", before.Cgroup.ReportSection, after.Cgroup.ReportSection) {
+		diffCgroupReports(d, before.Cgroup, after.Cgroup)
+	}
+	if d.sections("virtualization", before.Virtualization.ReportSection, after.Virtualization.ReportSection) {
+		d.text("virtualization", "", "type", before.Virtualization.Type, after.Virtualization.Type, DiffSeverityWarning)
+		d.text("virtualization", "", "container_runtime", before.Virtualization.ContainerRuntime, after.Virtualization.ContainerRuntime, DiffSeverityInfo)
+	}
+	if d.sections("pci", before.PCI.ReportSection, after.PCI.ReportSection) {
+		diffPCIReports(d, before.PCI, after.PCI)
+	}
+	if d.sections("disks", before.listSection("disks"), after.listSection("disks")) {
+		diffDiskReports(d, before.Disks, after.Disks)
+	}
+	if d.sections("network", before.Network.ReportSection, after.Network.ReportSection) {
+		d.text("network", "", "congestion_control", before.Network.CongestionControl, after.Network.CongestionControl, DiffSeverityInfo)
+		d.text("network", "", "default_qdisc", before.Network.DefaultQdisc, after.Network.DefaultQdisc, DiffSeverityInfo)
+	}
+	if d.sections("interfaces", before.Interfaces.ReportSection, after.Interfaces.ReportSection) {
+		diffInterfaceReports(d, before.Interfaces, after.Interfaces)
+	}
+	if d.sections("firmware", before.Firmware.ReportSection, after.Firmware.ReportSection) {
+		d.text("firmware", "", "board_name", before.Firmware.BoardName, after.Firmware.BoardName, DiffSeverityInfo)
+		d.text("firmware", "", "bios_version", before.Firmware.BIOSVersion, after.Firmware.BIOSVersion, DiffSeverityInfo)
+	}
+	if d.sections("memory_topology", before.MemoryTopology.ReportSection, after.MemoryTopology.ReportSection) {
+		d.count("memory_topology", "", "numa_nodes", len(before.MemoryTopology.Nodes), len(after.MemoryTopology.Nodes), DiffSeverityWarning)
+		d.count("memory_topology", "", "dimms", len(before.MemoryTopology.DIMMs), len(after.MemoryTopology.DIMMs), DiffSeverityWarning)
+		d.int64s("memory_topology", "", "hugepages_total", before.MemoryTopology.HugePagesTotal, after.MemoryTopology.HugePagesTotal, DiffSeverityWarning)
+	}
+	if d.sections("raid", before.RAID.ReportSection, after.RAID.ReportSection) {
+		diffRAIDReports(d, before.RAID, after.RAID)
+	}
+	return d.result()
+}
+
+// listSection returns the status of a list section. Reports written before
+// SectionStatus existed count as available.
+func (r *SystemReport) listSection(name string) ReportSection {
+	if section, ok := r.SectionStatus[name]; ok {
+		return section
+	}
+	return ReportSection{Availability: AvailabilityAvailable}
+}
+
+func diffCPUReports(d *reportDiffer, before, after CPUReport) {
+	d.text("cpu", "", "model", before.Model, after.Model, DiffSeverityWarning)
+	d.ints("cpu", "", "logical_cpus", before.LogicalCPUs, after.LogicalCPUs, DiffSeverityCritical)
+	d.ints("cpu", "", "physical_cores", before.PhysicalCores, after.PhysicalCores, DiffSeverityCritical)
+	d.ints("cpu", "", "sockets", before.Sockets, after.Sockets, DiffSeverityWarning)
+	d.ints("cpu", "", "threads_per_core", before.ThreadsPerCore, after.ThreadsPerCore, DiffSeverityInfo)
+	d.text("cpu", "", "cpuset", before.CPUSet, after.CPUSet, DiffSeverityInfo)
+	d.flag("cpu", "", "aes_ni", before.AESNI, after.AESNI, DiffSeverityWarning)
+	d.flag("cpu", "", "virtualization_supported", before.VirtualizationSupported, after.VirtualizationSupported, DiffSeverityWarning)
+}
+
+// diffCgroupReports treats a missing limit as unlimited, so gaining a limit
+// is a regression just like lowering one.
+func diffCgroupReports(d *reportDiffer, before, after CgroupReport) {
+	d.text("cgroup", "", "version", before.Version, after.Version, DiffSeverityInfo)
+	d.text("cgroup", "", "cpuset", before.CPUSet, after.CPUSet, DiffSeverityWarning)
+	beforeCores, afterCores := formatOptionalFloat(before.CPUQuotaCores), formatOptionalFloat(after.CPUQuotaCores)
+	if beforeCores != afterCores {
+		d.add("cgroup", "", "cpu_quota_cores", DiffChanged, limitSeverity(floatLimit(before.CPUQuotaCores), floatLimit(after.CPUQuotaCores)), unlimitedIfEmpty(beforeCores), unlimitedIfEmpty(afterCores))
+	}
+	for _, limit := range []struct {
+		field         string
+		before, after *int64
+		bytes         bool
+	}{
+		{"memory_limit_bytes", before.MemoryLimitBytes, after.MemoryLimitBytes, true},
+		{"memory_high_bytes", before.MemoryHighBytes, after.MemoryHighBytes, true},
+		{"memory_swap_limit_bytes", before.MemorySwapLimitBytes, after.MemorySwapLimitBytes, true},
+		{"pids_limit", before.PidsLimit, after.PidsLimit, false},
+	} {
+		if optionalInt64Equal(limit.before, limit.after) {
+			continue
+		}
+		format := formatOptionalInt64
+		if limit.bytes {
+			format = formatOptionalBytes
+		}
+		d.add("cgroup", "", limit.field, DiffChanged, limitSeverity(intLimit(limit.before), intLimit(limit.after)), unlimitedIfEmpty(format(limit.before)), unlimitedIfEmpty(format(limit.after)))
+	}
+}
+
+func diffPCIReports(d *reportDiffer, before, after PCIReport) {
+	key := func(device PCIDeviceReport) string {
+		return device.Address + " " + device.VendorID + ":" + device.DeviceID
+	}
+	describe := func(device PCIDeviceReport) string {
+		return joinReportValues(" ", device.VendorID+":"+device.DeviceID, device.ClassID, device.Driver)
+	}
+	beforeDevices := make(map[string]PCIDeviceReport, len(before.Devices))
+	for _, device := range before.Devices {
+		beforeDevices[key(device)] = device
+	}
+	afterDevices := make(map[string]PCIDeviceReport, len(after.Devices))
+	for _, device := range after.Devices {
+		afterDevices[key(device)] = device
+	}
+	for _, name := range sortedDiffKeys(beforeDevices, afterDevices) {
+		beforeDevice, inBefore := beforeDevices[name]
+		afterDevice, inAfter := afterDevices[name]
+		switch {
+		case !inAfter:
+			d.add("pci", beforeDevice.Address, "", DiffRemoved, DiffSeverityWarning, describe(beforeDevice), "")
+		case !inBefore:
+			d.add("pci", afterDevice.Address, "", DiffAdded, DiffSeverityInfo, "", describe(afterDevice))
+		default:
+			d.text("pci", afterDevice.Address, "driver", beforeDevice.Driver, afterDevice.Driver, DiffSeverityWarning)
+		}
+	}
+}
+
+func diffDiskReports(d *reportDiffer, before, after []DiskReport) {
+	beforeDisks := make(map[string]DiskReport, len(before))
+	for _, disk := range before {
+		beforeDisks[disk.Name] = disk
+	}
+	afterDisks := make(map[string]DiskReport, len(after))
+	for _, disk := range after {
+		afterDisks[disk.Name] = disk
+	}
+	describe := func(disk DiskReport) string {
+		return joinReportValues(" ", disk.Model, formatOptionalBytes(disk.SizeBytes))
+	}
+	for _, name := range sortedDiffKeys(beforeDisks, afterDisks) {
+		beforeDisk, inBefore := beforeDisks[name]
+		afterDisk, inAfter := afterDisks[name]
+		switch {
+		case !inAfter:
+			d.add("disks", name, "", DiffRemoved, DiffSeverityCritical, describe(beforeDisk), "")
+			continue
+		case !inBefore:
+			d.add("disks", name, "", DiffAdded, DiffSeverityInfo, "", describe(afterDisk))
+			continue
+		}
+		d.text("disks", name, "model", beforeDisk.Model, afterDisk.Model, DiffSeverityWarning)
+		d.text("disks", name, "firmware", beforeDisk.Firmware, afterDisk.Firmware, DiffSeverityInfo)
+		d.bytes("disks", name, "size_bytes", beforeDisk.SizeBytes, afterDisk.SizeBytes, DiffSeverityCritical)
+		d.text("disks", name, "controller_state", beforeDisk.ControllerState, afterDisk.ControllerState, DiffSeverityWarning)
+		if beforeDisk.Health.Availability == AvailabilityAvailable && afterDisk.Health.Availability == AvailabilityAvailable {
+			diffDiskHealth(d, name, beforeDisk.Health, afterDisk.Health)
+		} else if beforeDisk.Health.Availability != afterDisk.Health.Availability {
+			d.add("disks", name, "health.availability", DiffChanged, DiffSeverityInfo, string(beforeDisk.Health.Availability), string(afterDisk.Health.Availability))
+		}
+		diffDiskVerdicts(d, name, beforeDisk.Verdict, afterDisk.Verdict)
+	}
+}
+
+// diskHealthStatusFailing lists the health verdicts that count as a
+// regression when a disk moves into them.
+var diskHealthStatusFailing = map[string]bool{"failed": true, "warning": true}
+
+func diffDiskHealth(d *reportDiffer, name string, before, after DiskHealthReport) {
+	if before.Status != after.Status && before.Status != "" && after.Status != "" {
+		severity := DiffSeverityInfo
+		if diskHealthStatusFailing[after.Status] {
+			severity = DiffSeverityCritical
+		}
+		d.add("disks", name, "health.status", DiffChanged, severity, before.Status, after.Status)
+	}
+	if before.CriticalWarning != nil && after.CriticalWarning != nil && *before.CriticalWarning != *after.CriticalWarning {
+		severity := DiffSeverityInfo
+		if *after.CriticalWarning&^*before.CriticalWarning != 0 {
+			severity = DiffSeverityCritical
+		}
+		d.add("disks", name, "health.critical_warning", DiffChanged, severity, fmt.Sprintf("0x%02x", *before.CriticalWarning), fmt.Sprintf("0x%02x", *after.CriticalWarning))
+	}
+	if before.AvailableSparePct != nil && after.AvailableSparePct != nil && *after.AvailableSparePct < *before.AvailableSparePct {
+		d.add("disks", name, "health.available_spare_percent", DiffChanged, DiffSeverityWarning, strconv.Itoa(int(*before.AvailableSparePct)), strconv.Itoa(int(*after.AvailableSparePct)))
+	}
+	// Error counters only ever grow; a drop means the disk was replaced or
+	// the counter reset, which is not a regression.
+	for _, counter := range []struct {
+		field         string
+		before, after *big.Int
+		severity      string
+	}{
+		{"health.media_errors", healthCounter(before.MediaErrors, before.MediaErrorsDecimal), healthCounter(after.MediaErrors, after.MediaErrorsDecimal), DiffSeverityCritical},
+		{"health.reallocated_sectors", healthCounter(before.ReallocatedSectors, ""), healthCounter(after.ReallocatedSectors, ""), DiffSeverityCritical},
+		{"health.pending_sectors", healthCounter(before.PendingSectors, ""), healthCounter(after.PendingSectors, ""), DiffSeverityCritical},
+		{"health.offline_uncorrectable", healthCounter(before.OfflineUncorrectable, ""), healthCounter(after.OfflineUncorrectable, ""), DiffSeverityCritical},
+		{"health.unsafe_shutdowns", healthCounter(before.UnsafeShutdowns, before.UnsafeShutdownsDecimal), healthCounter(after.UnsafeShutdowns, after.UnsafeShutdownsDecimal), DiffSeverityWarning},
+		{"health.percentage_used", healthCounter(uint8Counter(before.PercentageUsed), ""), healthCounter(uint8Counter(after.PercentageUsed), ""), DiffSeverityInfo},
+	} {
+		if counter.before == nil || counter.after == nil || counter.after.Cmp(counter.before) == 0 {
+			continue
+		}
+		severity := counter.severity
+		if counter.after.Cmp(counter.before) < 0 {
+			severity = DiffSeverityInfo
+		}
+		d.add("disks", name, counter.field, DiffChanged, severity, counter.before.String(), counter.after.String())
+	}
+}
+
+// diffDiskVerdicts ignores verdicts that could not be judged in either report.
+func diffDiskVerdicts(d *reportDiffer, name string, before, after DiskVerdict) {
+	if before.Status == after.Status || before.Status == "" || before.Status == DiskVerdictUnknown || after.Status == "" || after.Status == DiskVerdictUnknown {
+		return
+	}
+	severity := DiffSeverityInfo
+	switch after.Status {
+	case DiskVerdictFailing:
+		severity = DiffSeverityCritical
+	case DiskVerdictWarning:
+		if before.Status == DiskVerdictOK {
+			severity = DiffSeverityWarning
+		}
+	}
+	d.add("disks", name, "verdict", DiffChanged, severity, before.Status, after.Status)
+}
+
+func diffInterfaceReports(d *reportDiffer, before, after NetworkInterfacesReport) {
+	beforeInterfaces := make(map[string]NetworkInterfaceReport, len(before.Interfaces))
+	for _, iface := range before.Interfaces {
+		beforeInterfaces[iface.Name] = iface
+	}
+	afterInterfaces := make(map[string]NetworkInterfaceReport, len(after.Interfaces))
+	for _, iface := range after.Interfaces {
+		afterInterfaces[iface.Name] = iface
+	}
+	for _, name := range sortedDiffKeys(beforeInterfaces, afterInterfaces) {
+		beforeInterface, inBefore := beforeInterfaces[name]
+		afterInterface, inAfter := afterInterfaces[name]
+		switch {
+		case !inAfter:
+			d.add("interfaces", name, "", DiffRemoved, DiffSeverityInfo, beforeInterface.Kind, "")
+		case !inBefore:
+			d.add("interfaces", name, "", DiffAdded, DiffSeverityInfo, "", afterInterface.Kind)
+		default:
+			d.ints("interfaces", name, "mtu", beforeInterface.MTU, afterInterface.MTU, DiffSeverityInfo)
+			d.text("interfaces", name, "driver", beforeInterface.Driver, afterInterface.Driver, DiffSeverityInfo)
+		}
+	}
+}
+
+func diffRAIDReports(d *reportDiffer, before, after RAIDReport) {
+	beforeArrays := make(map[string]RAIDArrayReport, len(before.Arrays))
+	for _, array := range before.Arrays {
+		beforeArrays[array.Name] = array
+	}
+	afterArrays := make(map[string]RAIDArrayReport, len(after.Arrays))
+	for _, array := range after.Arrays {
+		afterArrays[array.Name] = array
+	}
+	for _, name := range sortedDiffKeys(beforeArrays, afterArrays) {
+		beforeArray, inBefore := beforeArrays[name]
+		afterArray, inAfter := afterArrays[name]
+		switch {
+		case !inAfter:
+			d.add("raid", name, "", DiffRemoved, DiffSeverityWarning, beforeArray.Level, "")
+		case !inBefore:
+			severity := DiffSeverityInfo
+			if afterArray.Degraded {
+				severity = DiffSeverityCritical
+			}
+			d.add("raid", name, "", DiffAdded, severity, "", joinReportValues(" ", afterArray.Level, afterArray.State))
+		default:
+			if beforeArray.Degraded != afterArray.Degraded {
+				severity := DiffSeverityInfo
+				if afterArray.Degraded {
+					severity = DiffSeverityCritical
+				}
+				d.add("raid", name, "degraded", DiffChanged, severity, strconv.FormatBool(beforeArray.Degraded), strconv.FormatBool(afterArray.Degraded))
+			}
+			d.text("raid", name, "state", beforeArray.State, afterArray.State, DiffSeverityInfo)
+			d.count("raid", name, "members", len(beforeArray.Members), len(afterArray.Members), DiffSeverityCritical)
+		}
+	}
+}
+
+type reportDiffer struct {
+	changes []ReportChange
+}
+
+func (d *reportDiffer) result() *ReportDiff {
+	diff := &ReportDiff{Changes: d.changes}
+	if diff.Changes == nil {
+		diff.Changes = []ReportChange{}
+	}
+	for _, change := range diff.Changes {
+		if change.Severity == DiffSeverityCritical {
+			diff.Regressions++
+		}
+	}
+	return diff
+}
+
+func (d *reportDiffer) add(section, item, field, kind, severity, before, after string) {
+	d.changes = append(d.changes, ReportChange{Section: section, Item: item, Field: field, Kind: kind, Severity: severity, Before: before, After: after})
+}
+
+// sections reports whether both sections are available and records an
+// availability change otherwise.
+func (d *reportDiffer) sections(name string, before, after ReportSection) bool {
+	if before.Availability == AvailabilityAvailable && after.Availability == AvailabilityAvailable {
+		return true
+	}
+	if before.Availability != after.Availability {
+		d.add(name, "", "availability", DiffChanged, DiffSeverityInfo, string(before.Availability), string(after.Availability))
+	}
+	return false
+}
+
+func (d *reportDiffer) text(section, item, field, before, after, severity string) {
+	before, after = strings.TrimSpace(before), strings.TrimSpace(after)
+	if before != after && before != "" && after != "" {
+		d.add(section, item, field, DiffChanged, severity, before, after)
+	}
+}
+
+// int64s records a change; severity applies when the value decreased and
+// increases are informational.
+func (d *reportDiffer) int64s(section, item, field string, before, after *int64, severity string) {
+	if before == nil || after == nil || *before == *after {
+		return
+	}
+	d.add(section, item, field, DiffChanged, decreaseSeverity(*after < *before, severity), strconv.FormatInt(*before, 10), strconv.FormatInt(*after, 10))
+}
+
+func (d *reportDiffer) bytes(section, item, field string, before, after *int64, severity string) {
+	if before == nil || after == nil || *before == *after {
+		return
+	}
+	d.add(section, item, field, DiffChanged, decreaseSeverity(*after < *before, severity), formatCompactBytes(*before), formatCompactBytes(*after))
+}
+
+func (d *reportDiffer) ints(section, item, field string, before, after *int, severity string) {
+	if before != nil && after != nil {
+		d.count(section, item, field, *before, *after, severity)
+	}
+}
+
+func (d *reportDiffer) count(section, item, field string, before, after int, severity string) {
+	if before != after {
+		d.add(section, item, field, DiffChanged, decreaseSeverity(after < before, severity), strconv.Itoa(before), strconv.Itoa(after))
+	}
+}
+
+// flag treats losing a capability as the regression.
+func (d *reportDiffer) flag(section, item, field string, before, after *bool, severity string) {
+	if before == nil || after == nil || *before == *after {
+		return
+	}
+	d.add(section, item, field, DiffChanged, decreaseSeverity(!*after, severity), strconv.FormatBool(*before), strconv.FormatBool(*after))
+}
+
+func decreaseSeverity(decreased bool, severity string) string {
+	if decreased {
+		return severity
+	}
+	return DiffSeverityInfo
+}
+
+// limitSeverity compares two limits where nil means unlimited.
+func limitSeverity(before, after *big.Float) string {
+	if after != nil && (before == nil || after.Cmp(before) < 0) {
+		return DiffSeverityCritical
+	}
+	return DiffSeverityInfo
+}
+
+func floatLimit(value *float64) *big.Float {
+	if value == nil {
+		return nil
+	}
+	return big.NewFloat(*value)
+}
+
+func intLimit(value *int64) *big.Float {
+	if value == nil {
+		return nil
+	}
+	return new(big.Float).SetInt64(*value)
+}
+
+func healthCounter(value *uint64, decimal string) *big.Int {
+	if decimal != "" {
+		if parsed, ok := new(big.Int).SetString(decimal, 10); ok {
+			return parsed
+		}
+	}
+	if value == nil {
+		return nil
+	}
+	return new(big.Int).SetUint64(*value)
+}
+
+func uint8Counter(value *uint8) *uint64 {
+	if value == nil {
+		return nil
+	}
+	return uint64Ptr(uint64(*value))
+}
+
+func optionalInt64Equal(before, after *int64) bool {
+	return (before == nil && after == nil) || (before != nil && after != nil && *before == *after)
+}
+
+func formatOptionalInt64(value *int64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatInt(*value, 10)
+}
+
+func formatOptionalBytes(value *int64) string {
+	if value == nil {
+		return ""
+	}
+	return formatCompactBytes(*value)
+}
+
+func formatOptionalFloat(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', 2, 64)
+}
+
+func unlimitedIfEmpty(value string) string {
+	if value == "" {
+		return "unlimited"
+	}
+	return value
+}
+
+func sortedDiffKeys[T any](before, after map[string]T) []string {
+	keys := make([]string, 0, len(before)+len(after))
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RenderReportDiffText prints one line per change followed by a summary row.
+func RenderReportDiffText(diff *ReportDiff, language string) string {
+	zh := strings.EqualFold(strings.TrimSpace(language), "zh")
+	if diff == nil || len(diff.Changes) == 0 {
+		if zh {
+			return "两份报告没有差异\n"
+		}
+		return "No differences\n"
+	}
+	severityLabels := map[string]string{DiffSeverityInfo: "info", DiffSeverityWarning: "warning", DiffSeverityCritical: "critical"}
+	kindLabels := map[string]string{DiffAdded: "added", DiffRemoved: "removed"}
+	if zh {
+		severityLabels = map[string]string{DiffSeverityInfo: "信息", DiffSeverityWarning: "警告", DiffSeverityCritical: "严重"}
+		kindLabels = map[string]string{DiffAdded: "新增", DiffRemoved: "移除"}
+	}
+	var builder strings.Builder
+	for _, change := range diff.Changes {
+		path := joinReportValues("/", change.Section, change.Item)
+		if change.Field != "" {
+			path += " " + change.Field
+		}
+		var value string
+		switch change.Kind {
+		case DiffAdded:
+			value = joinReportValues(" ", kindLabels[change.Kind], change.After)
+		case DiffRemoved:
+			value = joinReportValues(" ", kindLabels[change.Kind], change.Before)
+		default:
+			value = change.Before + " -> " + change.After
+		}
+		fmt.Fprintf(&builder, " [%s] %s: %s\n", severityLabels[change.Severity], path, value)
+	}
+	if zh {
+		builder.WriteString(formatReportRow("差异数量", fmt.Sprintf("%d (严重 %d)", len(diff.Changes), diff.Regressions)))
+	} else {
+		builder.WriteString(formatReportRow("Changes", fmt.Sprintf("%d (critical %d)", len(diff.Changes), diff.Regressions)))
+	}
+	return builder.String()
+}
@@ -0,0 +1,157 @@
+package system
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func diffTestReport() *SystemReport {
+	available := ReportSection{Availability: AvailabilityAvailable}
+	logical, cores := 8, 4
+	return &SystemReport{
+		SchemaVersion: "goecs.system/v1",
+		Availability:  AvailabilityAvailable,
+		CPU:           CPUReport{ReportSection: available, Model: "AMD EPYC 7763", LogicalCPUs: &logical, PhysicalCores: &cores},
+		Memory:        MemoryReport{ReportSection: available, TotalBytes: int64Ptr(16 << 30)},
+		Cgroup:        CgroupReport{ReportSection: available, Version: "v2", PidsLimit: int64Ptr(4096)},
+		PCI: PCIReport{ReportSection: available, Devices: []PCIDeviceReport{
+			{Address: "0000:00:03.0", VendorID: "1af4", DeviceID: "1000", Driver: "virtio-pci"},
+		}},
+		Disks: []DiskReport{
+			{ReportSection: available, Name: "nvme0n1", Model: "Samsung SSD", SizeBytes: int64Ptr(1 << 40), Health: DiskHealthReport{
+				ReportSection: available, Status: "passed", CriticalWarning: uint8Ptr(0),
+				MediaErrors: uint64Ptr(0), MediaErrorsDecimal: "0", UnsafeShutdowns: uint64Ptr(3), UnsafeShutdownsDecimal: "3",
+			}},
+			{ReportSection: available, Name: "sdb", Model: "HDD", Health: DiskHealthReport{ReportSection: available, Status: "passed", ReallocatedSectors: uint64Ptr(0)}},
+		},
+		RAID: RAIDReport{ReportSection: available, Arrays: []RAIDArrayReport{{Name: "md0", Level: "raid1", Members: []string{"sda1", "sdb1"}, State: "clean"}}},
+	}
+}
+
+func uint8Ptr(value uint8) *uint8 { return &value }
+
+func TestDiffSystemReportsIdentical(t *testing.T) {
+	diff := DiffSystemReports(diffTestReport(), diffTestReport())
+	if len(diff.Changes) != 0 || diff.Regressed() {
+		t.Fatalf("expected no changes, got %+v", diff)
+	}
+	if text := RenderReportDiffText(diff, "en"); text != "No differences\n" {
+		t.Fatalf("unexpected text: %q", text)
+	}
+}
+
+func TestDiffSystemReportsRegressions(t *testing.T) {
+	before, after := diffTestReport(), diffTestReport()
+	logical := 4
+	after.CPU.LogicalCPUs = &logical
+	after.Cgroup.MemoryLimitBytes = int64Ptr(2 << 30)
+	after.Cgroup.PidsLimit = int64Ptr(8192)
+	after.PCI.Devices = append(after.PCI.Devices, PCIDeviceReport{Address: "0000:00:04.0", VendorID: "10de", DeviceID: "2204"})
+	after.Disks[0].Health.MediaErrors, after.Disks[0].Health.MediaErrorsDecimal = uint64Ptr(12), "12"
+	after.Disks[0].Health.UnsafeShutdowns, after.Disks[0].Health.UnsafeShutdownsDecimal = uint64Ptr(4), "4"
+	after.Disks = after.Disks[:1]
+	after.RAID.Arrays[0].Degraded, after.RAID.Arrays[0].State = true, "clean, degraded"
+
+	diff := DiffSystemReports(before, after)
+	got := make(map[string]ReportChange)
+	for _, change := range diff.Changes {
+		got[strings.TrimSpace(change.Section+" "+change.Item+" "+change.Field)] = change
+	}
+	for key, severity := range map[string]string{
+		"cpu  logical_cpus":                     DiffSeverityCritical,
+		"cgroup  memory_limit_bytes":            DiffSeverityCritical,
+		"cgroup  pids_limit":                    DiffSeverityInfo,
+		"pci 0000:00:04.0":                      DiffSeverityInfo,
+		"disks nvme0n1 health.media_errors":     DiffSeverityCritical,
+		"disks nvme0n1 health.unsafe_shutdowns": DiffSeverityWarning,
+		"disks sdb":                             DiffSeverityCritical,
+		"raid md0 degraded":                     DiffSeverityCritical,
+		"raid md0 state":                        DiffSeverityInfo,
+	} {
+		change, ok := got[key]
+		if !ok || change.Severity != severity {
+			t.Fatalf("change %q = %+v (present %v), want severity %s; all: %+v", key, change, ok, severity, diff.Changes)
+		}
+	}
+	if got["cgroup  memory_limit_bytes"].Before != "unlimited" || got["cgroup  memory_limit_bytes"].After != "2 GiB" {
+		t.Fatalf("unexpected cgroup change: %+v", got["cgroup  memory_limit_bytes"])
+	}
+	if len(diff.Changes) != 9 || diff.Regressions != 5 || !diff.Regressed() {
+		t.Fatalf("unexpected diff: %d changes, %d regressions", len(diff.Changes), diff.Regressions)
+	}
+
+	text := RenderReportDiffText(diff, "en")
+	for _, want := range []string{"[critical] disks/nvme0n1 health.media_errors: 0 -> 12", "[critical] disks/sdb: removed HDD", "[info] pci/0000:00:04.0: added 10de:2204", "Changes"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("text missing %q:\n%s", want, text)
+		}
+	}
+	if zh := RenderReportDiffText(diff, "zh"); !strings.Contains(zh, "[严重] raid/md0 degraded: false -> true") || !strings.Contains(zh, "9 (严重 5)") {
+		t.Fatalf("unexpected zh text:\n%s", zh)
+	}
+}
+
+func TestDiffSystemReportsSkipsUnavailableSections(t *testing.T) {
+	before, after := diffTestReport(), diffTestReport()
+	after.Memory = MemoryReport{ReportSection: ReportSection{Availability: AvailabilityPermissionDenied}}
+	after.Disks[0].Health = DiskHealthReport{ReportSection: ReportSection{Availability: AvailabilityPermissionDenied}}
+	diff := DiffSystemReports(before, after)
+	if diff.Regressed() || len(diff.Changes) != 2 {
+		t.Fatalf("unexpected diff: %+v", diff.Changes)
+	}
+	for _, change := range diff.Changes {
+		if change.After != string(AvailabilityPermissionDenied) || change.Severity != DiffSeverityInfo {
+			t.Fatalf("unexpected change: %+v", change)
+		}
+	}
+}
+
+func TestDiffSystemReportsSkipsTimedOutDisks(t *testing.T) {
+	before, after := diffTestReport(), diffTestReport()
+	after.Disks = nil
+	after.SectionStatus = map[string]ReportSection{"disks": {Availability: AvailabilityCanceled, Error: "context deadline exceeded"}}
+	diff := DiffSystemReports(before, after)
+	if diff.Regressed() || len(diff.Changes) != 1 || diff.Changes[0].Section != "disks" || diff.Changes[0].After != string(AvailabilityCanceled) {
+		t.Fatalf("unexpected diff: %+v", diff.Changes)
+	}
+}
+
+func TestLoadSystemReport(t *testing.T) {
+	dir := t.TempDir()
+	content, err := json.Marshal(struct {
+		*SystemReport
+		PublicNetwork map[string]string `json:"public_network"`
+	}{diffTestReport(), map[string]string{"stack_type": "IPv4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "report.json")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	report, err := LoadSystemReport(path)
+	if err != nil || report.CPU.Model != "AMD EPYC 7763" || len(report.Disks) != 2 {
+		t.Fatalf("LoadSystemReport = %+v, %v", report, err)
+	}
+	other := filepath.Join(dir, "other.json")
+	if err := os.WriteFile(other, []byte(`{"ip":"192.0.2.1"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSystemReport(other); err == nil {
+		t.Fatal("expected a document without schema_version to be rejected")
+	}
+}
+
+func TestDiffSystemReportsDiskVerdict(t *testing.T) {
+	before, after := diffTestReport(), diffTestReport()
+	before.Disks[0].Verdict = DiskVerdict{Status: DiskVerdictOK}
+	after.Disks[0].Verdict = DiskVerdict{Status: DiskVerdictFailing}
+	after.Disks[1].Verdict = DiskVerdict{Status: DiskVerdictWarning}
+	diff := DiffSystemReports(before, after)
+	if len(diff.Changes) != 1 || diff.Changes[0].Field != "verdict" || diff.Changes[0].Severity != DiffSeverityCritical || diff.Changes[0].After != DiskVerdictFailing {
+		t.Fatalf("unexpected verdict diff: %+v", diff.Changes)
+	}
+}
@@ -0,0 +1,149 @@
+package system
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ReportCollector is an additional SystemReport section supplied by the
+// caller. Its result is stored in SystemReport.Extensions under Name.
+// Collect receives the same ReportFileReader as the built-in sections, so
+// extensions are fixture-testable in the same way.
+type ReportCollector struct {
+	Name string
+	// OperatingSystems lists the runtime.GOOS values the collector supports.
+	// An empty list means every operating system.
+	OperatingSystems []string
+	Collect          func(files ReportFileReader) (any, error)
+}
+
+// ExtensionReport wraps the value returned by a registered ReportCollector.
+type ExtensionReport struct {
+	ReportSection
+	Data any `json:"data,omitempty"`
+}
+
+// ReportSectionFilter selects report sections by name. An empty Enable list
+// selects every section; a name in Disable is always skipped.
+type ReportSectionFilter struct {
+	Enable  []string
+	Disable []string
+}
+
+var reportSectionNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+var builtinReportSectionNames = []string{
+	"cpu", "memory", "cgroup", "cpu_contention", "virtualization", "gpus", "pci", "disks",
+	"network", "interfaces", "firmware", "memory_topology", "raid",
+}
+
+var reportRegistry = struct {
+	sync.RWMutex
+	collectors map[string]ReportCollector
+}{collectors: make(map[string]ReportCollector)}
+
+// RegisterReportCollector adds an extension section to every subsequent
+// structured report. Names must be lower-case identifiers and must not clash
+// with a built-in or an already registered section.
+func RegisterReportCollector(collector ReportCollector) error {
+	collector.Name = strings.TrimSpace(collector.Name)
+	if !reportSectionNamePattern.MatchString(collector.Name) {
+		return fmt.Errorf("invalid report section name %q", collector.Name)
+	}
+	if collector.Collect == nil {
+		return fmt.Errorf("report section %q has no collect function", collector.Name)
+	}
+	if containsString(builtinReportSectionNames, collector.Name) {
+		return fmt.Errorf("report section %q is built in", collector.Name)
+	}
+	reportRegistry.Lock()
+	defer reportRegistry.Unlock()
+	if _, exists := reportRegistry.collectors[collector.Name]; exists {
+		return fmt.Errorf("report section %q is already registered", collector.Name)
+	}
+	collector.OperatingSystems = append([]string(nil), collector.OperatingSystems...)
+	reportRegistry.collectors[collector.Name] = collector
+	return nil
+}
+
+// UnregisterReportCollector removes a previously registered extension.
+func UnregisterReportCollector(name string) {
+	reportRegistry.Lock()
+	defer reportRegistry.Unlock()
+	delete(reportRegistry.collectors, name)
+}
+
+// ReportSectionNames lists the built-in sections followed by the registered
+// extensions in name order.
+func ReportSectionNames() []string {
+	names := append([]string(nil), builtinReportSectionNames...)
+	return append(names, registeredReportCollectorNames()...)
+}
+
+func registeredReportCollectorNames() []string {
+	reportRegistry.RLock()
+	defer reportRegistry.RUnlock()
+	names := make([]string, 0, len(reportRegistry.collectors))
+	for name := range reportRegistry.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func registeredReportCollectors() []ReportCollector {
+	reportRegistry.RLock()
+	defer reportRegistry.RUnlock()
+	collectors := make([]ReportCollector, 0, len(reportRegistry.collectors))
+	for _, collector := range reportRegistry.collectors {
+		collectors = append(collectors, collector)
+	}
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].Name < collectors[j].Name })
+	return collectors
+}
+
+// Validate reports names that are neither built in nor registered.
+func (f ReportSectionFilter) Validate() error {
+	known := ReportSectionNames()
+	var unknown []string
+	for _, name := range append(append([]string(nil), f.Enable...), f.Disable...) {
+		if !containsString(known, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown report sections: %s (known: %s)", strings.Join(unknown, ","), strings.Join(known, ","))
+	}
+	return nil
+}
+
+// Allows reports whether the section called name should be collected.
+func (f ReportSectionFilter) Allows(name string) bool {
+	if containsString(f.Disable, name) {
+		return false
+	}
+	return len(f.Enable) == 0 || containsString(f.Enable, name)
+}
+
+// ParseReportSectionList splits a comma separated list of section names as
+// accepted by the CLI.
+func ParseReportSectionList(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" && !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func collectorSupports(collector ReportCollector, operatingSystem string) bool {
+	return len(collector.OperatingSystems) == 0 || containsString(collector.OperatingSystems, operatingSystem)
+}
+
+func disabledReportSection() ReportSection {
+	return ReportSection{Availability: AvailabilityDisabled}
+}
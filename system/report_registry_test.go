@@ -0,0 +1,101 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegisterReportCollectorAddsExtensionSection(t *testing.T) {
+	if err := RegisterReportCollector(ReportCollector{
+		Name:             "fixture_license",
+		OperatingSystems: []string{"linux"},
+		Collect: func(files ReportFileReader) (any, error) {
+			return map[string]string{"key": strings.TrimSpace(readString(files, "/etc/fixture-license"))}, nil
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterReportCollector(ReportCollector{
+		Name:    "fixture_failing",
+		Collect: func(ReportFileReader) (any, error) { return nil, errors.New("probe failed") },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		UnregisterReportCollector("fixture_license")
+		UnregisterReportCollector("fixture_failing")
+	})
+	fixture := reportFixture{files: map[string]string{
+		"/proc/cpuinfo":        "processor : 0\nmodel name : Fixture CPU\n",
+		"/etc/fixture-license": "ABC-123\n",
+	}}
+	report := CollectSystemReportFrom(context.Background(), fixture, "linux")
+	license, ok := report.Extensions["fixture_license"]
+	if !ok || license.Availability != AvailabilityAvailable || license.DurationMS == nil {
+		t.Fatalf("extension section missing: %+v", report.Extensions)
+	}
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(encoded), `"extensions":{`) || !strings.Contains(string(encoded), `"key":"ABC-123"`) {
+		t.Fatalf("extension data missing from JSON: %s", encoded)
+	}
+	if failing := report.Extensions["fixture_failing"]; failing.Availability != AvailabilityError || failing.Error != "probe failed" {
+		t.Fatalf("failing extension = %+v", failing)
+	}
+	unsupported := CollectSystemReportFrom(context.Background(), fixture, "windows")
+	if unsupported.Extensions["fixture_license"].Availability != AvailabilityUnsupported {
+		t.Fatalf("OS restriction ignored: %+v", unsupported.Extensions)
+	}
+}
+
+func TestRegisterReportCollectorRejectsInvalidNames(t *testing.T) {
+	collect := func(ReportFileReader) (any, error) { return nil, nil }
+	for _, collector := range []ReportCollector{
+		{Name: "", Collect: collect},
+		{Name: "Bad Name", Collect: collect},
+		{Name: "cpu", Collect: collect},
+		{Name: "no_function"},
+	} {
+		if err := RegisterReportCollector(collector); err == nil {
+			t.Fatalf("collector %q was accepted", collector.Name)
+		}
+	}
+	if err := RegisterReportCollector(ReportCollector{Name: "fixture_duplicate", Collect: collect}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { UnregisterReportCollector("fixture_duplicate") })
+	if err := RegisterReportCollector(ReportCollector{Name: "fixture_duplicate", Collect: collect}); err == nil {
+		t.Fatal("duplicate collector was accepted")
+	}
+}
+
+func TestReportSectionFilterSelectsSections(t *testing.T) {
+	fixture := reportFixture{files: map[string]string{
+		"/proc/cpuinfo":                "processor : 0\nmodel name : Fixture CPU\n",
+		"/proc/meminfo":                "MemTotal: 1024 kB\n",
+		"/sys/class/dmi/id/board_name": "Fixture Board\n",
+		"/sys/block/sda/size":          "2048\n",
+	}, globs: map[string][]string{"/sys/block/*": {"/sys/block/sda"}}}
+	report := CollectSystemReportFromWithFilter(context.Background(), fixture, "linux", ReportSectionFilter{Enable: []string{"cpu", "memory", "disks"}, Disable: []string{"memory"}})
+	if report.Availability != AvailabilityAvailable || report.CPU.Availability != AvailabilityAvailable || len(report.Disks) != 1 {
+		t.Fatalf("enabled sections missing: %+v", report)
+	}
+	if report.Memory.Availability != AvailabilityDisabled || report.Firmware.Availability != AvailabilityDisabled || report.RAID.Availability != AvailabilityDisabled {
+		t.Fatalf("filtered sections were collected: memory=%q firmware=%q raid=%q", report.Memory.Availability, report.Firmware.Availability, report.RAID.Availability)
+	}
+	onlyDisks := CollectSystemReportFromWithFilter(context.Background(), fixture, "linux", ReportSectionFilter{Enable: []string{"disks"}})
+	if onlyDisks.Availability != AvailabilityAvailable {
+		t.Fatalf("report without core sections = %q", onlyDisks.Availability)
+	}
+	if err := (ReportSectionFilter{Enable: []string{"cpu"}, Disable: []string{"nope"}}).Validate(); err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Fatalf("unknown section error = %v", err)
+	}
+	if got := ParseReportSectionList(" CPU, disks,,cpu "); len(got) != 2 || got[0] != "cpu" || got[1] != "disks" {
+		t.Fatalf("parsed section list = %v", got)
+	}
+}
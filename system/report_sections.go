@@ -0,0 +1,256 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Collectors only read files or issue ioctls and cannot observe a context, so
+// each one runs against its own budget. A collector that overruns is abandoned
+// and its late result is discarded; the other sections are unaffected.
+const defaultReportSectionTimeout = 5 * time.Second
+
+// withDefaults fills in the budgets left unset. Under a context deadline the
+// sections get nine tenths of the remaining time, so a hung section is
+// abandoned before the whole report is canceled.
+func (o ReportOptions) withDefaults(ctx context.Context) ReportOptions {
+	if o.SectionTimeout <= 0 {
+		o.SectionTimeout = defaultReportSectionTimeout
+		if deadline, ok := ctx.Deadline(); ok {
+			o.SectionTimeout = max(time.Until(deadline)*9/10, time.Millisecond)
+		}
+	}
+	if o.DiskHealthTimeout <= 0 {
+		o.DiskHealthTimeout = o.SectionTimeout * 4 / 5
+	}
+	if o.ContentionWindow <= 0 {
+		o.ContentionWindow = defaultCPUContentionWindow
+	}
+	if o.DiskThresholds == nil {
+		thresholds := DefaultDiskHealthThresholds()
+		o.DiskThresholds = &thresholds
+	}
+	return o
+}
+
+type reportSectionTask struct {
+	name string
+	run  func(ctx context.Context)
+}
+
+// builtinReportSections returns one task per SystemReport field. Every task
+// writes only its own field, so the tasks may run concurrently.
+func builtinReportSections(report *SystemReport, files ReportFileReader, collector diskHealthCollector, operatingSystem string, options ReportOptions) []reportSectionTask {
+	reportSectionTimeout := options.SectionTimeout
+	// The list sections share SectionStatus, so they serialize their writes.
+	var mu sync.Mutex
+	listSection := func(name string, elapsed time.Duration, err error) {
+		section := ReportSection{Availability: AvailabilityAvailable}
+		if operatingSystem != "linux" {
+			section.Availability = AvailabilityUnsupported
+		}
+		finishReportSection(&section, elapsed, err)
+		mu.Lock()
+		defer mu.Unlock()
+		report.SectionStatus[name] = section
+	}
+	return []reportSectionTask{
+		{name: "cpu", run: func(ctx context.Context) {
+			result, elapsed, err := runReportSection(ctx, reportSectionTimeout, func() CPUReport { return collectCPUReport(files, operatingSystem) })
+			finishReportSection(&result.ReportSection, elapsed, err)
+			report.CPU = result
+		}},
+		{name: "memory", run: func(ctx context.Context) {
+			result, elapsed, err := runReportSection(ctx, reportSectionTimeout, func() MemoryReport { return collectMemoryReport(files, operatingSystem) })
+			finishReportSection(&result.ReportSection, elapsed, err)
+			report.Memory = result
+		}},
+		{name: "cgroup", run: func(ctx context.Context) {
+			result, elapsed, err := runReportSection(ctx, reportSectionTimeout, func() CgroupReport { return collectCgroupReport(files, operatingSystem) })
+			finishReportSection(&result.ReportSection, elapsed, err)
+			report.Cgroup = result
+		}},
+		{name: "cpu_contention", run: func(ctx context.Context) {
+			window := options.ContentionWindow
+			result, elapsed, err := runReportSection(ctx, window+reportSectionTimeout, func() CPUContentionReport {
+				return collectCPUContentionReport(ctx, files, options.ContentionSecondSample, operatingSystem, window)
+			})
+			finishReportSection(&result.ReportSection, elapsed, err)
+			report.CPUContention = result
+		}},
+		{name: "virtualization", run: func(ctx context.Context) {
+			result, elapsed, err := runReportSection(ctx, reportSectionTimeout, func() VirtualizationReport { return collectVirtualizationReport(files, operatingSystem) })
+			finishReportSection(&result.ReportSection, elapsed, err)
+			report.Virtualization = result
+		}},
+		{name: "gpus", run: func(ctx context.Context) {
+			result, elapsed, err := runReportSection(ctx, reportSectionTimeout, func() []GPUReport { return collectGPUReports(files, operatingSystem) })
+			listSection("gpus", elapsed, err)
+			report.GPUs = result
+		}},
+		{name: "pci", run: func(ctx context.Context) {
+			result, elapsed, err := runReportSection(ctx, reportSectionTimeout, func() PCIReport { return collectPCIReport(files, operatingSystem) })
+			finishReportSection(&result.ReportSection, elapsed, err)
+			report.PCI = result
+		}},
+		{name: "disks", run: func(ctx context.Context) {
+			// Only the sysfs listing shares the section budget. The health reads
+			// run concurrently, each bounded by timedDiskHealthCollector, so hung
+			// disks cancel their own health data but the listed disks are kept.
+			result, elapsed, err := runReportSection(ctx, reportSectionTimeout, func() []DiskReport { return listDiskReports(files, operatingSystem) })
+			if err == nil {
+				started := time.Now()
+				collectDiskHealth(result, files, collector, *options.DiskThresholds)
+				elapsed += time.Since(started)
+			}
+			listSection("disks", elapsed, err)
+			report.Disks = result
+		}},
+		{name: "network", run: func(ctx context.Context) {
+			result, elapsed, err := runReportSection(ctx, reportSectionTimeout, func() NetworkTuningReport { return collectNetworkTuningReport(files, operatingSystem) })
+			finishReportSection(&result.ReportSection, elapsed, err)
+			report.Network = result
+		}},
+		{name: "interfaces", run: func(ctx context.Context) {
+			result, elapsed, err := runReportSection(ctx, reportSectionTimeout, func() NetworkInterfacesReport {
+				return collectNetworkInterfacesReport(files, operatingSystem, options.IncludeMACAddresses)
+			})
+			finishReportSection(&result.ReportSection, elapsed, err)
+			report.Interfaces = result
+		}},
+		{name: "firmware", run: func(ctx context.Context) {
+			result, elapsed, err := runReportSection(ctx, reportSectionTimeout, func() FirmwareReport { return collectFirmwareReport(files, operatingSystem) })
+			finishReportSection(&result.ReportSection, elapsed, err)
+			report.Firmware = result
+		}},
+		{name: "memory_topology", run: func(ctx context.Context) {
+			result, elapsed, err := runReportSection(ctx, reportSectionTimeout, func() MemoryTopologyReport { return collectMemoryTopologyReport(files, operatingSystem) })
+			finishReportSection(&result.ReportSection, elapsed, err)
+			report.MemoryTopology = result
+		}},
+		{name: "raid", run: func(ctx context.Context) {
+			result, elapsed, err := runReportSection(ctx, reportSectionTimeout, func() RAIDReport { return collectRAIDReport(files, operatingSystem) })
+			finishReportSection(&result.ReportSection, elapsed, err)
+			report.RAID = result
+		}},
+	}
+}
+
+// disableReportSections marks every section as disabled; the tasks selected
+// by the section filter overwrite their own field.
+func disableReportSections(report *SystemReport) {
+	report.SectionStatus = map[string]ReportSection{"gpus": disabledReportSection(), "disks": disabledReportSection()}
+	for _, section := range []*ReportSection{
+		&report.CPU.ReportSection, &report.Memory.ReportSection, &report.Cgroup.ReportSection, &report.CPUContention.ReportSection,
+		&report.Virtualization.ReportSection, &report.PCI.ReportSection, &report.Network.ReportSection,
+		&report.Interfaces.ReportSection, &report.Firmware.ReportSection, &report.MemoryTopology.ReportSection, &report.RAID.ReportSection,
+	} {
+		*section = disabledReportSection()
+	}
+}
+
+// extensionReportSections returns one task per registered ReportCollector.
+// Extension results share a map, so the tasks serialize their writes.
+func extensionReportSections(report *SystemReport, files ReportFileReader, operatingSystem string, options ReportOptions) []reportSectionTask {
+	collectors := registeredReportCollectors()
+	if len(collectors) == 0 {
+		return nil
+	}
+	var mu sync.Mutex
+	store := func(name string, extension ExtensionReport) {
+		mu.Lock()
+		defer mu.Unlock()
+		if report.Extensions == nil {
+			report.Extensions = make(map[string]ExtensionReport)
+		}
+		report.Extensions[name] = extension
+	}
+	tasks := make([]reportSectionTask, 0, len(collectors))
+	for _, collector := range collectors {
+		tasks = append(tasks, reportSectionTask{name: collector.Name, run: func(ctx context.Context) {
+			if !collectorSupports(collector, operatingSystem) {
+				store(collector.Name, ExtensionReport{ReportSection: ReportSection{Availability: AvailabilityUnsupported}})
+				return
+			}
+			result, elapsed, err := runReportSection(ctx, options.SectionTimeout, func() ExtensionReport {
+				data, collectErr := collector.Collect(files)
+				if collectErr != nil {
+					return ExtensionReport{ReportSection: ReportSection{Availability: AvailabilityError, Error: collectErr.Error()}, Data: data}
+				}
+				return ExtensionReport{ReportSection: ReportSection{Availability: AvailabilityAvailable}, Data: data}
+			})
+			finishReportSection(&result.ReportSection, elapsed, err)
+			store(collector.Name, result)
+		}})
+	}
+	return tasks
+}
+
+// runReportSection returns the zero value and the context error when collect
+// does not finish within timeout or before ctx is done.
+func runReportSection[T any](ctx context.Context, timeout time.Duration, collect func() T) (T, time.Duration, error) {
+	type outcome struct {
+		value T
+		err   error
+	}
+	started := time.Now()
+	sectionCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: fmt.Errorf("collector panic: %v", r)}
+			}
+		}()
+		done <- outcome{value: collect()}
+	}()
+	select {
+	case result := <-done:
+		return result.value, time.Since(started), result.err
+	case <-sectionCtx.Done():
+		var zero T
+		return zero, time.Since(started), sectionCtx.Err()
+	}
+}
+
+func finishReportSection(section *ReportSection, elapsed time.Duration, err error) {
+	section.DurationMS = int64Ptr(elapsed.Milliseconds())
+	if err == nil {
+		return
+	}
+	section.Error = err.Error()
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		section.Availability = AvailabilityCanceled
+	} else {
+		section.Availability = AvailabilityError
+	}
+}
+
+// timedDiskHealthCollector gives every disk its own budget so one hung SG_IO
+// or NVMe admin command only cancels the health data of that disk.
+type timedDiskHealthCollector struct {
+	ctx     context.Context
+	timeout time.Duration
+	inner   diskHealthCollector
+}
+
+func (c timedDiskHealthCollector) Collect(name string, files ReportFileReader) (DiskHealthReport, DiskTemperatureReport) {
+	type diskHealth struct {
+		health      DiskHealthReport
+		temperature DiskTemperatureReport
+	}
+	result, elapsed, err := runReportSection(c.ctx, c.timeout, func() diskHealth {
+		health, temperature := c.inner.Collect(name, files)
+		return diskHealth{health: health, temperature: temperature}
+	})
+	if err != nil {
+		result.health.Protocol = storageProtocol(name)
+		finishReportSection(&result.temperature.ReportSection, elapsed, err)
+	}
+	finishReportSection(&result.health.ReportSection, elapsed, err)
+	return result.health, result.temperature
+}
@@ -0,0 +1,441 @@
+package system
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/netip"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	reportSnapshotSchema   = "goecs.system-snapshot/v1"
+	reportSnapshotManifest = "manifest.json"
+	reportSnapshotFilesDir = "files"
+	redactedSnapshotValue  = "REDACTED"
+)
+
+type reportSnapshotManifestFile struct {
+	SchemaVersion   string              `json:"schema_version"`
+	OperatingSystem string              `json:"operating_system"`
+	Globs           map[string][]string `json:"globs"`
+}
+
+// RecordingReportFileReader remembers every file read and every pattern
+// globbed through it so the inputs of a report can be replayed later.
+// Identifying values such as serial numbers are scrubbed when recorded.
+type RecordingReportFileReader struct {
+	inner ReportFileReader
+	mu    sync.Mutex
+	files map[string][]byte
+	globs map[string][]string
+}
+
+func NewRecordingReportFileReader(inner ReportFileReader) *RecordingReportFileReader {
+	return &RecordingReportFileReader{inner: inner, files: make(map[string][]byte), globs: make(map[string][]string)}
+}
+
+func (r *RecordingReportFileReader) ReadFile(name string) ([]byte, error) {
+	content, err := r.inner.ReadFile(name)
+	if err == nil {
+		r.mu.Lock()
+		r.files[name] = scrubSnapshotFile(name, content)
+		r.mu.Unlock()
+	}
+	return content, err
+}
+
+func (r *RecordingReportFileReader) Glob(pattern string) ([]string, error) {
+	matches, err := r.inner.Glob(pattern)
+	if err == nil {
+		r.mu.Lock()
+		r.globs[pattern] = append([]string{}, matches...)
+		r.mu.Unlock()
+	}
+	return matches, err
+}
+
+// InterfaceAddresses passes the live interface addresses through. They are
+// not read from a file, so a snapshot does not hold them and its replay
+// attributes the fib_trie addresses instead.
+func (r *RecordingReportFileReader) InterfaceAddresses() (map[string][]netip.Prefix, error) {
+	if lister, ok := r.inner.(interfaceAddressLister); ok {
+		return lister.InterfaceAddresses()
+	}
+	return nil, errors.New("reader cannot list interface addresses")
+}
+
+func (r *RecordingReportFileReader) live() bool { return isLiveReportFileReader(r.inner) }
+
+// FileCount returns the number of distinct files recorded so far.
+func (r *RecordingReportFileReader) FileCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.files)
+}
+
+func (r *RecordingReportFileReader) snapshot() (map[string][]byte, map[string][]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	files := make(map[string][]byte, len(r.files))
+	for name, content := range r.files {
+		files[name] = content
+	}
+	globs := make(map[string][]string, len(r.globs))
+	for pattern, matches := range r.globs {
+		globs[pattern] = matches
+	}
+	return files, globs
+}
+
+// WriteSnapshot stores the recording as a directory, or as a gzip compressed
+// tar archive when target ends in .tar.gz or .tgz.
+func (r *RecordingReportFileReader) WriteSnapshot(target, operatingSystem string) error {
+	files, globs := r.snapshot()
+	manifest, err := json.MarshalIndent(reportSnapshotManifestFile{SchemaVersion: reportSnapshotSchema, OperatingSystem: operatingSystem, Globs: globs}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if isTarSnapshot(target) {
+		return writeTarSnapshot(target, manifest, files)
+	}
+	return writeDirSnapshot(target, manifest, files)
+}
+
+// CaptureSystemReport collects a report from the running host and writes every
+// input the collectors touched to target. Passive disk health is not captured
+// because it is read from device ioctls rather than files.
+func CaptureSystemReport(ctx context.Context, target string, filter ReportSectionFilter) (*SystemReport, *RecordingReportFileReader, error) {
+	return CaptureSystemReportWithOptions(ctx, target, ReportOptions{Filter: filter})
+}
+
+// CaptureSystemReportWithOptions is CaptureSystemReport with the full set of
+// collection options.
+func CaptureSystemReportWithOptions(ctx context.Context, target string, options ReportOptions) (*SystemReport, *RecordingReportFileReader, error) {
+	recorder := NewRecordingReportFileReader(OSReportFileReader{})
+	report := collectSystemReport(ctx, recorder, nil, runtime.GOOS, options)
+	return report, recorder, recorder.WriteSnapshot(target, runtime.GOOS)
+}
+
+// OpenReportSnapshot opens a snapshot written by CaptureSystemReport and
+// returns a reader replaying it together with the captured operating system.
+func OpenReportSnapshot(source string) (ReportFileReader, string, error) {
+	if isTarSnapshot(source) {
+		reader, err := NewTarReportFileReader(source)
+		if err != nil {
+			return nil, "", err
+		}
+		return reader, reader.OperatingSystem, nil
+	}
+	reader, err := NewDirReportFileReader(source)
+	if err != nil {
+		return nil, "", err
+	}
+	return reader, reader.OperatingSystem, nil
+}
+
+// DirReportFileReader replays a snapshot directory.
+type DirReportFileReader struct {
+	Root            string
+	OperatingSystem string
+	globs           map[string][]string
+}
+
+func NewDirReportFileReader(root string) (*DirReportFileReader, error) {
+	content, err := os.ReadFile(filepath.Join(root, reportSnapshotManifest))
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot manifest: %w", err)
+	}
+	manifest, err := parseReportSnapshotManifest(content)
+	if err != nil {
+		return nil, err
+	}
+	return &DirReportFileReader{Root: root, OperatingSystem: manifest.OperatingSystem, globs: manifest.Globs}, nil
+}
+
+func (r *DirReportFileReader) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(r.Root, reportSnapshotFilesDir, filepath.FromSlash(cleanSnapshotPath(name))))
+}
+
+func (r *DirReportFileReader) Glob(pattern string) ([]string, error) {
+	if matches, ok := r.globs[pattern]; ok {
+		return append([]string(nil), matches...), nil
+	}
+	base := filepath.Join(r.Root, reportSnapshotFilesDir)
+	matches, err := filepath.Glob(filepath.Join(base, filepath.FromSlash(cleanSnapshotPath(pattern))))
+	if err != nil {
+		return nil, err
+	}
+	for index, match := range matches {
+		relative, _ := filepath.Rel(base, match)
+		matches[index] = "/" + filepath.ToSlash(relative)
+	}
+	return matches, nil
+}
+
+// TarReportFileReader replays a gzip compressed snapshot archive from memory.
+type TarReportFileReader struct {
+	OperatingSystem string
+	files           map[string][]byte
+	globs           map[string][]string
+}
+
+func NewTarReportFileReader(source string) (*TarReportFileReader, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readTarSnapshot(file)
+}
+
+func readTarSnapshot(input io.Reader) (*TarReportFileReader, error) {
+	compressed, err := gzip.NewReader(input)
+	if err != nil {
+		return nil, fmt.Errorf("open snapshot archive: %w", err)
+	}
+	defer compressed.Close()
+	reader := &TarReportFileReader{files: make(map[string][]byte)}
+	archive := tar.NewReader(compressed)
+	var manifest *reportSnapshotManifestFile
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read snapshot archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(io.LimitReader(archive, 64<<20))
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case header.Name == reportSnapshotManifest:
+			if manifest, err = parseReportSnapshotManifest(content); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(header.Name, reportSnapshotFilesDir+"/"):
+			reader.files[cleanSnapshotPath(strings.TrimPrefix(header.Name, reportSnapshotFilesDir))] = content
+		}
+	}
+	if manifest == nil {
+		return nil, errors.New("snapshot archive has no manifest")
+	}
+	reader.OperatingSystem, reader.globs = manifest.OperatingSystem, manifest.Globs
+	return reader, nil
+}
+
+func (r *TarReportFileReader) ReadFile(name string) ([]byte, error) {
+	content, ok := r.files[cleanSnapshotPath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return content, nil
+}
+
+func (r *TarReportFileReader) Glob(pattern string) ([]string, error) {
+	if matches, ok := r.globs[pattern]; ok {
+		return append([]string(nil), matches...), nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{})
+	for name := range r.files {
+		for candidate := name; candidate != "/"; candidate = path.Dir(candidate) {
+			if matched, _ := path.Match(pattern, candidate); matched {
+				seen[candidate] = struct{}{}
+			}
+		}
+	}
+	matches := make([]string, 0, len(seen))
+	for match := range seen {
+		matches = append(matches, match)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func parseReportSnapshotManifest(content []byte) (*reportSnapshotManifestFile, error) {
+	var manifest reportSnapshotManifestFile
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("decode snapshot manifest: %w", err)
+	}
+	if manifest.SchemaVersion != reportSnapshotSchema {
+		return nil, fmt.Errorf("unsupported snapshot schema %q", manifest.SchemaVersion)
+	}
+	if manifest.Globs == nil {
+		manifest.Globs = make(map[string][]string)
+	}
+	return &manifest, nil
+}
+
+func isTarSnapshot(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz")
+}
+
+// cleanSnapshotPath keeps recorded paths absolute and prevents replayed names
+// from escaping the snapshot root.
+func cleanSnapshotPath(name string) string {
+	return path.Clean("/" + filepath.ToSlash(name))
+}
+
+func writeDirSnapshot(root string, manifest []byte, files map[string][]byte) error {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return err
+	}
+	for name, content := range files {
+		target := filepath.Join(root, reportSnapshotFilesDir, filepath.FromSlash(cleanSnapshotPath(name)))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, content, 0o644); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(filepath.Join(root, reportSnapshotManifest), manifest, 0o644)
+}
+
+func writeTarSnapshot(target string, manifest []byte, files map[string][]byte) error {
+	var buffer bytes.Buffer
+	compressed := gzip.NewWriter(&buffer)
+	archive := tar.NewWriter(compressed)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	modified := time.Now()
+	write := func(name string, content []byte) error {
+		if err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), ModTime: modified, Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		_, err := archive.Write(content)
+		return err
+	}
+	if err := write(reportSnapshotManifest, manifest); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := write(reportSnapshotFilesDir+cleanSnapshotPath(name), files[name]); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	if err := compressed.Close(); err != nil {
+		return err
+	}
+	if dir := filepath.Dir(target); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(target, buffer.Bytes(), 0o644)
+}
+
+var identifyingSnapshotFiles = map[string]struct{}{
+	"product_serial": {}, "product_uuid": {}, "board_serial": {}, "chassis_serial": {},
+	"board_asset_tag": {}, "chassis_asset_tag": {}, "serial": {}, "wwid": {}, "wwn": {},
+	"uuid": {}, "eui": {}, "nguid": {}, "vpd_pg80": {}, "vpd_pg83": {}, "machine-id": {},
+}
+
+// scrubSnapshotFile removes serial numbers and other unique identifiers
+// before a file is written to a snapshot that may be attached to a bug report.
+func scrubSnapshotFile(name string, content []byte) []byte {
+	if _, ok := identifyingSnapshotFiles[path.Base(name)]; ok {
+		return []byte(redactedSnapshotValue + "\n")
+	}
+	if name == "/sys/firmware/dmi/tables/DMI" {
+		return scrubDMITable(content)
+	}
+	if strings.HasPrefix(name, "/sys/class/net/") && path.Base(name) == "address" && strings.Trim(string(content), "0:\n") != "" {
+		return []byte(redactMACAddress(string(content)) + "\n")
+	}
+	lines := strings.Split(string(content), "\n")
+	changed := false
+	for index, line := range lines {
+		separator := strings.IndexAny(line, "=:")
+		if separator <= 0 {
+			continue
+		}
+		key := strings.ToUpper(strings.TrimSpace(line[:separator]))
+		if strings.Contains(key, "SERIAL") || strings.Contains(key, "UUID") {
+			lines[index] = line[:separator+1] + redactedSnapshotValue
+			changed = true
+		}
+	}
+	if !changed {
+		return append([]byte(nil), content...)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// scrubDMITable overwrites the serial number strings and system UUID of the
+// SMBIOS structures in place, so string indexes and lengths stay valid and
+// parseDMIType17 still notices that a serial was present.
+func scrubDMITable(data []byte) []byte {
+	result := append([]byte(nil), data...)
+	serialOffsets := map[byte]int{1: 0x07, 2: 0x07, 3: 0x07, 4: 0x20, 17: 0x18}
+	for offset := 0; offset+4 <= len(result); {
+		structureType, length := result[offset], int(result[offset+1])
+		if length < 4 || offset+length > len(result) {
+			break
+		}
+		stringsStart := offset + length
+		end := stringsStart
+		for end+1 < len(result) && !(result[end] == 0 && result[end+1] == 0) {
+			end++
+		}
+		if end+1 >= len(result) {
+			break
+		}
+		if structureType == 1 && length >= 0x19 {
+			for index := offset + 0x08; index < offset+0x18; index++ {
+				result[index] = 0
+			}
+		}
+		if field, ok := serialOffsets[structureType]; ok && length > field {
+			if index := int(result[offset+field]); index > 0 {
+				start := stringsStart
+				for current := 1; start < end; current++ {
+					stop := bytes.IndexByte(result[start:end+1], 0)
+					if stop < 0 {
+						break
+					}
+					if current == index {
+						for position := start; position < start+stop; position++ {
+							result[position] = 'X'
+						}
+						break
+					}
+					start += stop + 1
+				}
+			}
+		}
+		offset = end + 2
+		if structureType == 127 {
+			break
+		}
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+package system
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReportSnapshotRoundTripsThroughDirAndTar(t *testing.T) {
+	fixture := reportFixture{
+		files: map[string]string{
+			"/proc/cpuinfo":                            "processor : 0\nmodel name : Snapshot CPU\nSerial : 00000000deadbeef\n",
+			"/proc/meminfo":                            "MemTotal: 2048 kB\n",
+			"/sys/class/dmi/id/board_name":             "Snapshot Board\n",
+			"/sys/class/dmi/id/product_serial":         "PRIVATE-SERIAL\n",
+			"/sys/bus/pci/devices/0000:00:02.0/uevent": "PCI_ID=1af4:1000\nPCI_CLASS=020000\nDRIVER=virtio-pci\nSERIAL=private-device-id\n",
+			"/sys/block/vda/size":                      "4096\n",
+			"/sys/block/vda/device/serial":             "private-disk-serial\n",
+		},
+		globs: map[string][]string{
+			"/sys/bus/pci/devices/*": {"/sys/bus/pci/devices/0000:00:02.0"},
+			"/sys/block/*":           {"/sys/block/vda"},
+		},
+	}
+	recorder := NewRecordingReportFileReader(fixture)
+	original := CollectSystemReportFrom(context.Background(), recorder, "linux")
+	_, _ = recorder.ReadFile("/sys/class/dmi/id/product_serial")
+	_, _ = recorder.ReadFile("/sys/block/vda/device/serial")
+	if recorder.FileCount() == 0 {
+		t.Fatal("recorder captured no files")
+	}
+	root := t.TempDir()
+	for _, target := range []string{filepath.Join(root, "snapshot"), filepath.Join(root, "snapshot.tar.gz")} {
+		if err := recorder.WriteSnapshot(target, "linux"); err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		files, operatingSystem, err := OpenReportSnapshot(target)
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		if operatingSystem != "linux" {
+			t.Fatalf("%s: operating system = %q", target, operatingSystem)
+		}
+		replayed := CollectSystemReportFrom(context.Background(), files, operatingSystem)
+		if replayed.CPU.Model != original.CPU.Model || replayed.Firmware.BoardName != "Snapshot Board" || *replayed.Memory.TotalBytes != *original.Memory.TotalBytes {
+			t.Fatalf("%s: replayed report differs: %+v", target, replayed)
+		}
+		if len(replayed.PCI.Devices) != 1 || replayed.PCI.Devices[0].Driver != "virtio-pci" || len(replayed.Disks) != 1 || *replayed.Disks[0].SizeBytes != 4096*512 {
+			t.Fatalf("%s: replayed globs differ: pci=%+v disks=%+v", target, replayed.PCI, replayed.Disks)
+		}
+		for _, name := range []string{"/proc/cpuinfo", "/sys/class/dmi/id/product_serial", "/sys/bus/pci/devices/0000:00:02.0/uevent", "/sys/block/vda/device/serial"} {
+			content, err := files.ReadFile(name)
+			if err != nil {
+				t.Fatalf("%s: %s was not captured: %v", target, name, err)
+			}
+			for _, private := range []string{"deadbeef", "PRIVATE-SERIAL", "private-device-id", "private-disk-serial"} {
+				if strings.Contains(string(content), private) {
+					t.Fatalf("%s: %s leaked %q: %q", target, name, private, content)
+				}
+			}
+		}
+		if _, err := files.ReadFile("/../../etc/passwd"); err == nil {
+			t.Fatalf("%s: replay escaped the snapshot root", target)
+		}
+		if matches, err := files.Glob("/sys/block/vda/s*"); err != nil || len(matches) != 1 || matches[0] != "/sys/block/vda/size" {
+			t.Fatalf("%s: unrecorded glob fallback = %v, %v", target, matches, err)
+		}
+	}
+}
+
+func TestScrubDMITableRedactsSerialsInPlace(t *testing.T) {
+	formatted := make([]byte, 0x22)
+	formatted[0] = 17
+	formatted[1] = byte(len(formatted))
+	binary.LittleEndian.PutUint16(formatted[0x0c:0x0e], 8192)
+	formatted[0x10], formatted[0x17], formatted[0x18], formatted[0x1a] = 1, 2, 3, 4
+	data := append(formatted, []byte("DIMM_A1\x00Vendor\x00Serial-123\x00Part-123\x00\x00")...)
+	data = append(data, []byte{127, 4, 0, 0, 0, 0}...)
+	scrubbed := scrubDMITable(data)
+	if len(scrubbed) != len(data) || bytes.Contains(scrubbed, []byte("Serial-123")) || !bytes.Contains(scrubbed, []byte("Part-123")) {
+		t.Fatalf("DMI serial was not scrubbed in place: %q", scrubbed)
+	}
+	dimms := parseDMIType17(scrubbed)
+	if len(dimms) != 1 || !dimms[0].SerialRedacted || dimms[0].PartNumber != "Part-123" || dimms[0].Manufacturer != "Vendor" {
+		t.Fatalf("scrubbed DMI table no longer parses: %+v", dimms)
+	}
+}
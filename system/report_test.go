@@ -7,6 +7,7 @@ import (
 	"errors"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -19,11 +20,14 @@ type reportFixture struct {
 type cancelingReportFixture struct {
 	reportFixture
 	cancel context.CancelFunc
+	mu     sync.Mutex
 	reads  map[string]int
 }
 
 func (f *cancelingReportFixture) ReadFile(path string) ([]byte, error) {
+	f.mu.Lock()
 	f.reads[path]++
+	f.mu.Unlock()
 	if path == "/proc/cpuinfo" {
 		f.cancel()
 	}
@@ -408,7 +412,7 @@ func TestCollectSystemReportCancellationAndUnsupported(t *testing.T) {
 	}
 }
 
-func TestCollectSystemReportStopsBetweenCollectorsWhenCanceled(t *testing.T) {
+func TestCollectSystemReportMarksReportCanceledWhenParentCanceled(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	fixture := &cancelingReportFixture{
 		reportFixture: reportFixture{files: map[string]string{
@@ -423,13 +427,10 @@ func TestCollectSystemReportStopsBetweenCollectorsWhenCanceled(t *testing.T) {
 	if report.Availability != AvailabilityCanceled || report.Error != context.Canceled.Error() {
 		t.Fatalf("canceled report = %+v", report)
 	}
-	if fixture.reads["/proc/meminfo"] != 0 {
-		t.Fatalf("memory collector ran after cancellation: reads=%v", fixture.reads)
-	}
 }
 
-func TestCollectSystemReportStopsBetweenCollectorsAfterDeadline(t *testing.T) {
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+func TestCollectSystemReportDeadlineOnlyCancelsUnfinishedSections(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 	defer cancel()
 	fixture := &cancelingReportFixture{
 		reportFixture: reportFixture{files: map[string]string{
@@ -441,11 +442,151 @@ func TestCollectSystemReportStopsBetweenCollectorsAfterDeadline(t *testing.T) {
 		reads:  make(map[string]int),
 	}
 	report := CollectSystemReportFrom(ctx, fixture, "linux")
-	if report.Availability != AvailabilityCanceled || report.Error != context.DeadlineExceeded.Error() {
+	// The section budget is derived from the deadline with a reserve, so the
+	// hung section is abandoned before the report itself runs out of time.
+	if report.Availability != AvailabilityAvailable || ctx.Err() != nil {
 		t.Fatalf("timed-out report = %+v", report)
 	}
-	if fixture.reads["/proc/meminfo"] != 0 {
-		t.Fatalf("memory collector ran after timeout: reads=%v", fixture.reads)
+	if report.CPU.Availability != AvailabilityCanceled || report.CPU.Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("hung CPU section = %+v", report.CPU.ReportSection)
+	}
+	if report.Memory.Availability != AvailabilityAvailable || report.Memory.TotalBytes == nil {
+		t.Fatalf("memory section did not finish independently: %+v", report.Memory)
+	}
+	if report.CPU.DurationMS == nil || report.Memory.DurationMS == nil {
+		t.Fatalf("section durations missing: cpu=%+v memory=%+v", report.CPU.ReportSection, report.Memory.ReportSection)
+	}
+}
+
+type hangingGlobFixture struct {
+	reportFixture
+	pattern string
+	release chan struct{}
+}
+
+func (f hangingGlobFixture) Glob(pattern string) ([]string, error) {
+	if pattern == f.pattern {
+		<-f.release
+	}
+	return f.reportFixture.Glob(pattern)
+}
+
+func TestCollectSystemReportRecordsListSectionStatus(t *testing.T) {
+	fixture := hangingGlobFixture{
+		reportFixture: reportFixture{files: map[string]string{"/proc/meminfo": "MemTotal: 1024 kB\n"}},
+		pattern:       "/sys/block/*",
+		release:       make(chan struct{}),
+	}
+	t.Cleanup(func() { close(fixture.release) })
+	report := CollectSystemReportFromWithOptions(context.Background(), fixture, "linux", ReportOptions{SectionTimeout: 50 * time.Millisecond})
+	disks, gpus := report.SectionStatus["disks"], report.SectionStatus["gpus"]
+	if disks.Availability != AvailabilityCanceled || disks.Error != context.DeadlineExceeded.Error() || disks.DurationMS == nil {
+		t.Fatalf("hung disks section = %+v", disks)
+	}
+	if gpus.Availability != AvailabilityAvailable || gpus.DurationMS == nil || report.Memory.Availability != AvailabilityAvailable {
+		t.Fatalf("other sections = gpus %+v, memory %+v", gpus, report.Memory.ReportSection)
+	}
+
+	filtered := CollectSystemReportFromWithFilter(context.Background(), reportFixture{}, "windows", ReportSectionFilter{Enable: []string{"gpus"}})
+	if filtered.SectionStatus["gpus"].Availability != AvailabilityUnsupported || filtered.SectionStatus["disks"].Availability != AvailabilityDisabled {
+		t.Fatalf("filtered list sections = %+v", filtered.SectionStatus)
+	}
+}
+
+func TestReportOptionsWithDefaults(t *testing.T) {
+	options := ReportOptions{}.withDefaults(context.Background())
+	if options.SectionTimeout != defaultReportSectionTimeout || options.DiskHealthTimeout != 4*time.Second {
+		t.Fatalf("default budgets = %+v", options)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	options = ReportOptions{DiskHealthTimeout: time.Second}.withDefaults(ctx)
+	if options.SectionTimeout <= 17*time.Second || options.SectionTimeout > 18*time.Second || options.DiskHealthTimeout != time.Second {
+		t.Fatalf("deadline budgets = %+v", options)
+	}
+}
+
+type blockingDiskHealthCollector struct {
+	hung    string
+	release chan struct{}
+}
+
+func (c blockingDiskHealthCollector) Collect(name string, _ ReportFileReader) (DiskHealthReport, DiskTemperatureReport) {
+	if name == c.hung {
+		<-c.release
+	}
+	return DiskHealthReport{ReportSection: ReportSection{Availability: AvailabilityAvailable}, Protocol: "nvme", Status: "passed"},
+		DiskTemperatureReport{ReportSection: ReportSection{Availability: AvailabilityUnavailable}}
+}
+
+func TestCollectSystemReportHungDiskHealthOnlyCancelsThatDisk(t *testing.T) {
+	collector := blockingDiskHealthCollector{hung: "sdb", release: make(chan struct{})}
+	t.Cleanup(func() { close(collector.release) })
+	fixture := reportFixture{
+		files: map[string]string{
+			"/proc/cpuinfo":                  "processor : 0\nmodel name : Fixture CPU\n",
+			"/proc/meminfo":                  "MemTotal: 1024 kB\n",
+			"/sys/class/dmi/id/board_name":   "Fixture Board\n",
+			"/sys/block/nvme0n1/size":        "2048\n",
+			"/sys/block/sdb/size":            "2048\n",
+			"/sys/devices/system/cpu/online": "0\n",
+		},
+		globs: map[string][]string{"/sys/block/*": {"/sys/block/nvme0n1", "/sys/block/sdb"}},
+	}
+	report := collectSystemReport(context.Background(), fixture, collector, "linux", ReportOptions{DiskHealthTimeout: 50 * time.Millisecond})
+	if report.Availability != AvailabilityAvailable || report.CPU.Availability != AvailabilityAvailable || report.Memory.Availability != AvailabilityAvailable || report.Firmware.Availability != AvailabilityAvailable {
+		t.Fatalf("hung disk affected other sections: %+v", report)
+	}
+	if len(report.Disks) != 2 {
+		t.Fatalf("unexpected disks: %+v", report.Disks)
+	}
+	if report.Disks[0].Health.Availability != AvailabilityAvailable || report.Disks[0].Health.Status != "passed" {
+		t.Fatalf("healthy disk = %+v", report.Disks[0].Health)
+	}
+	if report.Disks[1].Health.Availability != AvailabilityCanceled || report.Disks[1].Health.Error != context.DeadlineExceeded.Error() || report.Disks[1].Health.DurationMS == nil {
+		t.Fatalf("hung disk = %+v", report.Disks[1].Health)
+	}
+}
+
+func TestCollectSystemReportDiskHealthBudgetOutlastsSectionTimeout(t *testing.T) {
+	collector := blockingDiskHealthCollector{hung: "sdb", release: make(chan struct{})}
+	t.Cleanup(func() { close(collector.release) })
+	fixture := reportFixture{
+		files: map[string]string{"/sys/block/nvme0n1/size": "2048\n", "/sys/block/sdb/size": "2048\n"},
+		globs: map[string][]string{"/sys/block/*": {"/sys/block/nvme0n1", "/sys/block/sdb"}},
+	}
+	filter := ReportSectionFilter{Enable: []string{"disks"}}
+	report := collectSystemReport(context.Background(), fixture, collector, "linux", ReportOptions{Filter: filter, SectionTimeout: 20 * time.Millisecond, DiskHealthTimeout: 60 * time.Millisecond})
+	if status := report.SectionStatus["disks"]; status.Availability != AvailabilityAvailable {
+		t.Fatalf("disks section = %+v", status)
+	}
+	if len(report.Disks) != 2 || report.Disks[0].Health.Availability != AvailabilityAvailable || report.Disks[1].Health.Availability != AvailabilityCanceled {
+		t.Fatalf("unexpected disks: %+v", report.Disks)
+	}
+}
+
+type mediaErrorsDiskHealthCollector struct{}
+
+func (mediaErrorsDiskHealthCollector) Collect(string, ReportFileReader) (DiskHealthReport, DiskTemperatureReport) {
+	return DiskHealthReport{ReportSection: ReportSection{Availability: AvailabilityAvailable}, Protocol: "nvme", Status: "passed", MediaErrors: uint64Ptr(1)},
+		DiskTemperatureReport{ReportSection: ReportSection{Availability: AvailabilityUnavailable}}
+}
+
+func TestCollectSystemReportAppliesDiskThresholdsOption(t *testing.T) {
+	fixture := reportFixture{
+		files: map[string]string{"/sys/block/nvme0n1/size": "2048\n"},
+		globs: map[string][]string{"/sys/block/*": {"/sys/block/nvme0n1"}},
+	}
+	filter := ReportSectionFilter{Enable: []string{"disks"}}
+	report := collectSystemReport(context.Background(), fixture, mediaErrorsDiskHealthCollector{}, "linux", ReportOptions{Filter: filter})
+	if len(report.Disks) != 1 || report.Disks[0].Verdict.Status != DiskVerdictWarning {
+		t.Fatalf("default thresholds = %+v", report.Disks)
+	}
+	thresholds := DefaultDiskHealthThresholds()
+	thresholds.MediaErrorsWarning = 0
+	report = collectSystemReport(context.Background(), fixture, mediaErrorsDiskHealthCollector{}, "linux", ReportOptions{Filter: filter, DiskThresholds: &thresholds})
+	if len(report.Disks) != 1 || report.Disks[0].Verdict.Status != DiskVerdictOK {
+		t.Fatalf("custom thresholds = %+v", report.Disks)
 	}
 }
 
@@ -479,7 +620,7 @@ func TestCollectDiskReportsFiltersLogicalDevices(t *testing.T) {
 			"/sys/block/*": {"/sys/block/dm-0", "/sys/block/md0", "/sys/block/sda", "/sys/block/zram0"},
 		},
 	}
-	reports := collectDiskReports(fixture, "linux", nil)
+	reports := collectDiskReports(fixture, "linux", nil, DefaultDiskHealthThresholds())
 	if len(reports) != 1 || reports[0].Name != "sda" || reports[0].SizeBytes == nil || *reports[0].SizeBytes != 1048576 {
 		t.Fatalf("logical devices were not filtered: %+v", reports)
 	}
@@ -493,7 +634,7 @@ func TestCollectDiskReportsUsesSysfsSectorSizeFor4Kn(t *testing.T) {
 		},
 		globs: map[string][]string{"/sys/block/*": {"/sys/block/nvme0n1"}},
 	}
-	reports := collectDiskReports(fixture, "linux", nil)
+	reports := collectDiskReports(fixture, "linux", nil, DefaultDiskHealthThresholds())
 	if len(reports) != 1 || reports[0].LogicalBytes == nil || *reports[0].LogicalBytes != 4096 || reports[0].SizeBytes == nil || *reports[0].SizeBytes != 1<<20 {
 		t.Fatalf("4Kn sysfs capacity was not converted from 512-byte sectors: %+v", reports)
 	}
@@ -507,7 +648,7 @@ func TestCollectDiskReportsRejectsSizeOverflow(t *testing.T) {
 		},
 		globs: map[string][]string{"/sys/block/*": {"/sys/block/sda"}},
 	}
-	reports := collectDiskReports(fixture, "linux", nil)
+	reports := collectDiskReports(fixture, "linux", nil, DefaultDiskHealthThresholds())
 	if len(reports) != 1 || reports[0].Availability != AvailabilityError || reports[0].Error == "" {
 		t.Fatalf("overflow was not reported: %+v", reports)
 	}
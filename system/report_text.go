@@ -38,8 +38,10 @@ func renderHardwareReportText(report *SystemReport, language string) string {
 	}
 
 	renderCgroupRows(row, report.Cgroup)
+	renderCPUContentionRows(row, report.CPUContention)
 	renderFirmwareRows(row, report.Firmware)
 	renderPCIGPURows(row, report.PCI, report.GPUs)
+	renderInterfaceRows(row, report.Interfaces)
 	renderMemoryTopologyRows(row, report.MemoryTopology, zh)
 	for index, disk := range report.Disks {
 		if index >= 4 {
@@ -49,6 +51,7 @@ func renderHardwareReportText(report *SystemReport, language string) string {
 		renderDiskRows(row, index+1, disk, zh)
 	}
 	renderRAIDRows(row, report.RAID)
+	renderQualityRows(row, report.Quality, zh)
 	return builder.String()
 }
 
@@ -88,6 +91,16 @@ func renderNetworkReportText(report *SystemReport, language string) string {
 	}
 	row("TCP接收缓冲", "TCP Receive Buffer", formatByteTuple(report.Network.TCPRMem))
 	row("TCP发送缓冲", "TCP Send Buffer", formatByteTuple(report.Network.TCPWMem))
+	if report.Network.ConntrackCount != nil && report.Network.ConntrackMax != nil {
+		row("连接跟踪", "Conntrack", fmt.Sprintf("%d / %d", *report.Network.ConntrackCount, *report.Network.ConntrackMax))
+	}
+	for _, advisory := range report.Network.Advisories {
+		message := advisory.Message
+		if zh && advisory.messageZH != "" {
+			message = advisory.messageZH
+		}
+		row("调优建议", "Tuning Advice", message)
+	}
 	return builder.String()
 }
 
@@ -157,6 +170,38 @@ func renderCgroupRows(row func(string, string, string), cgroup CgroupReport) {
 	}
 }
 
+func renderCPUContentionRows(row func(string, string, string), contention CPUContentionReport) {
+	if contention.Availability != AvailabilityAvailable || contention.StealPercent == nil {
+		return
+	}
+	row("CPU窃取/IO等待/中断", "CPU Steal/IOWait/IRQ", fmt.Sprintf("%.1f%% / %.1f%% / %.1f%%", *contention.StealPercent, *contention.IOWaitPercent, *contention.IRQPercent))
+	if contention.BusyImbalancePercent != nil {
+		row("CPU负载不均衡", "CPU Busy Imbalance", fmt.Sprintf("%.1f%% (%d CPUs)", *contention.BusyImbalancePercent, len(contention.CPUs)))
+	}
+	if contention.RunDelayMSPerSecond != nil {
+		row("调度等待", "Run Queue Delay", fmt.Sprintf("%.1f ms/s", *contention.RunDelayMSPerSecond))
+	}
+	var pressure []string
+	for _, stall := range contention.Pressure {
+		pressure = append(pressure, fmt.Sprintf("%s %.1f%%", stall.Resource, stall.Some.Avg10))
+	}
+	row("压力阻塞(avg10)", "Pressure Stall avg10", strings.Join(pressure, ", "))
+}
+
+func renderQualityRows(row func(string, string, string), quality *QualityReport, zh bool) {
+	if quality == nil {
+		return
+	}
+	row("VPS质量", "VPS Quality", fmt.Sprintf("%s (%d/100)", quality.Rating, quality.Score))
+	for _, finding := range quality.Findings {
+		message := finding.Message
+		if zh && finding.messageZH != "" {
+			message = finding.messageZH
+		}
+		row("质量发现", "Quality Finding", "["+finding.Severity+"] "+message)
+	}
+}
+
 func renderFirmwareRows(row func(string, string, string), firmware FirmwareReport) {
 	if firmware.Availability != AvailabilityAvailable {
 		return
@@ -191,6 +236,30 @@ func renderPCIGPURows(row func(string, string, string), pci PCIReport, gpus []GP
 	row("GPU驱动", "GPU Drivers", strings.Join(sortedLimitedKeys(gpuDrivers, 4), ","))
 }
 
+func renderInterfaceRows(row func(string, string, string), interfaces NetworkInterfacesReport) {
+	if interfaces.Availability != AvailabilityAvailable {
+		return
+	}
+	total, up := 0, 0
+	for _, iface := range interfaces.Interfaces {
+		if iface.Kind == "loopback" {
+			continue
+		}
+		total++
+		if iface.OperState == "up" {
+			up++
+		}
+	}
+	row("网卡数量", "Interface Count", fmt.Sprintf("%d (up %d)", total, up))
+	routes := make([]string, 0, len(interfaces.DefaultRoutes))
+	for _, route := range interfaces.DefaultRoutes {
+		if value := route.Interface + " (" + strings.Replace(route.Family, "ip", "IP", 1) + ")"; !containsString(routes, value) {
+			routes = append(routes, value)
+		}
+	}
+	row("默认路由接口", "Default Route", strings.Join(routes, ", "))
+}
+
 func renderMemoryTopologyRows(row func(string, string, string), topology MemoryTopologyReport, zh bool) {
 	if topology.Availability != AvailabilityAvailable {
 		return
@@ -259,6 +328,20 @@ func renderDiskRows(row func(string, string, string), index int, disk DiskReport
 		}
 		parts = append(parts, fmt.Sprintf("%s %.1f C", label, *disk.Temperature.Celsius))
 	}
+	if verdict := disk.Verdict.Status; verdict != "" && verdict != DiskVerdictUnknown {
+		label := "verdict"
+		if zh {
+			label = "判定"
+		}
+		codes := make([]string, 0, len(disk.Verdict.Reasons))
+		for _, reason := range disk.Verdict.Reasons {
+			codes = append(codes, reason.Code)
+		}
+		if len(codes) > 0 {
+			verdict += " (" + strings.Join(codes, ", ") + ")"
+		}
+		parts = append(parts, label+" "+verdict)
+	}
 	if len(parts) > 0 {
 		row(zhPrefix, enPrefix, strings.Join(parts, " / "))
 	}
@@ -339,3 +422,64 @@ func sortedLimitedKeys(values map[string]struct{}, limit int) []string {
 	}
 	return result
 }
+
+// RenderDiskDetailsText prints the ATA SMART attribute table, self-test log
+// and error log of every disk that has them. Disks are numbered as in
+// RenderSystemReportText and their device names are not printed.
+func RenderDiskDetailsText(report *SystemReport, language string) string {
+	if report == nil {
+		return ""
+	}
+	zh := strings.EqualFold(strings.TrimSpace(language), "zh")
+	label := func(index int, zhTitle, enTitle string) string {
+		if zh {
+			return fmt.Sprintf("物理盘 %d %s", index, zhTitle)
+		}
+		return fmt.Sprintf("Disk %d %s", index, enTitle)
+	}
+	var builder strings.Builder
+	for index, disk := range report.Disks {
+		ata := disk.Health.ATA
+		if ata == nil {
+			continue
+		}
+		if len(ata.Attributes) > 0 {
+			builder.WriteString(" " + label(index+1, "SMART属性", "SMART Attributes") + "\n")
+			fmt.Fprintf(&builder, "  %3s %-24s %5s %5s %6s %-8s %-6s %s\n", "ID", "Name", "Value", "Worst", "Thresh", "Type", "Failed", "Raw")
+			for _, attribute := range ata.Attributes {
+				threshold, kind, raw := "-", "old_age", fmt.Sprintf("%d", attribute.Raw)
+				if attribute.Threshold != nil {
+					threshold = fmt.Sprintf("%d", *attribute.Threshold)
+				}
+				if attribute.Prefail {
+					kind = "prefail"
+				}
+				if attribute.RawDecoded != "" {
+					raw = attribute.RawDecoded
+				}
+				whenFailed := attribute.WhenFailed
+				if whenFailed == "" {
+					whenFailed = "-"
+				}
+				fmt.Fprintf(&builder, "  %3d %-24s %5d %5d %6s %-8s %-6s %s\n", attribute.ID, attribute.Name, attribute.Value, attribute.Worst, threshold, kind, whenFailed, raw)
+			}
+		}
+		if len(ata.SelfTests) > 0 {
+			builder.WriteString(" " + label(index+1, "自检记录", "Self-tests") + "\n")
+			for _, test := range ata.SelfTests {
+				line := fmt.Sprintf("  %-18s %-20s remaining %d%% at %dh", test.Type, test.Status, test.RemainingPercent, test.LifetimeHours)
+				if test.FirstErrorLBA != nil {
+					line += fmt.Sprintf(" LBA %d", *test.FirstErrorLBA)
+				}
+				builder.WriteString(line + "\n")
+			}
+		}
+		if ata.ErrorCount != nil {
+			builder.WriteString(formatReportRow(label(index+1, "错误日志", "Error Log"), fmt.Sprintf("%d", *ata.ErrorCount)))
+			for _, entry := range ata.Errors {
+				fmt.Fprintf(&builder, "  at %dh error 0x%02x status 0x%02x LBA %d %s\n", entry.LifetimeHours, entry.Error, entry.Status, entry.LBA, entry.State)
+			}
+		}
+	}
+	return builder.String()
+}
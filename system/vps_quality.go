@@ -0,0 +1,242 @@
+package system
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VPS quality finding severities and ratings. The rating follows the most
+// severe finding.
+const (
+	QualitySeverityInfo     = "info"
+	QualitySeverityWarning  = "warning"
+	QualitySeverityCritical = "critical"
+
+	QualityRatingGood = "good"
+	QualityRatingFair = "fair"
+	QualityRatingPoor = "poor"
+)
+
+// Thresholds of the VPS quality rules.
+const (
+	qualityStealInfoPercent     = 1.0
+	qualityStealWarningPercent  = 5.0
+	qualityStealCriticalPercent = 15.0
+	qualityMemoryStallPercent   = 5.0
+	qualityMemoryFreePercent    = 20.0
+	qualityWarningPenalty       = 10
+	qualityCriticalPenalty      = 25
+)
+
+// QualityReport is the oversell and quality assessment derived from the other
+// sections of a SystemReport by EvaluateVPSQuality. Score starts at 100 and
+// loses 10 per warning and 25 per critical finding.
+type QualityReport struct {
+	Rating   string           `json:"rating"`
+	Score    int              `json:"score"`
+	Findings []QualityFinding `json:"findings,omitempty"`
+}
+
+// QualityFinding is one rule that matched. Evidence lists the report fields
+// it was based on as path=value.
+type QualityFinding struct {
+	Code     string   `json:"code"`
+	Severity string   `json:"severity"`
+	Message  string   `json:"message"`
+	Evidence []string `json:"evidence,omitempty"`
+	// messageZH is the Chinese text used by the compact text report.
+	messageZH string
+}
+
+// Drivers of NICs that a hypervisor emulates in full rather than exposing a
+// paravirtual device such as virtio_net, vmxnet3 or hv_netvsc.
+var emulatedNICDrivers = []string{"e1000", "e1000e", "8139cp", "8139too", "ne2k-pci", "pcnet32", "tulip"}
+
+// CPU model strings of QEMU's generic CPU types, which hide the host model
+// and most of its instruction set extensions.
+var genericCPUModels = []string{"qemu virtual cpu", "common kvm processor", "common 32-bit kvm processor", "kvm64", "qemu64"}
+
+// EvaluateVPSQuality applies the quality rules to report. Rules whose
+// sections are unavailable or disabled are skipped rather than reported, and
+// nil is returned when no section the rules read is available.
+func EvaluateVPSQuality(report *SystemReport) *QualityReport {
+	if report == nil || (len(report.Disks) == 0 && !hasAvailableSection(report.CPU.ReportSection, report.Memory.ReportSection,
+		report.Cgroup.ReportSection, report.CPUContention.ReportSection, report.Interfaces.ReportSection)) {
+		return nil
+	}
+	result := &QualityReport{Rating: QualityRatingGood, Score: 100}
+	add := func(code, severity, message, messageZH string, evidence ...string) {
+		result.Findings = append(result.Findings, QualityFinding{Code: code, Severity: severity, Message: message, Evidence: evidence, messageZH: messageZH})
+	}
+	virtualMachine := report.Virtualization.Availability == AvailabilityAvailable && !report.Virtualization.Container &&
+		report.Virtualization.Type != "" && report.Virtualization.Type != "bare-metal-or-unknown"
+
+	if memory := report.Memory; memory.Availability == AvailabilityAvailable {
+		if memory.VirtioBalloon != nil && *memory.VirtioBalloon {
+			add("virtio_balloon", QualitySeverityWarning,
+				"virtio_balloon is loaded; the host can reclaim guest memory on demand",
+				"已加载 virtio_balloon，宿主机可随时回收本机内存",
+				"memory.virtio_balloon=true")
+		}
+		if memory.KSMRunning != nil && *memory.KSMRunning {
+			evidence := []string{"memory.ksm_running=true"}
+			if memory.KSMPagesSharing != nil {
+				evidence = append(evidence, fmt.Sprintf("memory.ksm_pages_sharing=%d", *memory.KSMPagesSharing))
+			}
+			if memory.KSMPagesSharing != nil && *memory.KSMPagesSharing > 0 {
+				add("ksm_merging", QualitySeverityWarning,
+					fmt.Sprintf("KSM is merging pages (%d pages sharing), which trades CPU time for memory density", *memory.KSMPagesSharing),
+					fmt.Sprintf("KSM 正在合并内存页（%d 页共享），以 CPU 时间换取内存密度", *memory.KSMPagesSharing),
+					evidence...)
+			} else {
+				add("ksm_enabled", QualitySeverityInfo, "KSM is enabled but no pages are merged", "KSM 已启用但没有合并的内存页", evidence...)
+			}
+		}
+		if memory.SwapTotalBytes != nil && memory.SwapFreeBytes != nil && *memory.SwapTotalBytes > 0 && *memory.SwapFreeBytes < *memory.SwapTotalBytes {
+			used := *memory.SwapTotalBytes - *memory.SwapFreeBytes
+			add("swap_in_use", QualitySeverityInfo,
+				fmt.Sprintf("%s of swap is in use", formatCompactBytes(used)),
+				fmt.Sprintf("已使用 %s 交换空间", formatCompactBytes(used)),
+				fmt.Sprintf("memory.swap_total_bytes=%d", *memory.SwapTotalBytes), fmt.Sprintf("memory.swap_free_bytes=%d", *memory.SwapFreeBytes))
+		}
+	}
+
+	if contention := report.CPUContention; contention.Availability == AvailabilityAvailable {
+		if contention.StealPercent != nil && *contention.StealPercent >= qualityStealInfoPercent {
+			severity := QualitySeverityInfo
+			switch {
+			case *contention.StealPercent >= qualityStealCriticalPercent:
+				severity = QualitySeverityCritical
+			case *contention.StealPercent >= qualityStealWarningPercent:
+				severity = QualitySeverityWarning
+			}
+			evidence := []string{"cpu_contention.steal_percent=" + formatQualityPercent(*contention.StealPercent)}
+			if contention.MaxStealPercent != nil {
+				evidence = append(evidence, "cpu_contention.max_steal_percent="+formatQualityPercent(*contention.MaxStealPercent))
+			}
+			add("cpu_steal", severity,
+				fmt.Sprintf("%.1f%% of CPU time was stolen by the hypervisor during the %d ms sample", *contention.StealPercent, contention.WindowMS),
+				fmt.Sprintf("采样的 %d 毫秒内 %.1f%% 的 CPU 时间被宿主机占用", contention.WindowMS, *contention.StealPercent),
+				evidence...)
+		}
+		// Memory stalls while most memory is free point at the host:
+		// ballooning or host swap slows guest memory access.
+		if stall := qualityMemoryStall(contention); stall != nil && report.Memory.TotalBytes != nil && report.Memory.AvailableBytes != nil && *report.Memory.TotalBytes > 0 {
+			free := float64(*report.Memory.AvailableBytes) / float64(*report.Memory.TotalBytes) * 100
+			if *stall >= qualityMemoryStallPercent && free >= qualityMemoryFreePercent {
+				add("host_memory_pressure", QualitySeverityWarning,
+					fmt.Sprintf("memory stalls %.1f%% of the time although %.0f%% of memory is available, consistent with host swapping or ballooning", *stall, free),
+					fmt.Sprintf("内存仍有 %.0f%% 可用却有 %.1f%% 的时间阻塞，疑似宿主机交换或气球回收", free, *stall),
+					"cpu_contention.pressure.memory.some="+formatQualityPercent(*stall),
+					fmt.Sprintf("memory.available_bytes=%d", *report.Memory.AvailableBytes), fmt.Sprintf("memory.total_bytes=%d", *report.Memory.TotalBytes))
+			}
+		}
+	}
+
+	if report.Cgroup.Availability == AvailabilityAvailable && report.CPU.Availability == AvailabilityAvailable &&
+		report.Cgroup.CPUQuotaCores != nil && report.CPU.LogicalCPUs != nil && *report.Cgroup.CPUQuotaCores < float64(*report.CPU.LogicalCPUs) {
+		add("cpu_quota_below_visible_cores", QualitySeverityWarning,
+			fmt.Sprintf("the cgroup CPU quota of %.2f cores is lower than the %d visible CPUs", *report.Cgroup.CPUQuotaCores, *report.CPU.LogicalCPUs),
+			fmt.Sprintf("cgroup CPU 配额 %.2f 核低于可见的 %d 个 CPU", *report.Cgroup.CPUQuotaCores, *report.CPU.LogicalCPUs),
+			"cgroup.cpu_quota_cores="+strconv.FormatFloat(*report.Cgroup.CPUQuotaCores, 'f', -1, 64), fmt.Sprintf("cpu.logical_cpus=%d", *report.CPU.LogicalCPUs))
+	}
+
+	if report.CPU.Availability == AvailabilityAvailable && isGenericCPUModel(report.CPU.Model) {
+		evidence := []string{"cpu.model=" + report.CPU.Model}
+		if report.CPU.AESNI != nil {
+			evidence = append(evidence, "cpu.aes_ni="+strconv.FormatBool(*report.CPU.AESNI))
+		}
+		add("generic_cpu_model", QualitySeverityWarning,
+			"the hypervisor exposes a generic CPU model that hides the host CPU and most of its instruction set extensions",
+			"宿主机提供的是通用 CPU 型号，隐藏了真实 CPU 及其大部分指令集扩展",
+			evidence...)
+	}
+
+	for _, disk := range report.Disks {
+		name := strings.TrimSpace(disk.Name)
+		vendor, model := strings.TrimSpace(disk.Vendor), strings.TrimSpace(disk.Model)
+		if virtualMachine && (strings.HasPrefix(name, "hd") || (strings.HasPrefix(name, "sd") && strings.EqualFold(vendor, "ATA"))) {
+			add("emulated_disk", QualitySeverityWarning,
+				fmt.Sprintf("disk %s is attached through an emulated IDE/SATA controller instead of virtio", name),
+				fmt.Sprintf("磁盘 %s 通过模拟的 IDE/SATA 控制器挂载，而非 virtio", name),
+				qualityDiskEvidence(name, vendor, model)...)
+		}
+		// virtio_blk reports rotational media by default, so only other
+		// disks are considered.
+		if disk.Rotational != nil && *disk.Rotational && !strings.HasPrefix(name, "vd") {
+			add("rotational_disk", QualitySeverityInfo,
+				fmt.Sprintf("disk %s reports rotational media", name),
+				fmt.Sprintf("磁盘 %s 报告为机械盘", name),
+				append(qualityDiskEvidence(name, vendor, model), "disks."+name+".rotational=true")...)
+		}
+	}
+
+	if report.Interfaces.Availability == AvailabilityAvailable {
+		for _, iface := range report.Interfaces.Interfaces {
+			if virtualMachine && iface.Kind == "physical" && containsString(emulatedNICDrivers, iface.Driver) {
+				add("emulated_nic", QualitySeverityWarning,
+					fmt.Sprintf("network interface %s uses the emulated %s driver instead of a paravirtual NIC", iface.Name, iface.Driver),
+					fmt.Sprintf("网卡 %s 使用模拟的 %s 驱动，而非半虚拟化网卡", iface.Name, iface.Driver),
+					"interfaces."+iface.Name+".driver="+iface.Driver)
+			}
+		}
+	}
+
+	for _, finding := range result.Findings {
+		switch finding.Severity {
+		case QualitySeverityCritical:
+			result.Score -= qualityCriticalPenalty
+			result.Rating = QualityRatingPoor
+		case QualitySeverityWarning:
+			result.Score -= qualityWarningPenalty
+			if result.Rating == QualityRatingGood {
+				result.Rating = QualityRatingFair
+			}
+		}
+	}
+	if result.Score < 0 {
+		result.Score = 0
+	}
+	return result
+}
+
+// qualityMemoryStall prefers the stall share measured in the sample window
+// over the kernel's 10 second average.
+func qualityMemoryStall(contention CPUContentionReport) *float64 {
+	for _, pressure := range contention.Pressure {
+		if pressure.Resource != "memory" {
+			continue
+		}
+		if pressure.Some.WindowPercent != nil {
+			return pressure.Some.WindowPercent
+		}
+		return float64Ptr(pressure.Some.Avg10)
+	}
+	return nil
+}
+
+func isGenericCPUModel(model string) bool {
+	model = strings.ToLower(strings.TrimSpace(model))
+	for _, generic := range genericCPUModels {
+		if strings.HasPrefix(model, generic) {
+			return true
+		}
+	}
+	return false
+}
+
+func qualityDiskEvidence(name, vendor, model string) []string {
+	var evidence []string
+	if vendor != "" {
+		evidence = append(evidence, "disks."+name+".vendor="+vendor)
+	}
+	if model != "" {
+		evidence = append(evidence, "disks."+name+".model="+model)
+	}
+	return evidence
+}
+
+func formatQualityPercent(value float64) string {
+	return strconv.FormatFloat(value, 'f', 1, 64)
+}
@@ -0,0 +1,136 @@
+package system
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func oversoldVPSReport() *SystemReport {
+	available := ReportSection{Availability: AvailabilityAvailable}
+	return &SystemReport{
+		CPU: CPUReport{ReportSection: available, Model: "QEMU Virtual CPU version 2.5+", LogicalCPUs: intPtr(4), AESNI: boolPtr(false)},
+		Memory: MemoryReport{
+			ReportSection: available, TotalBytes: int64Ptr(4 << 30), AvailableBytes: int64Ptr(3 << 30),
+			SwapTotalBytes: int64Ptr(1 << 30), SwapFreeBytes: int64Ptr(1 << 30),
+			VirtioBalloon: boolPtr(true), KSMRunning: boolPtr(true), KSMPagesSharing: int64Ptr(2048),
+		},
+		Cgroup: CgroupReport{ReportSection: available, CPUQuotaCores: float64Ptr(1.5)},
+		CPUContention: CPUContentionReport{
+			ReportSection: available, WindowMS: 1000, StealPercent: float64Ptr(17.5), MaxStealPercent: float64Ptr(30),
+			Pressure: []PressureStallReport{{Resource: "memory", Some: PressureStallLine{Avg10: 1, WindowPercent: float64Ptr(8)}}},
+		},
+		Virtualization: VirtualizationReport{ReportSection: available, Type: "kvm"},
+		Disks: []DiskReport{
+			{Name: "sda", Vendor: "ATA", Model: "QEMU HARDDISK", Rotational: boolPtr(true)},
+			{Name: "vda", Rotational: boolPtr(true)},
+		},
+		Interfaces: NetworkInterfacesReport{ReportSection: available, Interfaces: []NetworkInterfaceReport{
+			{Name: "eth0", Kind: "physical", Driver: "e1000"},
+			{Name: "eth1", Kind: "physical", Driver: "virtio_net"},
+			{Name: "lo", Kind: "loopback"},
+		}},
+	}
+}
+
+func TestEvaluateVPSQuality(t *testing.T) {
+	quality := EvaluateVPSQuality(oversoldVPSReport())
+	if quality == nil {
+		t.Fatal("expected a quality report")
+	}
+	findings := make(map[string]QualityFinding)
+	for _, finding := range quality.Findings {
+		findings[finding.Code] = finding
+	}
+	for code, severity := range map[string]string{
+		"virtio_balloon":                QualitySeverityWarning,
+		"ksm_merging":                   QualitySeverityWarning,
+		"cpu_steal":                     QualitySeverityCritical,
+		"host_memory_pressure":          QualitySeverityWarning,
+		"cpu_quota_below_visible_cores": QualitySeverityWarning,
+		"generic_cpu_model":             QualitySeverityWarning,
+		"emulated_disk":                 QualitySeverityWarning,
+		"rotational_disk":               QualitySeverityInfo,
+		"emulated_nic":                  QualitySeverityWarning,
+	} {
+		if findings[code].Severity != severity || len(findings[code].Evidence) == 0 {
+			t.Fatalf("finding %s = %+v, want severity %s with evidence", code, findings[code], severity)
+		}
+	}
+	if _, ok := findings["swap_in_use"]; ok || len(quality.Findings) != 9 {
+		t.Fatalf("unexpected findings: %+v", quality.Findings)
+	}
+	if quality.Rating != QualityRatingPoor || quality.Score != 100-25-7*10 {
+		t.Fatalf("unexpected rating: %s %d", quality.Rating, quality.Score)
+	}
+	if evidence := strings.Join(findings["cpu_steal"].Evidence, ","); evidence != "cpu_contention.steal_percent=17.5,cpu_contention.max_steal_percent=30.0" {
+		t.Fatalf("unexpected steal evidence: %s", evidence)
+	}
+	if evidence := strings.Join(findings["emulated_disk"].Evidence, ","); !strings.Contains(evidence, "disks.sda.vendor=ATA") || strings.Contains(evidence, "vda") {
+		t.Fatalf("unexpected disk evidence: %s", evidence)
+	}
+	if evidence := findings["emulated_nic"].Evidence; len(evidence) != 1 || evidence[0] != "interfaces.eth0.driver=e1000" {
+		t.Fatalf("unexpected NIC evidence: %v", evidence)
+	}
+
+	encoded, err := json.Marshal(quality)
+	if err != nil || !strings.Contains(string(encoded), `"code":"cpu_steal","severity":"critical"`) || strings.Contains(string(encoded), "messageZH") {
+		t.Fatalf("unexpected quality JSON: %s, %v", encoded, err)
+	}
+	text := renderHardwareReportText(&SystemReport{Quality: quality}, "zh")
+	if !strings.Contains(text, "poor (5/100)") || !strings.Contains(text, "[critical] 采样的 1000 毫秒内 17.5% 的 CPU 时间被宿主机占用") {
+		t.Fatalf("unexpected quality text:\n%s", text)
+	}
+}
+
+func TestEvaluateVPSQualitySkipsUnavailableSections(t *testing.T) {
+	if quality := EvaluateVPSQuality(&SystemReport{}); quality != nil {
+		t.Fatalf("empty report = %+v", quality)
+	}
+	report := oversoldVPSReport()
+	report.CPUContention.Availability = AvailabilityDisabled
+	report.Memory.Availability = AvailabilityUnavailable
+	// Containers share the host kernel, so emulated devices do not apply.
+	report.Virtualization.Container = true
+	quality := EvaluateVPSQuality(report)
+	var codes []string
+	for _, finding := range quality.Findings {
+		codes = append(codes, finding.Code)
+	}
+	if got := strings.Join(codes, ","); got != "cpu_quota_below_visible_cores,generic_cpu_model,rotational_disk" {
+		t.Fatalf("unexpected findings: %s", got)
+	}
+	if quality.Rating != QualityRatingFair || quality.Score != 80 {
+		t.Fatalf("unexpected rating: %s %d", quality.Rating, quality.Score)
+	}
+
+	bare := &SystemReport{Memory: MemoryReport{ReportSection: ReportSection{Availability: AvailabilityAvailable}, TotalBytes: int64Ptr(1 << 30)}}
+	if quality := EvaluateVPSQuality(bare); quality == nil || quality.Rating != QualityRatingGood || quality.Score != 100 || len(quality.Findings) != 0 {
+		t.Fatalf("clean report = %+v", quality)
+	}
+}
+
+func TestCollectMemoryReportBalloonAndKSM(t *testing.T) {
+	fixture := reportFixture{files: map[string]string{
+		"/proc/meminfo": "MemTotal:       1048576 kB\nMemAvailable:    524288 kB\n",
+		"/proc/modules": "virtio_net 57344 0 - Live 0x0000000000000000\n",
+		"/sys/bus/virtio/drivers/virtio_balloon/virtio2": "",
+		"/sys/kernel/mm/ksm/run":                         "1\n",
+		"/sys/kernel/mm/ksm/pages_sharing":               "512\n",
+	}}
+	report := collectMemoryReport(fixture, "linux")
+	if report.VirtioBalloon == nil || !*report.VirtioBalloon || report.KSMRunning == nil || !*report.KSMRunning || report.KSMPagesSharing == nil || *report.KSMPagesSharing != 512 {
+		t.Fatalf("unexpected memory report: %+v", report)
+	}
+	delete(fixture.files, "/sys/bus/virtio/drivers/virtio_balloon/virtio2")
+	fixture.files["/sys/kernel/mm/ksm/run"] = "0\n"
+	report = collectMemoryReport(fixture, "linux")
+	if report.VirtioBalloon == nil || *report.VirtioBalloon || report.KSMRunning == nil || *report.KSMRunning {
+		t.Fatalf("unexpected memory report without balloon: %+v", report)
+	}
+	delete(fixture.files, "/proc/modules")
+	delete(fixture.files, "/sys/kernel/mm/ksm/run")
+	if report := collectMemoryReport(fixture, "linux"); report.VirtioBalloon != nil || report.KSMRunning != nil {
+		t.Fatalf("missing inputs should leave the fields unset: %+v", report)
+	}
+}